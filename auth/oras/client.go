@@ -14,11 +14,13 @@ import (
 
 // ClientOptions type includes a Credential that stores the credentials
 // of the client. CredentialStore will be used if a Credential is not
-// provided. ClientOptions also includes a Debug flag.
+// provided. ClientOptions also includes a Debug flag and the Transport
+// sending the requests, http.DefaultTransport when it is nil.
 type ClientOptions struct {
 	Credential      auth.Credential
 	CredentialStore *Store
 	Debug           bool
+	Transport       http.RoundTripper
 }
 
 // NewClient generates a client based on the passed in options.
@@ -30,6 +32,9 @@ func NewClient(opts ClientOptions) remote.Client {
 	}
 	client.Header.Set("x-ms-correlation-request-id", uuid.New().String())
 	client.SetUserAgent("acr-cli/" + version.FullVersion())
+	if opts.Transport != nil {
+		client.Client = &http.Client{Transport: opts.Transport}
+	}
 	if opts.Debug {
 		client.Client.Transport = NewDebugTransport(client.Client.Transport)
 	}
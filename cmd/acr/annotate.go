@@ -7,6 +7,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 
 	"github.com/Azure/acr-cli/cmd/repository"
 	"github.com/Azure/acr-cli/internal/api"
@@ -39,7 +41,7 @@ acr annotate -r example --filter "hello-world:.*" --annotations "vnd.microsoft.a
 )
 
 var (
-	annotatedConcurrencyDescription = fmt.Sprintf("Number of concurrent annotate tasks. Range: [1 - %d]", maxPoolSize)
+	annotatedConcurrencyDescription = fmt.Sprintf("Number of concurrent annotate tasks. Range: [1 - %d], or %q to adapt the concurrency to the throttling of the registry", maxPoolSize, concurrencyAuto)
 )
 
 // annotateParameters defines the parameters that the annotate command uses (including the registry name, username, and password)
@@ -51,7 +53,7 @@ type annotateParameters struct {
 	annotations   []string
 	untagged      bool
 	dryRun        bool
-	concurrency   int
+	concurrency   string
 	includeLocked bool
 }
 
@@ -63,21 +65,22 @@ func newAnnotateCmd(rootParams *rootParameters) *cobra.Command {
 		Short:   "[Preview] Annotate images in a registry",
 		Long:    newAnnotateCmdLongMessage,
 		Example: annotateExampleMessage,
-		RunE: func(_ *cobra.Command, _ []string) error {
+		RunE: func(cmd *cobra.Command, _ []string) error {
 			// This context is used for all the http requests
-			ctx := context.Background()
+			ctx := cmd.Context()
 			registryName, err := annotateParams.GetRegistryName()
 			if err != nil {
 				return err
 			}
 			loginURL := api.LoginURL(registryName)
 			// An acrClient with authentication is generated, if the authentication cannot be resolved an error is returned.
-			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, annotateParams.username, annotateParams.password, annotateParams.configs)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, annotateParams.username, annotateParams.password, annotateParams.configs, annotateParams.transport)
 			if err != nil {
 				return err
 			}
+			acrClient.SetRetryPolicy(annotateParams.retryPolicy(false))
 
-			orasClient, err := api.GetORASClientWithAuth(annotateParams.username, annotateParams.password, annotateParams.configs)
+			orasClient, err := api.GetORASClientWithAuth(annotateParams.username, annotateParams.password, annotateParams.configs, annotateParams.transport)
 			if err != nil {
 				return err
 			}
@@ -97,16 +100,22 @@ func newAnnotateCmd(rootParams *rootParameters) *cobra.Command {
 			skippedTagsCount := 0
 			skippedManifestsCount := 0
 
-			poolSize := annotateParams.concurrency
-			if poolSize <= 0 {
-				poolSize = defaultPoolSize
-				fmt.Printf("Specified concurrency value invalid. Set to default value: %d \n", defaultPoolSize)
-			} else if poolSize > maxPoolSize {
-				poolSize = maxPoolSize
-				fmt.Printf("Specified concurrency value too large. Set to maximum value: %d \n", maxPoolSize)
+			poolSize, limiter, err := resolveConcurrency(annotateParams.concurrency)
+			if err != nil {
+				return err
+			}
+			opts := annotateOptions{
+				poolSize:      poolSize,
+				loginURL:      loginURL,
+				artifactType:  annotateParams.artifactType,
+				annotations:   annotateParams.annotations,
+				filterTimeout: annotateParams.filterTimeout,
+				dryRun:        annotateParams.dryRun,
+				includeLocked: annotateParams.includeLocked,
+				limiter:       limiter,
 			}
 			for repoName, tagRegex := range tagFilters {
-				singleAnnotatedTagsCount, singleSkippedTagsCount, err := annotateTags(ctx, acrClient, orasClient, poolSize, loginURL, repoName, annotateParams.artifactType, annotateParams.annotations, tagRegex, annotateParams.filterTimeout, annotateParams.dryRun, annotateParams.includeLocked)
+				singleAnnotatedTagsCount, singleSkippedTagsCount, err := annotateTags(ctx, acrClient, orasClient, repoName, tagRegex, opts)
 				if err != nil {
 					return fmt.Errorf("failed to annotate tags: %w", err)
 				}
@@ -114,7 +123,7 @@ func newAnnotateCmd(rootParams *rootParameters) *cobra.Command {
 				singleAnnotatedManifestsCount := 0
 				// If the untagged flag is set, then manifests with no tags are also annotated..
 				if annotateParams.untagged {
-					singleAnnotatedManifestsCount, err = annotateUntaggedManifests(ctx, acrClient, orasClient, poolSize, loginURL, repoName, annotateParams.artifactType, annotateParams.annotations, annotateParams.dryRun, annotateParams.includeLocked)
+					singleAnnotatedManifestsCount, err = annotateUntaggedManifests(ctx, acrClient, orasClient, repoName, opts)
 					if err != nil {
 						return fmt.Errorf("failed to annotate manifests: %w", err)
 					}
@@ -140,6 +149,7 @@ func newAnnotateCmd(rootParams *rootParameters) *cobra.Command {
 			if skippedManifestsCount > 0 {
 				fmt.Printf("%d manifests skipped as they are locked\n", skippedManifestsCount)
 			}
+			printEffectiveConcurrency(os.Stdout, limiter)
 			return nil
 		},
 	}
@@ -152,7 +162,7 @@ func newAnnotateCmd(rootParams *rootParameters) *cobra.Command {
 	cmd.Flags().BoolVar(&annotateParams.untagged, "untagged", false, "If the untagged flag is set, all the manifests that do not have any tags associated to them will also be annotated, except if they belong to a manifest list that contains at least one tag")
 	cmd.Flags().BoolVar(&annotateParams.dryRun, "dry-run", false, "If the dry-run flag is set, no manifest or tag will be annotated. The output would be the same as if they were annotated")
 	cmd.Flags().BoolVar(&annotateParams.includeLocked, "include-locked", false, "If the include-locked flag is set, locked manifests and tags (where writeEnabled is false) will be annotated")
-	cmd.Flags().IntVar(&annotateParams.concurrency, "concurrency", defaultPoolSize, annotatedConcurrencyDescription)
+	cmd.Flags().StringVar(&annotateParams.concurrency, "concurrency", strconv.Itoa(defaultPoolSize), annotatedConcurrencyDescription)
 	cmd.Flags().BoolP("help", "h", false, "Print usage")
 	_ = cmd.MarkFlagRequired("filter")
 	_ = cmd.MarkFlagRequired("artifact-type")
@@ -160,27 +170,33 @@ func newAnnotateCmd(rootParams *rootParameters) *cobra.Command {
 	return cmd
 }
 
+// annotateOptions holds the settings an annotation applies to every repository. The limiter can be nil.
+type annotateOptions struct {
+	poolSize      int
+	loginURL      string
+	artifactType  string
+	annotations   []string
+	filterTimeout int64
+	dryRun        bool
+	includeLocked bool
+	limiter       *worker.AdaptiveLimiter
+}
+
 // annotateTags annotates all tags that match the tagFilter string.
 func annotateTags(ctx context.Context,
 	acrClient api.AcrCLIClientInterface,
 	orasClient api.ORASClientInterface,
-	poolSize int,
-	loginURL string,
 	repoName string,
-	artifactType string,
-	annotations []string,
 	tagFilter string,
-	regexpMatchTimeoutSeconds int64,
-	dryRun bool,
-	includeLocked bool) (int, int, error) {
-
+	opts annotateOptions) (int, int, error) {
+	dryRun := opts.dryRun
 	if !dryRun {
 		fmt.Printf("\nAnnotating tags for repository: %s\n", repoName)
 	} else {
 		fmt.Printf("\nTags for this repository would be annotated: %s\n", repoName)
 	}
 
-	tagRegex, err := repository.BuildRegexFilter(tagFilter, regexpMatchTimeoutSeconds)
+	tagRegex, err := repository.BuildRegexFilter(tagFilter, opts.filterTimeout)
 	if err != nil {
 		return -1, 0, err
 	}
@@ -192,7 +208,7 @@ func annotateTags(ctx context.Context,
 	var annotator *worker.Annotator
 	if !dryRun {
 		// In order to only have a limited amount of http requests, an annotator is used that will start goroutines to annotate tags.
-		annotator, err = worker.NewAnnotator(poolSize, orasClient, loginURL, repoName, artifactType, annotations)
+		annotator, err = worker.NewAnnotator(opts.poolSize, orasClient, opts.loginURL, repoName, opts.artifactType, opts.annotations, opts.limiter)
 		if err != nil {
 			return -1, 0, err
 		}
@@ -200,7 +216,7 @@ func annotateTags(ctx context.Context,
 
 	for {
 		// GetTagsToAnnotate will return an empty lastTag when there are no more tags.
-		manifestsToAnnotate, newLastTag, skippedCount, err := getManifestsToAnnotate(ctx, acrClient, orasClient, loginURL, repoName, tagRegex, lastTag, artifactType, dryRun, includeLocked)
+		manifestsToAnnotate, newLastTag, skippedCount, err := getManifestsToAnnotate(ctx, acrClient, orasClient, opts.loginURL, repoName, tagRegex, lastTag, opts.artifactType, dryRun, opts.includeLocked)
 		if err != nil {
 			return -1, 0, err
 		}
@@ -294,10 +310,9 @@ func getManifestsToAnnotate(ctx context.Context,
 func annotateUntaggedManifests(ctx context.Context,
 	acrClient api.AcrCLIClientInterface,
 	orasClient api.ORASClientInterface,
-	poolSize int, loginURL string,
-	repoName string, artifactType string,
-	annotations []string,
-	dryRun bool, includeLocked bool) (int, error) {
+	repoName string,
+	opts annotateOptions) (int, error) {
+	dryRun, loginURL := opts.dryRun, opts.loginURL
 	if !dryRun {
 		fmt.Printf("Annotating manifests for repository: %s\n", repoName)
 	} else {
@@ -307,7 +322,7 @@ func annotateUntaggedManifests(ctx context.Context,
 	// Contrary to getTagsToAnnotate, getManifests gets all the manifests at once.
 	// This was done because if there is a manifest that has no tag but is referenced by a multiarch manifest that has tags then it
 	// should not be annotated.
-	manifestsToAnnotate, err := repository.GetUntaggedManifests(ctx, poolSize, acrClient, repoName, true, nil, dryRun, includeLocked, nil)
+	manifestsToAnnotate, err := repository.GetUntaggedManifests(ctx, opts.poolSize, acrClient, os.Stdout, repoName, true, nil, dryRun, opts.includeLocked, nil, nil, opts.limiter)
 	if err != nil {
 		return -1, err
 	}
@@ -316,7 +331,7 @@ func annotateUntaggedManifests(ctx context.Context,
 	annotatedManifestsCount := 0
 	if !dryRun {
 		// In order to only have a limited amount of http requests, an annotator is used that will start goroutines to annotate manifests.
-		annotator, err = worker.NewAnnotator(poolSize, orasClient, loginURL, repoName, artifactType, annotations)
+		annotator, err = worker.NewAnnotator(opts.poolSize, orasClient, loginURL, repoName, opts.artifactType, opts.annotations, opts.limiter)
 		if err != nil {
 			return -1, err
 		}
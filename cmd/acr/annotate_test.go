@@ -27,7 +27,7 @@ func TestAnnotateTags(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(EmptyListTagsResult, nil).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], testRegex, defaultRegexpMatchTimeoutSeconds, false, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, testRegex, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds})
 		assert.Equal(0, annotatedTags, "Number of annotated elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -40,7 +40,7 @@ func TestAnnotateTags(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResult, nil).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "^i.*", defaultRegexpMatchTimeoutSeconds, false, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "^i.*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds})
 		assert.Equal(0, annotatedTags, "Number of annotated elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -52,7 +52,7 @@ func TestAnnotateTags(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockOrasClient := &mocks.ORASClientInterface{}
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "[", defaultRegexpMatchTimeoutSeconds, false, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "[", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds})
 		assert.Equal(-1, annotatedTags, "Number of annotated elements should be -1")
 		assert.NotEqual(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -65,7 +65,7 @@ func TestAnnotateTags(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(nil, errors.New("error fetching tags")).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], testRegex, defaultRegexpMatchTimeoutSeconds, false, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, testRegex, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds})
 		assert.Equal(-1, annotatedTags, "Number of annotated elements should be -1")
 		assert.NotEqual(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -80,7 +80,7 @@ func TestAnnotateTags(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(WriteDisabledOneTagResult, nil).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], testRegex, defaultRegexpMatchTimeoutSeconds, false, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, testRegex, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds})
 		assert.Equal(0, annotatedTags, "Number of annotated elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -92,7 +92,7 @@ func TestAnnotateTags(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockOrasClient := &mocks.ORASClientInterface{}
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testBadAnnotations[:], testRegex, defaultRegexpMatchTimeoutSeconds, false, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, testRegex, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testBadAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds})
 		assert.Equal(-1, annotatedTags, "Number of annotated elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -110,7 +110,7 @@ func TestAnnotateTags(t *testing.T) {
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResult, nil).Once()
 		mockOrasClient.On("DiscoverLifecycleAnnotation", mock.Anything, ref, testArtifactType).Return(false, nil).Once()
 		mockOrasClient.On("Annotate", mock.Anything, digestRef, testArtifactType, annotationMap).Return(nil).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "^la.*", defaultRegexpMatchTimeoutSeconds, false, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "^la.*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds})
 		assert.Equal(1, annotatedTags, "Number of annotated elements should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -146,7 +146,7 @@ func TestAnnotateTags(t *testing.T) {
 		digestRef = fmt.Sprintf("%s/%s@%s", testLoginURL, testRepo, digest)
 		mockOrasClient.On("Annotate", mock.Anything, digestRef, testArtifactType, annotationMap).Return(nil).Once()
 
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], testRegex, defaultRegexpMatchTimeoutSeconds, false, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, testRegex, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds})
 		assert.Equal(5, annotatedTags, "Number of annotated elements should be 5")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -163,7 +163,7 @@ func TestAnnotateTags(t *testing.T) {
 		mockOrasClient.On("DiscoverLifecycleAnnotation", mock.Anything, ref, testArtifactType).Return(false, nil).Once()
 		digestRef := fmt.Sprintf("%s/%s@%s", testLoginURL, testRepo, digest)
 		mockOrasClient.On("Annotate", mock.Anything, digestRef, testArtifactType, annotationMap).Return(nil).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], ".*-?local[.].+", defaultRegexpMatchTimeoutSeconds, false, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, ".*-?local[.].+", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds})
 		assert.Equal(1, annotatedTags, "Number of annotated elements should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -196,7 +196,7 @@ func TestAnnotateTags(t *testing.T) {
 		digestRef = fmt.Sprintf("%s/%s@%s", testLoginURL, testRepo, digest)
 		mockOrasClient.On("Annotate", mock.Anything, digestRef, testArtifactType, annotationMap).Return(nil).Once()
 
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "^v.*", defaultRegexpMatchTimeoutSeconds, false, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "^v.*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds})
 		assert.Equal(4, annotatedTags, "Number of annotated elements should be 4")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -210,7 +210,7 @@ func TestAnnotateTags(t *testing.T) {
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResultWithNext, nil).Once()
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "latest").Return(FourTagsResult, nil).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "^i.*", defaultRegexpMatchTimeoutSeconds, false, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "^i.*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds})
 		assert.Equal(0, annotatedTags, "Number of annotated elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -279,7 +279,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(notFoundManifestResponse, errors.New("testRepo not found")).Once()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.Equal(0, annotatedManifests, "Number of annotated elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -292,7 +292,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(nil, errors.New("unauthorized")).Once()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.Equal(-1, annotatedManifests, "Number of annotated elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -306,7 +306,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:2830cc0fcddc1bc2bd4aeab0ed5ee7087dab29a49e65151c77553e46a7ed5283").Return(EmptyListManifestsResult, nil).Once()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.Equal(0, annotatedManifests, "Number of annotated elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -320,7 +320,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:2830cc0fcddc1bc2bd4aeab0ed5ee7087dab29a49e65151c77553e46a7ed5283").Return(nil, errors.New("error getting manifests")).Once()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.Equal(-1, annotatedManifests, "Number of annotated elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -337,7 +337,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockClient.On("GetManifest", mock.Anything, testRepo, "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(nil, errors.New("error getting manifest")).Once()
 		// Despite the failure, the GetAcrManifests method may be called again before the failure happens
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(nil, nil).Maybe()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.Equal(-1, annotatedManifests, "Number of annotated elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -353,7 +353,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockClient.On("GetManifest", mock.Anything, testRepo, "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(nil, errors.New("error getting manifest")).Once()
 		// Despite the failure, the GetAcrManifests method may be called again before the failure happens
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(nil, nil).Maybe()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.Equal(-1, annotatedManifests, "Number of annotated elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -367,7 +367,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:2830cc0fcddc1bc2bd4aeab0ed5ee7087dab29a49e65151c77553e46a7ed5283").Return(EmptyListManifestsResult, nil).Once()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testBadAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testBadAnnotations[:]})
 		assert.Equal(-1, annotatedManifests, "Number of annotated elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -388,7 +388,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockOrasClient.On("Annotate", mock.Anything, ref, testArtifactType, annotationMap).Return(nil).Once()
 		ref = fmt.Sprintf("%s/%s@sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696", testLoginURL, testRepo)
 		mockOrasClient.On("Annotate", mock.Anything, ref, testArtifactType, annotationMap).Return(nil).Once()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.Equal(2, annotatedManifests, "Number of annotated elements should be 2")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -407,7 +407,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockOrasClient.On("Annotate", mock.Anything, ref, testArtifactType, annotationMap).Return(nil).Maybe() // Depending on scheduling, this may not be invoked
 		ref = fmt.Sprintf("%s/%s@sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696", testLoginURL, testRepo)
 		mockOrasClient.On("Annotate", mock.Anything, ref, testArtifactType, annotationMap).Return(errors.New("manifest not found")).Once()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.True(annotatedManifests == 1 || annotatedManifests == 0, "Number of annotated elements should be 1 or 0")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -426,7 +426,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockOrasClient.On("Annotate", mock.Anything, ref, testArtifactType, annotationMap).Return(errors.New("error annotating manifest")).Once()
 		ref = fmt.Sprintf("%s/%s@sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696", testLoginURL, testRepo)
 		mockOrasClient.On("Annotate", mock.Anything, ref, testArtifactType, annotationMap).Return(nil).Maybe()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.True(annotatedManifests == 1 || annotatedManifests == 0, "Number of annotated elements should be 1 or 0")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -446,7 +446,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockOrasClient.On("Annotate", mock.Anything, ref, testArtifactType, annotationMap).Return(nil).Maybe()
 		ref = fmt.Sprintf("%s/%s@sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696", testLoginURL, testRepo)
 		mockOrasClient.On("Annotate", mock.Anything, ref, testArtifactType, annotationMap).Return(errors.New("error annotating manifest")).Once()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.True(annotatedManifests == 1 || annotatedManifests == 0, "Number of annotated elements should be 1 or 0, this is affected by the concurrent nature of the code")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -466,7 +466,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(EmptyListManifestsResult, nil).Once()
 		ref := fmt.Sprintf("%s/%s@sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696", testLoginURL, testRepo)
 		mockOrasClient.On("Annotate", mock.Anything, ref, testArtifactType, annotationMap).Return(nil).Once()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.Equal(1, annotatedManifests, "Number of annotated elements should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -481,7 +481,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(deleteDisabledOneManifestResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.Equal(0, annotatedManifests, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -496,7 +496,7 @@ func TestAnnotateManifests(t *testing.T) {
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(writeDisabledOneManifestResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, false)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:]})
 		assert.Equal(0, annotatedManifests, "Number of annotated elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -603,7 +603,7 @@ func TestIncludeLockedFlagAnnotate(t *testing.T) {
 
 		mockOrasClient.On("Annotate", mock.Anything, fmt.Sprintf("%s/%s@%s", testLoginURL, testRepo, digest), testArtifactType, annotationMap).Return(nil).Once()
 
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], false, true)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], includeLocked: true})
 		assert.Equal(1, annotatedManifests, "Should annotate locked manifest when include-locked is true")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -632,7 +632,7 @@ func TestIncludeLockedFlagAnnotate(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(lockedManifest, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
 
-		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], true, true)
+		annotatedManifests, err := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], dryRun: true, includeLocked: true})
 		assert.Equal(1, annotatedManifests, "Should count locked manifest in dry run when include-locked is true")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -652,8 +652,8 @@ func TestDryRunAnnotate(t *testing.T) {
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(notFoundManifestResponse, errors.New("testRepo not found")).Once()
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(notFoundTagResponse, errors.New("testRepo not found")).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "[\\s\\S]*", defaultRegexpMatchTimeoutSeconds, true, false)
-		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], true, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "[\\s\\S]*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds, dryRun: true})
+		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], dryRun: true})
 		assert.Equal(0, annotatedTags, "Number of annotated elements should be 0")
 		assert.Equal(0, annotatedManifests, "Number of annotated elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
@@ -666,7 +666,7 @@ func TestDryRunAnnotate(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockOrasClient := &mocks.ORASClientInterface{}
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "[", defaultRegexpMatchTimeoutSeconds, true, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "[", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds, dryRun: true})
 		assert.Equal(-1, annotatedTags, "Number of annotated elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -686,7 +686,7 @@ func TestDryRunAnnotate(t *testing.T) {
 		mockOrasClient.On("DiscoverLifecycleAnnotation", mock.Anything, ref, testArtifactType).Return(false, nil).Once()
 		ref = fmt.Sprintf("%s/%s:%s", testLoginURL, testRepo, tagName4)
 		mockOrasClient.On("DiscoverLifecycleAnnotation", mock.Anything, ref, testArtifactType).Return(false, nil).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "[\\s\\S]*", defaultRegexpMatchTimeoutSeconds, true, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "[\\s\\S]*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds, dryRun: true})
 		assert.Equal(4, annotatedTags, "Number of annotated elements should be 4")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -698,7 +698,7 @@ func TestDryRunAnnotate(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(nil, errors.New("error fetching tags")).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "[\\s\\S]*", defaultRegexpMatchTimeoutSeconds, true, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "[\\s\\S]*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds, dryRun: true})
 		assert.Equal(-1, annotatedTags, "Number of annotated elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -710,7 +710,7 @@ func TestDryRunAnnotate(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(nil, errors.New("error fetching tags")).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "[\\s\\S]*", defaultRegexpMatchTimeoutSeconds, true, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "[\\s\\S]*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds, dryRun: true})
 		assert.Equal(-1, annotatedTags, "Number of annotated elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -722,8 +722,8 @@ func TestDryRunAnnotate(t *testing.T) {
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(EmptyListTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(nil, errors.New("testRepo not found")).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "[\\s\\S]*", defaultRegexpMatchTimeoutSeconds, true, false)
-		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], true, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "[\\s\\S]*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds, dryRun: true})
+		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], dryRun: true})
 		assert.Equal(0, annotatedTags, "Number of annotated elements should be 0")
 		assert.Equal(-1, annotatedManifests, "Number of annotated elements should be -1")
 		assert.Equal(nil, err, "Error should be nil")
@@ -738,8 +738,8 @@ func TestDryRunAnnotate(t *testing.T) {
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(EmptyListTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(nil, errors.New("error fetching tags")).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "[\\s\\S]*", defaultRegexpMatchTimeoutSeconds, true, false)
-		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], true, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "[\\s\\S]*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds, dryRun: true})
+		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], dryRun: true})
 		assert.Equal(0, annotatedTags, "Number of annotated elements should be 0")
 		assert.Equal(-1, annotatedManifests, "Number of annotated elements should be -1")
 		assert.Equal(nil, err, "Error should be nil")
@@ -756,8 +756,8 @@ func TestDryRunAnnotate(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(singleMultiArchManifestV2WithTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", multiArchDigest).Return(EmptyListManifestsResult, nil).Maybe() // This is to ensure that the GetAcrManifests method may be called again before the failure happens
 		mockClient.On("GetManifest", mock.Anything, testRepo, "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(nil, errors.New("error getting manifest")).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "^lat.*", defaultRegexpMatchTimeoutSeconds, true, false)
-		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], true, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "^lat.*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds, dryRun: true})
+		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], dryRun: true})
 		assert.Equal(0, annotatedTags, "Number of annotated elements should be 0")
 		assert.Equal(-1, annotatedManifests, "Number of annotated elements should be -1")
 		assert.Equal(nil, err, "Error should be nil")
@@ -774,8 +774,8 @@ func TestDryRunAnnotate(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(singleMultiArchManifestV2WithTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", multiArchDigest).Return(nil, nil).Maybe() // This is to ensure that the GetAcrManifests method may be called again before the failure happens
 		mockClient.On("GetManifest", mock.Anything, testRepo, "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return([]byte("invalid json"), nil).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "^lat.*", defaultRegexpMatchTimeoutSeconds, true, false)
-		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], true, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "^lat.*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds, dryRun: true})
+		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], dryRun: true})
 		assert.Equal(0, annotatedTags, "Number of annotated elements should be 0")
 		assert.Equal(-1, annotatedManifests, "Number of annotated elements should be -1")
 		assert.Equal(nil, err, "Error should be nil")
@@ -793,8 +793,8 @@ func TestDryRunAnnotate(t *testing.T) {
 		mockClient.On("GetManifest", mock.Anything, testRepo, "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(multiArchManifestV2Bytes, nil).Maybe() // This may not be invoked if the
 		// GetAcrManifests call fails first.
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(nil, errors.New("error fetching manifests")).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "^lat.*", defaultRegexpMatchTimeoutSeconds, true, false)
-		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], true, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "^lat.*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds, dryRun: true})
+		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], dryRun: true})
 		assert.Equal(0, annotatedTags, "Number of annotated tags should be 0")
 		assert.Equal(-1, annotatedManifests, "Number of annotated manifests should be -1")
 		assert.Equal(nil, err, "Error should be nil")
@@ -813,8 +813,8 @@ func TestDryRunAnnotate(t *testing.T) {
 		mockClient.On("GetManifest", mock.Anything, testRepo, "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(multiArchManifestV2Bytes, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(doubleManifestV2WithoutTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(EmptyListManifestsResult, nil).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "^lat.*", defaultRegexpMatchTimeoutSeconds, true, false)
-		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], true, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "^lat.*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds, dryRun: true})
+		annotatedManifests, errManifests := annotateUntaggedManifests(testCtx, mockClient, mockOrasClient, testRepo, annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], dryRun: true})
 		assert.Equal(0, annotatedTags, "Number of annotated elements should be 0")
 		assert.Equal(1, annotatedManifests, "Number of annotated elements should be 1")
 		assert.Equal(nil, err, "Error should be nil")
@@ -829,7 +829,7 @@ func TestDryRunAnnotate(t *testing.T) {
 		mockOrasClient := &mocks.ORASClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResultWithNext, nil).Once()
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "latest").Return(FourTagsResult, nil).Once()
-		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, defaultPoolSize, testLoginURL, testRepo, testArtifactType, testAnnotations[:], "^i.*", defaultRegexpMatchTimeoutSeconds, true, false)
+		annotatedTags, _, err := annotateTags(testCtx, mockClient, mockOrasClient, testRepo, "^i.*", annotateOptions{poolSize: defaultPoolSize, loginURL: testLoginURL, artifactType: testArtifactType, annotations: testAnnotations[:], filterTimeout: defaultRegexpMatchTimeoutSeconds, dryRun: true})
 		assert.Equal(0, annotatedTags, "Number of annotated elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -0,0 +1,122 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Azure/acr-cli/internal/api"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newCopyCmdLongMessage = `acr copy: copy an image or artifact, with the manifests and blobs it references, to another repository or registry. The source and destination references are either fully qualified, such as example.azurecr.io/hello-world:v1, or a repository of the registry given by --registry, such as hello-world:v1`
+)
+
+// copyParameters defines the parameters of the copy command.
+type copyParameters struct {
+	*rootParameters
+	recursive   bool
+	concurrency int
+}
+
+// newCopyCmd defines the copy command.
+func newCopyCmd(rootParams *rootParameters) *cobra.Command {
+	copyParams := copyParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:   "copy <source> <destination>",
+		Short: "Copy an image between repositories and registries",
+		Long:  newCopyCmdLongMessage,
+		Example: `  - Promote the v1 image of the dev/app repository to the prod/app repository of the same registry, the layers are mounted instead of copied
+	acr copy -r example dev/app:v1 prod/app:v1
+
+  - Copy the v1 image and its signatures and SBOMs to another registry, keeping its tag
+	acr copy example.azurecr.io/app:v1 other.azurecr.io/app --recursive`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if copyParams.concurrency < 1 || copyParams.concurrency > maxPoolSize {
+				return fmt.Errorf("concurrency should be between 1 and %d", maxPoolSize)
+			}
+			src, err := qualifyReference(args[0], copyParams.rootParameters)
+			if err != nil {
+				return err
+			}
+			dst, err := qualifyReference(args[1], copyParams.rootParameters)
+			if err != nil {
+				return err
+			}
+			// The credentials of the flags are used for both registries, otherwise the credentials of each registry come
+			// from the docker config files.
+			orasClient, err := api.GetORASClientWithAuth(copyParams.username, copyParams.password, copyParams.configs, copyParams.transport)
+			if err != nil {
+				return err
+			}
+			return copyImage(cmd.Context(), orasClient, src, dst, copyParams.recursive, copyParams.concurrency)
+		},
+	}
+	cmd.Flags().BoolVar(&copyParams.recursive, "recursive", false, "Also copy the referrers of the image, such as its signatures and SBOMs, and their own referrers")
+	cmd.Flags().IntVar(&copyParams.concurrency, "concurrency", defaultPoolSize, fmt.Sprintf("Number of manifests and blobs copied at once. Range: [1 - %d]", maxPoolSize))
+	return cmd
+}
+
+// copyImage copies the image at src to dst, printing every manifest and blob copied and a summary.
+func copyImage(ctx context.Context, orasClient *api.ORASClient, src string, dst string, recursive bool, concurrency int) error {
+	progress := &copyProgress{}
+	fmt.Printf("Copying %s to %s\n", src, dst)
+	root, err := orasClient.Copy(ctx, src, dst, api.CopyOptions{Recursive: recursive, Concurrency: concurrency, Progress: progress.report})
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dst, err)
+	}
+	fmt.Printf("Copied %s to %s, digest: %s\n", src, dst, root.Digest)
+	progress.Print()
+	return nil
+}
+
+// copyProgress prints the manifests and blobs as they are copied and counts them. It is safe for concurrent use.
+type copyProgress struct {
+	mu          sync.Mutex
+	counts      map[api.CopyStatus]int
+	copiedBytes int64
+}
+
+// report prints and counts a manifest or blob, it is the progress function of the copy options.
+func (p *copyProgress) report(status api.CopyStatus, desc ocispec.Descriptor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.counts == nil {
+		p.counts = make(map[api.CopyStatus]int)
+	}
+	p.counts[status]++
+	if status == api.CopyStatusCopied {
+		p.copiedBytes += desc.Size
+	}
+	fmt.Printf("%-7s %s %s (%s)\n", status, desc.Digest, desc.MediaType, formatSize(desc.Size))
+}
+
+// Print prints the number of manifests and blobs copied, mounted and already in the destination.
+func (p *copyProgress) Print() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Printf("\nNumber of copied manifests and blobs: %d (%s)\n", p.counts[api.CopyStatusCopied], formatSize(p.copiedBytes))
+	fmt.Printf("Number of mounted blobs: %d\n", p.counts[api.CopyStatusMounted])
+	fmt.Printf("Number of manifests and blobs already in the destination: %d\n", p.counts[api.CopyStatusExists])
+}
+
+// qualifyReference returns the reference prefixed with the login server of the registry given by --registry, unless
+// it already starts with a registry. As with docker, the first component of the reference is a registry when it
+// holds a dot or a port, or is localhost.
+func qualifyReference(reference string, rootParams *rootParameters) (string, error) {
+	if first, _, found := strings.Cut(reference, "/"); found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return reference, nil
+	}
+	registryName, err := rootParams.GetRegistryName()
+	if err != nil {
+		return "", fmt.Errorf("%s is not a fully qualified reference: %w", reference, err)
+	}
+	return api.LoginURL(registryName) + "/" + reference, nil
+}
@@ -0,0 +1,99 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCopyCmd(t *testing.T) {
+	cmd := newCopyCmd(&rootParameters{})
+	assert.Equal(t, "copy <source> <destination>", cmd.Use)
+	assert.Equal(t, newCopyCmdLongMessage, cmd.Long)
+}
+
+func TestQualifyReference(t *testing.T) {
+	rootParams := &rootParameters{registryName: "example"}
+	for reference, expected := range map[string]string{
+		"hello-world:v1":                    "example.azurecr.io/hello-world:v1",
+		"dev/app:v1":                        "example.azurecr.io/dev/app:v1",
+		"other.azurecr.io/app:v1":           "other.azurecr.io/app:v1",
+		"localhost/app@sha256:abc":          "localhost/app@sha256:abc",
+		"127.0.0.1:5000/team/app:latest":    "127.0.0.1:5000/team/app:latest",
+		"registry.example.com:443/app:v1.0": "registry.example.com:443/app:v1.0",
+	} {
+		qualified, err := qualifyReference(reference, rootParams)
+		assert.NoError(t, err, reference)
+		assert.Equal(t, expected, qualified, reference)
+	}
+	// t.Setenv restores the variable once the test ends.
+	t.Setenv("ACR_DEFAULT_REGISTRY", "")
+	require.NoError(t, os.Unsetenv("ACR_DEFAULT_REGISTRY"))
+	_, err := qualifyReference("hello-world:v1", &rootParameters{})
+	assert.Error(t, err)
+}
+
+func TestCopyEndToEnd(t *testing.T) {
+	credentials := []string{"--username", fakeregistry.Username, "--password", fakeregistry.Password}
+
+	t.Run("Promote", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		image := registry.PushImage("dev/app", "app", "v1")
+		err := runCommand(registry, append([]string{"copy", "dev/app:v1", "prod/app:v1"}, credentials...)...)
+		require.NoError(t, err)
+		assert.Equal(t, []string{image}, registry.Manifests("prod/app"))
+		assert.Equal(t, []string{"v1"}, registry.Tags("prod/app"))
+		// The config and the layer are mounted from dev/app, they are never read.
+		for _, request := range registry.Requests() {
+			assert.False(t, strings.HasPrefix(request, "GET /v2/dev/app/blobs/"), request)
+		}
+
+		// Copying again only tags the manifest already in the destination.
+		err = runCommand(registry, append([]string{"copy", "dev/app:v1", "prod/app:stable"}, credentials...)...)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"v1", "stable"}, registry.Tags("prod/app"))
+	})
+
+	t.Run("Index", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		amd64 := registry.PushImage("app", "amd64")
+		arm64 := registry.PushImage("app", "arm64")
+		index := registry.PushIndex("app", []string{amd64, arm64}, "v1")
+		// Without a tag the destination gets the tag of the source.
+		err := runCommand(registry, append([]string{"copy", "app:v1", registry.LoginURL() + "/mirror/app"}, credentials...)...)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{index, amd64, arm64}, registry.Manifests("mirror/app"))
+		assert.Equal(t, []string{"v1"}, registry.Tags("mirror/app"))
+	})
+
+	t.Run("Recursive", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		image := registry.PushImage("app", "app", "v1")
+		signature := registry.PushReferrer("app", image, "application/vnd.cncf.notary.signature", nil)
+		err := runCommand(registry, append([]string{"copy", "app@" + image, "first/app"}, credentials...)...)
+		require.NoError(t, err)
+		assert.Equal(t, []string{image}, registry.Manifests("first/app"))
+		assert.Empty(t, registry.Tags("first/app"))
+
+		err = runCommand(registry, append([]string{"copy", "app:v1", "second/app:v1", "--recursive"}, credentials...)...)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{image, signature}, registry.Manifests("second/app"))
+	})
+
+	t.Run("InvalidArguments", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		err := runCommand(registry, append([]string{"copy", "app:v1", "other/app:v1", "--concurrency", "0"}, credentials...)...)
+		assert.EqualError(t, err, "concurrency should be between 1 and 32")
+		err = runCommand(registry, append([]string{"copy", "app", "other/app:v1"}, credentials...)...)
+		assert.ErrorContains(t, err, "has neither a tag nor a digest")
+		err = runCommand(registry, append([]string{"copy", "missing:v1", "other/app:v1"}, credentials...)...)
+		assert.ErrorContains(t, err, "failed to copy")
+	})
+}
@@ -74,18 +74,19 @@ func newPatchFilterCmd(csscParams *csscParameters) *cobra.Command {
 		Use:   "patch",
 		Short: "[Preview] Run cssc patch operations for a registry",
 		Long:  newPatchCmdLongMessage,
-		RunE: func(_ *cobra.Command, _ []string) error {
-			ctx := context.Background()
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
 			registryName, err := csscParams.GetRegistryName()
 			if err != nil {
 				return err
 			}
 			loginURL := api.LoginURL(registryName)
 			resolveRegistryCredentials(csscParams, loginURL)
-			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, csscParams.username, csscParams.password, csscParams.configs)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, csscParams.username, csscParams.password, csscParams.configs, csscParams.transport)
 			if err != nil {
 				return err
 			}
+			acrClient.SetRetryPolicy(csscParams.retryPolicy(false))
 
 			filter := cssc.Filter{}
 			if csscParams.filterPolicy != "" && csscParams.filterfilePath != "" {
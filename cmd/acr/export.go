@@ -0,0 +1,196 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Azure/acr-cli/cmd/repository"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/spf13/cobra"
+	"oras.land/oras-go/v2/content/oci"
+)
+
+const (
+	newExportCmdLongMessage = `acr export: export the tags matching the filters, with their manifests, blobs and referrers, to an OCI image layout directory or tarball that acr import restores. In the layout every tag is named <repository>:<tag>`
+	layoutTarExtension      = ".tar"
+)
+
+// exportParameters defines the parameters of the export command.
+type exportParameters struct {
+	*rootParameters
+	filters       []string
+	filterTimeout int64
+	repoPageSize  int32
+	to            string
+	concurrency   int
+}
+
+// newExportCmd defines the export command.
+func newExportCmd(rootParams *rootParameters) *cobra.Command {
+	exportParams := exportParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export tags to an OCI image layout",
+		Long:  newExportCmdLongMessage,
+		Example: `  - Export the tags of the hello-world repository starting with v1 to the layout directory
+	acr export -r example --filter "hello-world:^v1.*" --to ./layout
+
+  - Export every tag of the repositories under team/ to a tarball
+	acr export -r example --filter "team/.*:.*" --to ./team.tar`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if exportParams.concurrency < 1 || exportParams.concurrency > maxPoolSize {
+				return fmt.Errorf("concurrency should be between 1 and %d", maxPoolSize)
+			}
+			registryName, err := exportParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			ctx := cmd.Context()
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, exportParams.username, exportParams.password, exportParams.configs, exportParams.transport)
+			if err != nil {
+				return err
+			}
+			acrClient.SetRetryPolicy(exportParams.retryPolicy(false))
+			orasClient, err := api.GetORASClientWithAuth(exportParams.username, exportParams.password, exportParams.configs, exportParams.transport)
+			if err != nil {
+				return err
+			}
+			tagFilters, err := repository.CollectTagFilters(ctx, exportParams.filters, acrClient.AutorestClient, exportParams.filterTimeout, exportParams.repoPageSize)
+			if err != nil {
+				return err
+			}
+
+			// A tarball is written once the layout is complete in a temporary directory.
+			layoutDir := exportParams.to
+			isTar := strings.HasSuffix(exportParams.to, layoutTarExtension)
+			if isTar {
+				if layoutDir, err = os.MkdirTemp("", "acr-export-"); err != nil {
+					return err
+				}
+				defer os.RemoveAll(layoutDir)
+			}
+			store, err := oci.NewWithContext(ctx, layoutDir)
+			if err != nil {
+				return err
+			}
+			progress := &copyProgress{}
+			exportedCount, err := exportTags(ctx, acrClient, orasClient, loginURL, tagFilters, exportParams.filterTimeout, store, exportParams.concurrency, progress)
+			if err != nil {
+				return err
+			}
+			if isTar {
+				if err := writeLayoutTar(layoutDir, exportParams.to); err != nil {
+					return err
+				}
+			}
+			progress.Print()
+			fmt.Printf("Number of exported tags: %d\n", exportedCount)
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVarP(&exportParams.filters, "filter", "f", nil, "Specify the repository and a regular expression filter for the tag name, the tags matching the filter are exported. Note: If backtracking is used in the regexp it's possible for the expression to run into an infinite loop. The default timeout is set to 1 minute for evaluation of any filter expression. Use the '--filter-timeout-seconds' option to set a different value.")
+	cmd.Flags().Int64Var(&exportParams.filterTimeout, "filter-timeout-seconds", defaultRegexpMatchTimeoutSeconds, "This limits the evaluation of the regex filter, and will return a timeout error if this duration is exceeded during a single evaluation. If written incorrectly a regexp filter with backtracking can result in an infinite loop.")
+	cmd.Flags().Int32Var(&exportParams.repoPageSize, "repository-page-size", defaultRepoPageSize, repoPageSizeDescription)
+	cmd.Flags().StringVar(&exportParams.to, "to", "", fmt.Sprintf("The OCI image layout directory the tags are added to, or the tarball written when it ends with %s", layoutTarExtension))
+	cmd.Flags().IntVar(&exportParams.concurrency, "concurrency", defaultPoolSize, fmt.Sprintf("Number of manifests and blobs copied at once. Range: [1 - %d]", maxPoolSize))
+	_ = cmd.MarkFlagRequired("filter")
+	_ = cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+// exportTags copies the tags matching the filters of every repository, with their referrers, to the store where they
+// are named <repository>:<tag>. It returns the number of exported tags.
+func exportTags(ctx context.Context, acrClient api.AcrCLIClientInterface, orasClient *api.ORASClient, loginURL string, tagFilters map[string]string, filterTimeout int64, store *oci.Store, concurrency int, progress *copyProgress) (int, error) {
+	repoNames := make([]string, 0, len(tagFilters))
+	for repoName := range tagFilters {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	exportedCount := 0
+	for _, repoName := range repoNames {
+		if acrClient.IsAbac() {
+			if err := acrClient.RefreshTokenForAbac(ctx, []string{repoName}); err != nil {
+				return exportedCount, fmt.Errorf("failed to refresh ABAC token for repository %s: %w", repoName, err)
+			}
+		}
+		filter, err := repository.BuildRegexFilter(tagFilters[repoName], filterTimeout)
+		if err != nil {
+			return exportedCount, err
+		}
+		tagList, err := listTags(ctx, acrClient, repoName, "", filter)
+		if err != nil {
+			return exportedCount, err
+		}
+		for _, t := range tagList {
+			reference := fmt.Sprintf("%s/%s:%s", loginURL, repoName, *t.Name)
+			root, err := orasClient.Export(ctx, reference, store, repoName+":"+*t.Name, api.CopyOptions{Recursive: true, Concurrency: concurrency, Progress: progress.report})
+			if err != nil {
+				return exportedCount, fmt.Errorf("failed to export %s: %w", reference, err)
+			}
+			fmt.Printf("Exported %s, digest: %s\n", reference, root.Digest)
+			exportedCount++
+		}
+	}
+	return exportedCount, nil
+}
+
+// writeLayoutTar writes the files of the layout directory to the tarball at path.
+func writeLayoutTar(layoutDir string, path string) (err error) {
+	file, err := os.Create(path) // #nosec G304 -- path is the user-provided tarball path, this is expected
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	tarWriter := tar.NewWriter(file)
+	err = filepath.WalkDir(layoutDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || filePath == layoutDir {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(layoutDir, filePath)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		content, err := os.Open(filePath) // #nosec G304 -- the file is in the layout written by the export
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+		_, err = io.Copy(tarWriter, content)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tarWriter.Close()
+}
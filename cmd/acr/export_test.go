@@ -0,0 +1,71 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewExportCmd(t *testing.T) {
+	cmd := newExportCmd(&rootParameters{})
+	assert.Equal(t, "export", cmd.Use)
+	assert.Equal(t, newExportCmdLongMessage, cmd.Long)
+}
+
+func TestExportImportEndToEnd(t *testing.T) {
+	credentials := []string{"--username", fakeregistry.Username, "--password", fakeregistry.Password}
+	for _, to := range []string{"layout", "layout.tar"} {
+		t.Run(to, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), to)
+			source := fakeregistry.New(t)
+			v1 := source.PushImage("team/app", "v1", "v1")
+			signature := source.PushReferrer("team/app", v1, "application/vnd.cncf.notary.signature", map[string]string{"org.example.signed-by": "release"})
+			amd64 := source.PushImage("team/app", "amd64")
+			index := source.PushIndex("team/app", []string{amd64}, "v2")
+			source.PushImage("team/app", "dev", "dev")
+			other := source.PushImage("other", "latest", "latest")
+			manifests := map[string][]byte{}
+			for _, digest := range []string{v1, signature, amd64, index} {
+				manifests[digest], _ = source.Manifest("team/app", digest)
+			}
+
+			err := runCommand(source, append([]string{"export", "--filter", "team/app:^v.*", "--filter", "other:.*", "--to", path}, credentials...)...)
+			require.NoError(t, err)
+			if to == "layout" {
+				content, err := os.ReadFile(filepath.Join(path, ocispec.ImageIndexFile))
+				require.NoError(t, err)
+				var layoutIndex ocispec.Index
+				require.NoError(t, json.Unmarshal(content, &layoutIndex))
+				var names []string
+				for _, desc := range layoutIndex.Manifests {
+					if name := desc.Annotations[ocispec.AnnotationRefName]; name != "" {
+						names = append(names, name)
+					}
+				}
+				assert.ElementsMatch(t, []string{"team/app:v1", "team/app:v2", "other:latest"}, names)
+			}
+
+			// The layout is imported to another registry, the referrers and their annotations are kept.
+			target := fakeregistry.New(t)
+			err = runCommand(target, append([]string{"import", "--from", path}, credentials...)...)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"v1", "v2"}, target.Tags("team/app"))
+			assert.ElementsMatch(t, []string{v1, signature, amd64, index}, target.Manifests("team/app"))
+			for digest, content := range manifests {
+				imported, ok := target.Manifest("team/app", digest)
+				assert.True(t, ok, digest)
+				assert.Equal(t, content, imported, digest)
+			}
+			assert.Equal(t, []string{other}, target.Manifests("other"))
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/spf13/cobra"
+	"oras.land/oras-go/v2/content/oci"
+)
+
+const (
+	newImportCmdLongMessage = `acr import: import the tags of an OCI image layout directory or tarball written by acr export, with their manifests, blobs and referrers, to the registry. Every tag of the layout, named <repository>:<tag>, is pushed to the same repository and tag`
+)
+
+// importParameters defines the parameters of the import command.
+type importParameters struct {
+	*rootParameters
+	from        string
+	concurrency int
+}
+
+// newImportCmd defines the import command.
+func newImportCmd(rootParams *rootParameters) *cobra.Command {
+	importParams := importParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import tags from an OCI image layout",
+		Long:  newImportCmdLongMessage,
+		Example: `  - Import the tags of the layout directory to the example registry
+	acr import -r example --from ./layout
+
+  - Import the tags of a tarball written by acr export
+	acr import -r example --from ./team.tar`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if importParams.concurrency < 1 || importParams.concurrency > maxPoolSize {
+				return fmt.Errorf("concurrency should be between 1 and %d", maxPoolSize)
+			}
+			registryName, err := importParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			ctx := cmd.Context()
+			store, err := openLayout(ctx, importParams.from)
+			if err != nil {
+				return err
+			}
+			orasClient, err := api.GetORASClientWithAuth(importParams.username, importParams.password, importParams.configs, importParams.transport)
+			if err != nil {
+				return err
+			}
+			progress := &copyProgress{}
+			importedCount, err := importTags(ctx, orasClient, loginURL, store, importParams.concurrency, progress)
+			if err != nil {
+				return err
+			}
+			progress.Print()
+			fmt.Printf("Number of imported tags: %d\n", importedCount)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&importParams.from, "from", "", "The OCI image layout directory or tarball to import")
+	cmd.Flags().IntVar(&importParams.concurrency, "concurrency", defaultPoolSize, fmt.Sprintf("Number of manifests and blobs copied at once. Range: [1 - %d]", maxPoolSize))
+	_ = cmd.MarkFlagRequired("from")
+	return cmd
+}
+
+// openLayout opens the OCI image layout directory or tarball at path.
+func openLayout(ctx context.Context, path string) (*oci.ReadOnlyStore, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return oci.NewFromFS(ctx, os.DirFS(path))
+	}
+	return oci.NewFromTar(ctx, path)
+}
+
+// importTags copies every tag of the store, with its referrers, to the repository and tag it is named after. It returns
+// the number of imported tags.
+func importTags(ctx context.Context, orasClient *api.ORASClient, loginURL string, store *oci.ReadOnlyStore, concurrency int, progress *copyProgress) (int, error) {
+	var layoutTags []string
+	if err := store.Tags(ctx, "", func(tags []string) error {
+		layoutTags = append(layoutTags, tags...)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	importedCount := 0
+	for _, layoutTag := range layoutTags {
+		repoName, tagName, err := parseLayoutTag(layoutTag)
+		if err != nil {
+			return importedCount, err
+		}
+		reference := fmt.Sprintf("%s/%s:%s", loginURL, repoName, tagName)
+		root, err := orasClient.Import(ctx, store, layoutTag, reference, api.CopyOptions{Recursive: true, Concurrency: concurrency, Progress: progress.report})
+		if err != nil {
+			return importedCount, fmt.Errorf("failed to import %s: %w", reference, err)
+		}
+		fmt.Printf("Imported %s, digest: %s\n", reference, root.Digest)
+		importedCount++
+	}
+	return importedCount, nil
+}
+
+// parseLayoutTag returns the repository and the tag of a tag of the layout, named <repository>:<tag> by export. The
+// repository names and the tags cannot hold a colon.
+func parseLayoutTag(layoutTag string) (string, string, error) {
+	repoName, tagName, found := strings.Cut(layoutTag, ":")
+	if !found || repoName == "" || tagName == "" {
+		return "", "", fmt.Errorf("the tag %q of the layout is not in the <repository>:<tag> form written by acr export", layoutTag)
+	}
+	return repoName, tagName, nil
+}
@@ -0,0 +1,37 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewImportCmd(t *testing.T) {
+	cmd := newImportCmd(&rootParameters{})
+	assert.Equal(t, "import", cmd.Use)
+	assert.Equal(t, newImportCmdLongMessage, cmd.Long)
+}
+
+func TestParseLayoutTag(t *testing.T) {
+	repoName, tagName, err := parseLayoutTag("team/app:v1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "team/app", repoName)
+	assert.Equal(t, "v1.0", tagName)
+	for _, layoutTag := range []string{"v1", ":v1", "team/app:"} {
+		_, _, err := parseLayoutTag(layoutTag)
+		assert.Error(t, err, layoutTag)
+	}
+}
+
+func TestImportInvalidLayout(t *testing.T) {
+	registry := fakeregistry.New(t)
+	err := runCommand(registry, "import", "--username", fakeregistry.Username, "--password", fakeregistry.Password, "--from", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+	err = runCommand(registry, "import", "--username", fakeregistry.Username, "--password", fakeregistry.Password, "--from", t.TempDir())
+	assert.ErrorContains(t, err, "invalid OCI Image Layout")
+}
@@ -0,0 +1,137 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/repository"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/container/set"
+	"github.com/dlclark/regexp2"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// lockParameters holds the flags of the lock and unlock subcommands of the tag and manifest commands, besides the
+// filter which is shared with the list subcommands.
+type lockParameters struct {
+	concurrency string
+	attributes  changeableAttributesFlags
+}
+
+// addFlags adds the concurrency and attribute flags to a lock subcommand, or to an unlock subcommand when lock is
+// false. The delete and write attributes are always set, to false by lock and to true by unlock, the list and read
+// attributes are only set when their flag is.
+func (lockParams *lockParameters) addFlags(cmd *cobra.Command, lock bool) {
+	cmd.Flags().StringVar(&lockParams.concurrency, "concurrency", strconv.Itoa(defaultPoolSize), fmt.Sprintf("Number of concurrent updates. Range: [1 - %d], or %q to adapt the concurrency to the throttling of the registry", maxPoolSize, concurrencyAuto))
+	cmd.Flags().BoolVar(&lockParams.attributes.deleteEnabled, "delete-enabled", !lock, "Allow the deletion")
+	cmd.Flags().BoolVar(&lockParams.attributes.writeEnabled, "write-enabled", !lock, "Allow the update, or the overwrite of a tag")
+	cmd.Flags().BoolVar(&lockParams.attributes.listEnabled, "list-enabled", true, "Show in the list operations")
+	cmd.Flags().BoolVar(&lockParams.attributes.readEnabled, "read-enabled", true, "Allow the pull")
+}
+
+// changeableAttributes returns the attributes to set, according to the flags of cmd.
+func (lockParams *lockParameters) changeableAttributes(cmd *cobra.Command) *acr.ChangeableAttributes {
+	value := lockParams.attributes.changed(cmd)
+	if value == nil {
+		value = &acr.ChangeableAttributes{}
+	}
+	value.DeleteEnabled, value.WriteEnabled = &lockParams.attributes.deleteEnabled, &lockParams.attributes.writeEnabled
+	return value
+}
+
+// buildOptionalFilter returns nil when the expression is empty, it is not matched against anything then.
+func buildOptionalFilter(expression string, timeout int64) (*regexp2.Regexp, error) {
+	if expression == "" {
+		return nil, nil
+	}
+	return repository.BuildRegexFilter(expression, timeout)
+}
+
+// selectTags returns the tag names followed by the names of the tags matching the filter, when it is not nil, without
+// duplicates.
+func selectTags(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, tagNames []string, filter *regexp2.Regexp) ([]string, error) {
+	seen := set.New[string]()
+	selected := appendUnique(nil, seen, tagNames...)
+	if filter == nil {
+		return selected, nil
+	}
+	tagList, err := listTags(ctx, acrClient, repoName, "", filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tagList {
+		selected = appendUnique(selected, seen, *t.Name)
+	}
+	return selected, nil
+}
+
+// selectManifests returns the digests followed by the digests of the manifests with at least one tag matching the
+// filter, when it is not nil, without duplicates.
+func selectManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, digests []string, filter *regexp2.Regexp) ([]string, error) {
+	seen := set.New[string]()
+	selected := appendUnique(nil, seen, digests...)
+	if filter == nil {
+		return selected, nil
+	}
+	manifests, err := listAllManifests(ctx, acrClient, repoName)
+	if err != nil {
+		return nil, err
+	}
+	for _, manifest := range manifests {
+		if manifest.Tags == nil {
+			continue
+		}
+		for _, tagName := range *manifest.Tags {
+			matches, err := filter.MatchString(tagName)
+			if err != nil {
+				// The only error regexp2 can throw is a timeout error
+				return nil, err
+			}
+			if matches {
+				selected = appendUnique(selected, seen, *manifest.Digest)
+				break
+			}
+		}
+	}
+	return selected, nil
+}
+
+// listAllManifests returns the attributes of every manifest of the repository, or none when the repository does not
+// exist.
+func listAllManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string) ([]acr.ManifestAttributesBase, error) {
+	var all []acr.ManifestAttributesBase
+	lastManifestDigest := ""
+	for {
+		resultManifests, err := acrClient.GetAcrManifests(ctx, repoName, "", lastManifestDigest)
+		if err != nil {
+			if resultManifests != nil && resultManifests.Response.Response != nil && resultManifests.StatusCode == http.StatusNotFound {
+				return nil, nil
+			}
+			return nil, errors.Wrap(err, "failed to list manifests")
+		}
+		if resultManifests == nil || resultManifests.ManifestsAttributes == nil || len(*resultManifests.ManifestsAttributes) == 0 {
+			return all, nil
+		}
+		manifests := *resultManifests.ManifestsAttributes
+		all = append(all, manifests...)
+		lastManifestDigest = *manifests[len(manifests)-1].Digest
+	}
+}
+
+// appendUnique appends the values that were not seen yet, and adds them to seen.
+func appendUnique(slice []string, seen set.Set[string], values ...string) []string {
+	for _, value := range values {
+		if !seen.Contains(value) {
+			seen.Add(value)
+			slice = append(slice, value)
+		}
+	}
+	return slice
+}
@@ -0,0 +1,156 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/cmd/repository"
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLockCmds(t *testing.T) {
+	rootParams := &rootParameters{}
+	cmd := newTagLockCmd(&tagParameters{rootParameters: rootParams}, true)
+	assert.Equal(t, "lock", cmd.Use)
+	assert.Equal(t, newTagLockCmdLongMessage, cmd.Long)
+	cmd = newTagLockCmd(&tagParameters{rootParameters: rootParams}, false)
+	assert.Equal(t, "unlock", cmd.Use)
+	assert.Equal(t, newTagUnlockCmdLongMessage, cmd.Long)
+	cmd = newManifestLockCmd(&manifestParameters{rootParameters: rootParams}, true)
+	assert.Equal(t, "lock", cmd.Use)
+	assert.Equal(t, newManifestLockCmdLongMessage, cmd.Long)
+	cmd = newManifestLockCmd(&manifestParameters{rootParameters: rootParams}, false)
+	assert.Equal(t, "unlock", cmd.Use)
+	assert.Equal(t, newManifestUnlockCmdLongMessage, cmd.Long)
+}
+
+func TestLockChangeableAttributes(t *testing.T) {
+	enabled, disabled := true, false
+
+	t.Run("LockDisablesDeleteAndWrite", func(t *testing.T) {
+		lockParams := lockParameters{}
+		cmd := &cobra.Command{}
+		lockParams.addFlags(cmd, true)
+		require.NoError(t, cmd.ParseFlags(nil))
+		assert.Equal(t, &acr.ChangeableAttributes{DeleteEnabled: &disabled, WriteEnabled: &disabled}, lockParams.changeableAttributes(cmd))
+	})
+
+	t.Run("UnlockEnablesDeleteAndWrite", func(t *testing.T) {
+		lockParams := lockParameters{}
+		cmd := &cobra.Command{}
+		lockParams.addFlags(cmd, false)
+		require.NoError(t, cmd.ParseFlags(nil))
+		assert.Equal(t, &acr.ChangeableAttributes{DeleteEnabled: &enabled, WriteEnabled: &enabled}, lockParams.changeableAttributes(cmd))
+	})
+
+	t.Run("ListAndReadAreSetWithTheirFlags", func(t *testing.T) {
+		lockParams := lockParameters{}
+		cmd := &cobra.Command{}
+		lockParams.addFlags(cmd, true)
+		require.NoError(t, cmd.ParseFlags([]string{"--write-enabled", "--read-enabled=false"}))
+		assert.Equal(t, &acr.ChangeableAttributes{DeleteEnabled: &disabled, WriteEnabled: &enabled, ReadEnabled: &disabled}, lockParams.changeableAttributes(cmd))
+	})
+}
+
+func TestSelectTags(t *testing.T) {
+	t.Run("ArgumentsOnly", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		tagNames, err := selectTags(testCtx, mockClient, testRepo, []string{"v1", "v2", "v1"}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"v1", "v2"}, tagNames)
+		mockClient.AssertNotCalled(t, "GetAcrTags", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("ArgumentsAndFilter", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		filter, err := repository.BuildRegexFilter("^v[23]$", defaultRegexpMatchTimeoutSeconds)
+		require.NoError(t, err)
+		tagNames, err := selectTags(testCtx, mockClient, testRepo, []string{"latest", "v2"}, filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"latest", "v2", "v3"}, tagNames)
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestSelectManifests(t *testing.T) {
+	t.Run("ManifestsWithAMatchingTag", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
+		filter, err := repository.BuildRegexFilter("^lat.*", defaultRegexpMatchTimeoutSeconds)
+		require.NoError(t, err)
+		digests, err := selectManifests(testCtx, mockClient, testRepo, []string{"sha256:other", digest}, filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"sha256:other", digest}, digests)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("NoMatchingTag", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
+		filter, err := repository.BuildRegexFilter("^v1$", defaultRegexpMatchTimeoutSeconds)
+		require.NoError(t, err)
+		digests, err := selectManifests(testCtx, mockClient, testRepo, nil, filter)
+		assert.NoError(t, err)
+		assert.Empty(t, digests)
+	})
+}
+
+func TestListAllManifests(t *testing.T) {
+	t.Run("RepositoryNotFound", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(notFoundManifestResponse, errors.New("testRepo not found")).Once()
+		manifests, err := listAllManifests(testCtx, mockClient, testRepo)
+		assert.NoError(t, err)
+		assert.Empty(t, manifests)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("ListError", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(nil, errors.New("list error")).Once()
+		_, err := listAllManifests(testCtx, mockClient, testRepo)
+		assert.EqualError(t, err, "failed to list manifests: list error")
+	})
+}
+
+func TestLockEndToEnd(t *testing.T) {
+	registry := fakeregistry.New(t)
+	releaseDigest := registry.PushImage("hello", "a", "v1.0", "v1.1")
+	devDigest := registry.PushImage("hello", "b", "dev")
+	credentials := []string{"--repository", "hello", "--username", fakeregistry.Username, "--password", fakeregistry.Password}
+
+	err := runCommand(registry, append([]string{"tag", "lock", "dev", "--filter", `^v1\.0$`}, credentials...)...)
+	require.NoError(t, err)
+	assert.True(t, registry.Locked("hello", "v1.0"))
+	assert.False(t, registry.Locked("hello", "v1.1"))
+	assert.True(t, registry.Locked("hello", "dev"))
+
+	err = runCommand(registry, append([]string{"tag", "unlock", "dev"}, credentials...)...)
+	require.NoError(t, err)
+	assert.False(t, registry.Locked("hello", "dev"))
+
+	err = runCommand(registry, append([]string{"manifest", "lock", "--filter", `^v1\..*`}, credentials...)...)
+	require.NoError(t, err)
+	assert.True(t, registry.Locked("hello", releaseDigest))
+	assert.False(t, registry.Locked("hello", devDigest))
+
+	err = runCommand(registry, append([]string{"manifest", "unlock", releaseDigest}, credentials...)...)
+	require.NoError(t, err)
+	assert.False(t, registry.Locked("hello", releaseDigest))
+
+	err = runCommand(registry, append([]string{"tag", "lock"}, credentials...)...)
+	assert.EqualError(t, err, "at least one tag or --filter is required")
+}
@@ -3,13 +3,32 @@
 
 package main
 
-import "os"
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
 
 // The function of the main method is just to launch the root cobra command which is
 // used to launch the other commands.
 func main() {
-	cmd := newRootCmd(os.Args[1:])
-	if err := cmd.Execute(); err != nil {
+	// The context of every command is canceled on the first interrupt so that the commands can stop gracefully, a
+	// second interrupt terminates the process right away.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		fmt.Fprintln(os.Stderr, "Interrupted, waiting for the requests in flight to complete. Interrupt again to exit immediately.")
+		cancel()
+	}()
+
+	cmd := newRootCmd(os.Args[1:], nil)
+	if err := cmd.ExecuteContext(ctx); err != nil {
 		os.Exit(1)
 	}
 }
@@ -6,26 +6,31 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/worker"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 const (
-	newManifestCmdLongMessage       = `acr manifest: list manifests and delete them individually.`
+	newManifestCmdLongMessage       = `acr manifest: list, show, lock and unlock manifests, show them as a tree and delete them individually.`
 	newManifestListCmdLongMessage   = `acr manifest list: outputs all the manifests that are inside a given repository`
 	newManifestDeleteCmdLongMessage = `acr manifest delete: delete a set of manifests inside the specified repository`
+	newManifestLockCmdLongMessage   = `acr manifest lock: lock a set of manifests, and the manifests with a tag matching the filter, inside the specified repository. By default their deletion and update are disabled`
+	newManifestUnlockCmdLongMessage = `acr manifest unlock: unlock a set of manifests, and the manifests with a tag matching the filter, inside the specified repository. By default their deletion and update are enabled`
 )
 
 // Besides the registry name and authentication information only the repository is needed.
 type manifestParameters struct {
 	*rootParameters
-	repoName string
+	repoName      string
+	filter        string
+	filterTimeout int64
 }
 
-// The manifest command can be used to either list manifests or delete manifests inside a repository.
-// that can be done with the manifest list and manifest delete commands respectively.
+// The manifest command can be used to list, delete, lock, unlock, show or show the tree of manifests inside a repository.
 func newManifestCmd(rootParams *rootParameters) *cobra.Command {
 	manifestParams := manifestParameters{rootParameters: rootParams}
 	cmd := &cobra.Command{
@@ -40,14 +45,24 @@ func newManifestCmd(rootParams *rootParameters) *cobra.Command {
 
 	listManifestCmd := newManifestListCmd(&manifestParams)
 	deleteManifestCmd := newManifestDeleteCmd(&manifestParams)
+	showManifestCmd := newManifestShowCmd(&manifestParams)
+	treeManifestCmd := newManifestTreeCmd(&manifestParams)
 
 	cmd.AddCommand(
 		listManifestCmd,
 		deleteManifestCmd,
+		newManifestLockCmd(&manifestParams, true),
+		newManifestLockCmd(&manifestParams, false),
+		showManifestCmd,
+		treeManifestCmd,
 	)
-	cmd.PersistentFlags().StringVar(&manifestParams.repoName, "repository", "", "The repository name")
-	// Since the repository will be needed in either subcommand it is marked as a required flag
-	_ = cmd.MarkPersistentFlagRequired("repository")
+	// The repository is required by every subcommand but show and tree, which take it in their argument.
+	for _, subcommand := range cmd.Commands() {
+		if subcommand != showManifestCmd && subcommand != treeManifestCmd {
+			subcommand.Flags().StringVar(&manifestParams.repoName, "repository", "", "The repository name")
+			_ = subcommand.MarkFlagRequired("repository")
+		}
+	}
 
 	return cmd
 }
@@ -59,18 +74,19 @@ func newManifestListCmd(manifestParams *manifestParameters) *cobra.Command {
 		Use:   "list",
 		Short: "List manifests from a repository",
 		Long:  newManifestListCmdLongMessage,
-		RunE: func(_ *cobra.Command, _ []string) error {
+		RunE: func(cmd *cobra.Command, _ []string) error {
 			registryName, err := manifestParams.GetRegistryName()
 			if err != nil {
 				return err
 			}
 			loginURL := api.LoginURL(registryName)
-			ctx := context.Background()
+			ctx := cmd.Context()
 			// An acrClient is created to make the http requests to the registry.
-			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, manifestParams.username, manifestParams.password, manifestParams.configs)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, manifestParams.username, manifestParams.password, manifestParams.configs, manifestParams.transport)
 			if err != nil {
 				return err
 			}
+			acrClient.SetRetryPolicy(manifestParams.retryPolicy(false))
 			// For ABAC registries, scope the token to the target repository.
 			if acrClient.IsAbac() {
 				if err := acrClient.RefreshTokenForAbac(ctx, []string{manifestParams.repoName}); err != nil {
@@ -122,17 +138,18 @@ func newManifestDeleteCmd(manifestParams *manifestParameters) *cobra.Command {
 		Use:   "delete",
 		Short: "Delete manifest from a repository",
 		Long:  newManifestDeleteCmdLongMessage,
-		RunE: func(_ *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			registryName, err := manifestParams.GetRegistryName()
 			if err != nil {
 				return err
 			}
 			loginURL := api.LoginURL(registryName)
-			ctx := context.Background()
-			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, manifestParams.username, manifestParams.password, manifestParams.configs)
+			ctx := cmd.Context()
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, manifestParams.username, manifestParams.password, manifestParams.configs, manifestParams.transport)
 			if err != nil {
 				return err
 			}
+			acrClient.SetRetryPolicy(manifestParams.retryPolicy(false))
 			// For ABAC registries, scope the token to the target repository.
 			if acrClient.IsAbac() {
 				if err := acrClient.RefreshTokenForAbac(ctx, []string{manifestParams.repoName}); err != nil {
@@ -162,3 +179,65 @@ func deleteManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, l
 	}
 	return nil
 }
+
+// newManifestLockCmd defines the manifest lock subcommand, or the manifest unlock subcommand when lock is false. It
+// receives as an argument an array of manifest digests, the manifests with a tag matching --filter are updated too.
+func newManifestLockCmd(manifestParams *manifestParameters, lock bool) *cobra.Command {
+	// The lock and unlock subcommands have different flag defaults, so they cannot share their parameters.
+	lockParams := lockParameters{}
+	use, short, long := "lock", "Lock manifests inside a repository", newManifestLockCmdLongMessage
+	if !lock {
+		use, short, long = "unlock", "Unlock manifests inside a repository", newManifestUnlockCmdLongMessage
+	}
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && manifestParams.filter == "" {
+				return errors.New("at least one manifest digest or --filter is required")
+			}
+			filter, err := buildOptionalFilter(manifestParams.filter, manifestParams.filterTimeout)
+			if err != nil {
+				return err
+			}
+			poolSize, limiter, err := resolveConcurrency(lockParams.concurrency)
+			if err != nil {
+				return err
+			}
+			registryName, err := manifestParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			ctx := cmd.Context()
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, manifestParams.username, manifestParams.password, manifestParams.configs, manifestParams.transport)
+			if err != nil {
+				return err
+			}
+			acrClient.SetRetryPolicy(manifestParams.retryPolicy(false))
+			// For ABAC registries, scope the token to the target repository.
+			if acrClient.IsAbac() {
+				if err := acrClient.RefreshTokenForAbac(ctx, []string{manifestParams.repoName}); err != nil {
+					return err
+				}
+			}
+			digests, err := selectManifests(ctx, acrClient, manifestParams.repoName, args, filter)
+			if err != nil {
+				return err
+			}
+			locker := worker.NewLocker(poolSize, acrClient, loginURL, manifestParams.repoName, lockParams.changeableAttributes(cmd), limiter)
+			updatedManifestsCount, err := locker.LockManifests(ctx, digests)
+			fmt.Printf("\nNumber of updated manifests: %d\n", updatedManifestsCount)
+			printEffectiveConcurrency(os.Stdout, limiter)
+			if err != nil {
+				return errors.Wrap(err, "failed to update manifests")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&manifestParams.filter, "filter", "", "Regular expression matched against the tags of the manifests, the manifests with a matching tag are updated in addition to the digests passed as arguments")
+	cmd.Flags().Int64Var(&manifestParams.filterTimeout, "filter-timeout-seconds", defaultRegexpMatchTimeoutSeconds, "This limits the evaluation of the regex filter, and will return a timeout error if this duration is exceeded during a single evaluation. If written incorrectly a regexp filter with backtracking can result in an infinite loop")
+	lockParams.addFlags(cmd, lock)
+	return cmd
+}
@@ -0,0 +1,273 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/acr-cli/internal/api"
+	godigest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newManifestShowCmdLongMessage = `acr manifest show: shows a manifest, given as <repository>@<digest>, <repository>@<tag> or <repository>:<tag>.
+The media type of the manifest is detected, the config, the layers and the total size of images are summarized, the
+child manifests of indexes are listed with their platform, and the subject and artifact type of referrers are shown,
+followed by the manifest itself.`
+
+	mediaTypeDockerManifest       = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList   = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifestV1     = "application/vnd.docker.distribution.manifest.v1+json"
+	mediaTypeDockerManifestSigned = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+	mediaTypeArtifactManifest     = "application/vnd.oci.artifact.manifest.v1+json"
+)
+
+// newManifestShowCmd creates the manifest show command, the manifest is fetched with GetManifest and described by
+// showManifest.
+func newManifestShowCmd(manifestParams *manifestParameters) *cobra.Command {
+	var raw bool
+	cmd := &cobra.Command{
+		Use:   "show <repository>@<digest|tag>",
+		Short: "Show a manifest",
+		Long:  newManifestShowCmdLongMessage,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registryName, err := manifestParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			repoName, reference, err := parseManifestReference(loginURL, args[0])
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, manifestParams.username, manifestParams.password, manifestParams.configs, manifestParams.transport)
+			if err != nil {
+				return err
+			}
+			acrClient.SetRetryPolicy(manifestParams.retryPolicy(false))
+			// For ABAC registries, scope the token to the target repository.
+			if acrClient.IsAbac() {
+				if err := acrClient.RefreshTokenForAbac(ctx, []string{repoName}); err != nil {
+					return err
+				}
+			}
+			return showManifest(ctx, acrClient, os.Stdout, loginURL, repoName, reference, raw)
+		},
+	}
+	cmd.Flags().BoolVar(&raw, "raw", false, "Only write the manifest as returned by the registry, without the summary")
+	return cmd
+}
+
+// parseManifestReference splits a reference like hello@sha256:..., hello@v1 or hello:v1, optionally prefixed with the
+// login URL of the registry, into the repository and the digest or tag.
+func parseManifestReference(loginURL string, value string) (string, string, error) {
+	value = strings.TrimPrefix(value, loginURL+"/")
+	repoName, reference, found := strings.Cut(value, "@")
+	if !found {
+		// The tag is after the last colon that follows the last slash, a colon before it would separate a port.
+		if i := strings.LastIndex(value, ":"); i > strings.LastIndex(value, "/") {
+			repoName, reference = value[:i], value[i+1:]
+		}
+	}
+	if repoName == "" || reference == "" {
+		return "", "", fmt.Errorf("invalid manifest reference %q, expected <repository>@<digest>, <repository>@<tag> or <repository>:<tag>", value)
+	}
+	return repoName, reference, nil
+}
+
+// manifestContent holds the fields of every kind of manifest, the ones that do not apply to a kind are empty.
+type manifestContent struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        *v1.Descriptor    `json:"config,omitempty"`
+	Layers        []v1.Descriptor   `json:"layers,omitempty"`
+	Blobs         []v1.Descriptor   `json:"blobs,omitempty"`
+	Manifests     []v1.Descriptor   `json:"manifests,omitempty"`
+	Subject       *v1.Descriptor    `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// parseManifest decodes the manifest, when it has no mediaType field the media type is detected from its fields.
+func parseManifest(manifestBytes []byte) (*manifestContent, error) {
+	var content manifestContent
+	if err := json.Unmarshal(manifestBytes, &content); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the manifest")
+	}
+	if content.MediaType == "" {
+		switch {
+		case content.SchemaVersion == 1:
+			content.MediaType = mediaTypeDockerManifestV1
+		case content.Manifests != nil:
+			content.MediaType = v1.MediaTypeImageIndex
+		case content.Blobs != nil:
+			content.MediaType = mediaTypeArtifactManifest
+		default:
+			content.MediaType = v1.MediaTypeImageManifest
+		}
+	}
+	return &content, nil
+}
+
+// kind returns a human readable description of the media type. OCI image manifests whose config is not an image
+// config, or that have an artifact type, are artifacts.
+func (content *manifestContent) kind() string {
+	switch content.MediaType {
+	case mediaTypeDockerManifest:
+		return "Docker image"
+	case mediaTypeDockerManifestList:
+		return "Docker manifest list"
+	case mediaTypeDockerManifestV1, mediaTypeDockerManifestSigned:
+		return "Docker image, schema 1"
+	case v1.MediaTypeImageIndex:
+		return "OCI image index"
+	case mediaTypeArtifactManifest:
+		return "OCI artifact"
+	case v1.MediaTypeImageManifest:
+		if content.ArtifactType != "" || (content.Config != nil && content.Config.MediaType != v1.MediaTypeImageConfig) {
+			return "OCI artifact"
+		}
+		return "OCI image"
+	}
+	return "unknown"
+}
+
+// isIndex returns true for manifest lists and image indexes.
+func (content *manifestContent) isIndex() bool {
+	return content.MediaType == mediaTypeDockerManifestList || content.MediaType == v1.MediaTypeImageIndex
+}
+
+// artifactType returns the artifact type of the manifest, which defaults to the media type of the config of OCI
+// image manifests.
+func (content *manifestContent) artifactType() string {
+	if content.ArtifactType == "" && content.MediaType == v1.MediaTypeImageManifest && content.Config != nil &&
+		content.Config.MediaType != v1.MediaTypeImageConfig {
+		return content.Config.MediaType
+	}
+	return content.ArtifactType
+}
+
+// blobs returns the layers of images, or the blobs of artifact manifests.
+func (content *manifestContent) blobs() []v1.Descriptor {
+	if content.MediaType == mediaTypeArtifactManifest {
+		return content.Blobs
+	}
+	return content.Layers
+}
+
+// showManifest writes the summary of the manifest followed by the manifest indented, or only the manifest as returned
+// by the registry when raw is true.
+func showManifest(ctx context.Context, acrClient api.AcrCLIClientInterface, out io.Writer, loginURL string, repoName string, reference string, raw bool) error {
+	manifestBytes, err := acrClient.GetManifest(ctx, repoName, reference)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the manifest %s/%s", repoName, reference)
+	}
+	if raw {
+		_, err = out.Write(manifestBytes)
+		return err
+	}
+	content, err := parseManifest(manifestBytes)
+	if err != nil {
+		return err
+	}
+	manifestDigest := reference
+	if _, err := godigest.Parse(reference); err != nil {
+		manifestDigest = godigest.FromBytes(manifestBytes).String()
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Manifest:\t%s/%s@%s\n", loginURL, repoName, manifestDigest)
+	fmt.Fprintf(w, "Media type:\t%s (%s)\n", content.MediaType, content.kind())
+	if artifactType := content.artifactType(); artifactType != "" {
+		fmt.Fprintf(w, "Artifact type:\t%s\n", artifactType)
+	}
+	if content.Subject != nil {
+		fmt.Fprintf(w, "Subject:\t%s (%s)\n", content.Subject.Digest, content.Subject.MediaType)
+	}
+	if content.isIndex() {
+		fmt.Fprintf(w, "Manifests:\t%d\n", len(content.Manifests))
+	} else {
+		// The total size is the size of the manifest and of the blobs it references.
+		totalSize := int64(len(manifestBytes))
+		if content.Config != nil {
+			fmt.Fprintf(w, "Config:\t%s (%s, %s)\n", content.Config.Digest, content.Config.MediaType, formatSize(content.Config.Size))
+			totalSize += content.Config.Size
+		}
+		for _, blob := range content.blobs() {
+			totalSize += blob.Size
+		}
+		fmt.Fprintf(w, "Layers:\t%d\n", len(content.blobs()))
+		fmt.Fprintf(w, "Total size:\t%s\n", formatSize(totalSize))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if content.isIndex() && len(content.Manifests) > 0 {
+		rows := make([][]string, 0, len(content.Manifests))
+		for _, child := range content.Manifests {
+			rows = append(rows, []string{formatPlatform(child.Platform), child.MediaType, child.Digest.String(), formatSize(child.Size)})
+		}
+		fmt.Fprintln(out)
+		if err := writeTable(out, []string{"platform", "mediaType", "digest", "size"}, rows); err != nil {
+			return err
+		}
+	} else if blobs := content.blobs(); len(blobs) > 0 {
+		rows := make([][]string, 0, len(blobs))
+		for _, blob := range blobs {
+			rows = append(rows, []string{blob.MediaType, blob.Digest.String(), formatSize(blob.Size)})
+		}
+		fmt.Fprintln(out)
+		if err := writeTable(out, []string{"mediaType", "digest", "size"}, rows); err != nil {
+			return err
+		}
+	}
+	if len(content.Annotations) > 0 {
+		keys := make([]string, 0, len(content.Annotations))
+		for key := range content.Annotations {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintln(out, "\nAnnotations:")
+		for _, key := range keys {
+			fmt.Fprintf(out, "  %s=%s\n", key, content.Annotations[key])
+		}
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, manifestBytes, "", "  "); err != nil {
+		return errors.Wrap(err, "failed to indent the manifest")
+	}
+	fmt.Fprintf(out, "\n%s\n", indented.String())
+	return nil
+}
+
+// formatPlatform returns the platform as os/architecture/variant, or "-" when it is unknown.
+func formatPlatform(platform *v1.Platform) string {
+	if platform == nil || platform.OS == "" {
+		return "-"
+	}
+	parts := []string{platform.OS, platform.Architecture}
+	if platform.Variant != "" {
+		parts = append(parts, platform.Variant)
+	}
+	formatted := strings.Join(parts, "/")
+	if platform.OSVersion != "" {
+		formatted += " (" + platform.OSVersion + ")"
+	}
+	return formatted
+}
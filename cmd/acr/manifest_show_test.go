@@ -0,0 +1,151 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewManifestShowCmd(t *testing.T) {
+	cmd := newManifestShowCmd(&manifestParameters{rootParameters: &rootParameters{}})
+	assert.Equal(t, "show <repository>@<digest|tag>", cmd.Use)
+	assert.Equal(t, newManifestShowCmdLongMessage, cmd.Long)
+}
+
+func TestParseManifestReference(t *testing.T) {
+	tests := []struct {
+		value     string
+		repoName  string
+		reference string
+	}{
+		{"hello@sha256:abc", "hello", "sha256:abc"},
+		{"hello@v1", "hello", "v1"},
+		{"hello:v1", "hello", "v1"},
+		{"team/hello:v1", "team/hello", "v1"},
+		{"foo.azurecr.io/team/hello@sha256:abc", "team/hello", "sha256:abc"},
+	}
+	for _, test := range tests {
+		repoName, reference, err := parseManifestReference(testLoginURL, test.value)
+		assert.NoError(t, err, test.value)
+		assert.Equal(t, test.repoName, repoName, test.value)
+		assert.Equal(t, test.reference, reference, test.value)
+	}
+	for _, value := range []string{"hello", "hello@", "@v1", "hello:"} {
+		_, _, err := parseManifestReference(testLoginURL, value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifest  string
+		mediaType string
+		kind      string
+	}{
+		{"DockerImage", `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`, mediaTypeDockerManifest, "Docker image"},
+		{"DockerList", `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.list.v2+json","manifests":[]}`, mediaTypeDockerManifestList, "Docker manifest list"},
+		{"OCIImageWithoutMediaType", `{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json"},"layers":[]}`, "application/vnd.oci.image.manifest.v1+json", "OCI image"},
+		{"OCIIndexWithoutMediaType", `{"schemaVersion":2,"manifests":[]}`, "application/vnd.oci.image.index.v1+json", "OCI image index"},
+		{"OCIArtifact", `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/vnd.example.sbom","config":{"mediaType":"application/vnd.oci.empty.v1+json"}}`, "application/vnd.oci.image.manifest.v1+json", "OCI artifact"},
+		{"ArtifactManifest", `{"mediaType":"application/vnd.oci.artifact.manifest.v1+json","blobs":[]}`, mediaTypeArtifactManifest, "OCI artifact"},
+		{"DockerSchema1", `{"schemaVersion":1,"fsLayers":[]}`, mediaTypeDockerManifestV1, "Docker image, schema 1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, err := parseManifest([]byte(test.manifest))
+			require.NoError(t, err)
+			assert.Equal(t, test.mediaType, content.MediaType)
+			assert.Equal(t, test.kind, content.kind())
+		})
+	}
+
+	_, err := parseManifest([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestShowManifest(t *testing.T) {
+	imageManifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json",` +
+		`"config":{"mediaType":"application/vnd.docker.container.image.v1+json","digest":"sha256:c0","size":1000},` +
+		`"layers":[{"mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip","digest":"sha256:l1","size":2048},` +
+		`{"mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip","digest":"sha256:l2","size":1048576}]}`)
+
+	t.Run("Image", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifest", mock.Anything, testRepo, "v1").Return(imageManifest, nil).Once()
+		var out bytes.Buffer
+		err := showManifest(testCtx, mockClient, &out, testLoginURL, testRepo, "v1", false)
+		require.NoError(t, err)
+		assert.Contains(t, out.String(), "Media type:  application/vnd.docker.distribution.manifest.v2+json (Docker image)\n")
+		assert.Contains(t, out.String(), "Config:      sha256:c0 (application/vnd.docker.container.image.v1+json, 1000 B)\n")
+		assert.Contains(t, out.String(), "Layers:      2\n")
+		assert.Contains(t, out.String(), "Total size:  1.0 MiB\n")
+		assert.Contains(t, out.String(), "sha256:l2  1.0 MiB\n")
+		assert.Contains(t, out.String(), "\"schemaVersion\": 2,\n")
+	})
+
+	t.Run("Index", func(t *testing.T) {
+		index := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` +
+			`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:amd","size":500,"platform":{"os":"linux","architecture":"amd64"}},` +
+			`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:arm","size":501,"platform":{"os":"linux","architecture":"arm64","variant":"v8"}}]}`)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifest", mock.Anything, testRepo, digest).Return(index, nil).Once()
+		var out bytes.Buffer
+		err := showManifest(testCtx, mockClient, &out, testLoginURL, testRepo, digest, false)
+		require.NoError(t, err)
+		assert.Contains(t, out.String(), "Manifest:    foo.azurecr.io/bar@"+digest+"\n")
+		assert.Contains(t, out.String(), "Manifests:   2\n")
+		assert.Contains(t, out.String(), "linux/amd64     application/vnd.oci.image.manifest.v1+json  sha256:amd")
+		assert.Contains(t, out.String(), "linux/arm64/v8  application/vnd.oci.image.manifest.v1+json  sha256:arm")
+	})
+
+	t.Run("Raw", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifest", mock.Anything, testRepo, "v1").Return(imageManifest, nil).Once()
+		var out bytes.Buffer
+		err := showManifest(testCtx, mockClient, &out, testLoginURL, testRepo, "v1", true)
+		require.NoError(t, err)
+		assert.Equal(t, string(imageManifest), out.String())
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifest", mock.Anything, testRepo, "v1").Return(nil, errors.New("not found")).Once()
+		err := showManifest(testCtx, mockClient, &bytes.Buffer{}, testLoginURL, testRepo, "v1", false)
+		assert.EqualError(t, err, "failed to get the manifest bar/v1: not found")
+	})
+}
+
+func TestShowManifestEndToEnd(t *testing.T) {
+	registry := fakeregistry.New(t)
+	image := registry.PushImage("hello", "a", "v1")
+	referrer := registry.PushReferrer("hello", image, "application/vnd.example.sbom", map[string]string{"org.example.key": "value"})
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	err = showManifest(testCtx, acrClient, &out, registry.LoginURL(), "hello", "v1", false)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "@"+image+"\n")
+	assert.Contains(t, out.String(), "(OCI image)\n")
+
+	out.Reset()
+	err = showManifest(testCtx, acrClient, &out, registry.LoginURL(), "hello", referrer, false)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "Artifact type:  application/vnd.example.sbom\n")
+	assert.Contains(t, out.String(), "Subject:        "+image+" (application/vnd.oci.image.manifest.v1+json)\n")
+	assert.Contains(t, out.String(), "org.example.key=value\n")
+
+	err = runCommand(registry, "manifest", "show", "hello:v1", "--username", fakeregistry.Username, "--password", fakeregistry.Password)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,339 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/alitto/pond/v2"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newManifestTreeCmdLongMessage = `acr manifest tree: shows the manifests of a repository as a tree, or only the tree of the given manifest.
+Indexes hold their platform manifests and manifests hold their referrers, such as signatures, SBOMs and lifecycle
+annotations. The manifests that a purge of the untagged manifests keeps are marked as protected, with the reasons.`
+
+	lifecycleArtifactType      = "application/vnd.microsoft.artifact.lifecycle"
+	lifecycleEndOfLifeDateName = "vnd.microsoft.artifact.lifecycle.end-of-life.date"
+)
+
+// Reasons for which a manifest is protected from a purge of the untagged manifests.
+const (
+	protectedTagged   = "tagged"
+	protectedLocked   = "locked"
+	protectedReferrer = "referrer"
+	protectedInIndex  = "in a protected index"
+)
+
+// newManifestTreeCmd creates the manifest tree command, the tree is built by buildManifestTree.
+func newManifestTreeCmd(manifestParams *manifestParameters) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "tree <repository>[@<digest>]",
+		Short: "Show the manifests of a repository as a tree",
+		Long:  newManifestTreeCmdLongMessage,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutput(output, outputText, outputJSON); err != nil {
+				return err
+			}
+			registryName, err := manifestParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			repoName, rootDigest, _ := strings.Cut(strings.TrimPrefix(args[0], loginURL+"/"), "@")
+			ctx := cmd.Context()
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, manifestParams.username, manifestParams.password, manifestParams.configs, manifestParams.transport)
+			if err != nil {
+				return err
+			}
+			acrClient.SetRetryPolicy(manifestParams.retryPolicy(false))
+			// For ABAC registries, scope the token to the target repository.
+			if acrClient.IsAbac() {
+				if err := acrClient.RefreshTokenForAbac(ctx, []string{repoName}); err != nil {
+					return err
+				}
+			}
+			roots, err := buildManifestTree(ctx, acrClient, defaultPoolSize, repoName, rootDigest)
+			if err != nil {
+				return err
+			}
+			if output == outputJSON {
+				return writeJSON(os.Stdout, roots)
+			}
+			printManifestTree(os.Stdout, fmt.Sprintf("%s/%s", loginURL, repoName), roots)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", outputText, "Output format: text, an ASCII tree, or json")
+	return cmd
+}
+
+// manifestNode is a manifest of the tree, with the manifests of the index and the referrers of the manifest as
+// children. The same platform manifest can be in several indexes.
+type manifestNode struct {
+	Digest       string            `json:"digest"`
+	MediaType    string            `json:"mediaType,omitempty"`
+	Kind         string            `json:"kind"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Platform     string            `json:"platform,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Protected    []string          `json:"protected,omitempty"`
+	Missing      bool              `json:"missing,omitempty"`
+	Manifests    []*manifestNode   `json:"manifests,omitempty"`
+	Referrers    []*manifestNode   `json:"referrers,omitempty"`
+
+	subject    string
+	locked     bool
+	parents    []*manifestNode
+	attributes acr.ManifestAttributesBase
+}
+
+// buildManifestTree returns the trees of the manifests of the repository, or only the tree of rootDigest when it is
+// not empty. The indexes and the OCI manifests, which can have a subject, are fetched concurrently with poolSize
+// workers.
+func buildManifestTree(ctx context.Context, acrClient api.AcrCLIClientInterface, poolSize int, repoName string, rootDigest string) ([]*manifestNode, error) {
+	manifests, err := listAllManifests(ctx, acrClient, repoName)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]*manifestNode, len(manifests))
+	var toFetch []*manifestNode
+	for _, manifest := range manifests {
+		node := &manifestNode{Digest: *manifest.Digest, MediaType: stringValue(manifest.MediaType), attributes: manifest}
+		if manifest.Tags != nil {
+			node.Tags = append(node.Tags, *manifest.Tags...)
+		}
+		if changeable := manifest.ChangeableAttributes; changeable != nil {
+			node.locked = (changeable.DeleteEnabled != nil && !*changeable.DeleteEnabled) || (changeable.WriteEnabled != nil && !*changeable.WriteEnabled)
+		}
+		nodes[node.Digest] = node
+		switch node.MediaType {
+		case mediaTypeDockerManifest, mediaTypeDockerManifestV1, mediaTypeDockerManifestSigned:
+			node.Kind = (&manifestContent{MediaType: node.MediaType}).kind()
+		default:
+			toFetch = append(toFetch, node)
+		}
+	}
+
+	// The contents are only read by this function once the pool is done.
+	var mu sync.Mutex
+	contents := make(map[string]*manifestContent, len(toFetch))
+	pool := pond.NewPool(poolSize, pond.WithContext(ctx), pond.WithQueueSize(poolSize*3), pond.WithNonBlocking(false))
+	group := pool.NewGroup()
+	for _, node := range toFetch {
+		group.SubmitErr(func() error {
+			manifestBytes, err := acrClient.GetManifest(ctx, repoName, node.Digest)
+			if err != nil {
+				errParsed := autorest.DetailedError{}
+				if errors.As(err, &errParsed) && errParsed.StatusCode == http.StatusNotFound {
+					// The manifest was deleted since it was listed.
+					return nil
+				}
+				return err
+			}
+			content, err := parseManifest(manifestBytes)
+			if err != nil {
+				return pkgerrors.Wrapf(err, "failed to read the manifest %s", node.Digest)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			contents[node.Digest] = content
+			return nil
+		})
+	}
+	err = group.Wait()
+	pool.StopAndWait()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range toFetch {
+		content, ok := contents[node.Digest]
+		if !ok {
+			node.Kind = "unknown"
+			continue
+		}
+		node.MediaType, node.Kind, node.ArtifactType, node.Annotations = content.MediaType, content.kind(), content.artifactType(), content.Annotations
+		if content.Subject != nil {
+			node.subject = content.Subject.Digest.String()
+		}
+		for _, descriptor := range content.Manifests {
+			child, ok := nodes[descriptor.Digest.String()]
+			if !ok {
+				// The index references a manifest that is not in the repository.
+				child = &manifestNode{Digest: descriptor.Digest.String(), MediaType: descriptor.MediaType, Kind: "missing", Missing: true}
+			}
+			if child.Platform == "" && descriptor.Platform != nil {
+				child.Platform = formatPlatform(descriptor.Platform)
+			}
+			child.parents = append(child.parents, node)
+			node.Manifests = append(node.Manifests, child)
+		}
+	}
+
+	var roots []*manifestNode
+	for _, manifest := range manifests {
+		node := nodes[*manifest.Digest]
+		if subject, ok := nodes[node.subject]; ok {
+			node.parents = append(node.parents, subject)
+			subject.Referrers = append(subject.Referrers, node)
+		}
+		if len(node.parents) == 0 {
+			roots = append(roots, node)
+		}
+	}
+	for _, node := range nodes {
+		sortManifestNodes(node.Referrers)
+	}
+	sortManifestNodes(roots)
+	markProtected(nodes)
+
+	if rootDigest != "" {
+		root, ok := nodes[rootDigest]
+		if !ok {
+			return nil, fmt.Errorf("manifest %s not found in repository %s", rootDigest, repoName)
+		}
+		return []*manifestNode{root}, nil
+	}
+	return roots, nil
+}
+
+// markProtected sets the reasons for which every manifest is kept by a purge of the untagged manifests. The manifests
+// of a protected index are protected too, so the reasons are propagated until they no longer change.
+func markProtected(nodes map[string]*manifestNode) {
+	for _, node := range nodes {
+		if len(node.Tags) > 0 {
+			node.Protected = append(node.Protected, protectedTagged)
+		}
+		if node.locked {
+			node.Protected = append(node.Protected, protectedLocked)
+		}
+		if node.subject != "" {
+			node.Protected = append(node.Protected, protectedReferrer)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, node := range nodes {
+			if hasProtection(node, protectedInIndex) {
+				continue
+			}
+			for _, parent := range node.parents {
+				if len(parent.Protected) > 0 && parentHolds(parent, node) {
+					node.Protected = append(node.Protected, protectedInIndex)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// parentHolds returns true when node is one of the manifests of the index parent, rather than one of its referrers.
+func parentHolds(parent *manifestNode, node *manifestNode) bool {
+	for _, child := range parent.Manifests {
+		if child == node {
+			return true
+		}
+	}
+	return false
+}
+
+func hasProtection(node *manifestNode, reason string) bool {
+	for _, protected := range node.Protected {
+		if protected == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// sortManifestNodes orders the tagged manifests first, by their first tag, and then the untagged ones by digest.
+func sortManifestNodes(nodes []*manifestNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if (len(a.Tags) > 0) != (len(b.Tags) > 0) {
+			return len(a.Tags) > 0
+		}
+		if len(a.Tags) > 0 && a.Tags[0] != b.Tags[0] {
+			return a.Tags[0] < b.Tags[0]
+		}
+		return a.Digest < b.Digest
+	})
+}
+
+// printManifestTree writes the trees below the title with box drawing characters.
+func printManifestTree(out io.Writer, title string, roots []*manifestNode) {
+	fmt.Fprintln(out, title)
+	for i, root := range roots {
+		printManifestNode(out, root, "", i == len(roots)-1)
+	}
+}
+
+func printManifestNode(out io.Writer, node *manifestNode, prefix string, last bool) {
+	branch, indent := "├── ", "│   "
+	if last {
+		branch, indent = "└── ", "    "
+	}
+	fmt.Fprintf(out, "%s%s%s\n", prefix, branch, node.describe())
+	children := append(append([]*manifestNode{}, node.Manifests...), node.Referrers...)
+	for i, child := range children {
+		printManifestNode(out, child, prefix+indent, i == len(children)-1)
+	}
+}
+
+// describe returns the line of the manifest in the tree, like
+// sha256:... [v1, latest] OCI image index (protected: tagged).
+func (node *manifestNode) describe() string {
+	var b strings.Builder
+	b.WriteString(node.Digest)
+	if len(node.Tags) > 0 {
+		fmt.Fprintf(&b, " [%s]", strings.Join(node.Tags, ", "))
+	}
+	b.WriteString(" " + node.Kind)
+	if node.Platform != "" {
+		b.WriteString(" " + node.Platform)
+	}
+	if node.ArtifactType != "" {
+		fmt.Fprintf(&b, " %s (%s)", referrerLabel(node.ArtifactType), node.ArtifactType)
+		if date, ok := node.Annotations[lifecycleEndOfLifeDateName]; ok {
+			fmt.Fprintf(&b, " end of life %s", date)
+		}
+	}
+	if len(node.Protected) > 0 {
+		fmt.Fprintf(&b, " *protected: %s*", strings.Join(node.Protected, ", "))
+	}
+	return b.String()
+}
+
+// referrerLabel returns a short name for the well known artifact types of referrers.
+func referrerLabel(artifactType string) string {
+	switch {
+	case artifactType == lifecycleArtifactType:
+		return "lifecycle annotation"
+	case strings.Contains(artifactType, "notary.signature"), strings.Contains(artifactType, "cosign"),
+		strings.Contains(artifactType, "sigstore"), strings.Contains(artifactType, "signature"):
+		return "signature"
+	case strings.Contains(artifactType, "sbom"), strings.Contains(artifactType, "spdx"),
+		strings.Contains(artifactType, "cyclonedx"), strings.Contains(artifactType, "syft"):
+		return "SBOM"
+	}
+	return "artifact"
+}
@@ -0,0 +1,120 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewManifestTreeCmd(t *testing.T) {
+	cmd := newManifestTreeCmd(&manifestParameters{rootParameters: &rootParameters{}})
+	assert.Equal(t, "tree <repository>[@<digest>]", cmd.Use)
+	assert.Equal(t, newManifestTreeCmdLongMessage, cmd.Long)
+}
+
+func TestReferrerLabel(t *testing.T) {
+	assert.Equal(t, "signature", referrerLabel("application/vnd.cncf.notary.signature"))
+	assert.Equal(t, "signature", referrerLabel("application/vnd.dev.cosign.artifact.sig.v1+json"))
+	assert.Equal(t, "SBOM", referrerLabel("application/spdx+json"))
+	assert.Equal(t, "SBOM", referrerLabel("application/vnd.cyclonedx+json"))
+	assert.Equal(t, "lifecycle annotation", referrerLabel(lifecycleArtifactType))
+	assert.Equal(t, "artifact", referrerLabel("application/vnd.example.thing"))
+}
+
+func TestBuildManifestTree(t *testing.T) {
+	t.Run("DockerManifestsAreNotFetched", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
+		roots, err := buildManifestTree(testCtx, mockClient, defaultPoolSize, testRepo, "")
+		require.NoError(t, err)
+		require.Len(t, roots, 1)
+		assert.Equal(t, digest, roots[0].Digest)
+		assert.Equal(t, "Docker image", roots[0].Kind)
+		assert.Equal(t, []string{protectedTagged}, roots[0].Protected)
+		mockClient.AssertExpectations(t)
+		mockClient.AssertNotCalled(t, "GetManifest", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("ListError", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(nil, errors.New("list error")).Once()
+		_, err := buildManifestTree(testCtx, mockClient, defaultPoolSize, testRepo, "")
+		assert.EqualError(t, err, "failed to list manifests: list error")
+	})
+
+	t.Run("UnknownRoot", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(EmptyListManifestsResult, nil).Once()
+		_, err := buildManifestTree(testCtx, mockClient, defaultPoolSize, testRepo, "sha256:unknown")
+		assert.EqualError(t, err, "manifest sha256:unknown not found in repository bar")
+	})
+}
+
+func TestManifestTreeEndToEnd(t *testing.T) {
+	registry := fakeregistry.New(t)
+	amd := registry.PushImage("hello", "amd")
+	arm := registry.PushImage("hello", "arm")
+	index := registry.PushIndex("hello", []string{amd, arm}, "v1")
+	signature := registry.PushReferrer("hello", index, "application/vnd.cncf.notary.signature", nil)
+	lifecycle := registry.PushReferrer("hello", amd, lifecycleArtifactType, map[string]string{lifecycleEndOfLifeDateName: "2026-01-01"})
+	old := registry.PushImage("hello", "old")
+	oldIndex := registry.PushIndex("hello", []string{old})
+	locked := registry.PushImage("hello", "locked")
+	registry.Lock("hello", locked)
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+	require.NoError(t, err)
+
+	roots, err := buildManifestTree(testCtx, acrClient, defaultPoolSize, "hello", "")
+	require.NoError(t, err)
+	nodes := map[string]*manifestNode{}
+	var walk func([]*manifestNode)
+	walk = func(children []*manifestNode) {
+		for _, node := range children {
+			nodes[node.Digest] = node
+			walk(node.Manifests)
+			walk(node.Referrers)
+		}
+	}
+	walk(roots)
+	require.Len(t, roots, 3)
+	assert.Equal(t, index, roots[0].Digest)
+	assert.ElementsMatch(t, []string{index, oldIndex, locked}, []string{roots[0].Digest, roots[1].Digest, roots[2].Digest})
+	assert.Equal(t, []string{protectedTagged}, nodes[index].Protected)
+	assert.Equal(t, []string{protectedInIndex}, nodes[amd].Protected)
+	assert.Equal(t, []string{protectedInIndex}, nodes[arm].Protected)
+	assert.Equal(t, []string{protectedReferrer}, nodes[signature].Protected)
+	assert.Equal(t, []string{protectedReferrer}, nodes[lifecycle].Protected)
+	assert.Equal(t, []string{protectedLocked}, nodes[locked].Protected)
+	assert.Empty(t, nodes[oldIndex].Protected)
+	assert.Empty(t, nodes[old].Protected)
+
+	var out bytes.Buffer
+	printManifestTree(&out, registry.LoginURL()+"/hello", roots[:1])
+	assert.Equal(t, registry.LoginURL()+"/hello\n"+
+		"└── "+index+" [v1] OCI image index *protected: tagged*\n"+
+		"    ├── "+amd+" OCI image *protected: in a protected index*\n"+
+		"    │   └── "+lifecycle+" OCI artifact lifecycle annotation ("+lifecycleArtifactType+") end of life 2026-01-01 *protected: referrer*\n"+
+		"    ├── "+arm+" OCI image *protected: in a protected index*\n"+
+		"    └── "+signature+" OCI artifact signature (application/vnd.cncf.notary.signature) *protected: referrer*\n",
+		out.String())
+
+	roots, err = buildManifestTree(testCtx, acrClient, defaultPoolSize, "hello", amd)
+	require.NoError(t, err)
+	require.Len(t, roots, 1)
+	assert.Equal(t, amd, roots[0].Digest)
+	assert.Len(t, roots[0].Referrers, 1)
+
+	err = runCommand(registry, "manifest", "tree", "hello@"+index, "--output", "json", "--username", fakeregistry.Username, "--password", fakeregistry.Password)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,95 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats of the list and show commands, besides the default text output of each command.
+const (
+	outputText  = "text"
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+// validateOutput returns an error when the format is not one of the allowed ones.
+func validateOutput(format string, allowed ...string) error {
+	for _, value := range allowed {
+		if format == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid output format %q, allowed values are %s", format, strings.Join(allowed, ", "))
+}
+
+// writeTable writes the rows as columns aligned with spaces, under an upper case header.
+func writeTable(out io.Writer, header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(header, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// writeCSV writes the rows as CSV records, after the header.
+func writeCSV(out io.Writer, header []string, rows [][]string) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(out io.Writer, v any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// formatAge returns the time elapsed since the RFC 3339 timestamp in its largest unit, for example 3d, 5h or 10m. An
+// empty string is returned when the timestamp cannot be parsed.
+func formatAge(timestamp string, now time.Time) string {
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return ""
+	}
+	age := now.Sub(t)
+	switch {
+	case age >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(age/(24*time.Hour)))
+	case age >= time.Hour:
+		return fmt.Sprintf("%dh", int(age/time.Hour))
+	case age >= time.Minute:
+		return fmt.Sprintf("%dm", int(age/time.Minute))
+	default:
+		return fmt.Sprintf("%ds", max(int(age/time.Second), 0))
+	}
+}
+
+// formatSize returns the size in bytes in the largest binary unit it reaches, for example 512 B, 1.5 KiB or 3.2 GiB.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTP"[exp])
+}
@@ -0,0 +1,34 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatAge(t *testing.T) {
+	now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, "3d", formatAge("2024-03-01T10:00:00Z", now))
+	assert.Equal(t, "5h", formatAge("2024-03-04T07:00:00Z", now))
+	assert.Equal(t, "10m", formatAge("2024-03-04T11:50:00Z", now))
+	assert.Equal(t, "0s", formatAge("2024-03-05T00:00:00Z", now))
+	assert.Equal(t, "", formatAge("yesterday", now))
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "0 B", formatSize(0))
+	assert.Equal(t, "1023 B", formatSize(1023))
+	assert.Equal(t, "1.5 KiB", formatSize(1536))
+	assert.Equal(t, "1.0 MiB", formatSize(1<<20))
+	assert.Equal(t, "3.2 GiB", formatSize(3435973837))
+	assert.Equal(t, "2.0 PiB", formatSize(2<<50))
+}
+
+func TestValidateOutput(t *testing.T) {
+	assert.NoError(t, validateOutput(outputJSON, outputText, outputJSON))
+	assert.EqualError(t, validateOutput("yaml", outputText, outputJSON), `invalid output format "yaml", allowed values are text, json`)
+}
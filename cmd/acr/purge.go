@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"runtime"
@@ -18,6 +19,9 @@ import (
 	"github.com/Azure/acr-cli/acr"
 	"github.com/Azure/acr-cli/cmd/repository"
 	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/container/set"
+	"github.com/Azure/acr-cli/internal/report"
+	"github.com/Azure/acr-cli/internal/tag"
 	"github.com/Azure/acr-cli/internal/worker"
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/dlclark/regexp2"
@@ -37,6 +41,12 @@ const (
   - Delete tags older than 7 days that begin with "hello", keeping the latest 2
     	acr purge -r example --filter "hello-world:^hello.*" --ago 7d --keep 2
 
+  - Delete tags older than 7 days in the hello-world repository, but keep the latest 3 patch versions of each of the last 2 minor versions
+    	acr purge -r example --filter "hello-world:.*" --ago 7d --semver-keep-minors 2 --semver-keep-patches 3
+
+  - Delete all tags older than 7 days in all repositories, except "latest" and "stable"
+    	acr purge -r example --filter ".*:.*" --ago 7d --exclude ".*:^latest$" --exclude ".*:^stable$"
+
   - Delete tags containing "test" that are older than 5 days, then delete any dangling (untagged) manifests older than 5 days
 	acr purge -r example --filter "hello-world:\w*test\w*" --ago 5d --untagged 
 
@@ -50,6 +60,9 @@ const (
   - Clean up dangling manifests older than 3 days, keeping the 5 most recent
 	acr purge -r example --untagged-only --ago 3d --keep 5
 
+  - Delete the oldest untagged manifests until every repository fits in 50GiB
+	acr purge -r example --untagged-only --max-repo-size 50GiB
+
   ADVANCED OPTIONS:
   - Use custom authentication config
 	acr purge -r example --filter "hello-world:.*" --ago 1d --config C://Users/docker/config.json
@@ -60,8 +73,42 @@ const (
   - Use custom page size for repository queries
 	acr purge -r example --filter ".*:.*" --ago 7d --repository-page-size 50
 
+  - Write a JSON record for every tag and manifest considered, one per line
+	acr purge -r example --filter "hello-world:.*" --ago 7d --output ndjson
+
+  - Write the tags and manifests that would be deleted to a plan file, then delete exactly those after review
+	acr purge -r example --filter "hello-world:.*" --ago 7d --untagged --plan-out plan.json
+	acr purge apply -r example plan.json
+
+  - Record the progress in a checkpoint file, running the same command again resumes an interrupted purge
+	acr purge -r example --filter ".*:.*" --ago 7d --untagged --checkpoint purge-checkpoint.json
+
+  - Keep purging the other tags and repositories when a deletion fails, the failures are listed at the end
+	acr purge -r example --filter ".*:.*" --ago 7d --untagged --continue-on-error
+
+  - Delete the repositories left without any manifest or tag once purged
+	acr purge -r example --filter ".*:.*" --ago 7d --untagged --delete-empty-repositories
+
   - Include locked manifests/tags in deletion
 	acr purge -r example --filter ".*:.*" --ago 7d --include-locked
+
+  POLICY FILE EXAMPLES:
+  - Purge every repository with the first matching rule of a retention policy
+	acr purge -r example --policy retention.yaml
+
+	Policy file format (rules are evaluated in order, the first rule matching a repository is used):
+	version: v1
+	rules:
+	  - repository: "release/.*"
+	    tag: "^v.*"
+	    exclude: ["^v1[.]0[.]0$"]
+	    ago: 30d
+	    keep: 10
+	  - repository: ".*"
+	    tag: ".*"
+	    ago: 7d
+	    untagged: true
+	    include-locked: false
 	`
 	maxPoolSize = 32 // The max number of parallel delete requests recommended by ACR server
 	headerLink  = "Link"
@@ -71,9 +118,12 @@ var (
 	defaultPoolSize         = runtime.GOMAXPROCS(0)
 	defaultRepoPageSize     = int32(100)
 	repoPageSizeDescription = "Number of repositories queried at once"
-	concurrencyDescription  = fmt.Sprintf("Number of concurrent purge tasks. Range: [1 - %d]", maxPoolSize)
+	concurrencyDescription  = fmt.Sprintf("Number of concurrent purge tasks. Range: [1 - %d], or %q to adapt the concurrency to the throttling of the registry", maxPoolSize, concurrencyAuto)
 )
 
+// concurrencyAuto is the value of the --concurrency flag that adapts the concurrency while the command runs.
+const concurrencyAuto = "auto"
+
 // Default settings for regexp2
 const (
 	defaultRegexpMatchTimeoutSeconds int64 = 60
@@ -85,15 +135,27 @@ type purgeParameters struct {
 	*rootParameters
 	ago           string
 	keep          int
+	semverKeep    tag.SemverKeep
 	filters       []string
+	excludes      []string
 	filterTimeout int64
 	untagged      bool
 	untaggedOnly  bool
 	dryRun        bool
 	includeLocked bool
-	concurrency   int
+	concurrency   string
 	repoPageSize  int32
 	verbose       bool
+	policy        string
+	output        string
+	planOut       string
+	checkpoint    string
+	continueOnErr bool
+	deleteEmpty   bool
+	explain       bool
+	referrers     string
+	maxRepoSize   string
+	targetRegSize string
 }
 
 // newPurgeCmd defines the purge command.
@@ -104,16 +166,52 @@ func newPurgeCmd(rootParams *rootParameters) *cobra.Command {
 		Short:   "Delete images from a registry.",
 		Long:    newPurgeCmdLongMessage,
 		Example: purgeExampleMessage,
-		RunE: func(_ *cobra.Command, _ []string) error {
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			// With a machine-readable output the report is the only thing written to stdout, the human readable
+			// messages are written to stderr instead.
+			reporter, err := report.NewReporter(purgeParams.output, os.Stdout)
+			if err != nil {
+				return err
+			}
+			out := messageWriter(reporter)
+
+			// When a policy file is used every rule carries its own settings, the file is loaded and validated
+			// before authentication.
+			var policy *purgePolicy
+			if purgeParams.policy != "" {
+				var err error
+				policy, err = loadPurgePolicy(purgeParams.policy, purgeParams.filterTimeout)
+				if err != nil {
+					return err
+				}
+			}
+
+			if err := validateReferrersMode(purgeParams.referrers); err != nil {
+				return err
+			}
+			if policy == nil && purgeParams.referrers != referrersPreserve && !purgeParams.untagged && !purgeParams.untaggedOnly {
+				return fmt.Errorf("--referrers %s requires --untagged or --untagged-only", purgeParams.referrers)
+			}
+
+			// With a size budget only the oldest tags and manifests needed to fit in it are deleted, deleting tags does
+			// not free any storage unless their manifests are deleted too.
+			budget, err := parseSizeBudget(purgeParams.maxRepoSize, purgeParams.targetRegSize)
+			if err != nil {
+				return err
+			}
+			if budget != nil && !purgeParams.untagged && !purgeParams.untaggedOnly {
+				return fmt.Errorf("--max-repo-size and --target-registry-size require --untagged or --untagged-only")
+			}
+
 			// Validate flag combinations before authentication
 			// untagged-only mode: filter and ago are optional (skip validation)
 			// untagged mode and standard mode: both require filter and ago
-			if !purgeParams.untaggedOnly {
+			if policy == nil && !purgeParams.untaggedOnly {
 				if len(purgeParams.filters) == 0 {
 					return fmt.Errorf("--filter is required when not using --untagged-only")
 				}
-				if purgeParams.ago == "" {
-					return fmt.Errorf("--ago is required when not using --untagged-only")
+				if purgeParams.ago == "" && budget == nil {
+					return fmt.Errorf("--ago is required when not using --untagged-only or a size budget")
 				}
 			}
 
@@ -131,23 +229,91 @@ func newPurgeCmd(rootParams *rootParameters) *cobra.Command {
 			}
 
 			// This context is used for all the http requests.
-			ctx := context.Background()
+			ctx := cmd.Context()
 			registryName, err := purgeParams.GetRegistryName()
 			if err != nil {
 				return err
 			}
 			loginURL := api.LoginURL(registryName)
 			// An acrClient with authentication is generated, if the authentication cannot be resolved an error is returned.
-			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, purgeParams.username, purgeParams.password, purgeParams.configs)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, purgeParams.username, purgeParams.password, purgeParams.configs, purgeParams.transport)
+			if err != nil {
+				return err
+			}
+			// The number of concurrent requests will be ultimately limited by what repoParallelism is set to. This value
+			// is at most maxPoolSize, and at least 1. With --concurrency auto, the limiter adapts the concurrency and is
+			// told about every throttled request, including the retried ones.
+			repoParallelism, limiter, err := resolveConcurrency(purgeParams.concurrency)
 			if err != nil {
 				return err
 			}
+			retryPolicy := purgeParams.retryPolicy(purgeParams.verbose)
+			retryPolicy.Out = out
+			retryPolicy.OnThrottled = limiter.Throttled
+			acrClient.SetRetryPolicy(retryPolicy)
+
+			// Writing a plan never deletes anything, the plan holds what a dry run would delete.
+			var plan *purgePlan
+			if purgeParams.planOut != "" {
+				purgeParams.dryRun = true
+				plan = newPurgePlan(loginURL)
+				reporter.Subscribe(plan.add)
+			}
+
+			// With --referrers cascade the referrers of the deleted manifests are listed with the OCI referrers API.
+			var referrers *referrerPurger
+			if purgeParams.referrers != referrersPreserve {
+				orasClient, err := api.GetORASClientWithAuth(purgeParams.username, purgeParams.password, purgeParams.configs, purgeParams.transport)
+				if err != nil {
+					return err
+				}
+				referrers = newReferrerPurger(purgeParams.referrers, orasClient)
+			}
+
+			// With --explain every evaluated manifest is recorded with the reason it was kept or deleted.
+			var explanation *purgeExplanation
+			if purgeParams.explain {
+				explanation = newPurgeExplanation(loginURL)
+				reporter.Explain()
+				reporter.Subscribe(explanation.add)
+			}
+
+			// The checkpoint holds the progress of a previous run that did not complete, it is created when missing.
+			var checkpoint *purgeCheckpoint
+			if purgeParams.checkpoint != "" {
+				checkpoint, err = loadPurgeCheckpoint(purgeParams.checkpoint, loginURL)
+				if err != nil {
+					return err
+				}
+				if completed := checkpoint.completedCount(); completed > 0 {
+					fmt.Fprintf(out, "Resuming from checkpoint %s, %d repositories were already purged\n", purgeParams.checkpoint, completed)
+				}
+			}
+
+			// With --continue-on-error the failures are collected and reported at the end instead of stopping the purge.
+			var failures *report.Failures
+			if purgeParams.continueOnErr {
+				failures = report.NewFailures()
+			}
+
+			// With --delete-empty-repositories the repositories left without manifests and tags are deleted too.
+			var emptyRepos *emptyRepositories
+			if purgeParams.deleteEmpty {
+				emptyRepos = newEmptyRepositories()
+			}
 
 			// A map is used to collect the regex tags for every repository.
 			var tagFilters map[string]string
-			if purgeParams.untaggedOnly && len(purgeParams.filters) == 0 {
+			var allRepoNames []string
+			if policy != nil {
+				// The policy rules are matched against every repository in the registry.
+				allRepoNames, err = repository.GetAllRepositoryNames(ctx, acrClient.AutorestClient, purgeParams.repoPageSize)
+				if err != nil {
+					return err
+				}
+			} else if purgeParams.untaggedOnly && len(purgeParams.filters) == 0 {
 				// If untagged-only without filters, get all repositories
-				allRepoNames, err := repository.GetAllRepositoryNames(ctx, acrClient.AutorestClient, purgeParams.repoPageSize)
+				allRepoNames, err = repository.GetAllRepositoryNames(ctx, acrClient.AutorestClient, purgeParams.repoPageSize)
 				if err != nil {
 					return err
 				}
@@ -166,38 +332,124 @@ func newPurgeCmd(rootParams *rootParameters) *cobra.Command {
 
 			// A clarification message for --dry-run.
 			if purgeParams.dryRun {
-				fmt.Println("DRY RUN: The following output shows what WOULD be deleted if the purge command was executed. Nothing is deleted.")
+				fmt.Fprintln(out, "DRY RUN: The following output shows what WOULD be deleted if the purge command was executed. Nothing is deleted.")
 			}
 
-			// The number of concurrent requests will be ultimately limited by what repoParallelism is set to. This value
-			// is at most maxPoolSize, and at least 1.
-			repoParallelism := purgeParams.concurrency
-			if repoParallelism <= 0 {
-				repoParallelism = defaultPoolSize
-				fmt.Printf("Specified concurrency value invalid. Set to default value: %d \n", defaultPoolSize)
-			} else if repoParallelism > maxPoolSize {
-				repoParallelism = maxPoolSize
-				fmt.Printf("Specified concurrency value too large. Set to maximum value: %d \n", maxPoolSize)
+			// The exclude filters are matched against the same repositories as the tag filters or the policy rules.
+			excludeRepoNames := allRepoNames
+			if policy == nil {
+				excludeRepoNames = make([]string, 0, len(tagFilters))
+				for repoName := range tagFilters {
+					excludeRepoNames = append(excludeRepoNames, repoName)
+				}
+			}
+			excludeFilters, err := repository.CollectExcludeFilters(purgeParams.excludes, excludeRepoNames, purgeParams.filterTimeout)
+			if err != nil {
+				return err
 			}
 
-			// Combine flags for clarity - these are mutually exclusive
-			supportUntaggedCleanup := purgeParams.untagged || purgeParams.untaggedOnly
+			opts := purgeOptions{
+				out:             out,
+				loginURL:        loginURL,
+				repoParallelism: repoParallelism,
+				agoDuration:     agoDuration,
+				keep:            purgeParams.keep,
+				semverKeep:      purgeParams.semverKeep,
+				filterTimeout:   purgeParams.filterTimeout,
+				untagged:        purgeParams.untagged,
+				untaggedOnly:    purgeParams.untaggedOnly,
+				dryRun:          purgeParams.dryRun,
+				includeLocked:   purgeParams.includeLocked,
+				verbose:         purgeParams.verbose,
+				reporter:        reporter,
+				checkpoint:      checkpoint,
+				limiter:         limiter,
+				failures:        failures,
+				emptyRepos:      emptyRepos,
+				referrers:       referrers,
+				budget:          budget,
+			}
+			if err := budget.plan(ctx, acrClient, tagFilters, excludeFilters, opts); err != nil {
+				return err
+			}
 
-			deletedTagsCount, deletedManifestsCount, err := purge(ctx, acrClient, loginURL, repoParallelism, agoDuration, purgeParams.keep, purgeParams.filterTimeout, supportUntaggedCleanup, purgeParams.untaggedOnly, tagFilters, purgeParams.dryRun, purgeParams.includeLocked, purgeParams.verbose)
+			var deletedTagsCount, deletedManifestsCount, excludedTagsCount int
+			if policy != nil {
+				deletedTagsCount, deletedManifestsCount, excludedTagsCount, err = purgeWithPolicy(ctx, acrClient, policy, allRepoNames, excludeFilters, opts)
+			} else {
+				deletedTagsCount, deletedManifestsCount, excludedTagsCount, err = purge(ctx, acrClient, tagFilters, excludeFilters, opts)
+			}
 
 			if err != nil && !strings.Contains(err.Error(), "insufficient permissions") {
-				fmt.Printf("Failed to complete purge: %v \n", err)
+				fmt.Fprintf(out, "Failed to complete purge: %v \n", err)
+			}
+			// The bytes freed are measured from the sizes of the repositories once purged.
+			if !purgeParams.dryRun {
+				if measureErr := budget.measure(ctx, acrClient); measureErr != nil {
+					fmt.Fprintf(out, "Failed to measure the freed storage: %v\n", measureErr)
+				}
 			}
 
 			// After all repos have been purged the summary is printed.
 			if purgeParams.dryRun {
-				fmt.Printf("\nNumber of tags to be deleted: %d\n", deletedTagsCount)
-				fmt.Printf("Number of manifests to be deleted: %d\n", deletedManifestsCount)
+				fmt.Fprintf(out, "\nNumber of tags to be deleted: %d\n", deletedTagsCount)
+				fmt.Fprintf(out, "Number of manifests to be deleted: %d\n", deletedManifestsCount)
+				if emptyRepos != nil {
+					fmt.Fprintf(out, "Number of empty repositories to be deleted: %d\n", emptyRepos.Deleted())
+				}
 			} else {
-				fmt.Printf("\nNumber of deleted tags: %d\n", deletedTagsCount)
-				fmt.Printf("Number of deleted manifests: %d\n", deletedManifestsCount)
+				fmt.Fprintf(out, "\nNumber of deleted tags: %d\n", deletedTagsCount)
+				fmt.Fprintf(out, "Number of deleted manifests: %d\n", deletedManifestsCount)
+				if emptyRepos != nil {
+					fmt.Fprintf(out, "Number of deleted empty repositories: %d\n", emptyRepos.Deleted())
+				}
+			}
+			// Excluded tags are only reported when exclusions were requested, either through the flag or the policy.
+			if len(purgeParams.excludes) > 0 || excludedTagsCount > 0 {
+				fmt.Fprintf(out, "Number of excluded tags: %d\n", excludedTagsCount)
+			}
+			budget.Print(out, purgeParams.dryRun)
+			explanation.Print(out)
+			failedRestores := printFailedRestores(out, reporter)
+			printEffectiveConcurrency(out, limiter)
+			failures.Print(out)
+			if err == nil {
+				err = failures.Err()
+			}
+			if err == nil {
+				err = failedRestoresError(failedRestores)
 			}
 
+			// The checkpoint is only needed to resume an incomplete purge.
+			if err == nil {
+				err = checkpoint.remove()
+			}
+
+			// An incomplete plan is not written since applying it would only delete part of what the purge would.
+			if plan != nil && err == nil {
+				if err = writePurgePlan(purgeParams.planOut, plan); err == nil {
+					fmt.Fprintf(out, "Purge plan with %d items written to %s\n", len(plan.Items), purgeParams.planOut)
+				}
+			}
+
+			summary := report.Summary{
+				DryRun:              purgeParams.dryRun,
+				DeletedTags:         deletedTagsCount,
+				DeletedManifests:    deletedManifestsCount,
+				DeletedRepositories: emptyRepos.Deleted(),
+				ExcludedTags:        excludedTagsCount,
+				Failures:            failures.Len(),
+				FailedRestores:      failedRestores,
+				ProjectedBytes:      budget.Projected(),
+				FreedBytes:          budget.Freed(),
+			}
+			summary.EffectiveConcurrency, _, _ = limiter.Limits()
+			if err != nil {
+				summary.Error = err.Error()
+			}
+			if reportErr := reporter.Close(summary); reportErr != nil && err == nil {
+				return reportErr
+			}
 			return err
 		},
 	}
@@ -208,32 +460,93 @@ func newPurgeCmd(rootParams *rootParameters) *cobra.Command {
 	cmd.Flags().BoolVar(&purgeParams.includeLocked, "include-locked", false, "If the include-locked flag is set, locked manifests and tags (where deleteEnabled or writeEnabled is false) will be unlocked before deletion")
 	cmd.Flags().StringVar(&purgeParams.ago, "ago", "", "Delete tags or untagged manifests that were last updated before this duration. Format: [number]d[string] where the first number represents days and the string is in Go duration format (e.g. 2d3h6m selects images older than 2 days, 3 hours and 6 minutes). Required when deleting tags, optional with --untagged-only. Maximum duration is capped at 150 years to prevent overflow")
 	cmd.Flags().IntVar(&purgeParams.keep, "keep", 0, "Number of latest to-be-deleted items to keep. For tag deletion: keep the x most recent tags that would otherwise be deleted. For --untagged-only: keep the x most recent untagged manifests")
+	cmd.Flags().IntVar(&purgeParams.semverKeep.Minors, "semver-keep-minors", 0, "Number of latest major.minor versions whose tags are protected from deletion, based on semantic version parsing of the names of the tags matching --filter (an optional v prefix is allowed). Must be used together with --semver-keep-patches. Pre-release and non semantic version tags are not protected and follow the --ago and --keep rules")
+	cmd.Flags().IntVar(&purgeParams.semverKeep.Patches, "semver-keep-patches", 0, "Number of latest patch versions to protect from deletion within each of the major.minor versions selected by --semver-keep-minors")
 	cmd.Flags().StringArrayVarP(&purgeParams.filters, "filter", "f", nil, "Specify the repository and a regular expression filter for the tag name, if a tag matches the filter and is older than the duration specified in ago it will be deleted. Note: If backtracking is used in the regexp it's possible for the expression to run into an infinite loop. The default timeout is set to 1 minute for evaluation of any filter expression. Use the '--filter-timeout-seconds' option to set a different value.")
+	cmd.Flags().StringArrayVar(&purgeParams.excludes, "exclude", nil, "Specify the repository and a regular expression for tag names that must never be deleted, in the same <repository>:<tag regex> format as --filter. Tags that match --filter and --exclude are kept and reported as excluded in the summary. Can be specified multiple times and combined with --policy, in which case it applies on top of every rule")
 	cmd.Flags().StringArrayVarP(&purgeParams.configs, "config", "c", nil, "Authentication config paths (e.g. C://Users/docker/config.json)")
 	cmd.Flags().Int64Var(&purgeParams.filterTimeout, "filter-timeout-seconds", defaultRegexpMatchTimeoutSeconds, "This limits the evaluation of the regex filter, and will return a timeout error if this duration is exceeded during a single evaluation. If written incorrectly a regexp filter with backtracking can result in an infinite loop.")
-	cmd.Flags().IntVar(&purgeParams.concurrency, "concurrency", defaultPoolSize, concurrencyDescription)
+	cmd.Flags().StringVar(&purgeParams.concurrency, "concurrency", strconv.Itoa(defaultPoolSize), concurrencyDescription)
 	cmd.Flags().Int32Var(&purgeParams.repoPageSize, "repository-page-size", defaultRepoPageSize, repoPageSizeDescription)
-	cmd.Flags().BoolVar(&purgeParams.verbose, "verbose", false, "Enable verbose output including detailed repository names during ABAC token operations")
+	cmd.Flags().BoolVar(&purgeParams.verbose, "verbose", false, "Enable verbose output including detailed repository names during ABAC token operations and the retries of throttled or failed requests")
+	cmd.Flags().StringVar(&purgeParams.policy, "policy", "", "Path to a YAML retention policy file with an ordered list of rules. Each rule holds a repository expression, a tag expression, ago, keep, untagged, untagged-only and include-locked settings, and every repository is purged with the first rule that matches it. Cannot be combined with the flags it replaces")
+	cmd.Flags().StringVarP(&purgeParams.output, "output", "o", string(report.FormatText), "Output format: text, json or ndjson. With json or ndjson a record is written to stdout for every tag and manifest considered, with the action taken (deleted, skipped, kept, locked or failed) and the reason, followed by a summary. The human readable messages are written to stderr instead")
+	cmd.Flags().StringVar(&purgeParams.planOut, "plan-out", "", "Path of a JSON plan file to write the tags and manifests that would be deleted to, with the digests and last update times the decision was based on. Implies --dry-run. The plan can be reviewed and then applied with 'acr purge apply'")
+	cmd.Flags().StringVar(&purgeParams.checkpoint, "checkpoint", "", "Path of a checkpoint file recording the repositories that were purged and the last tag page processed in each of them. When the purge is interrupted, running it again with the same checkpoint skips the purged repositories and resumes from the last tag page. The file is removed once the purge completes")
+	cmd.Flags().BoolVar(&purgeParams.continueOnErr, "continue-on-error", false, "Keep purging when a tag, a manifest or a repository fails instead of stopping at the first error. The failures are listed in a table at the end and the command exits with an error if anything failed")
+	cmd.Flags().BoolVar(&purgeParams.deleteEmpty, "delete-empty-repositories", false, "Delete the repositories that are left without any manifest or tag once purged, so that they no longer show in the catalog. Locked repositories (where deleteEnabled or writeEnabled is false) are never deleted, even with --include-locked. With --dry-run the repositories that would be left empty are reported. Repositories are not part of the plans written with --plan-out")
+	cmd.Flags().BoolVar(&purgeParams.explain, "explain", false, "Record every manifest evaluated for deletion of untagged manifests, including the tagged ones, with the code of the reason it was kept or deleted (tagged, locked, newer-than-ago, keep, in-protected-index, referrer, untagged...) and the digest of the protecting index or subject. A table per repository with a breakdown by reason is printed at the end, and the code and parent are part of the --output json and ndjson records")
+	cmd.Flags().StringVar(&purgeParams.referrers, "referrers", referrersPreserve, "How the referrers of untagged manifests, such as signatures, SBOMs and attestations, are purged with --untagged or --untagged-only: preserve keeps them and relies on the registry to delete the referrers of deleted manifests, cascade deletes the referrers listed by the OCI referrers API before their subject, and orphans-only deletes the referrers whose subject no longer exists and that are older than --ago. Tagged referrers are always kept, and locked ones unless --include-locked is set")
+	cmd.Flags().StringVar(&purgeParams.maxRepoSize, "max-repo-size", "", "Size budget of every repository, such as 500MB or 50GiB. Only the oldest of the tags and untagged manifests that the purge would delete are deleted, until the repository fits in the budget. Requires --untagged or --untagged-only, --ago becomes optional. Every manifest is read so that the blobs shared between manifests are counted once, a blob shared with the repositories left out by --filter is counted as freed once it is not referenced in the purged repositories")
+	cmd.Flags().StringVar(&purgeParams.targetRegSize, "target-registry-size", "", "Size budget of all the repositories matched by --filter together, or of every repository with --untagged-only and no --filter, in the same format as --max-repo-size. The oldest tags and untagged manifests of all the repositories are deleted first, until they fit in the budget")
 	cmd.Flags().BoolP("help", "h", false, "Print usage")
+	cmd.AddCommand(newPurgeApplyCmd(rootParams))
 	// Make filter and ago conditionally required based on untagged-only flag
-	cmd.MarkFlagsOneRequired("filter", "untagged-only")
+	cmd.MarkFlagsOneRequired("filter", "untagged-only", "policy")
 	cmd.MarkFlagsMutuallyExclusive("untagged", "untagged-only")
+	cmd.MarkFlagsMutuallyExclusive("exclude", "untagged-only")
+	cmd.MarkFlagsMutuallyExclusive("checkpoint", "dry-run")
+	cmd.MarkFlagsMutuallyExclusive("checkpoint", "plan-out")
+	cmd.MarkFlagsRequiredTogether("semver-keep-minors", "semver-keep-patches")
+	cmd.MarkFlagsMutuallyExclusive("max-repo-size", "target-registry-size")
+	// The policy file replaces the per-run selection flags
+	for _, flagName := range []string{"filter", "ago", "keep", "semver-keep-minors", "semver-keep-patches", "untagged", "untagged-only", "include-locked", "max-repo-size", "target-registry-size"} {
+		cmd.MarkFlagsMutuallyExclusive("policy", flagName)
+	}
 	return cmd
 }
 
+// purgeOptions holds the settings a purge applies to every repository. The zero value of every field leaves the
+// matching feature off, in particular the reporter, checkpoint, limiter, failures, emptyRepos, referrers and budget
+// can be nil.
+type purgeOptions struct {
+	// out receives the human readable messages, stdout when it is nil.
+	out             io.Writer
+	loginURL        string
+	repoParallelism int
+	agoDuration     time.Duration
+	keep            int
+	semverKeep      tag.SemverKeep
+	filterTimeout   int64
+	// untagged deletes the untagged manifests once the tags are purged, untaggedOnly deletes them without purging
+	// the tags.
+	untagged      bool
+	untaggedOnly  bool
+	dryRun        bool
+	includeLocked bool
+	verbose       bool
+	reporter      *report.Reporter
+	checkpoint    *purgeCheckpoint
+	limiter       *worker.AdaptiveLimiter
+	failures      *report.Failures
+	emptyRepos    *emptyRepositories
+	referrers     *referrerPurger
+	budget        *sizeBudget
+}
+
+// writer returns the writer of the human readable messages.
+func (o purgeOptions) writer() io.Writer {
+	if o.out == nil {
+		return os.Stdout
+	}
+	return o.out
+}
+
+// messageWriter returns the writer of the human readable messages of a command, stdout unless the reporter writes a
+// machine-readable report to it, in which case stderr is used.
+func messageWriter(reporter *report.Reporter) io.Writer {
+	if reporter.Writes() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
 func purge(ctx context.Context,
 	acrClient api.AcrCLIClientInterface,
-	loginURL string,
-	repoParallelism int,
-	agoDuration time.Duration,
-	keep int,
-	filterTimeout int64,
-	removeUntaggedManifests bool,
-	untaggedOnly bool,
 	tagFilters map[string]string,
-	dryRun bool,
-	includeLocked bool,
-	verbose bool) (deletedTagsCount int, deletedManifestsCount int, err error) {
+	excludeFilters map[string]string,
+	opts purgeOptions) (deletedTagsCount int, deletedManifestsCount int, excludedTagsCount int, err error) {
+	out, checkpoint, failures := opts.writer(), opts.checkpoint, opts.failures
 
 	// Load ABAC batch size from environment variable
 	abacBatchSize := 10 // default
@@ -243,9 +556,14 @@ func purge(ctx context.Context,
 		}
 	}
 
-	// Collect all repository names into a sorted slice for deterministic batching and output.
+	// Collect all repository names into a sorted slice for deterministic batching and output. Repositories that a
+	// previous run already purged according to the checkpoint are left out.
 	repos := make([]string, 0, len(tagFilters))
 	for repoName := range tagFilters {
+		if checkpoint.repository(repoName).Completed {
+			fmt.Fprintf(out, "Skipping repository %s, it was already purged according to the checkpoint\n", repoName)
+			continue
+		}
 		repos = append(repos, repoName)
 	}
 	sort.Strings(repos)
@@ -269,102 +587,205 @@ func purge(ctx context.Context,
 		// request access for each repository before operating on it.
 		if acrClient.IsAbac() {
 			if err := acrClient.RefreshTokenForAbac(ctx, batch); err != nil {
-				return deletedTagsCount, deletedManifestsCount, fmt.Errorf("failed to refresh ABAC token for batch: %w", err)
+				if ctx.Err() == nil && failures.Collecting() {
+					// Without a token none of the repositories of the batch can be purged, the next batch is tried.
+					for _, repoName := range batch {
+						failures.Collect(repoName, "", "refresh ABAC token", err)
+					}
+					continue
+				}
+				return deletedTagsCount, deletedManifestsCount, excludedTagsCount, fmt.Errorf("failed to refresh ABAC token for batch: %w", err)
 			}
-			if verbose {
-				fmt.Printf("ABAC: Setting token scope for %d repositories: %v\n", len(batch), batch)
+			if opts.verbose {
+				fmt.Fprintf(out, "ABAC: Setting token scope for %d repositories: %v\n", len(batch), batch)
 			} else {
-				fmt.Printf("ABAC: Setting token scope for %d repositories\n", len(batch))
+				fmt.Fprintf(out, "ABAC: Setting token scope for %d repositories\n", len(batch))
 			}
 		}
 
 		// Process all repositories in this batch
 		for _, repoName := range batch {
 			tagRegex := tagFilters[repoName]
-			var singleDeletedTagsCount int
+			var singleDeletedTagsCount, singleExcludedTagsCount int
 			var manifestToTagsCountMap map[string]int
 
 			// Handle tag deletion based on mode
-			if untaggedOnly {
-				// Initialize empty map for untagged-only mode (no tag deletion)
+			if opts.untaggedOnly || checkpoint.repository(repoName).TagsDone {
+				// Initialize empty map for untagged-only mode, or when the tags were already purged by a previous run
+				// (no tag deletion)
 				manifestToTagsCountMap = make(map[string]int)
 			} else {
 				// Standard mode: delete matching tags first
-				singleDeletedTagsCount, manifestToTagsCountMap, err = purgeTags(ctx, acrClient, repoParallelism, loginURL, repoName, agoDuration, tagRegex, keep, filterTimeout, dryRun, includeLocked)
+				singleDeletedTagsCount, singleExcludedTagsCount, manifestToTagsCountMap, err = purgeTags(ctx, acrClient, repoName, tagRegex, excludeFilters[repoName], opts)
 				if err != nil {
+					if ctx.Err() != nil {
+						// The tags deleted before the interruption are still part of the summary.
+						deletedTagsCount += max(singleDeletedTagsCount, 0)
+						excludedTagsCount += singleExcludedTagsCount
+						remainingRepos := repos[i+indexOf(batch, repoName):]
+						return deletedTagsCount, deletedManifestsCount, excludedTagsCount,
+							formatInterruptedError(ctx, repoName, completedRepos, remainingRepos)
+					}
+					if failures.Collect(repoName, "", "purge tags", err) {
+						// The untagged manifests are left alone since the tags of the repository are unknown.
+						deletedTagsCount += max(singleDeletedTagsCount, 0)
+						excludedTagsCount += singleExcludedTagsCount
+						continue
+					}
 					if isUnauthorizedError(err) {
 						remainingRepos := repos[i+indexOf(batch, repoName):]
-						return deletedTagsCount, deletedManifestsCount,
+						return deletedTagsCount, deletedManifestsCount, excludedTagsCount,
 							formatPermissionError(repoName, "purge tags", completedRepos, remainingRepos)
 					}
-					return deletedTagsCount, deletedManifestsCount, fmt.Errorf("failed to purge tags: %w", err)
+					return deletedTagsCount, deletedManifestsCount, excludedTagsCount, fmt.Errorf("failed to purge tags: %w", err)
+				}
+				// The tags of a repository with failed deletions are purged again by the next run, from the first page.
+				if err := checkpoint.update(repoName, func(state *purgeCheckpointRepository) {
+					*state = purgeCheckpointRepository{TagsDone: !failures.Has(repoName)}
+				}); err != nil {
+					return deletedTagsCount, deletedManifestsCount, excludedTagsCount, err
 				}
 			}
 
 			singleDeletedManifestsCount := 0
 			// If the untagged flag is set or untagged-only mode is enabled, delete manifests
-			if removeUntaggedManifests {
-				singleDeletedManifestsCount, err = purgeDanglingManifests(ctx, acrClient, repoParallelism, loginURL, repoName, agoDuration, keep, manifestToTagsCountMap, dryRun, includeLocked)
+			if opts.untagged || opts.untaggedOnly {
+				singleDeletedManifestsCount, err = purgeDanglingManifests(ctx, acrClient, repoName, manifestToTagsCountMap, opts)
 				if err != nil {
+					if ctx.Err() != nil {
+						deletedTagsCount += singleDeletedTagsCount
+						deletedManifestsCount += max(singleDeletedManifestsCount, 0)
+						excludedTagsCount += singleExcludedTagsCount
+						remainingRepos := repos[i+indexOf(batch, repoName):]
+						return deletedTagsCount, deletedManifestsCount, excludedTagsCount,
+							formatInterruptedError(ctx, repoName, completedRepos, remainingRepos)
+					}
+					if failures.Collect(repoName, "", "purge manifests", err) {
+						deletedTagsCount += singleDeletedTagsCount
+						deletedManifestsCount += max(singleDeletedManifestsCount, 0)
+						excludedTagsCount += singleExcludedTagsCount
+						continue
+					}
 					if isUnauthorizedError(err) {
 						remainingRepos := repos[i+indexOf(batch, repoName):]
-						return deletedTagsCount, deletedManifestsCount,
+						return deletedTagsCount, deletedManifestsCount, excludedTagsCount,
 							formatPermissionError(repoName, "purge manifests", completedRepos, remainingRepos)
 					}
-					return deletedTagsCount, deletedManifestsCount, fmt.Errorf("failed to purge manifests: %w", err)
+					return deletedTagsCount, deletedManifestsCount, excludedTagsCount, fmt.Errorf("failed to purge manifests: %w", err)
+				}
+			}
+			// A repository is only deleted once everything in it was purged successfully.
+			if !failures.Has(repoName) {
+				if err := opts.emptyRepos.deleteIfEmpty(ctx, acrClient, out, opts.loginURL, repoName, singleDeletedTagsCount, singleDeletedManifestsCount, opts.dryRun, opts.reporter); err != nil {
+					deletedTagsCount += singleDeletedTagsCount
+					deletedManifestsCount += singleDeletedManifestsCount
+					excludedTagsCount += singleExcludedTagsCount
+					if ctx.Err() != nil {
+						remainingRepos := repos[i+indexOf(batch, repoName):]
+						return deletedTagsCount, deletedManifestsCount, excludedTagsCount,
+							formatInterruptedError(ctx, repoName, completedRepos, remainingRepos)
+					}
+					if failures.Collect(repoName, "", "delete empty repository", err) {
+						continue
+					}
+					return deletedTagsCount, deletedManifestsCount, excludedTagsCount, err
 				}
 			}
 			// After every repository is purged the counters are updated.
 			deletedTagsCount += singleDeletedTagsCount
 			deletedManifestsCount += singleDeletedManifestsCount
+			excludedTagsCount += singleExcludedTagsCount
 			completedRepos = append(completedRepos, repoName)
+			if err := checkpoint.update(repoName, func(state *purgeCheckpointRepository) {
+				state.Completed = !failures.Has(repoName)
+			}); err != nil {
+				return deletedTagsCount, deletedManifestsCount, excludedTagsCount, err
+			}
 		}
 	}
 
-	return deletedTagsCount, deletedManifestsCount, nil
+	return deletedTagsCount, deletedManifestsCount, excludedTagsCount, nil
 
 }
 
 // purgeTags deletes all tags that are older than the agoDuration value and that match the tagFilter string.
-func purgeTags(ctx context.Context, acrClient api.AcrCLIClientInterface, repoParallelism int, loginURL string, repoName string, agoDuration time.Duration, tagFilter string, keep int, regexpMatchTimeoutSeconds int64, dryRun bool, includeLocked bool) (int, map[string]int, error) {
-	if dryRun {
-		fmt.Printf("Would delete tags for repository: %s\n", repoName)
+// Tags protected by the semverKeep rule or matching the excludeFilter are never deleted, the second return value is the
+// number of tags that were kept because of the excludeFilter. Every tag matching the tagFilter is recorded in the reporter.
+// The cursor of every processed tag page is saved in the checkpoint, and the tags are resumed from the saved cursor.
+// When failures are collected the failed deletions are added to them and the other tags are still purged. With a size
+// budget only the tags of the manifests it selected are deleted.
+func purgeTags(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, tagFilter string, excludeFilter string, opts purgeOptions) (int, int, map[string]int, error) {
+	out, checkpoint, failures := opts.writer(), opts.checkpoint, opts.failures
+	if opts.dryRun {
+		fmt.Fprintf(out, "Would delete tags for repository: %s\n", repoName)
 	} else {
-		fmt.Printf("Deleting tags for repository: %s\n", repoName)
+		fmt.Fprintf(out, "Deleting tags for repository: %s\n", repoName)
 	}
 	manifestToTagsCountMap := make(map[string]int) // This map is used to keep track of how many tags would have been deleted per manifest.
 	timeToCompare := time.Now().UTC()
 	// Since the parseDuration function returns a negative duration, it is added to the current duration in order to be able to easily compare
 	// with the LastUpdatedTime attribute a tag has.
-	timeToCompare = timeToCompare.Add(agoDuration)
+	timeToCompare = timeToCompare.Add(opts.agoDuration)
 
-	tagRegex, err := repository.BuildRegexFilter(tagFilter, regexpMatchTimeoutSeconds)
+	tagRegex, err := repository.BuildRegexFilter(tagFilter, opts.filterTimeout)
 	if err != nil {
-		return -1, manifestToTagsCountMap, fmt.Errorf("failed to build Regex %s with error: %w", tagRegex, err)
+		return -1, 0, manifestToTagsCountMap, fmt.Errorf("failed to build Regex %s with error: %w", tagRegex, err)
+	}
+	// An empty excludeFilter means no tags are excluded, a nil regex is used in that case.
+	var excludeRegex *regexp2.Regexp
+	if excludeFilter != "" {
+		excludeRegex, err = repository.BuildRegexFilter(excludeFilter, opts.filterTimeout)
+		if err != nil {
+			return -1, 0, manifestToTagsCountMap, fmt.Errorf("failed to build exclude Regex %s with error: %w", excludeFilter, err)
+		}
+	}
+	// The semantic version protection needs to see every tag matching the filter, so it is computed before the tags
+	// are paged through for deletion.
+	var protectedTags set.Set[string]
+	if opts.semverKeep.Enabled() {
+		protectedTags, err = getSemverProtectedTags(ctx, acrClient, out, repoName, tagRegex, opts.semverKeep)
+		if err != nil {
+			return -1, 0, manifestToTagsCountMap, err
+		}
+	}
+	// Without a checkpoint, or for a repository it has no progress for, the tags are processed from the first page.
+	state := checkpoint.repository(repoName)
+	lastTag := state.LastTag
+	skippedTagsCount := state.KeptTags
+	if lastTag != "" {
+		fmt.Fprintf(out, "Resuming tag deletion for repository %s after tag %s\n", repoName, lastTag)
 	}
-	lastTag := ""
-	skippedTagsCount := 0
 	deletedTagsCount := 0
+	excludedTagsCount := 0
 	// In order to only have a limited amount of http requests, a purger is used that will start goroutines to delete tags.
-	purger := worker.NewPurger(repoParallelism, acrClient, loginURL, repoName, includeLocked)
+	purger := worker.NewPurger(opts.repoParallelism, acrClient, out, opts.loginURL, repoName, opts.includeLocked, opts.reporter, opts.limiter, failures)
 
 	// GetTagsToDelete will return an empty lastTag when there are no more tags.
 	for {
-		tagsToDelete, newLastTag, newSkippedTagsCount, err := getTagsToDelete(ctx, acrClient, repoName, tagRegex, timeToCompare, lastTag, keep, skippedTagsCount, includeLocked)
+		tagsToDelete, newLastTag, newSkippedTagsCount, pageExcludedTagsCount, err := getTagsToDelete(ctx, acrClient, repoName, tagRegex, excludeRegex, protectedTags, timeToCompare, lastTag, skippedTagsCount, opts)
 		if err != nil {
-			return -1, manifestToTagsCountMap, err
+			if failures.Collecting() {
+				// The tags deleted from the previous pages are still part of the summary.
+				return deletedTagsCount, excludedTagsCount, manifestToTagsCountMap, err
+			}
+			return -1, excludedTagsCount, manifestToTagsCountMap, err
 		}
 		lastTag = newLastTag
 		skippedTagsCount = newSkippedTagsCount
+		excludedTagsCount += pageExcludedTagsCount
+		tagsToDelete = opts.budget.filterTags(repoName, tagsToDelete, opts.reporter)
 		if len(tagsToDelete) > 0 {
 			for _, tag := range tagsToDelete {
 				manifestToTagsCountMap[*tag.Digest]++
-				if dryRun {
-					fmt.Printf("Would delete: %s/%s:%s\n", loginURL, repoName, *tag.Name)
+				if opts.dryRun {
+					fmt.Fprintf(out, "Would delete: %s/%s:%s\n", opts.loginURL, repoName, *tag.Name)
+					record := report.TagRecord(repoName, tag, report.ActionDeleted, "")
+					record.DryRun = true
+					opts.reporter.Record(record)
 				}
 			}
 
-			if dryRun {
+			if opts.dryRun {
 				deletedTagsCount += len(tagsToDelete)
 				if len(lastTag) == 0 {
 					break
@@ -374,16 +795,30 @@ func purgeTags(ctx context.Context, acrClient api.AcrCLIClientInterface, repoPar
 
 			count, purgeErr := purger.PurgeTags(ctx, tagsToDelete)
 			if purgeErr != nil {
-				return -1, manifestToTagsCountMap, purgeErr
+				if ctx.Err() != nil {
+					// The tags deleted before the interruption are returned along with the error.
+					return deletedTagsCount + count, excludedTagsCount, manifestToTagsCountMap, purgeErr
+				}
+				return -1, excludedTagsCount, manifestToTagsCountMap, purgeErr
 			}
 			deletedTagsCount += count
 		}
 		if len(lastTag) == 0 {
 			break
 		}
+		// The cursor of the last page is not saved, the caller marks the tags of the repository as done instead.
+		if err := checkpoint.update(repoName, func(state *purgeCheckpointRepository) {
+			state.LastTag = lastTag
+			state.KeptTags = skippedTagsCount
+		}); err != nil {
+			return -1, excludedTagsCount, manifestToTagsCountMap, err
+		}
 	}
 
-	return deletedTagsCount, manifestToTagsCountMap, nil
+	if excludedTagsCount > 0 {
+		fmt.Fprintf(out, "Excluded %d tags in repository: %s\n", excludedTagsCount, repoName)
+	}
+	return deletedTagsCount, excludedTagsCount, manifestToTagsCountMap, nil
 }
 
 // parseDuration analog to time.ParseDuration() but with days added.
@@ -409,7 +844,7 @@ func parseDuration(ago string) (time.Duration, error) {
 	if days > maxDays {
 		days = maxDays
 		capped = true
-		fmt.Printf("Warning: ago value exceeds maximum duration of %d years, capping to %d years\n", maxAgoDurationYears, maxAgoDurationYears)
+		fmt.Fprintf(os.Stderr, "Warning: ago value exceeds maximum duration of %d years, capping to %d years\n", maxAgoDurationYears, maxAgoDurationYears)
 	}
 	// The number of days gets converted to hours.
 	duration := time.Duration(days) * 24 * time.Hour
@@ -424,7 +859,7 @@ func parseDuration(ago string) (time.Duration, error) {
 				}
 				// Cap at max duration and continue
 				agoDuration = time.Duration(maxDays) * 24 * time.Hour
-				fmt.Printf("Warning: ago value exceeds maximum duration of %d years, capping to %d years\n", maxAgoDurationYears, maxAgoDurationYears)
+				fmt.Fprintf(os.Stderr, "Warning: ago value exceeds maximum duration of %d years, capping to %d years\n", maxAgoDurationYears, maxAgoDurationYears)
 			} else {
 				return time.Duration(0), err
 			}
@@ -435,7 +870,7 @@ func parseDuration(ago string) (time.Duration, error) {
 			agoDuration = maxDuration
 			if originalDays <= maxDays && !capped {
 				// Only print warning if we haven't already printed one for days
-				fmt.Printf("Warning: ago value exceeds maximum duration of %d years, capping to %d years\n", maxAgoDurationYears, maxAgoDurationYears)
+				fmt.Fprintf(os.Stderr, "Warning: ago value exceeds maximum duration of %d years, capping to %d years\n", maxAgoDurationYears, maxAgoDurationYears)
 			}
 		}
 		// Make sure the combined duration doesn't exceed max
@@ -449,27 +884,34 @@ func parseDuration(ago string) (time.Duration, error) {
 
 // getTagsToDelete gets all tags that should be deleted according to the ago flag and the filter flag, this will at most return 100 tags,
 // returns a pointer to a slice that contains the tags that will be deleted, the last tag obtained through the AcrListTags function
-// and an error in case it occurred, the fourth return value contains a map that is used to determine how many tags a manifest has
+// and an error in case it occurred, the fourth return value contains a map that is used to determine how many tags a manifest has.
+// Tags in protectedTags or matching the exclude filter are never returned and do not count towards keep, the number of tags that
+// matched the exclude filter in this page is returned as well. A nil exclude filter excludes nothing. The tags that match the
+// filter but are not returned are recorded in the reporter together with the reason they are kept. The keep, includeLocked
+// and reporter settings of opts are used.
 func getTagsToDelete(ctx context.Context,
 	acrClient api.AcrCLIClientInterface,
 	repoName string,
 	filter *regexp2.Regexp,
+	exclude *regexp2.Regexp,
+	protectedTags set.Set[string],
 	timeToCompare time.Time,
 	lastTag string,
-	keep int,
 	skippedTagsCount int,
-	includeLocked bool) ([]acr.TagAttributesBase, string, int, error) {
+	opts purgeOptions) ([]acr.TagAttributesBase, string, int, int, error) {
+	keep, reporter := opts.keep, opts.reporter
 
 	var matches bool
 	var lastUpdateTime time.Time
+	excludedTagsCount := 0
 	resultTags, err := acrClient.GetAcrTags(ctx, repoName, "timedesc", lastTag)
 	if err != nil {
 		if resultTags != nil && resultTags.Response.Response != nil && resultTags.StatusCode == http.StatusNotFound {
-			fmt.Printf("%s repository not found\n", repoName)
-			return nil, "", skippedTagsCount, nil
+			fmt.Fprintf(opts.writer(), "%s repository not found\n", repoName)
+			return nil, "", skippedTagsCount, 0, nil
 		}
 		// An empty lastTag string is returned so there will not be any tag purged.
-		return nil, "", skippedTagsCount, err
+		return nil, "", skippedTagsCount, excludedTagsCount, err
 	}
 	newLastTag := ""
 	if resultTags != nil && resultTags.TagsAttributes != nil && len(*resultTags.TagsAttributes) > 0 {
@@ -479,29 +921,50 @@ func getTagsToDelete(ctx context.Context,
 			matches, err = filter.MatchString(*tag.Name)
 			if err != nil {
 				// The only error that regexp2 will return is a timeout error
-				return nil, "", skippedTagsCount, err
+				return nil, "", skippedTagsCount, excludedTagsCount, err
 			}
 			if !matches {
 				// If a tag does not match the regex then it not added to the list no matter the LastUpdateTime
 				continue
 			}
+			if exclude != nil {
+				excluded, err := exclude.MatchString(*tag.Name)
+				if err != nil {
+					return nil, "", skippedTagsCount, excludedTagsCount, err
+				}
+				if excluded {
+					// Excluded tags are kept no matter the LastUpdateTime
+					excludedTagsCount++
+					reporter.Record(report.TagRecord(repoName, tag, report.ActionKept, "matches an exclude filter"))
+					continue
+				}
+			}
+			if protectedTags.Contains(*tag.Name) {
+				// Protected tags are kept no matter the LastUpdateTime
+				reporter.Record(report.TagRecord(repoName, tag, report.ActionKept, "protected by semantic version keep"))
+				continue
+			}
 			lastUpdateTime, err = time.Parse(time.RFC3339Nano, *tag.LastUpdateTime)
 			if err != nil {
-				return nil, "", skippedTagsCount, err
+				return nil, "", skippedTagsCount, excludedTagsCount, err
 			}
 			// If a tag did match the regex filter, is older than the specified duration and can be deleted then it is returned
 			// as a tag to delete. With --include-locked flag, locked tags are also eligible for deletion.
 			if lastUpdateTime.Before(timeToCompare) {
-				if includeLocked || (*(*tag.ChangeableAttributes).DeleteEnabled && *(*tag.ChangeableAttributes).WriteEnabled) {
+				if opts.includeLocked || (*(*tag.ChangeableAttributes).DeleteEnabled && *(*tag.ChangeableAttributes).WriteEnabled) {
 					tagsEligibleForDeletion = append(tagsEligibleForDeletion, tag)
+				} else {
+					reporter.Record(report.TagRecord(repoName, tag, report.ActionLocked, "tag is locked"))
 				}
+			} else {
+				reporter.Record(report.TagRecord(repoName, tag, report.ActionKept, "newer than the ago duration"))
 			}
 		}
 
 		newLastTag = repository.GetLastTagFromResponse(resultTags)
 		// No more tags to keep
 		if keep == 0 || skippedTagsCount == keep {
-			return tagsEligibleForDeletion, newLastTag, skippedTagsCount, nil
+			return tagsEligibleForDeletion, newLastTag, skippedTagsCount, excludedTagsCount, nil
 		}
 
 		tagsToDelete := []acr.TagAttributesBase{}
@@ -509,14 +972,55 @@ func getTagsToDelete(ctx context.Context,
 			// Keep at least the configured number of tags
 			if skippedTagsCount < keep {
 				skippedTagsCount++
+				reporter.Record(report.TagRecord(repoName, tag, report.ActionKept, "kept by keep"))
 			} else {
 				tagsToDelete = append(tagsToDelete, tag)
 			}
 		}
-		return tagsToDelete, newLastTag, skippedTagsCount, nil
+		return tagsToDelete, newLastTag, skippedTagsCount, excludedTagsCount, nil
 	}
 	// In case there are no more tags return empty string as lastTag so that the purgeTags function stops
-	return nil, "", skippedTagsCount, nil
+	return nil, "", skippedTagsCount, 0, nil
+}
+
+// getSemverProtectedTags pages through all the tags of a repository and returns the ones protected by the semverKeep rule.
+// Only the tags matching the filter are considered, so the latest versions are the latest of the tags that the purge
+// would otherwise delete.
+func getSemverProtectedTags(ctx context.Context, acrClient api.AcrCLIClientInterface, out io.Writer, repoName string, filter *regexp2.Regexp, semverKeep tag.SemverKeep) (set.Set[string], error) {
+	var tagNames []string
+	lastTag := ""
+	for {
+		resultTags, err := acrClient.GetAcrTags(ctx, repoName, "timedesc", lastTag)
+		if err != nil {
+			if resultTags != nil && resultTags.Response.Response != nil && resultTags.StatusCode == http.StatusNotFound {
+				// The repository not found case is reported by getTagsToDelete.
+				return set.New[string](), nil
+			}
+			return nil, err
+		}
+		if resultTags == nil || resultTags.TagsAttributes == nil || len(*resultTags.TagsAttributes) == 0 {
+			break
+		}
+		for _, tag := range *resultTags.TagsAttributes {
+			matches, err := filter.MatchString(*tag.Name)
+			if err != nil {
+				// The only error regexp2 can throw is a timeout error
+				return nil, err
+			}
+			if matches {
+				tagNames = append(tagNames, *tag.Name)
+			}
+		}
+		lastTag = repository.GetLastTagFromResponse(resultTags)
+		if len(lastTag) == 0 {
+			break
+		}
+	}
+	protectedTags := semverKeep.ProtectedTags(tagNames)
+	if len(protectedTags) > 0 {
+		fmt.Fprintf(out, "Protecting %d semantic version tags in repository: %s\n", len(protectedTags), repoName)
+	}
+	return protectedTags, nil
 }
 
 // sortManifestsByTime sorts manifests by LastUpdateTime (newest first) with consistent
@@ -579,54 +1083,148 @@ func sortManifestsByTime(manifests []acr.ManifestAttributesBase) {
 	})
 }
 
+// keepMostRecent returns the manifests without the keep most recent ones, which are recorded as kept. The manifests
+// are sorted by sortManifestsByTime when keep is set.
+func keepMostRecent(repoName string, manifests []acr.ManifestAttributesBase, keep int, reporter *report.Reporter) []acr.ManifestAttributesBase {
+	if keep <= 0 {
+		return manifests
+	}
+	// Sort manifests by LastUpdateTime (newest first) using sortManifestsByTime
+	sortManifestsByTime(manifests)
+	keptManifests := manifests
+	if len(manifests) > keep {
+		keptManifests = manifests[:keep]
+	}
+	for _, manifest := range keptManifests {
+		reporter.Record(report.ManifestRecord(repoName, manifest, report.ActionKept, "kept by keep").WithCode(report.ReasonKeep, ""))
+	}
+	if len(manifests) <= keep {
+		// If there are fewer manifests than the keep count, delete nothing
+		return nil
+	}
+	// Keep only manifests after the 'keep' count
+	return manifests[keep:]
+}
+
 // purgeDanglingManifests deletes all manifests that do not have any tags associated with them.
 // except the ones that are referenced by a multiarch manifest or that have subject.
-// If keep is provided, the specified number of most recent manifests will be kept.
-func purgeDanglingManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, repoParallelism int, loginURL string, repoName string, agoDuration time.Duration, keep int, manifestToTagsCountMap map[string]int, dryRun bool, includeLocked bool) (int, error) {
-	if dryRun {
-		fmt.Printf("Would delete manifests for repository: %s\n", repoName)
+// If keep is provided, the specified number of most recent manifests will be kept. When failures are collected the failed
+// deletions are added to them and the other manifests are still purged. The referrers found by the referrer purger are
+// deleted before the manifests and counted with them. With a size budget only the manifests it selected are deleted.
+func purgeDanglingManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, manifestToTagsCountMap map[string]int, opts purgeOptions) (int, error) {
+	out, loginURL, reporter, budget := opts.writer(), opts.loginURL, opts.reporter, opts.budget
+	if opts.dryRun {
+		fmt.Fprintf(out, "Would delete manifests for repository: %s\n", repoName)
 	} else {
-		fmt.Printf("Deleting manifests for repository: %s\n", repoName)
+		fmt.Fprintf(out, "Deleting manifests for repository: %s\n", repoName)
 	}
-	timeToCompare := time.Now().UTC().Add(agoDuration)
+	timeToCompare := time.Now().UTC().Add(opts.agoDuration)
 	// Contrary to getTagsToDelete, getManifestsToDelete gets all the Manifests at once, this was done because if there is a manifest that has no
 	// tag but is referenced by a multiarch manifest that has tags then it should not be deleted. Or if a manifest has no tag, but it has subject,
 	// then it should not be deleted.
-	manifestsToDelete, err := repository.GetUntaggedManifests(ctx, repoParallelism, acrClient, repoName, false, manifestToTagsCountMap, dryRun, includeLocked, &timeToCompare)
+	manifestsToDelete, err := repository.GetUntaggedManifests(ctx, opts.repoParallelism, acrClient, out, repoName, false, manifestToTagsCountMap, opts.dryRun, opts.includeLocked, &timeToCompare, reporter, opts.limiter)
 	if err != nil {
 		return -1, err
 	}
 
-	// Apply keep logic if keep parameter is provided
-	if keep > 0 {
-		if len(manifestsToDelete) <= keep {
-			// If there are fewer manifests than the keep count, delete nothing
-			return 0, nil
-		}
-		// Sort manifests by LastUpdateTime (newest first) using sortManifestsByTime
-		sortManifestsByTime(manifestsToDelete)
-		// Keep only manifests after the 'keep' count
-		manifestsToDelete = manifestsToDelete[keep:]
+	// Apply keep logic if keep parameter is provided. With a size budget the manifests kept by keep were left out when
+	// the budget was planned, the budget keeps them.
+	if budget == nil {
+		manifestsToDelete = keepMostRecent(repoName, manifestsToDelete, opts.keep, reporter)
+	}
+	manifestsToDelete = budget.filterManifests(repoName, manifestsToDelete, reporter)
+
+	// With --referrers cascade or orphans-only the referrers are deleted before the manifests, the deepest ones first.
+	referrerLevels, referrerParents, err := opts.referrers.referrersToDelete(ctx, acrClient, opts.repoParallelism, loginURL, repoName, manifestsToDelete, timeToCompare, opts.includeLocked, reporter)
+	if err != nil {
+		return -1, err
 	}
 
 	// If dryRun is set to true then no manifests will be deleted, but the number of manifests that would be deleted is returned. Additionally,
 	// the manifests that would be deleted are printed to the console. We also need to account for the manifests that would be deleted from the tag
 	// filtering first as that would influence the untagged manifests that would be deleted.
-	if dryRun {
+	if opts.dryRun {
+		deletedReferrersCount := 0
+		for _, level := range referrerLevels {
+			for _, manifest := range level {
+				fmt.Fprintf(out, "Would delete: %s/%s@%s, referrer of %s\n", loginURL, repoName, *manifest.Digest, referrerParents[*manifest.Digest])
+				record := report.ManifestRecord(repoName, manifest, report.ActionDeleted, "").WithCode(report.ReasonSubjectDeleted, referrerParents[*manifest.Digest])
+				record.DryRun = true
+				reporter.Record(record)
+				deletedReferrersCount++
+			}
+		}
 		for _, manifest := range manifestsToDelete {
-			fmt.Printf("Would delete: %s/%s@%s\n", loginURL, repoName, *manifest.Digest)
+			fmt.Fprintf(out, "Would delete: %s/%s@%s\n", loginURL, repoName, *manifest.Digest)
+			record := report.ManifestRecord(repoName, manifest, report.ActionDeleted, "").WithCode(report.ReasonUntagged, "")
+			record.DryRun = true
+			reporter.Record(record)
 		}
-		return len(manifestsToDelete), nil
+		return deletedReferrersCount + len(manifestsToDelete), nil
 	}
+
+	// The levels of referrers are deleted one after the other, a referrer being deleted before its subject. When a
+	// referrer is not deleted, with --continue-on-error, its subject is kept and so are the subjects of the subject.
+	deletedReferrersCount := 0
+	keptBy := make(map[string]string)
+	if len(referrerLevels) > 0 {
+		cascadePurger := worker.NewPurger(opts.repoParallelism, acrClient, out, loginURL, repoName, opts.includeLocked, reporter, opts.limiter, opts.failures)
+		cascadePurger.SetReason(report.ReasonSubjectDeleted, referrerParents)
+		for _, level := range referrerLevels {
+			level = keepSubjectsOfFailedReferrers(out, loginURL, repoName, level, keptBy, referrerParents, reporter)
+			levelDeletedCount, purgeErr := cascadePurger.PurgeManifests(ctx, level)
+			deletedReferrersCount += levelDeletedCount
+			if purgeErr != nil {
+				if ctx.Err() != nil {
+					return deletedReferrersCount, purgeErr
+				}
+				return -1, purgeErr
+			}
+			for _, manifest := range level {
+				if cascadePurger.NotDeleted(*manifest.Digest) {
+					keptBy[referrerParents[*manifest.Digest]] = *manifest.Digest
+				}
+			}
+		}
+		manifestsToDelete = keepSubjectsOfFailedReferrers(out, loginURL, repoName, manifestsToDelete, keptBy, referrerParents, reporter)
+	}
+
 	// In order to only have a limited amount of http requests, a purger is used that will start goroutines to delete manifests.
-	purger := worker.NewPurger(repoParallelism, acrClient, loginURL, repoName, includeLocked)
+	purger := worker.NewPurger(opts.repoParallelism, acrClient, out, loginURL, repoName, opts.includeLocked, reporter, opts.limiter, opts.failures)
 	deletedManifestsCount, purgeErr := purger.PurgeManifests(ctx, manifestsToDelete)
+	deletedManifestsCount += deletedReferrersCount
 	if purgeErr != nil {
+		if ctx.Err() != nil {
+			return deletedManifestsCount, purgeErr
+		}
 		return -1, purgeErr
 	}
 	return deletedManifestsCount, nil
 }
 
+// keepSubjectsOfFailedReferrers returns the manifests that are not in keptBy, which holds the digest of a referrer that
+// was not deleted by the digest of its subject. The other manifests are recorded as kept, and their own subject is
+// kept in turn.
+func keepSubjectsOfFailedReferrers(out io.Writer, loginURL string, repoName string, manifests []acr.ManifestAttributesBase, keptBy map[string]string, referrerParents map[string]string, reporter *report.Reporter) []acr.ManifestAttributesBase {
+	if len(keptBy) == 0 {
+		return manifests
+	}
+	var remaining []acr.ManifestAttributesBase
+	for _, manifest := range manifests {
+		referrer, ok := keptBy[*manifest.Digest]
+		if !ok {
+			remaining = append(remaining, manifest)
+			continue
+		}
+		fmt.Fprintf(out, "Kept %s/%s@%s, its referrer %s was not deleted\n", loginURL, repoName, *manifest.Digest, referrer)
+		reporter.Record(report.ManifestRecord(repoName, manifest, report.ActionKept, "referrer was not deleted").WithCode(report.ReasonReferrerFailed, referrer))
+		if subject, ok := referrerParents[*manifest.Digest]; ok {
+			keptBy[subject] = *manifest.Digest
+		}
+	}
+	return remaining
+}
+
 // isUnauthorizedError checks if an error is an HTTP 401 Unauthorized response.
 // This is used to detect permission failures on ABAC-enabled registries where
 // the user may have access to some repositories but not others.
@@ -665,6 +1263,80 @@ func formatPermissionError(failedRepo string, operation string, completedRepos [
 	return errors.New(sb.String())
 }
 
+// resolveConcurrency returns the pool size for the value of a --concurrency flag, at most maxPoolSize and at least 1.
+// For concurrencyAuto an adaptive limiter starting at the default pool size is returned as well.
+func resolveConcurrency(value string) (int, *worker.AdaptiveLimiter, error) {
+	if value == concurrencyAuto {
+		return maxPoolSize, worker.NewAdaptiveLimiter(defaultPoolSize, maxPoolSize), nil
+	}
+	poolSize, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid concurrency %q, it should be a number or %s", value, concurrencyAuto)
+	}
+	if poolSize <= 0 {
+		poolSize = defaultPoolSize
+		fmt.Fprintf(os.Stderr, "Specified concurrency value invalid. Set to default value: %d \n", defaultPoolSize)
+	} else if poolSize > maxPoolSize {
+		poolSize = maxPoolSize
+		fmt.Fprintf(os.Stderr, "Specified concurrency value too large. Set to maximum value: %d \n", maxPoolSize)
+	}
+	return poolSize, nil, nil
+}
+
+// printFailedRestores prints and returns the number of items whose lock could not be restored after an
+// --include-locked deletion did not happen, nothing is printed when there is none.
+func printFailedRestores(out io.Writer, reporter *report.Reporter) int {
+	failedRestores := reporter.Count(report.ActionRestoreFailed)
+	if failedRestores > 0 {
+		fmt.Fprintf(out, "Number of locks that could not be restored: %d\n", failedRestores)
+	}
+	return failedRestores
+}
+
+// failedRestoresError returns an error when locks could not be restored, since the items are left unprotected the
+// command fails so that it does not go unnoticed.
+func failedRestoresError(failedRestores int) error {
+	if failedRestores == 0 {
+		return nil
+	}
+	return fmt.Errorf("failed to restore the lock of %d tags or manifests that were not deleted", failedRestores)
+}
+
+// printEffectiveConcurrency prints the concurrency the adaptive limiter ended with and the range it moved in, nothing
+// is printed when the concurrency was not adaptive.
+func printEffectiveConcurrency(out io.Writer, limiter *worker.AdaptiveLimiter) {
+	if limiter == nil {
+		return
+	}
+	current, lowest, highest := limiter.Limits()
+	fmt.Fprintf(out, "Effective concurrency: %d (adapted between %d and %d)\n", current, lowest, highest)
+}
+
+// formatInterruptedError builds the error returned when a purge is interrupted or times out. Like
+// formatPermissionError it reports which repositories were already purged and which remain untouched.
+func formatInterruptedError(ctx context.Context, interruptedRepo string, completedRepos []string, remainingRepos []string) error {
+	var sb strings.Builder
+	cause := "interrupted"
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		cause = "timed out"
+	}
+	sb.WriteString(fmt.Sprintf("purge %s while purging repository %q", cause, interruptedRepo))
+
+	if len(completedRepos) > 0 {
+		sb.WriteString(fmt.Sprintf("\n  Completed repositories (%d): %s", len(completedRepos), strings.Join(completedRepos, ", ")))
+	} else {
+		sb.WriteString("\n  Completed repositories: none")
+	}
+
+	// remainingRepos includes the interrupted repo, it was only partially purged
+	if len(remainingRepos) > 1 {
+		sb.WriteString(fmt.Sprintf("\n  Remaining repositories not yet processed (%d): %s", len(remainingRepos)-1, strings.Join(remainingRepos[1:], ", ")))
+	}
+
+	sb.WriteString("\n  Hint: run the same command again to purge the remaining items, with --checkpoint to resume where it stopped")
+	return errors.New(sb.String())
+}
+
 // indexOf returns the index of s in slice, or 0 if not found.
 func indexOf(slice []string, s string) int {
 	for i, v := range slice {
@@ -0,0 +1,135 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const purgeCheckpointVersionV1 = "v1"
+
+// purgeCheckpoint records the progress of a purge so that a rerun can skip the repositories that were already purged
+// and continue the others from the last tag page that was processed. Every update is written to the file right away.
+// A nil *purgeCheckpoint is valid and records nothing.
+type purgeCheckpoint struct {
+	Version      string                                `json:"version"`
+	Registry     string                                `json:"registry"`
+	Repositories map[string]*purgeCheckpointRepository `json:"repositories"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// purgeCheckpointRepository is the progress of a single repository. LastTag is the cursor of the last tag page that
+// was processed and KeptTags the number of tags kept by --keep up to that page.
+type purgeCheckpointRepository struct {
+	LastTag   string `json:"lastTag,omitempty"`
+	KeptTags  int    `json:"keptTags,omitempty"`
+	TagsDone  bool   `json:"tagsDone,omitempty"`
+	Completed bool   `json:"completed,omitempty"`
+}
+
+// loadPurgeCheckpoint reads the checkpoint file from the specified path, a new checkpoint is returned when the file does
+// not exist yet. A checkpoint can only be used for the registry it was created for.
+func loadPurgeCheckpoint(filePath string, loginURL string) (*purgeCheckpoint, error) {
+	checkpoint := &purgeCheckpoint{
+		Version:      purgeCheckpointVersionV1,
+		Registry:     loginURL,
+		Repositories: make(map[string]*purgeCheckpointRepository),
+		path:         filePath,
+	}
+	content, err := os.ReadFile(filePath) // #nosec G304 -- filePath is the user-provided checkpoint file, this is expected CLI behavior
+	if err != nil {
+		if os.IsNotExist(err) {
+			return checkpoint, nil
+		}
+		return nil, errors.Wrap(err, "error reading the checkpoint file")
+	}
+	if err := json.Unmarshal(content, checkpoint); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling the checkpoint file")
+	}
+	if checkpoint.Version != purgeCheckpointVersionV1 {
+		return nil, fmt.Errorf("version is required in the checkpoint file and should be %s", purgeCheckpointVersionV1)
+	}
+	if checkpoint.Registry != loginURL {
+		return nil, fmt.Errorf("the checkpoint file was created for registry %s and cannot be used for %s", checkpoint.Registry, loginURL)
+	}
+	if checkpoint.Repositories == nil {
+		checkpoint.Repositories = make(map[string]*purgeCheckpointRepository)
+	}
+	return checkpoint, nil
+}
+
+// repository returns a copy of the progress of the repository, the zero value when nothing was recorded.
+func (c *purgeCheckpoint) repository(repoName string) purgeCheckpointRepository {
+	if c == nil {
+		return purgeCheckpointRepository{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if state, ok := c.Repositories[repoName]; ok {
+		return *state
+	}
+	return purgeCheckpointRepository{}
+}
+
+// completedCount returns the number of repositories that were completely purged.
+func (c *purgeCheckpoint) completedCount() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := 0
+	for _, state := range c.Repositories {
+		if state.Completed {
+			count++
+		}
+	}
+	return count
+}
+
+// update applies fn to the progress of the repository and writes the checkpoint file.
+func (c *purgeCheckpoint) update(repoName string, fn func(state *purgeCheckpointRepository)) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.Repositories[repoName]
+	if !ok {
+		state = &purgeCheckpointRepository{}
+		c.Repositories[repoName] = state
+	}
+	fn(state)
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error marshalling the checkpoint")
+	}
+	// The file is replaced atomically so that an interruption never leaves a truncated checkpoint behind.
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0600); err != nil {
+		return errors.Wrap(err, "error writing the checkpoint file")
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return errors.Wrap(err, "error writing the checkpoint file")
+	}
+	return nil
+}
+
+// remove deletes the checkpoint file once the purge is complete.
+func (c *purgeCheckpoint) remove() error {
+	if c == nil {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "error removing the checkpoint file")
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestPurgeCheckpointFile checks that the checkpoint file is written on every update and can be read back.
+func TestPurgeCheckpointFile(t *testing.T) {
+	t.Run("NewWhenMissing", func(t *testing.T) {
+		assert := assert.New(t)
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+		checkpoint, err := loadPurgeCheckpoint(path, testLoginURL)
+		assert.Nil(err, "Error should be nil")
+		assert.Equal(0, checkpoint.completedCount())
+		assert.Equal(purgeCheckpointRepository{}, checkpoint.repository(testRepo))
+		_, err = os.Stat(path)
+		assert.True(os.IsNotExist(err), "The checkpoint file should only be written on the first update")
+	})
+
+	t.Run("UpdateAndLoad", func(t *testing.T) {
+		assert := assert.New(t)
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+		checkpoint, err := loadPurgeCheckpoint(path, testLoginURL)
+		assert.Nil(err, "Error should be nil")
+		assert.Nil(checkpoint.update(testRepo, func(state *purgeCheckpointRepository) {
+			state.LastTag = "v2"
+			state.KeptTags = 1
+		}))
+		assert.Nil(checkpoint.update("other", func(state *purgeCheckpointRepository) {
+			state.Completed = true
+		}))
+		loaded, err := loadPurgeCheckpoint(path, testLoginURL)
+		assert.Nil(err, "Error should be nil")
+		assert.Equal(purgeCheckpointRepository{LastTag: "v2", KeptTags: 1}, loaded.repository(testRepo))
+		assert.Equal(1, loaded.completedCount())
+		assert.Nil(loaded.remove())
+		_, err = os.Stat(path)
+		assert.True(os.IsNotExist(err), "The checkpoint file should be removed")
+	})
+
+	t.Run("OtherRegistry", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+		checkpoint, _ := loadPurgeCheckpoint(path, "other.azurecr.io")
+		assert.Nil(t, checkpoint.update(testRepo, func(state *purgeCheckpointRepository) { state.Completed = true }))
+		_, err := loadPurgeCheckpoint(path, testLoginURL)
+		assert.NotNil(t, err, "Error should not be nil")
+	})
+
+	t.Run("InvalidVersion", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+		if err := os.WriteFile(path, []byte(`{"version": "v0", "registry": "`+testLoginURL+`"}`), 0600); err != nil {
+			t.Fatalf("Failed to write checkpoint file: %v", err)
+		}
+		_, err := loadPurgeCheckpoint(path, testLoginURL)
+		assert.NotNil(t, err, "Error should not be nil")
+	})
+
+	t.Run("NilCheckpoint", func(t *testing.T) {
+		var checkpoint *purgeCheckpoint
+		assert.Nil(t, checkpoint.update(testRepo, func(state *purgeCheckpointRepository) { state.Completed = true }))
+		assert.Equal(t, purgeCheckpointRepository{}, checkpoint.repository(testRepo))
+		assert.Nil(t, checkpoint.remove())
+	})
+}
+
+// TestPurgeCheckpointResume checks that an interrupted purge records its progress and that a rerun continues from it.
+func TestPurgeCheckpointResume(t *testing.T) {
+	newCheckpoint := func(t *testing.T) *purgeCheckpoint {
+		checkpoint, err := loadPurgeCheckpoint(filepath.Join(t.TempDir(), "checkpoint.json"), testLoginURL)
+		if err != nil {
+			t.Fatalf("Failed to load checkpoint: %v", err)
+		}
+		return checkpoint
+	}
+
+	// When the second tag page fails the cursor of the first page is kept, together with the tags kept so far.
+	t.Run("CursorIsSaved", func(t *testing.T) {
+		assert := assert.New(t)
+		checkpoint := newCheckpoint(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResultWithNext, nil).Once()
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "latest").Return(nil, errors.New("interrupted")).Once()
+		_, _, _, err := purgeTags(testCtx, mockClient, testRepo, "[\\s\\S]*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, keep: 1, filterTimeout: 60, checkpoint: checkpoint})
+		assert.NotNil(err, "Error should not be nil")
+		assert.Equal(purgeCheckpointRepository{LastTag: "latest", KeptTags: 1}, checkpoint.repository(testRepo))
+		mockClient.AssertExpectations(t)
+	})
+
+	// The rerun starts after the saved cursor and only keeps the tags that were not kept before.
+	t.Run("TagsAreResumed", func(t *testing.T) {
+		assert := assert.New(t)
+		checkpoint := newCheckpoint(t)
+		assert.Nil(checkpoint.update(testRepo, func(state *purgeCheckpointRepository) {
+			state.LastTag = "latest"
+			state.KeptTags = 1
+		}))
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "latest").Return(FourTagsResult, nil).Once()
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "v.*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, keep: 2, filterTimeout: 60, dryRun: true, checkpoint: checkpoint})
+		assert.Nil(err, "Error should be nil")
+		assert.Equal(3, deletedTags, "Number of tags to be deleted should be 3")
+		mockClient.AssertExpectations(t)
+	})
+
+	// Repositories that were completed are skipped and the others are marked as completed once purged.
+	t.Run("CompletedRepositoriesAreSkipped", func(t *testing.T) {
+		assert := assert.New(t)
+		checkpoint := newCheckpoint(t)
+		assert.Nil(checkpoint.update("done", func(state *purgeCheckpointRepository) { state.Completed = true }))
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("IsAbac").Return(false)
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(notFoundTagResponse, errors.New("testRepo not found")).Once()
+		_, _, _, err := purge(testCtx, mockClient, map[string]string{"done": "[\\s\\S]*", testRepo: "[\\s\\S]*"}, nil, purgeOptions{loginURL: testLoginURL, repoParallelism: defaultPoolSize, agoDuration: -24 * time.Hour, filterTimeout: 60, checkpoint: checkpoint})
+		assert.Nil(err, "Error should be nil")
+		assert.Equal(purgeCheckpointRepository{TagsDone: true, Completed: true}, checkpoint.repository(testRepo))
+		assert.Equal(2, checkpoint.completedCount())
+		mockClient.AssertExpectations(t)
+	})
+
+	// When the tags of a repository were purged only the untagged manifests are left to clean up.
+	t.Run("TagsDoneAreSkipped", func(t *testing.T) {
+		assert := assert.New(t)
+		checkpoint := newCheckpoint(t)
+		assert.Nil(checkpoint.update(testRepo, func(state *purgeCheckpointRepository) { state.TagsDone = true }))
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("IsAbac").Return(false)
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(notFoundManifestResponse, errors.New("testRepo not found")).Once()
+		_, _, _, err := purge(testCtx, mockClient, map[string]string{testRepo: "[\\s\\S]*"}, nil, purgeOptions{loginURL: testLoginURL, repoParallelism: defaultPoolSize, agoDuration: -24 * time.Hour, filterTimeout: 60, untagged: true, checkpoint: checkpoint})
+		assert.Nil(err, "Error should be nil")
+		assert.True(checkpoint.repository(testRepo).Completed)
+		mockClient.AssertExpectations(t)
+	})
+}
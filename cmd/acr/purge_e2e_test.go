@@ -0,0 +1,136 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runCommand runs the acr command line with the arguments against the fake registry.
+func runCommand(registry *fakeregistry.Registry, args ...string) error {
+	args = append(args, "--registry", registry.LoginURL())
+	cmd := newRootCmd(args, registry.Transport())
+	cmd.SetArgs(args)
+	return cmd.ExecuteContext(context.Background())
+}
+
+// TestPurgeEndToEnd runs the purge command against the fake registry, through the HTTP clients, pagination and
+// authentication used against ACR.
+func TestPurgeEndToEnd(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+
+	t.Run("TagsAndUntaggedManifests", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		// More tags than fit in a page, so the Link header is followed.
+		for i := 0; i < 120; i++ {
+			tagName := fmt.Sprintf("v%03d", i)
+			digest := registry.PushImage("hello", tagName, tagName)
+			registry.SetLastUpdateTime("hello", tagName, old)
+			registry.SetLastUpdateTime("hello", digest, old)
+		}
+		latest := registry.PushImage("hello", "latest", "latest")
+		referrer := registry.PushReferrer("hello", latest, "application/vnd.example.sbom", nil)
+		child := registry.PushImage("hello", "child")
+		registry.SetLastUpdateTime("hello", child, old)
+		registry.PushIndex("hello", []string{child}, "multi")
+		dangling := registry.PushImage("hello", "dangling")
+		registry.SetLastUpdateTime("hello", dangling, old)
+		registry.Lock("hello", "v000")
+
+		err := runCommand(registry, "purge", "--username", fakeregistry.Username, "--password", fakeregistry.Password,
+			"--filter", "hello:v.*", "--ago", "1d", "--untagged")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"latest", "multi", "v000"}, registry.Tags("hello"))
+		manifests := registry.Manifests("hello")
+		assert.Contains(t, manifests, latest)
+		assert.Contains(t, manifests, referrer)
+		assert.Contains(t, manifests, child)
+		assert.NotContains(t, manifests, dangling)
+		// The latest, referrer, child, index and locked v000 manifests are left.
+		assert.Len(t, manifests, 5)
+	})
+
+	t.Run("ABAC", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		registry.SetABAC(true)
+		for _, repoName := range []string{"hello", "world"} {
+			registry.PushImage(repoName, "old", "old")
+			registry.SetLastUpdateTime(repoName, "old", old)
+			registry.PushImage(repoName, "new", "new")
+		}
+
+		err := runCommand(registry, "purge", "--password", registry.RefreshToken(), "--filter", ".*:.*", "--ago", "1d")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"new"}, registry.Tags("hello"))
+		assert.Equal(t, []string{"new"}, registry.Tags("world"))
+	})
+
+	t.Run("DeleteEmptyRepositories", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		for _, repoName := range []string{"empty", "locked", "kept"} {
+			digest := registry.PushImage(repoName, "old", "old")
+			registry.SetLastUpdateTime(repoName, "old", old)
+			registry.SetLastUpdateTime(repoName, digest, old)
+		}
+		registry.PushImage("kept", "new", "new")
+		require.NoError(t, runCommand(registry, "repository", "update", "locked", "--delete-enabled=false",
+			"--username", fakeregistry.Username, "--password", fakeregistry.Password))
+
+		args := []string{"purge", "--username", fakeregistry.Username, "--password", fakeregistry.Password,
+			"--filter", ".*:.*", "--ago", "1d", "--untagged", "--delete-empty-repositories"}
+		require.NoError(t, runCommand(registry, append(args, "--dry-run")...))
+		assert.Equal(t, []string{"empty", "kept", "locked"}, registry.Repositories())
+
+		require.NoError(t, runCommand(registry, args...))
+		assert.Equal(t, []string{"kept", "locked"}, registry.Repositories())
+		assert.Equal(t, []string{"new"}, registry.Tags("kept"))
+	})
+
+	t.Run("ContinueOnError", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		for _, tagName := range []string{"a", "b"} {
+			registry.PushImage("hello", tagName, tagName)
+			registry.SetLastUpdateTime("hello", tagName, old)
+		}
+		registry.InjectFault(fakeregistry.Fault{Method: http.MethodDelete, Path: "/_tags/a", StatusCode: http.StatusInternalServerError})
+
+		err := runCommand(registry, "purge", "--username", fakeregistry.Username, "--password", fakeregistry.Password,
+			"--filter", "hello:.*", "--ago", "1d", "--continue-on-error", "--max-attempts", "1")
+		assert.EqualError(t, err, "1 operation failed")
+		assert.Equal(t, []string{"a"}, registry.Tags("hello"))
+	})
+
+	t.Run("IncludeLockedRestoresLocks", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		for _, tagName := range []string{"a", "b"} {
+			registry.PushImage("hello", tagName, tagName)
+			registry.SetLastUpdateTime("hello", tagName, old)
+			registry.Lock("hello", tagName)
+		}
+		registry.InjectFault(fakeregistry.Fault{Method: http.MethodDelete, Path: "/_tags/", StatusCode: http.StatusInternalServerError})
+		// The second update of b, which restores its lock, fails.
+		updates := 0
+		registry.InjectFault(fakeregistry.Fault{Method: http.MethodPatch, Path: "/_tags/b", StatusCode: http.StatusInternalServerError, Match: func(*http.Request) bool {
+			updates++
+			return updates == 2
+		}})
+
+		err := runCommand(registry, "purge", "--username", fakeregistry.Username, "--password", fakeregistry.Password,
+			"--filter", "hello:.*", "--ago", "1d", "--include-locked", "--continue-on-error", "--max-attempts", "1", "--concurrency", "1")
+		assert.EqualError(t, err, "2 operations failed")
+		assert.Equal(t, []string{"a", "b"}, registry.Tags("hello"))
+		assert.True(t, registry.Locked("hello", "a"))
+		assert.False(t, registry.Locked("hello", "b"))
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/report"
+	"github.com/pkg/errors"
+)
+
+// emptyRepositories deletes the repositories that a purge left without any manifest or tag, see
+// --delete-empty-repositories, and counts them. A nil *emptyRepositories is valid and deletes nothing. The repositories
+// are purged one after the other so it is not safe for concurrent use.
+type emptyRepositories struct {
+	deleted int
+}
+
+// newEmptyRepositories returns an emptyRepositories that has not deleted anything yet.
+func newEmptyRepositories() *emptyRepositories {
+	return &emptyRepositories{}
+}
+
+// Deleted returns the number of repositories that were deleted, or would be deleted in a dry run.
+func (e *emptyRepositories) Deleted() int {
+	if e == nil {
+		return 0
+	}
+	return e.deleted
+}
+
+// deleteIfEmpty deletes the repository when it has no manifest and no tag left. In a dry run nothing was deleted by
+// the purge, so the repository is considered empty when the tags and manifests that would be deleted are all it
+// holds. Locked repositories, whose deleteEnabled or writeEnabled attribute is false, are never deleted. What is
+// deleted or skipped is written to out.
+func (e *emptyRepositories) deleteIfEmpty(ctx context.Context, acrClient api.AcrCLIClientInterface, out io.Writer, loginURL string, repoName string, deletedTagsCount int, deletedManifestsCount int, dryRun bool, reporter *report.Reporter) error {
+	if e == nil {
+		return nil
+	}
+	attributes, err := acrClient.GetAcrRepositoryAttributes(ctx, repoName)
+	if err != nil {
+		if attributes != nil && attributes.Response.Response != nil && attributes.StatusCode == http.StatusNotFound {
+			// The repository is already gone, for example because another purge deleted it.
+			return nil
+		}
+		return errors.Wrapf(err, "failed to get the attributes of repository %s", repoName)
+	}
+	manifestCount, tagCount := int(int32Value(attributes.ManifestCount)), int(int32Value(attributes.TagCount))
+	if dryRun {
+		manifestCount -= deletedManifestsCount
+		tagCount -= deletedTagsCount
+	}
+	if manifestCount > 0 || tagCount > 0 {
+		return nil
+	}
+	if changeable := attributes.ChangeableAttributes; changeable != nil &&
+		((changeable.DeleteEnabled != nil && !*changeable.DeleteEnabled) || (changeable.WriteEnabled != nil && !*changeable.WriteEnabled)) {
+		fmt.Fprintf(out, "Skipping empty repository %s/%s, it is locked\n", loginURL, repoName)
+		reporter.Record(report.Record{Repository: repoName, Action: report.ActionLocked, Reason: "empty repository is locked", DryRun: dryRun})
+		return nil
+	}
+	if dryRun {
+		fmt.Fprintf(out, "Would delete empty repository: %s/%s\n", loginURL, repoName)
+	} else {
+		deleted, err := acrClient.DeleteAcrRepository(ctx, repoName)
+		if err != nil {
+			if deleted != nil && deleted.Response.Response != nil && deleted.StatusCode == http.StatusNotFound {
+				return nil
+			}
+			return errors.Wrapf(err, "failed to delete empty repository %s", repoName)
+		}
+		fmt.Fprintf(out, "Deleted empty repository %s/%s\n", loginURL, repoName)
+	}
+	reporter.Record(report.Record{Repository: repoName, Action: report.ActionDeleted, Reason: "empty repository", DryRun: dryRun})
+	e.deleted++
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDeleteIfEmpty(t *testing.T) {
+	emptyAttributes := func(deleteEnabled bool) *acr.RepositoryAttributes {
+		attributes := testRepositoryAttributes()
+		manifestCount, tagCount := int32(0), int32(0)
+		attributes.ManifestCount, attributes.TagCount = &manifestCount, &tagCount
+		attributes.ChangeableAttributes.DeleteEnabled = &deleteEnabled
+		return attributes
+	}
+
+	t.Run("EmptyRepositoryIsDeleted", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositoryAttributes", mock.Anything, testRepo).Return(emptyAttributes(true), nil).Once()
+		mockClient.On("DeleteAcrRepository", mock.Anything, testRepo).Return(&acr.DeletedRepository{}, nil).Once()
+		emptyRepos := newEmptyRepositories()
+		err := emptyRepos.deleteIfEmpty(testCtx, mockClient, os.Stdout, testLoginURL, testRepo, 2, 3, false, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, emptyRepos.Deleted())
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("RepositoryWithManifestsIsKept", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositoryAttributes", mock.Anything, testRepo).Return(testRepositoryAttributes(), nil).Once()
+		emptyRepos := newEmptyRepositories()
+		err := emptyRepos.deleteIfEmpty(testCtx, mockClient, os.Stdout, testLoginURL, testRepo, 0, 0, false, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, emptyRepos.Deleted())
+		mockClient.AssertNotCalled(t, "DeleteAcrRepository", mock.Anything, mock.Anything)
+	})
+
+	t.Run("LockedRepositoryIsKept", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositoryAttributes", mock.Anything, testRepo).Return(emptyAttributes(false), nil).Once()
+		emptyRepos := newEmptyRepositories()
+		err := emptyRepos.deleteIfEmpty(testCtx, mockClient, os.Stdout, testLoginURL, testRepo, 0, 0, false, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, emptyRepos.Deleted())
+		mockClient.AssertNotCalled(t, "DeleteAcrRepository", mock.Anything, mock.Anything)
+	})
+
+	t.Run("DryRunCountsWhatWouldBeDeleted", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		// The repository holds 3 manifests and 2 tags, the dry run would delete all of them.
+		mockClient.On("GetAcrRepositoryAttributes", mock.Anything, testRepo).Return(testRepositoryAttributes(), nil).Twice()
+		emptyRepos := newEmptyRepositories()
+		err := emptyRepos.deleteIfEmpty(testCtx, mockClient, os.Stdout, testLoginURL, testRepo, 2, 3, true, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, emptyRepos.Deleted(), "the locked repository would not be deleted")
+
+		unlocked := testRepositoryAttributes()
+		unlocked.ChangeableAttributes = nil
+		mockClient = &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositoryAttributes", mock.Anything, testRepo).Return(unlocked, nil).Twice()
+		err = emptyRepos.deleteIfEmpty(testCtx, mockClient, os.Stdout, testLoginURL, testRepo, 2, 2, true, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, emptyRepos.Deleted(), "a manifest would be left")
+		err = emptyRepos.deleteIfEmpty(testCtx, mockClient, os.Stdout, testLoginURL, testRepo, 2, 3, true, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, emptyRepos.Deleted())
+		mockClient.AssertNotCalled(t, "DeleteAcrRepository", mock.Anything, mock.Anything)
+	})
+
+	t.Run("NotFoundIsIgnored", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		notFound := &acr.RepositoryAttributes{Response: autorest.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}}
+		mockClient.On("GetAcrRepositoryAttributes", mock.Anything, testRepo).Return(notFound, errors.New("not found")).Once()
+		err := newEmptyRepositories().deleteIfEmpty(testCtx, mockClient, os.Stdout, testLoginURL, testRepo, 0, 0, false, nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("DeleteError", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositoryAttributes", mock.Anything, testRepo).Return(emptyAttributes(true), nil).Once()
+		mockClient.On("DeleteAcrRepository", mock.Anything, testRepo).Return(nil, errors.New("boom")).Once()
+		err := newEmptyRepositories().deleteIfEmpty(testCtx, mockClient, os.Stdout, testLoginURL, testRepo, 0, 0, false, nil)
+		assert.EqualError(t, err, "failed to delete empty repository bar: boom")
+	})
+
+	t.Run("NilDeletesNothing", func(t *testing.T) {
+		var emptyRepos *emptyRepositories
+		err := emptyRepos.deleteIfEmpty(testCtx, &mocks.AcrCLIClientInterface{}, os.Stdout, testLoginURL, testRepo, 0, 0, false, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, emptyRepos.Deleted())
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Azure/acr-cli/internal/report"
+)
+
+// purgeExplanation collects the manifest records of a purge with --explain, to print why every manifest was kept or
+// deleted per repository. A nil *purgeExplanation is valid and prints nothing. It is subscribed to the reporter, which
+// serializes the calls to add.
+type purgeExplanation struct {
+	loginURL     string
+	repositories map[string][]report.Record
+	// indexes holds the index of the record of every manifest in its repository, by repository and digest.
+	indexes map[string]map[string]int
+}
+
+// newPurgeExplanation returns an empty purgeExplanation for the registry.
+func newPurgeExplanation(loginURL string) *purgeExplanation {
+	return &purgeExplanation{
+		loginURL:     loginURL,
+		repositories: make(map[string][]report.Record),
+		indexes:      make(map[string]map[string]int),
+	}
+}
+
+// add is subscribed to the purge reporter, only the records of manifests are kept. A manifest can be recorded several
+// times, for example a referrer kept by the cleanup of untagged manifests and then deleted with its subject, in which
+// case the last record replaces the previous ones.
+func (e *purgeExplanation) add(record report.Record) {
+	if record.Tag != "" || record.Digest == "" {
+		return
+	}
+	indexes, ok := e.indexes[record.Repository]
+	if !ok {
+		indexes = make(map[string]int)
+		e.indexes[record.Repository] = indexes
+	}
+	if i, ok := indexes[record.Digest]; ok {
+		e.repositories[record.Repository][i] = record
+		return
+	}
+	indexes[record.Digest] = len(e.repositories[record.Repository])
+	e.repositories[record.Repository] = append(e.repositories[record.Repository], record)
+}
+
+// Print writes a table of the manifests of every repository with the action, the reason code and the protecting
+// parent, followed by the number of manifests per action and reason code.
+func (e *purgeExplanation) Print(out io.Writer) {
+	if e == nil {
+		return
+	}
+	repoNames := make([]string, 0, len(e.repositories))
+	for repoName := range e.repositories {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	for _, repoName := range repoNames {
+		records := append([]report.Record{}, e.repositories[repoName]...)
+		sort.SliceStable(records, func(i, j int) bool {
+			if records[i].Action != records[j].Action {
+				return records[i].Action < records[j].Action
+			}
+			return records[i].Code < records[j].Code
+		})
+		rows := make([][]string, 0, len(records))
+		for _, record := range records {
+			rows = append(rows, []string{record.Digest, string(record.Action), valueOrDash(string(record.Code)), valueOrDash(record.Parent)})
+		}
+		fmt.Fprintf(out, "\nExplanation for %s/%s:\n", e.loginURL, repoName)
+		_ = writeTable(out, []string{"digest", "action", "reason", "parent"}, rows)
+		fmt.Fprintf(out, "Breakdown: %s\n", explanationBreakdown(records))
+	}
+}
+
+// explanationBreakdown returns the number of records per action and reason code, such as
+// "2 deleted (2 untagged), 3 kept (1 tagged, 2 in-protected-index)". The records must be sorted by action and code.
+func explanationBreakdown(records []report.Record) string {
+	var actions []string
+	for i := 0; i < len(records); {
+		action := records[i].Action
+		var codes []string
+		count := 0
+		for i < len(records) && records[i].Action == action {
+			code := records[i].Code
+			codeCount := 0
+			for i < len(records) && records[i].Action == action && records[i].Code == code {
+				codeCount++
+				i++
+			}
+			codes = append(codes, fmt.Sprintf("%d %s", codeCount, valueOrDash(string(code))))
+			count += codeCount
+		}
+		actions = append(actions, fmt.Sprintf("%d %s (%s)", count, action, strings.Join(codes, ", ")))
+	}
+	return strings.Join(actions, ", ")
+}
+
+// valueOrDash returns "-" for empty values, so that table columns are never empty.
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
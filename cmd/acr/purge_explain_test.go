@@ -0,0 +1,85 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/repository"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/report"
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeExplanationPrint(t *testing.T) {
+	explanation := newPurgeExplanation(testLoginURL)
+	explanation.add(report.Record{Repository: testRepo, Tag: "v1", Action: report.ActionDeleted})
+	explanation.add(report.Record{Repository: testRepo, Digest: "sha256:child", Action: report.ActionKept, Code: report.ReasonInIndex, Parent: "sha256:index"})
+	explanation.add(report.Record{Repository: testRepo, Digest: "sha256:old", Action: report.ActionDeleted, Code: report.ReasonUntagged})
+	explanation.add(report.Record{Repository: testRepo, Digest: "sha256:index", Action: report.ActionKept, Code: report.ReasonTagged})
+	explanation.add(report.Record{Repository: testRepo, Digest: "sha256:other", Action: report.ActionKept, Code: report.ReasonInIndex, Parent: "sha256:index"})
+
+	var out bytes.Buffer
+	explanation.Print(&out)
+	assert.Equal(t, "\nExplanation for foo.azurecr.io/bar:\n"+
+		"DIGEST        ACTION   REASON              PARENT\n"+
+		"sha256:old    deleted  untagged            -\n"+
+		"sha256:child  kept     in-protected-index  sha256:index\n"+
+		"sha256:other  kept     in-protected-index  sha256:index\n"+
+		"sha256:index  kept     tagged              -\n"+
+		"Breakdown: 1 deleted (1 untagged), 3 kept (2 in-protected-index, 1 tagged)\n", out.String())
+
+	out.Reset()
+	(*purgeExplanation)(nil).Print(&out)
+	assert.Empty(t, out.String())
+}
+
+func TestPurgeExplainEndToEnd(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	registry := fakeregistry.New(t)
+	child := registry.PushImage("hello", "child")
+	index := registry.PushIndex("hello", []string{child}, "v1")
+	signature := registry.PushReferrer("hello", index, "application/vnd.cncf.notary.signature", nil)
+	dangling := registry.PushImage("hello", "dangling")
+	recent := registry.PushImage("hello", "recent")
+	locked := registry.PushImage("hello", "locked")
+	registry.Lock("hello", locked)
+	for _, digest := range []string{child, index, signature, dangling, locked} {
+		registry.SetLastUpdateTime("hello", digest, old)
+	}
+
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+	require.NoError(t, err)
+	reporter, err := report.NewReporter("text", &bytes.Buffer{})
+	require.NoError(t, err)
+	reporter.Explain()
+	records := map[string]report.Record{}
+	reporter.Subscribe(func(record report.Record) {
+		records[record.Digest] = record
+	})
+	cutoff := time.Now().Add(-24 * time.Hour)
+	manifests, err := repository.GetUntaggedManifests(testCtx, 1, acrClient, os.Stdout, "hello", false, nil, false, false, &cutoff, reporter, nil)
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	assert.Equal(t, dangling, *manifests[0].Digest)
+
+	assert.Equal(t, report.ReasonTagged, records[index].Code)
+	assert.Equal(t, report.ReasonInIndex, records[child].Code)
+	assert.Equal(t, index, records[child].Parent)
+	assert.Equal(t, report.ReasonReferrer, records[signature].Code)
+	assert.Equal(t, index, records[signature].Parent)
+	assert.Equal(t, report.ReasonNewer, records[recent].Code)
+	assert.Equal(t, report.ReasonLocked, records[locked].Code)
+	assert.NotContains(t, records, dangling)
+
+	err = runCommand(registry, "purge", "--username", fakeregistry.Username, "--password", fakeregistry.Password,
+		"--untagged-only", "--ago", "1d", "--explain", "--dry-run")
+	require.NoError(t, err)
+	assert.Contains(t, registry.Manifests("hello"), dangling)
+}
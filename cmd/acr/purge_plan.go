@@ -0,0 +1,477 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/repository"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/container/set"
+	"github.com/Azure/acr-cli/internal/report"
+	"github.com/Azure/acr-cli/internal/worker"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	purgePlanVersionV1          = "v1"
+	newPurgeApplyCmdLongMessage = `acr purge apply: delete exactly the tags and manifests listed in a plan file written by acr purge --plan-out.
+Items whose digest or last update time changed since the plan was made are skipped.`
+	purgeApplyExampleMessage = `  - Write a plan of the tags older than 7 days in the hello-world repository, review it, then apply it
+	acr purge -r example --filter "hello-world:.*" --ago 7d --untagged --plan-out plan.json
+	acr purge apply -r example plan.json`
+)
+
+// purgePlan is the list of tags and manifests a purge decided to delete, together with the state they were in when
+// the decision was made.
+type purgePlan struct {
+	Version   string          `json:"version"`
+	Registry  string          `json:"registry"`
+	CreatedAt string          `json:"createdAt"`
+	Items     []purgePlanItem `json:"items"`
+}
+
+// purgePlanItem is a tag when Tag is set and an untagged manifest otherwise. Subject is the digest of the manifest a
+// referrer deleted with purge --referrers refers to, the referrer is deleted before its subject.
+type purgePlanItem struct {
+	Repository     string `json:"repository"`
+	Tag            string `json:"tag,omitempty"`
+	Digest         string `json:"digest"`
+	LastUpdateTime string `json:"lastUpdateTime"`
+	Subject        string `json:"subject,omitempty"`
+}
+
+// newPurgePlan returns an empty plan for the registry.
+func newPurgePlan(loginURL string) *purgePlan {
+	return &purgePlan{
+		Version:   purgePlanVersionV1,
+		Registry:  loginURL,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Items:     []purgePlanItem{},
+	}
+}
+
+// add is subscribed to the purge reporter, every item a dry run would delete is added to the plan.
+func (p *purgePlan) add(record report.Record) {
+	// Repositories deleted with --delete-empty-repositories are not part of the plan, only tags and manifests are.
+	if !record.DryRun || record.Action != report.ActionDeleted || (record.Tag == "" && record.Digest == "") {
+		return
+	}
+	item := purgePlanItem{
+		Repository:     record.Repository,
+		Tag:            record.Tag,
+		Digest:         record.Digest,
+		LastUpdateTime: record.LastUpdateTime,
+	}
+	if record.Code == report.ReasonSubjectDeleted {
+		item.Subject = record.Parent
+	}
+	p.Items = append(p.Items, item)
+}
+
+// writePurgePlan writes the plan to the specified path as indented JSON so that it can be reviewed.
+func writePurgePlan(filePath string, plan *purgePlan) error {
+	content, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error marshalling the purge plan")
+	}
+	if err := os.WriteFile(filePath, append(content, '\n'), 0600); err != nil {
+		return errors.Wrap(err, "error writing the purge plan file")
+	}
+	return nil
+}
+
+// loadPurgePlan reads the plan file from the specified path and validates it.
+func loadPurgePlan(filePath string) (*purgePlan, error) {
+	content, err := os.ReadFile(filePath) // #nosec G304 -- filePath is the user-provided plan file, this is expected CLI behavior
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading the purge plan file")
+	}
+	plan := &purgePlan{}
+	if err := json.Unmarshal(content, plan); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling the purge plan file")
+	}
+	if plan.Version != purgePlanVersionV1 {
+		return nil, fmt.Errorf("version is required in the purge plan and should be %s", purgePlanVersionV1)
+	}
+	if plan.Registry == "" {
+		return nil, errors.New("registry is required in the purge plan")
+	}
+	for i, item := range plan.Items {
+		if item.Repository == "" || item.Digest == "" {
+			return nil, fmt.Errorf("item %d: repository and digest are required", i+1)
+		}
+	}
+	return plan, nil
+}
+
+// purgeApplyParameters defines the parameters that the purge apply command uses.
+type purgeApplyParameters struct {
+	*rootParameters
+	includeLocked bool
+	concurrency   string
+	output        string
+	continueOnErr bool
+}
+
+// newPurgeApplyCmd defines the purge apply command.
+func newPurgeApplyCmd(rootParams *rootParameters) *cobra.Command {
+	applyParams := purgeApplyParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "apply <plan file>",
+		Short:   "Delete the tags and manifests listed in a purge plan.",
+		Long:    newPurgeApplyCmdLongMessage,
+		Example: purgeApplyExampleMessage,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reporter, err := report.NewReporter(applyParams.output, os.Stdout)
+			if err != nil {
+				return err
+			}
+			out := messageWriter(reporter)
+
+			plan, err := loadPurgePlan(args[0])
+			if err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			registryName, err := applyParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			// The plan is only valid for the registry it was made for.
+			if plan.Registry != loginURL {
+				return fmt.Errorf("the purge plan was made for registry %s and cannot be applied to %s", plan.Registry, loginURL)
+			}
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, applyParams.username, applyParams.password, applyParams.configs, applyParams.transport)
+			if err != nil {
+				return err
+			}
+			repoParallelism, limiter, err := resolveConcurrency(applyParams.concurrency)
+			if err != nil {
+				return err
+			}
+			retryPolicy := applyParams.retryPolicy(false)
+			retryPolicy.OnThrottled = limiter.Throttled
+			acrClient.SetRetryPolicy(retryPolicy)
+
+			var failures *report.Failures
+			if applyParams.continueOnErr {
+				failures = report.NewFailures()
+			}
+
+			deletedTagsCount, deletedManifestsCount, skippedCount, err := applyPurgePlan(ctx, acrClient, out, loginURL, repoParallelism, plan, applyParams.includeLocked, reporter, limiter, failures)
+			if err != nil {
+				fmt.Fprintf(out, "Failed to complete purge apply: %v \n", err)
+			}
+
+			fmt.Fprintf(out, "\nNumber of deleted tags: %d\n", deletedTagsCount)
+			fmt.Fprintf(out, "Number of deleted manifests: %d\n", deletedManifestsCount)
+			fmt.Fprintf(out, "Number of skipped items: %d\n", skippedCount)
+			failedRestores := printFailedRestores(out, reporter)
+			printEffectiveConcurrency(out, limiter)
+			failures.Print(out)
+			if err == nil {
+				err = failures.Err()
+			}
+			if err == nil {
+				err = failedRestoresError(failedRestores)
+			}
+
+			summary := report.Summary{DeletedTags: deletedTagsCount, DeletedManifests: deletedManifestsCount, Failures: failures.Len(), FailedRestores: failedRestores}
+			summary.EffectiveConcurrency, _, _ = limiter.Limits()
+			if err != nil {
+				summary.Error = err.Error()
+			}
+			if reportErr := reporter.Close(summary); reportErr != nil && err == nil {
+				return reportErr
+			}
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&applyParams.includeLocked, "include-locked", false, "If the include-locked flag is set, locked manifests and tags in the plan will be unlocked before deletion, otherwise they are skipped")
+	cmd.Flags().StringVar(&applyParams.concurrency, "concurrency", strconv.Itoa(defaultPoolSize), concurrencyDescription)
+	cmd.Flags().StringVarP(&applyParams.output, "output", "o", string(report.FormatText), "Output format: text, json or ndjson")
+	cmd.Flags().StringArrayVarP(&applyParams.configs, "config", "c", nil, "Authentication config paths (e.g. C://Users/docker/config.json)")
+	cmd.Flags().BoolVar(&applyParams.continueOnErr, "continue-on-error", false, "Keep applying the plan when an item or a repository fails instead of stopping at the first error. The failures are listed in a table at the end and the command exits with an error if anything failed")
+	cmd.Flags().BoolP("help", "h", false, "Print usage")
+	return cmd
+}
+
+// applyPurgePlan deletes the items of the plan, repository by repository, tags first. An item is only deleted when it
+// is still in the state it was in when the plan was made, and an untagged manifest is only deleted when all its current
+// tags are deleted first. The referrers are deleted level by level before their subjects, the deepest ones first, and
+// the subject of a referrer that is skipped or fails to be deleted is kept. It returns the number of deleted tags, deleted manifests and skipped items. When failures are
+// collected a failed item or repository is added to them and the rest of the plan is still applied. What is deleted or
+// skipped is written to out.
+func applyPurgePlan(ctx context.Context,
+	acrClient api.AcrCLIClientInterface,
+	out io.Writer,
+	loginURL string,
+	repoParallelism int,
+	plan *purgePlan,
+	includeLocked bool,
+	reporter *report.Reporter,
+	limiter *worker.AdaptiveLimiter,
+	failures *report.Failures) (deletedTagsCount int, deletedManifestsCount int, skippedCount int, err error) {
+
+	// The items are grouped by repository, keeping the order of the plan.
+	var repoNames []string
+	itemsPerRepo := make(map[string][]purgePlanItem)
+	for _, item := range plan.Items {
+		if _, ok := itemsPerRepo[item.Repository]; !ok {
+			repoNames = append(repoNames, item.Repository)
+		}
+		itemsPerRepo[item.Repository] = append(itemsPerRepo[item.Repository], item)
+	}
+
+	for _, repoName := range repoNames {
+		if acrClient.IsAbac() {
+			if err := acrClient.RefreshTokenForAbac(ctx, []string{repoName}); err != nil {
+				if ctx.Err() == nil && failures.Collect(repoName, "", "refresh ABAC token", err) {
+					continue
+				}
+				return deletedTagsCount, deletedManifestsCount, skippedCount, fmt.Errorf("failed to refresh ABAC token for repository %s: %w", repoName, err)
+			}
+		}
+		fmt.Fprintf(out, "Applying purge plan for repository: %s\n", repoName)
+
+		var plannedTags, plannedManifests []purgePlanItem
+		for _, item := range itemsPerRepo[repoName] {
+			if item.Tag != "" {
+				plannedTags = append(plannedTags, item)
+			} else {
+				plannedManifests = append(plannedManifests, item)
+			}
+		}
+
+		// The current state is read before anything is deleted so that it can be compared with the plan.
+		currentTags, err := listCurrentTags(ctx, acrClient, repoName, len(plannedTags))
+		if err != nil {
+			if ctx.Err() == nil && failures.Collect(repoName, "", "list tags", err) {
+				continue
+			}
+			return deletedTagsCount, deletedManifestsCount, skippedCount, err
+		}
+		currentManifests, err := listCurrentManifests(ctx, acrClient, repoName, len(plannedManifests))
+		if err != nil {
+			if ctx.Err() == nil && failures.Collect(repoName, "", "list manifests", err) {
+				continue
+			}
+			return deletedTagsCount, deletedManifestsCount, skippedCount, err
+		}
+
+		var tagsToDelete []acr.TagAttributesBase
+		deletedTagNames := set.New[string]()
+		for _, item := range plannedTags {
+			tag, ok := currentTags[item.Tag]
+			reason := ""
+			switch {
+			case !ok:
+				reason = "no longer exists"
+			case *tag.Digest != item.Digest || !sameUpdateTime(tag.LastUpdateTime, item.LastUpdateTime):
+				reason = "changed since the plan was made"
+			}
+			if reason != "" {
+				fmt.Fprintf(out, "Skipped %s/%s:%s, %s\n", loginURL, repoName, item.Tag, reason)
+				reporter.Record(report.Record{Repository: repoName, Tag: item.Tag, Digest: item.Digest, LastUpdateTime: item.LastUpdateTime, Action: report.ActionSkipped, Reason: reason})
+				skippedCount++
+				continue
+			}
+			if !includeLocked && isLocked(tag.ChangeableAttributes) {
+				fmt.Fprintf(out, "Skipped %s/%s:%s, tag is locked\n", loginURL, repoName, item.Tag)
+				reporter.Record(report.TagRecord(repoName, tag, report.ActionLocked, "tag is locked"))
+				skippedCount++
+				continue
+			}
+			tagsToDelete = append(tagsToDelete, tag)
+			deletedTagNames.Add(item.Tag)
+		}
+
+		var manifestsToDelete []acr.ManifestAttributesBase
+		referrerParents := make(map[string]string)
+		keptBy := make(map[string]string)
+		for _, item := range plannedManifests {
+			if item.Subject != "" {
+				referrerParents[item.Digest] = item.Subject
+			}
+			manifest, ok := currentManifests[item.Digest]
+			reason := ""
+			switch {
+			case !ok:
+				reason = "no longer exists"
+			case !sameUpdateTime(manifest.LastUpdateTime, item.LastUpdateTime):
+				reason = "changed since the plan was made"
+			case manifest.Tags != nil && !allContained(*manifest.Tags, deletedTagNames):
+				// Deleting a tagged manifest deletes its tags as well, only the tags of the plan may go.
+				reason = "tagged since the plan was made"
+			}
+			if reason != "" {
+				fmt.Fprintf(out, "Skipped %s/%s@%s, %s\n", loginURL, repoName, item.Digest, reason)
+				reporter.Record(report.Record{Repository: repoName, Digest: item.Digest, LastUpdateTime: item.LastUpdateTime, Action: report.ActionSkipped, Reason: reason})
+				skippedCount++
+				if item.Subject != "" {
+					keptBy[item.Subject] = item.Digest
+				}
+				continue
+			}
+			if !includeLocked && isLocked(manifest.ChangeableAttributes) {
+				fmt.Fprintf(out, "Skipped %s/%s@%s, manifest is locked\n", loginURL, repoName, item.Digest)
+				reporter.Record(report.ManifestRecord(repoName, manifest, report.ActionLocked, "manifest is locked").WithCode(report.ReasonLocked, ""))
+				skippedCount++
+				if item.Subject != "" {
+					keptBy[item.Subject] = item.Digest
+				}
+				continue
+			}
+			manifestsToDelete = append(manifestsToDelete, manifest)
+		}
+
+		purger := worker.NewPurger(repoParallelism, acrClient, out, loginURL, repoName, includeLocked, reporter, limiter, failures)
+		if len(tagsToDelete) > 0 {
+			count, purgeErr := purger.PurgeTags(ctx, tagsToDelete)
+			deletedTagsCount += count
+			if purgeErr != nil {
+				return deletedTagsCount, deletedManifestsCount, skippedCount, fmt.Errorf("failed to purge tags: %w", purgeErr)
+			}
+		}
+		// The levels are deleted one after the other in the same way as purgeDanglingManifests does, the manifests that
+		// are not referrers being the last level.
+		levels := planReferrerLevels(manifestsToDelete, referrerParents)
+		cascadePurger := worker.NewPurger(repoParallelism, acrClient, out, loginURL, repoName, includeLocked, reporter, limiter, failures)
+		cascadePurger.SetReason(report.ReasonSubjectDeleted, referrerParents)
+		for i, level := range levels {
+			level = keepSubjectsOfFailedReferrers(out, loginURL, repoName, level, keptBy, referrerParents, reporter)
+			if len(level) == 0 {
+				continue
+			}
+			levelPurger := cascadePurger
+			if i == len(levels)-1 {
+				levelPurger = purger
+			}
+			count, purgeErr := levelPurger.PurgeManifests(ctx, level)
+			deletedManifestsCount += count
+			if purgeErr != nil {
+				return deletedTagsCount, deletedManifestsCount, skippedCount, fmt.Errorf("failed to purge manifests: %w", purgeErr)
+			}
+			for _, manifest := range level {
+				if subject, ok := referrerParents[*manifest.Digest]; ok && levelPurger.NotDeleted(*manifest.Digest) {
+					keptBy[subject] = *manifest.Digest
+				}
+			}
+		}
+	}
+	return deletedTagsCount, deletedManifestsCount, skippedCount, nil
+}
+
+// planReferrerLevels groups the manifests by their depth in the chains of referrers, the deepest referrers first and
+// the manifests that are not referrers last.
+func planReferrerLevels(manifests []acr.ManifestAttributesBase, referrerParents map[string]string) [][]acr.ManifestAttributesBase {
+	depths := make([]int, len(manifests))
+	maxDepth := 0
+	for i, manifest := range manifests {
+		for digest, ok := referrerParents[*manifest.Digest]; ok; digest, ok = referrerParents[digest] {
+			depths[i]++
+		}
+		maxDepth = max(maxDepth, depths[i])
+	}
+	levels := make([][]acr.ManifestAttributesBase, maxDepth+1)
+	for i, manifest := range manifests {
+		levels[maxDepth-depths[i]] = append(levels[maxDepth-depths[i]], manifest)
+	}
+	return levels
+}
+
+// listCurrentTags returns all the tags of a repository by name. Nothing is listed when no tags are planned, and a
+// repository that does not exist has no tags.
+func listCurrentTags(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, plannedCount int) (map[string]acr.TagAttributesBase, error) {
+	currentTags := make(map[string]acr.TagAttributesBase)
+	if plannedCount == 0 {
+		return currentTags, nil
+	}
+	lastTag := ""
+	for {
+		resultTags, err := acrClient.GetAcrTags(ctx, repoName, "", lastTag)
+		if err != nil {
+			if resultTags != nil && resultTags.Response.Response != nil && resultTags.StatusCode == http.StatusNotFound {
+				return currentTags, nil
+			}
+			return nil, err
+		}
+		if resultTags == nil || resultTags.TagsAttributes == nil || len(*resultTags.TagsAttributes) == 0 {
+			return currentTags, nil
+		}
+		for _, tag := range *resultTags.TagsAttributes {
+			if tag.Name != nil && tag.Digest != nil {
+				currentTags[*tag.Name] = tag
+			}
+		}
+		lastTag = repository.GetLastTagFromResponse(resultTags)
+		if lastTag == "" {
+			return currentTags, nil
+		}
+	}
+}
+
+// listCurrentManifests returns all the manifests of a repository by digest. Nothing is listed when no manifests are
+// planned, and a repository that does not exist has no manifests.
+func listCurrentManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, plannedCount int) (map[string]acr.ManifestAttributesBase, error) {
+	currentManifests := make(map[string]acr.ManifestAttributesBase)
+	if plannedCount == 0 {
+		return currentManifests, nil
+	}
+	manifests, err := listAllManifests(ctx, acrClient, repoName)
+	if err != nil {
+		return nil, err
+	}
+	for _, manifest := range manifests {
+		if manifest.Digest != nil {
+			currentManifests[*manifest.Digest] = manifest
+		}
+	}
+	return currentManifests, nil
+}
+
+// sameUpdateTime compares a current last update time with the one recorded in the plan, as instants when both can be
+// parsed.
+func sameUpdateTime(current *string, planned string) bool {
+	if current == nil {
+		return planned == ""
+	}
+	currentTime, currentErr := time.Parse(time.RFC3339Nano, *current)
+	plannedTime, plannedErr := time.Parse(time.RFC3339Nano, planned)
+	if currentErr != nil || plannedErr != nil {
+		return *current == planned
+	}
+	return currentTime.Equal(plannedTime)
+}
+
+// isLocked returns true when the attributes prevent deletion.
+func isLocked(attributes *acr.ChangeableAttributes) bool {
+	if attributes == nil {
+		return false
+	}
+	return (attributes.DeleteEnabled != nil && !*attributes.DeleteEnabled) || (attributes.WriteEnabled != nil && !*attributes.WriteEnabled)
+}
+
+// allContained returns true when every item is in the set.
+func allContained(items []string, s set.Set[string]) bool {
+	for _, item := range items {
+		if !s.Contains(item) {
+			return false
+		}
+	}
+	return true
+}
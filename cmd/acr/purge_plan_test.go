@@ -0,0 +1,178 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/internal/report"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestPurgePlanFile checks that a dry run is recorded in the plan and that the plan file can be read back.
+func TestPurgePlanFile(t *testing.T) {
+	t.Run("DryRunIsRecorded", func(t *testing.T) {
+		assert := assert.New(t)
+		reporter, _ := report.NewReporter("text", nil)
+		plan := newPurgePlan(testLoginURL)
+		reporter.Subscribe(plan.add)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(FourTagsResult, nil).Once()
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "v.*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, keep: 1, filterTimeout: 60, dryRun: true, reporter: reporter})
+		assert.Nil(err, "Error should be nil")
+		assert.Equal(3, deletedTags, "Number of tags to be deleted should be 3")
+		// Only the tags that would be deleted are planned, v1 is kept.
+		assert.Len(plan.Items, 3)
+		for i, name := range []string{"v2", "v3", "v4"} {
+			assert.Equal(testRepo, plan.Items[i].Repository)
+			assert.Equal(name, plan.Items[i].Tag)
+			assert.Equal(lastUpdateTime, plan.Items[i].LastUpdateTime)
+		}
+		assert.Equal(multiArchDigest, plan.Items[1].Digest)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("WriteAndLoad", func(t *testing.T) {
+		assert := assert.New(t)
+		plan := newPurgePlan(testLoginURL)
+		plan.Items = append(plan.Items, purgePlanItem{Repository: testRepo, Tag: "v1", Digest: digest, LastUpdateTime: lastUpdateTime})
+		path := filepath.Join(t.TempDir(), "plan.json")
+		assert.Nil(writePurgePlan(path, plan))
+		loaded, err := loadPurgePlan(path)
+		assert.Nil(err, "Error should be nil")
+		assert.Equal(plan, loaded)
+	})
+
+	invalidPlans := []struct {
+		name    string
+		content string
+	}{
+		{"InvalidJSON", "{"},
+		{"MissingVersion", `{"registry": "example.azurecr.io", "items": []}`},
+		{"MissingRegistry", `{"version": "v1", "items": []}`},
+		{"MissingDigest", `{"version": "v1", "registry": "example.azurecr.io", "items": [{"repository": "repo", "tag": "v1"}]}`},
+	}
+	for _, tc := range invalidPlans {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "plan.json")
+			if err := os.WriteFile(path, []byte(tc.content), 0600); err != nil {
+				t.Fatalf("Failed to write plan file: %v", err)
+			}
+			_, err := loadPurgePlan(path)
+			assert.NotNil(t, err, "Error should not be nil")
+		})
+	}
+}
+
+// TestApplyPurgePlan checks that only the items that did not change since the plan was made are deleted.
+func TestApplyPurgePlan(t *testing.T) {
+	otherDigest := "sha256:0000000000000000000000000000000000000000000000000000000000000000" //#nosec G101
+	newerUpdateTime := "2099-01-01T00:00:00Z"
+	tagsResult := func(tags ...acr.TagAttributesBase) *acr.RepositoryTagsType {
+		return &acr.RepositoryTagsType{
+			Response:       autorest.Response{Response: &http.Response{StatusCode: 200}},
+			Registry:       &testLoginURL,
+			ImageName:      &testRepo,
+			TagsAttributes: &tags,
+		}
+	}
+	manifestsResult := func(manifests ...acr.ManifestAttributesBase) *acr.Manifests {
+		return &acr.Manifests{
+			Response:            autorest.Response{Response: &http.Response{StatusCode: 200}},
+			Registry:            &testLoginURL,
+			ImageName:           &testRepo,
+			ManifestsAttributes: &manifests,
+		}
+	}
+	newTag := func(name string, tagDigest string, updateTime string, deletable bool) acr.TagAttributesBase {
+		return acr.TagAttributesBase{
+			Name:                 &name,
+			Digest:               &tagDigest,
+			LastUpdateTime:       &updateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deletable, WriteEnabled: &writeEnabled},
+		}
+	}
+	newManifest := func(manifestDigest string, updateTime string, tags ...string) acr.ManifestAttributesBase {
+		return acr.ManifestAttributesBase{
+			Digest:               &manifestDigest,
+			LastUpdateTime:       &updateTime,
+			Tags:                 &tags,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled, WriteEnabled: &writeEnabled},
+		}
+	}
+
+	t.Run("UnchangedItemsAreDeleted", func(t *testing.T) {
+		assert := assert.New(t)
+		plan := newPurgePlan(testLoginURL)
+		plan.Items = []purgePlanItem{
+			{Repository: testRepo, Tag: "v1", Digest: digest, LastUpdateTime: lastUpdateTime},
+			{Repository: testRepo, Digest: digest, LastUpdateTime: lastUpdateTime},
+		}
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("IsAbac").Return(false)
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "", "").Return(tagsResult(newTag("v1", digest, lastUpdateTime, true)), nil).Once()
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(manifestsResult(newManifest(digest, lastUpdateTime, "v1")), nil).Once()
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteManifest", mock.Anything, testRepo, digest).Return(&deletedResponse, nil).Once()
+		deletedTags, deletedManifests, skipped, err := applyPurgePlan(testCtx, mockClient, os.Stdout, testLoginURL, defaultPoolSize, plan, false, nil, nil, nil)
+		assert.Nil(err, "Error should be nil")
+		assert.Equal(1, deletedTags)
+		assert.Equal(1, deletedManifests)
+		assert.Equal(0, skipped)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("ChangedItemsAreSkipped", func(t *testing.T) {
+		assert := assert.New(t)
+		plan := newPurgePlan(testLoginURL)
+		plan.Items = []purgePlanItem{
+			// Retagged to another digest.
+			{Repository: testRepo, Tag: "v1", Digest: digest, LastUpdateTime: lastUpdateTime},
+			// Updated since the plan was made.
+			{Repository: testRepo, Tag: "v2", Digest: digest, LastUpdateTime: lastUpdateTime},
+			// Already deleted.
+			{Repository: testRepo, Tag: "v3", Digest: digest, LastUpdateTime: lastUpdateTime},
+			// Locked.
+			{Repository: testRepo, Tag: "v4", Digest: digest, LastUpdateTime: lastUpdateTime},
+			// Still tagged with v1, which is not deleted.
+			{Repository: testRepo, Digest: otherDigest, LastUpdateTime: lastUpdateTime},
+		}
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("IsAbac").Return(false)
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "", "").Return(tagsResult(
+			newTag("v1", otherDigest, lastUpdateTime, true),
+			newTag("v2", digest, newerUpdateTime, true),
+			newTag("v4", digest, lastUpdateTime, false),
+		), nil).Once()
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(manifestsResult(newManifest(otherDigest, lastUpdateTime, "v1")), nil).Once()
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", otherDigest).Return(EmptyListManifestsResult, nil).Once()
+		deletedTags, deletedManifests, skipped, err := applyPurgePlan(testCtx, mockClient, os.Stdout, testLoginURL, defaultPoolSize, plan, false, nil, nil, nil)
+		assert.Nil(err, "Error should be nil")
+		assert.Equal(0, deletedTags)
+		assert.Equal(0, deletedManifests)
+		assert.Equal(5, skipped)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("RepositoryNotFound", func(t *testing.T) {
+		assert := assert.New(t)
+		plan := newPurgePlan(testLoginURL)
+		plan.Items = []purgePlanItem{{Repository: testRepo, Tag: "v1", Digest: digest, LastUpdateTime: lastUpdateTime}}
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("IsAbac").Return(false)
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "", "").Return(notFoundTagResponse, errors.New("not found")).Once()
+		_, _, skipped, err := applyPurgePlan(testCtx, mockClient, os.Stdout, testLoginURL, defaultPoolSize, plan, false, nil, nil, nil)
+		assert.Nil(err, "Error should be nil")
+		assert.Equal(1, skipped)
+		mockClient.AssertExpectations(t)
+	})
+}
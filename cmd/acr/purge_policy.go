@@ -0,0 +1,196 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/repository"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/tag"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const purgePolicyVersionV1 = "v1"
+
+// purgePolicy is the declarative form of the purge flags. It holds an ordered list of rules, every repository
+// is purged with the first rule whose repository expression matches its name.
+type purgePolicy struct {
+	Version string            `yaml:"version"`
+	Rules   []purgePolicyRule `yaml:"rules"`
+}
+
+// purgePolicyRule defines the purge settings for the repositories that match the Repository expression. The fields
+// are named after the purge flags they replace.
+type purgePolicyRule struct {
+	Repository    string   `yaml:"repository"`
+	Tag           string   `yaml:"tag"`
+	Exclude       []string `yaml:"exclude"`
+	Ago           string   `yaml:"ago"`
+	Keep          int      `yaml:"keep"`
+	SemverMinors  int      `yaml:"semver-keep-minors"`
+	SemverPatches int      `yaml:"semver-keep-patches"`
+	Untagged      bool     `yaml:"untagged"`
+	UntaggedOnly  bool     `yaml:"untagged-only"`
+	IncludeLocked bool     `yaml:"include-locked"`
+
+	// agoDuration is the parsed value of Ago, it is set by validate.
+	agoDuration time.Duration
+}
+
+// loadPurgePolicy reads the policy file from the specified path and validates it.
+func loadPurgePolicy(filePath string, regexpMatchTimeoutSeconds int64) (*purgePolicy, error) {
+	file, err := os.ReadFile(filePath) // #nosec G304 -- filePath is the user-provided policy file, this is expected CLI behavior
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading the purge policy file")
+	}
+
+	policy := &purgePolicy{}
+	if err := yaml.Unmarshal(file, policy); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling the purge policy file")
+	}
+	if err := policy.validate(regexpMatchTimeoutSeconds); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// validate checks every rule of the policy up front so that an invalid policy does not leave a registry half purged.
+func (p *purgePolicy) validate(regexpMatchTimeoutSeconds int64) error {
+	if p.Version != purgePolicyVersionV1 {
+		return fmt.Errorf("version is required in the purge policy and should be %s", purgePolicyVersionV1)
+	}
+	if len(p.Rules) == 0 {
+		return errors.New("at least one rule is required in the purge policy")
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Repository == "" {
+			return fmt.Errorf("rule %d: repository is required", i+1)
+		}
+		if _, err := repository.BuildRegexFilter("^"+rule.Repository+"$", regexpMatchTimeoutSeconds); err != nil {
+			return fmt.Errorf("rule %d: invalid repository expression %q: %w", i+1, rule.Repository, err)
+		}
+		if rule.Untagged && rule.UntaggedOnly {
+			return fmt.Errorf("rule %d: untagged and untagged-only cannot be used together", i+1)
+		}
+		if rule.Keep < 0 {
+			return fmt.Errorf("rule %d: keep cannot be negative", i+1)
+		}
+		if rule.SemverMinors < 0 || rule.SemverPatches < 0 {
+			return fmt.Errorf("rule %d: semver-keep-minors and semver-keep-patches cannot be negative", i+1)
+		}
+		if (rule.SemverMinors == 0) != (rule.SemverPatches == 0) {
+			return fmt.Errorf("rule %d: semver-keep-minors and semver-keep-patches must be used together", i+1)
+		}
+		// The same requirements as the flags apply: only untagged-only rules can omit the tag expression and the age.
+		if !rule.UntaggedOnly {
+			if rule.Tag == "" {
+				return fmt.Errorf("rule %d: tag is required when not using untagged-only", i+1)
+			}
+			if rule.Ago == "" {
+				return fmt.Errorf("rule %d: ago is required when not using untagged-only", i+1)
+			}
+		}
+		if rule.Tag != "" {
+			if _, err := repository.BuildRegexFilter(rule.Tag, regexpMatchTimeoutSeconds); err != nil {
+				return fmt.Errorf("rule %d: invalid tag expression %q: %w", i+1, rule.Tag, err)
+			}
+		}
+		for _, exclude := range rule.Exclude {
+			if _, err := repository.BuildRegexFilter(exclude, regexpMatchTimeoutSeconds); err != nil {
+				return fmt.Errorf("rule %d: invalid exclude expression %q: %w", i+1, exclude, err)
+			}
+		}
+		if rule.Ago != "" {
+			agoDuration, err := parseDuration(rule.Ago)
+			if err != nil {
+				return fmt.Errorf("rule %d: invalid ago value %q: %w", i+1, rule.Ago, err)
+			}
+			rule.agoDuration = agoDuration
+		}
+	}
+	return nil
+}
+
+// assignRepositories maps every repository to the index of the first rule that matches it. Repositories that do not
+// match any rule are left out. The result holds, per rule, the tag filter of each repository it applies to.
+func (p *purgePolicy) assignRepositories(repoNames []string, regexpMatchTimeoutSeconds int64) ([]map[string]string, error) {
+	tagFiltersPerRule := make([]map[string]string, len(p.Rules))
+	for i := range tagFiltersPerRule {
+		tagFiltersPerRule[i] = make(map[string]string)
+	}
+	assigned := make(map[string]bool, len(repoNames))
+	for i, rule := range p.Rules {
+		matchedRepos, err := repository.GetMatchingRepos(repoNames, "^"+rule.Repository+"$", regexpMatchTimeoutSeconds)
+		if err != nil {
+			return nil, err
+		}
+		for _, repoName := range matchedRepos {
+			if assigned[repoName] {
+				// An earlier rule already claimed this repository.
+				continue
+			}
+			assigned[repoName] = true
+			tagFiltersPerRule[i][repoName] = rule.Tag
+		}
+	}
+	return tagFiltersPerRule, nil
+}
+
+// purgeWithPolicy evaluates every rule of the policy against the repositories it was assigned and returns the combined
+// number of deleted tags, deleted manifests and excluded tags. The excludeFilters, collected from the --exclude flag, apply
+// on top of the exclusions of every rule. The settings of every rule replace the ones of opts, and no size budget is used.
+func purgeWithPolicy(ctx context.Context,
+	acrClient api.AcrCLIClientInterface,
+	policy *purgePolicy,
+	repoNames []string,
+	excludeFilters map[string]string,
+	opts purgeOptions) (deletedTagsCount int, deletedManifestsCount int, excludedTagsCount int, err error) {
+
+	out := opts.writer()
+	tagFiltersPerRule, err := policy.assignRepositories(repoNames, opts.filterTimeout)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for i, rule := range policy.Rules {
+		tagFilters := tagFiltersPerRule[i]
+		if len(tagFilters) == 0 {
+			fmt.Fprintf(out, "Rule %d (%s): no matching repositories\n", i+1, rule.Repository)
+			continue
+		}
+		fmt.Fprintf(out, "Rule %d (%s): applying to %d repositories\n", i+1, rule.Repository, len(tagFilters))
+		ruleExcludeFilters := make(map[string]string)
+		for repoName := range tagFilters {
+			exclusions := append([]string{}, rule.Exclude...)
+			if excludeFilter, ok := excludeFilters[repoName]; ok {
+				exclusions = append(exclusions, excludeFilter)
+			}
+			if len(exclusions) > 0 {
+				ruleExcludeFilters[repoName] = strings.Join(exclusions, "|")
+			}
+		}
+		ruleOpts := opts
+		ruleOpts.agoDuration = rule.agoDuration
+		ruleOpts.keep = rule.Keep
+		ruleOpts.semverKeep = tag.SemverKeep{Minors: rule.SemverMinors, Patches: rule.SemverPatches}
+		ruleOpts.untagged = rule.Untagged
+		ruleOpts.untaggedOnly = rule.UntaggedOnly
+		ruleOpts.includeLocked = rule.IncludeLocked
+		ruleOpts.budget = nil
+		ruleDeletedTagsCount, ruleDeletedManifestsCount, ruleExcludedTagsCount, ruleErr := purge(ctx, acrClient, tagFilters, ruleExcludeFilters, ruleOpts)
+		deletedTagsCount += ruleDeletedTagsCount
+		deletedManifestsCount += ruleDeletedManifestsCount
+		excludedTagsCount += ruleExcludedTagsCount
+		if ruleErr != nil {
+			return deletedTagsCount, deletedManifestsCount, excludedTagsCount, fmt.Errorf("rule %d (%s): %w", i+1, rule.Repository, ruleErr)
+		}
+	}
+	return deletedTagsCount, deletedManifestsCount, excludedTagsCount, nil
+}
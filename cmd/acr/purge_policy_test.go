@@ -0,0 +1,161 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// writePolicyFile writes the policy content to a temporary file and returns its path.
+func writePolicyFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "retention.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+	return path
+}
+
+// TestLoadPurgePolicy contains the tests for reading and validating a purge policy file.
+func TestLoadPurgePolicy(t *testing.T) {
+	t.Run("ValidPolicy", func(t *testing.T) {
+		assert := assert.New(t)
+		path := writePolicyFile(t, `
+version: v1
+rules:
+  - repository: "release/.*"
+    tag: "^v.*"
+    ago: 30d
+    keep: 10
+  - repository: ".*"
+    untagged-only: true
+    include-locked: true
+`)
+		policy, err := loadPurgePolicy(path, 60)
+		assert.Nil(err, "Error should be nil")
+		assert.Len(policy.Rules, 2, "Policy should have 2 rules")
+		assert.Equal(mustParseDuration("30d"), policy.Rules[0].agoDuration, "Ago should be parsed")
+		assert.Equal(10, policy.Rules[0].Keep, "Keep should be read")
+		assert.True(policy.Rules[1].UntaggedOnly, "Untagged-only should be read")
+		assert.True(policy.Rules[1].IncludeLocked, "Include-locked should be read")
+	})
+
+	t.Run("MissingFile", func(t *testing.T) {
+		_, err := loadPurgePolicy(filepath.Join(t.TempDir(), "missing.yaml"), 60)
+		assert.NotNil(t, err, "Error should not be nil")
+	})
+
+	invalidPolicies := []struct {
+		name    string
+		content string
+	}{
+		{"MissingVersion", "rules:\n  - repository: a\n    tag: b\n    ago: 1d\n"},
+		{"NoRules", "version: v1\n"},
+		{"MissingRepository", "version: v1\nrules:\n  - tag: b\n    ago: 1d\n"},
+		{"InvalidRepositoryRegex", "version: v1\nrules:\n  - repository: \"[\"\n    tag: b\n    ago: 1d\n"},
+		{"MissingTag", "version: v1\nrules:\n  - repository: a\n    ago: 1d\n"},
+		{"MissingAgo", "version: v1\nrules:\n  - repository: a\n    tag: b\n"},
+		{"InvalidAgo", "version: v1\nrules:\n  - repository: a\n    tag: b\n    ago: 15p\n"},
+		{"NegativeKeep", "version: v1\nrules:\n  - repository: a\n    tag: b\n    ago: 1d\n    keep: -1\n"},
+		{"UntaggedAndUntaggedOnly", "version: v1\nrules:\n  - repository: a\n    untagged: true\n    untagged-only: true\n"},
+		{"InvalidExcludeRegex", "version: v1\nrules:\n  - repository: a\n    tag: b\n    exclude: [\"[\"]\n    ago: 1d\n"},
+		{"InvalidYaml", "version: [v1\n"},
+	}
+	for _, tc := range invalidPolicies {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadPurgePolicy(writePolicyFile(t, tc.content), 60)
+			assert.NotNil(t, err, "Error should not be nil")
+		})
+	}
+}
+
+// TestPurgePolicyAssignRepositories checks that every repository is assigned to the first rule that matches it.
+func TestPurgePolicyAssignRepositories(t *testing.T) {
+	assert := assert.New(t)
+	policy := &purgePolicy{
+		Version: purgePolicyVersionV1,
+		Rules: []purgePolicyRule{
+			{Repository: "release/.*", Tag: "^v.*", Ago: "30d"},
+			{Repository: "release/keep", Tag: ".*", Ago: "1d"},
+			{Repository: ".*", UntaggedOnly: true},
+		},
+	}
+	assert.Nil(policy.validate(60), "Policy should be valid")
+	tagFiltersPerRule, err := policy.assignRepositories([]string{"release/app", "release/keep", "dev/app"}, 60)
+	assert.Nil(err, "Error should be nil")
+	assert.Equal(map[string]string{"release/app": "^v.*", "release/keep": "^v.*"}, tagFiltersPerRule[0])
+	assert.Empty(tagFiltersPerRule[1], "Repositories claimed by an earlier rule should not be assigned again")
+	assert.Equal(map[string]string{"dev/app": ""}, tagFiltersPerRule[2])
+}
+
+// TestPurgeWithPolicy checks that the rules are evaluated through the purge pipeline and the counts are combined.
+func TestPurgeWithPolicy(t *testing.T) {
+	t.Run("CombinedSummary", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("IsAbac").Return(false)
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResult, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "latest").Return(&deletedResponse, nil).Once()
+		mockClient.On("GetAcrTags", mock.Anything, "other", "timedesc", "").Return(OneTagResult, nil).Once()
+		policy := &purgePolicy{
+			Version: purgePolicyVersionV1,
+			Rules: []purgePolicyRule{
+				{Repository: testRepo, Tag: "^la.*", Ago: "0m"},
+				{Repository: "other", Tag: "^la.*", Ago: "1d"},
+				{Repository: "unused", Tag: ".*", Ago: "1d"},
+			},
+		}
+		assert.Nil(policy.validate(60), "Policy should be valid")
+		deletedTags, deletedManifests, _, err := purgeWithPolicy(testCtx, mockClient, policy, []string{testRepo, "other"}, nil, purgeOptions{loginURL: testLoginURL, repoParallelism: defaultPoolSize, filterTimeout: 60})
+		assert.Nil(err, "Error should be nil")
+		assert.Equal(1, deletedTags, "Only the tag in the first repository is old enough to be deleted")
+		assert.Equal(0, deletedManifests, "No manifests should be deleted")
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("RuleErrorStopsPurge", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("IsAbac").Return(false)
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(nil, errors.New("unauthorized")).Once()
+		policy := &purgePolicy{
+			Version: purgePolicyVersionV1,
+			Rules: []purgePolicyRule{
+				{Repository: testRepo, Tag: ".*", Ago: "1d"},
+				{Repository: "other", Tag: ".*", Ago: "1d"},
+			},
+		}
+		assert.Nil(policy.validate(60), "Policy should be valid")
+		_, _, _, err := purgeWithPolicy(testCtx, mockClient, policy, []string{testRepo, "other"}, nil, purgeOptions{loginURL: testLoginURL, repoParallelism: defaultPoolSize, filterTimeout: 60})
+		assert.NotNil(err, "Error should not be nil")
+		assert.Contains(err.Error(), "rule 1", "Error should name the failing rule")
+		mockClient.AssertExpectations(t)
+	})
+	t.Run("RuleAndFlagExclusions", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("IsAbac").Return(false)
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v3").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v4").Return(&deletedResponse, nil).Once()
+		policy := &purgePolicy{
+			Version: purgePolicyVersionV1,
+			Rules: []purgePolicyRule{
+				{Repository: testRepo, Tag: "v.*", Exclude: []string{"^v1$"}, Ago: "0m"},
+			},
+		}
+		assert.Nil(policy.validate(60), "Policy should be valid")
+		deletedTags, _, excludedTags, err := purgeWithPolicy(testCtx, mockClient, policy, []string{testRepo}, map[string]string{testRepo: "^v2$"}, purgeOptions{loginURL: testLoginURL, repoParallelism: defaultPoolSize, filterTimeout: 60})
+		assert.Nil(err, "Error should be nil")
+		assert.Equal(2, deletedTags, "Number of deleted tags should be 2")
+		assert.Equal(2, excludedTags, "Both the rule and the flag exclusions should apply")
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,243 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/container/set"
+	"github.com/Azure/acr-cli/internal/report"
+	"github.com/alitto/pond/v2"
+	"github.com/pkg/errors"
+)
+
+// The values of the --referrers flag of purge.
+const (
+	referrersPreserve    = "preserve"
+	referrersCascade     = "cascade"
+	referrersOrphansOnly = "orphans-only"
+)
+
+// referrerPurger finds the referrers that a purge of the untagged manifests deletes with --referrers cascade or
+// orphans-only. A nil *referrerPurger preserves every referrer, which is the default: registries that clean up the
+// referrers of deleted manifests do not need anything else.
+type referrerPurger struct {
+	mode       string
+	orasClient api.ORASClientInterface
+}
+
+// validateReferrersMode returns an error when the value of the --referrers flag is not supported.
+func validateReferrersMode(mode string) error {
+	switch mode {
+	case referrersPreserve, referrersCascade, referrersOrphansOnly:
+		return nil
+	}
+	return fmt.Errorf("invalid referrers mode %q, allowed values are %s, %s and %s", mode, referrersPreserve, referrersCascade, referrersOrphansOnly)
+}
+
+// newReferrerPurger returns a referrerPurger for the mode, or nil to preserve the referrers. The ORAS client is only
+// used to list the referrers of the deleted manifests with cascade.
+func newReferrerPurger(mode string, orasClient api.ORASClientInterface) *referrerPurger {
+	if mode == referrersPreserve {
+		return nil
+	}
+	return &referrerPurger{mode: mode, orasClient: orasClient}
+}
+
+// referrersToDelete returns the referrers to delete along with the untagged manifests of the repository, grouped in
+// levels with the deepest first, so that every referrer is deleted before its own subject and the untagged manifests
+// are deleted last. The digest of the subject of every referrer is returned too.
+//
+// With cascade the referrers of the manifests to delete are listed through the OCI referrers API. With orphans-only
+// the referrers whose subject no longer exists are found from the manifests of the repository, and only the ones
+// last updated before the cutoff are deleted since a referrer can be pushed before its subject. In both cases the
+// referrers of the deleted referrers are deleted too, tagged referrers are kept and so are locked ones unless
+// includeLocked is set, together with their own referrers.
+func (r *referrerPurger) referrersToDelete(ctx context.Context, acrClient api.AcrCLIClientInterface, poolSize int, loginURL string, repoName string, manifestsToDelete []acr.ManifestAttributesBase, cutoff time.Time, includeLocked bool, reporter *report.Reporter) ([][]acr.ManifestAttributesBase, map[string]string, error) {
+	if r == nil {
+		return nil, nil, nil
+	}
+	walk := &referrerWalk{
+		repoName:      repoName,
+		includeLocked: includeLocked,
+		reporter:      reporter,
+		manifests:     make(map[string]acr.ManifestAttributesBase),
+		seen:          set.New[string](),
+		parents:       make(map[string]string),
+	}
+
+	var subjects []string
+	var listReferrers func([]string) (map[string][]string, error)
+	if r.mode == referrersCascade {
+		manifests, err := listAllManifests(ctx, acrClient, repoName)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, manifest := range manifests {
+			walk.manifests[*manifest.Digest] = manifest
+		}
+		for _, manifest := range manifestsToDelete {
+			walk.seen.Add(*manifest.Digest)
+			subjects = append(subjects, *manifest.Digest)
+		}
+		listReferrers = func(subjects []string) (map[string][]string, error) {
+			return r.listReferrers(ctx, poolSize, loginURL, repoName, subjects)
+		}
+	} else {
+		roots, err := buildManifestTree(ctx, acrClient, poolSize, repoName, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		nodes := make(map[string]*manifestNode)
+		var collect func([]*manifestNode)
+		collect = func(children []*manifestNode) {
+			for _, node := range children {
+				if _, ok := nodes[node.Digest]; !ok && !node.Missing {
+					nodes[node.Digest] = node
+					walk.manifests[node.Digest] = node.attributes
+					collect(node.Manifests)
+					collect(node.Referrers)
+				}
+			}
+		}
+		collect(roots)
+		// The orphan referrers are the roots of the tree that have a subject, since their subject is not in the
+		// repository.
+		var orphans []acr.ManifestAttributesBase
+		for _, root := range roots {
+			if root.subject == "" || walk.seen.Contains(root.Digest) {
+				continue
+			}
+			walk.seen.Add(root.Digest)
+			if newerThan(root.attributes, cutoff) {
+				reporter.Record(report.ManifestRecord(repoName, root.attributes, report.ActionKept, "orphan referrer newer than the ago duration").WithCode(report.ReasonNewer, root.subject))
+				continue
+			}
+			if walk.keep(root.attributes) {
+				continue
+			}
+			walk.parents[root.Digest] = root.subject
+			orphans = append(orphans, root.attributes)
+			subjects = append(subjects, root.Digest)
+		}
+		if len(orphans) > 0 {
+			walk.levels = append(walk.levels, orphans)
+		}
+		listReferrers = func(subjects []string) (map[string][]string, error) {
+			referrers := make(map[string][]string, len(subjects))
+			for _, subject := range subjects {
+				for _, referrer := range nodes[subject].Referrers {
+					referrers[subject] = append(referrers[subject], referrer.Digest)
+				}
+			}
+			return referrers, nil
+		}
+	}
+
+	for len(subjects) > 0 {
+		referrers, err := listReferrers(subjects)
+		if err != nil {
+			return nil, nil, err
+		}
+		subjects = walk.addLevel(subjects, referrers)
+	}
+	slices.Reverse(walk.levels)
+	return walk.levels, walk.parents, nil
+}
+
+// listReferrers returns the digests of the referrers of every subject, listed concurrently with poolSize workers.
+func (r *referrerPurger) listReferrers(ctx context.Context, poolSize int, loginURL string, repoName string, subjects []string) (map[string][]string, error) {
+	var mu sync.Mutex
+	referrers := make(map[string][]string, len(subjects))
+	pool := pond.NewPool(poolSize, pond.WithContext(ctx), pond.WithQueueSize(poolSize*3), pond.WithNonBlocking(false))
+	group := pool.NewGroup()
+	for _, subject := range subjects {
+		group.SubmitErr(func() error {
+			descriptors, err := r.orasClient.Referrers(ctx, fmt.Sprintf("%s/%s@%s", loginURL, repoName, subject), "")
+			if err != nil {
+				return errors.Wrapf(err, "failed to list the referrers of %s", subject)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, descriptor := range descriptors {
+				referrers[subject] = append(referrers[subject], descriptor.Digest.String())
+			}
+			return nil
+		})
+	}
+	err := group.Wait()
+	pool.StopAndWait()
+	return referrers, err
+}
+
+// referrerWalk holds the state of referrersToDelete while the referrers are walked level by level.
+type referrerWalk struct {
+	repoName      string
+	includeLocked bool
+	reporter      *report.Reporter
+	// manifests holds the attributes of the manifests of the repository by digest.
+	manifests map[string]acr.ManifestAttributesBase
+	seen      set.Set[string]
+	parents   map[string]string
+	levels    [][]acr.ManifestAttributesBase
+}
+
+// addLevel adds the referrers of the subjects that are not kept as the next level, and returns their digests to find
+// their own referrers.
+func (w *referrerWalk) addLevel(subjects []string, referrers map[string][]string) []string {
+	var level []acr.ManifestAttributesBase
+	var next []string
+	for _, subject := range subjects {
+		for _, digest := range referrers[subject] {
+			if w.seen.Contains(digest) {
+				continue
+			}
+			w.seen.Add(digest)
+			manifest, ok := w.manifests[digest]
+			if !ok {
+				// The referrer was deleted since the manifests were listed.
+				continue
+			}
+			if w.keep(manifest) {
+				continue
+			}
+			w.parents[digest] = subject
+			level = append(level, manifest)
+			next = append(next, digest)
+		}
+	}
+	if len(level) > 0 {
+		w.levels = append(w.levels, level)
+	}
+	return next
+}
+
+// keep returns true and records why when the referrer is tagged, or locked and locked manifests are not included.
+func (w *referrerWalk) keep(manifest acr.ManifestAttributesBase) bool {
+	if manifest.Tags != nil && len(*manifest.Tags) > 0 {
+		w.reporter.Record(report.ManifestRecord(w.repoName, manifest, report.ActionKept, "referrer is tagged").WithCode(report.ReasonTagged, ""))
+		return true
+	}
+	if !w.includeLocked && isLocked(manifest.ChangeableAttributes) {
+		w.reporter.Record(report.ManifestRecord(w.repoName, manifest, report.ActionLocked, "manifest is locked").WithCode(report.ReasonLocked, ""))
+		return true
+	}
+	return false
+}
+
+// newerThan returns true when the manifest was last updated after the cutoff, or when its last update time cannot be
+// read.
+func newerThan(manifest acr.ManifestAttributesBase, cutoff time.Time) bool {
+	if manifest.LastUpdateTime == nil {
+		return true
+	}
+	lastUpdateTime, err := time.Parse(time.RFC3339Nano, *manifest.LastUpdateTime)
+	return err != nil || lastUpdateTime.After(cutoff)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateReferrersMode(t *testing.T) {
+	for _, mode := range []string{referrersPreserve, referrersCascade, referrersOrphansOnly} {
+		assert.NoError(t, validateReferrersMode(mode))
+	}
+	assert.EqualError(t, validateReferrersMode("all"), `invalid referrers mode "all", allowed values are preserve, cascade and orphans-only`)
+	assert.Nil(t, newReferrerPurger(referrersPreserve, nil))
+	assert.NotNil(t, newReferrerPurger(referrersCascade, nil))
+}
+
+func TestReferrersToDelete(t *testing.T) {
+	t.Run("NilPreservesReferrers", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		levels, parents, err := (*referrerPurger)(nil).referrersToDelete(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, nil, time.Now(), false, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, levels)
+		assert.Nil(t, parents)
+		mockClient.AssertNotCalled(t, "GetAcrManifests", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("CascadeReferrersError", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
+		mockOrasClient := &mocks.ORASClientInterface{}
+		mockOrasClient.On("Referrers", mock.Anything, testLoginURL+"/"+testRepo+"@"+digest, "").Return(nil, errors.New("unsupported")).Once()
+		manifests := *singleManifestV2WithTagsResult.ManifestsAttributes
+		_, _, err := newReferrerPurger(referrersCascade, mockOrasClient).referrersToDelete(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, manifests, time.Now(), false, nil)
+		assert.EqualError(t, err, "failed to list the referrers of "+digest+": unsupported")
+	})
+}
+
+func TestPurgeReferrersEndToEnd(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	credentials := []string{"--username", fakeregistry.Username, "--password", fakeregistry.Password}
+
+	t.Run("Cascade", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		dangling := registry.PushImage("hello", "dangling")
+		signature := registry.PushReferrer("hello", dangling, "application/vnd.cncf.notary.signature", nil)
+		signatureOfSignature := registry.PushReferrer("hello", signature, "application/vnd.cncf.notary.signature", nil)
+		taggedSBOM := registry.PushReferrer("hello", dangling, "application/spdx+json", nil)
+		content, _ := registry.Manifest("hello", taggedSBOM)
+		registry.PushManifest("hello", "application/vnd.oci.image.manifest.v1+json", content, "sbom")
+		tagged := registry.PushImage("hello", "tagged", "v1")
+		taggedSignature := registry.PushReferrer("hello", tagged, "application/vnd.cncf.notary.signature", nil)
+
+		acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+		require.NoError(t, err)
+		orasClient, err := api.GetORASClientWithAuth(fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+		require.NoError(t, err)
+		referrers := newReferrerPurger(referrersCascade, orasClient)
+		deleted, err := purgeDanglingManifests(testCtx, acrClient, "hello", nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: registry.LoginURL(), dryRun: true, referrers: referrers})
+		require.NoError(t, err)
+		assert.Equal(t, 3, deleted)
+		assert.Len(t, registry.Manifests("hello"), 6)
+
+		err = runCommand(registry, append([]string{"purge", "--untagged-only", "--referrers", "cascade"}, credentials...)...)
+		require.NoError(t, err)
+		manifests := registry.Manifests("hello")
+		assert.NotContains(t, manifests, dangling)
+		assert.NotContains(t, manifests, signature)
+		assert.NotContains(t, manifests, signatureOfSignature)
+		assert.ElementsMatch(t, []string{taggedSBOM, tagged, taggedSignature}, manifests)
+	})
+
+	t.Run("CascadeKeepsTheSubjectsOfFailedReferrers", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		dangling := registry.PushImage("hello", "dangling")
+		signature := registry.PushReferrer("hello", dangling, "application/vnd.cncf.notary.signature", nil)
+		signatureOfSignature := registry.PushReferrer("hello", signature, "application/vnd.cncf.notary.signature", nil)
+		other := registry.PushImage("hello", "other")
+		otherSignature := registry.PushReferrer("hello", other, "application/vnd.cncf.notary.signature", nil)
+		registry.InjectFault(fakeregistry.Fault{Method: http.MethodDelete, Path: "/manifests/" + signatureOfSignature, StatusCode: http.StatusInternalServerError})
+
+		err := runCommand(registry, append([]string{"purge", "--untagged-only", "--referrers", "cascade", "--continue-on-error", "--max-attempts", "1"}, credentials...)...)
+		assert.EqualError(t, err, "1 operation failed")
+		// The signature and the image it signs are kept since the signature of the signature could not be deleted.
+		manifests := registry.Manifests("hello")
+		assert.ElementsMatch(t, []string{dangling, signature, signatureOfSignature}, manifests)
+		assert.NotContains(t, manifests, other)
+		assert.NotContains(t, manifests, otherSignature)
+	})
+
+	t.Run("PlanDeletesTheReferrersBeforeTheirSubjects", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		dangling := registry.PushImage("hello", "dangling")
+		signature := registry.PushReferrer("hello", dangling, "application/vnd.cncf.notary.signature", nil)
+		signatureOfSignature := registry.PushReferrer("hello", signature, "application/vnd.cncf.notary.signature", nil)
+		other := registry.PushImage("hello", "other")
+		otherSignature := registry.PushReferrer("hello", other, "application/vnd.cncf.notary.signature", nil)
+
+		planPath := filepath.Join(t.TempDir(), "plan.json")
+		err := runCommand(registry, append([]string{"purge", "--untagged-only", "--referrers", "cascade", "--plan-out", planPath}, credentials...)...)
+		require.NoError(t, err)
+		plan, err := loadPurgePlan(planPath)
+		require.NoError(t, err)
+		subjects := make(map[string]string)
+		for _, item := range plan.Items {
+			subjects[item.Digest] = item.Subject
+		}
+		assert.Equal(t, map[string]string{dangling: "", signature: dangling, signatureOfSignature: signature, other: "", otherSignature: other}, subjects)
+
+		// The signature of the signature is deleted first, so the signature and the image it signs are kept when it fails.
+		registry.InjectFault(fakeregistry.Fault{Method: http.MethodDelete, Path: "/manifests/" + signatureOfSignature, StatusCode: http.StatusInternalServerError})
+		err = runCommand(registry, append([]string{"purge", "apply", planPath, "--continue-on-error", "--max-attempts", "1"}, credentials...)...)
+		assert.EqualError(t, err, "1 operation failed")
+		assert.ElementsMatch(t, []string{dangling, signature, signatureOfSignature}, registry.Manifests("hello"))
+	})
+
+	t.Run("OrphansOnly", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		subject := registry.PushImage("hello", "subject")
+		orphan := registry.PushReferrer("hello", subject, "application/vnd.cncf.notary.signature", nil)
+		orphanOfOrphan := registry.PushReferrer("hello", orphan, "application/vnd.cncf.notary.signature", nil)
+		recentSubject := registry.PushImage("hello", "recent-subject")
+		recentOrphan := registry.PushReferrer("hello", recentSubject, "application/vnd.cncf.notary.signature", nil)
+		tagged := registry.PushImage("hello", "tagged", "v1")
+		signature := registry.PushReferrer("hello", tagged, "application/vnd.cncf.notary.signature", nil)
+		for _, digest := range []string{orphan, orphanOfOrphan, tagged, signature} {
+			registry.SetLastUpdateTime("hello", digest, old)
+		}
+		acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+		require.NoError(t, err)
+		for _, digest := range []string{subject, recentSubject} {
+			_, err = acrClient.DeleteManifest(testCtx, "hello", digest)
+			require.NoError(t, err)
+		}
+
+		err = runCommand(registry, append([]string{"purge", "--untagged-only", "--ago", "1d", "--referrers", "orphans-only"}, credentials...)...)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{recentOrphan, tagged, signature}, registry.Manifests("hello"))
+	})
+
+	t.Run("RequiresUntagged", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		err := runCommand(registry, append([]string{"purge", "--filter", "hello:.*", "--ago", "1d", "--referrers", "cascade"}, credentials...)...)
+		assert.EqualError(t, err, "--referrers cascade requires --untagged or --untagged-only")
+	})
+}
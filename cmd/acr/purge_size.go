@@ -0,0 +1,410 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/repository"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/container/set"
+	"github.com/Azure/acr-cli/internal/report"
+	"github.com/dlclark/regexp2"
+)
+
+// sizeUnits holds the number of bytes of the units accepted by parseSize, in lower case.
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// parseSize parses a size such as 500MB, 1.5GiB or 1024, decimal (KB, MB, GB, TB) and binary (KiB, MiB, GiB, TiB)
+// units are accepted and a number without unit is in bytes.
+func parseSize(value string) (int64, error) {
+	trimmed := strings.TrimSpace(value)
+	i := strings.IndexFunc(trimmed, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(trimmed)
+	}
+	number, err := strconv.ParseFloat(trimmed[:i], 64)
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(trimmed[i:]))]
+	if err != nil || !ok || number < 0 {
+		return 0, fmt.Errorf("invalid size %q, it should be a number of bytes optionally followed by a unit such as MB, GB, MiB or GiB", value)
+	}
+	return int64(number * unit), nil
+}
+
+// sizeBudget limits a purge to the oldest tags and untagged manifests it would delete that are needed to bring the
+// repositories under a storage budget, see --max-repo-size and --target-registry-size. A nil *sizeBudget does not
+// limit the purge. The manifests are read to count the blobs shared between them once, a manifest only frees the
+// blobs that no other manifest references.
+type sizeBudget struct {
+	maxRepoSize        int64
+	targetRegistrySize int64
+	// blobs holds the blobs referenced by the manifests of the planned repositories.
+	blobs *blobIndex
+	// selected holds, by repository, the bytes freed by the manifests selected for deletion by digest.
+	selected map[string]map[string]int64
+	// kept holds, by repository, the digests of the manifests kept by --keep.
+	kept      map[string]set.Set[string]
+	projected int64
+	freed     int64
+}
+
+// newSizeBudget returns a sizeBudget limiting the size of every repository to maxRepoSize, or of all the repositories
+// together to targetRegistrySize. It returns nil when both are 0.
+func newSizeBudget(maxRepoSize int64, targetRegistrySize int64) *sizeBudget {
+	if maxRepoSize == 0 && targetRegistrySize == 0 {
+		return nil
+	}
+	return &sizeBudget{
+		maxRepoSize:        maxRepoSize,
+		targetRegistrySize: targetRegistrySize,
+		blobs:              newBlobIndex(),
+		selected:           make(map[string]map[string]int64),
+		kept:               make(map[string]set.Set[string]),
+	}
+}
+
+// parseSizeBudget returns the sizeBudget of the values of the --max-repo-size and --target-registry-size flags, or nil
+// when neither is set.
+func parseSizeBudget(maxRepoSize string, targetRegistrySize string) (*sizeBudget, error) {
+	sizes := make([]int64, 2)
+	for i, value := range []string{maxRepoSize, targetRegistrySize} {
+		if value == "" {
+			continue
+		}
+		size, err := parseSize(value)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, fmt.Errorf("invalid size %q, the size budget must be greater than 0", value)
+		}
+		sizes[i] = size
+	}
+	return newSizeBudget(sizes[0], sizes[1]), nil
+}
+
+// sizeCandidate is a manifest that the purge would delete, with its repository.
+type sizeCandidate struct {
+	repoName       string
+	manifest       acr.ManifestAttributesBase
+	lastUpdateTime time.Time
+}
+
+// plan selects the manifests to delete in the repositories of tagFilters. The candidates are the manifests that the
+// purge would delete with the same settings: the untagged ones and, unless untaggedOnly is set, the ones whose every
+// tag would be deleted. They are selected from the oldest until every repository, or all of the repositories together
+// with a registry budget, fit in the budget. The sizes count every blob once, in every repository referencing it for
+// the repository budget and once for the registry budget. Nothing is recorded in the reporter of opts while planning.
+func (b *sizeBudget) plan(ctx context.Context, acrClient api.AcrCLIClientInterface, tagFilters map[string]string, excludeFilters map[string]string, opts purgeOptions) error {
+	if b == nil {
+		return nil
+	}
+	repoNames := make([]string, 0, len(tagFilters))
+	for repoName := range tagFilters {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	out, cutoff := opts.writer(), time.Now().UTC().Add(opts.agoDuration)
+	opts.reporter = nil
+
+	candidatesByRepo := make(map[string][]sizeCandidate, len(repoNames))
+	for _, repoName := range repoNames {
+		if acrClient.IsAbac() {
+			if err := acrClient.RefreshTokenForAbac(ctx, []string{repoName}); err != nil {
+				return fmt.Errorf("failed to refresh ABAC token for repository %s: %w", repoName, err)
+			}
+		}
+		candidates, err := b.candidates(ctx, acrClient, repoName, tagFilters[repoName], excludeFilters[repoName], cutoff, opts)
+		if err != nil {
+			return err
+		}
+		candidatesByRepo[repoName] = candidates
+	}
+
+	sizes, total := b.blobs.uniqueBytes()
+	release := b.blobs.newRelease()
+	var allCandidates []sizeCandidate
+	for _, repoName := range repoNames {
+		if b.maxRepoSize > 0 {
+			repositoryFreed := func(ref manifestRef) int64 {
+				freed, _ := release.release(ref)
+				return freed
+			}
+			selectedCount, selectedSize := b.selectOldest(candidatesByRepo[repoName], sizes[repoName]-b.maxRepoSize, repositoryFreed)
+			printBudgetPlan(out, fmt.Sprintf("Repository %s uses", repoName), sizes[repoName], b.maxRepoSize, selectedCount, selectedSize)
+			continue
+		}
+		allCandidates = append(allCandidates, candidatesByRepo[repoName]...)
+	}
+	if b.targetRegistrySize > 0 {
+		registryFreed := func(ref manifestRef) int64 {
+			_, freed := release.release(ref)
+			return freed
+		}
+		selectedCount, selectedSize := b.selectOldest(allCandidates, total-b.targetRegistrySize, registryFreed)
+		printBudgetPlan(out, fmt.Sprintf("The %d repositories use", len(repoNames)), total, b.targetRegistrySize, selectedCount, selectedSize)
+	}
+	// A blob shared by manifests selected in several repositories is only freed once.
+	_, b.projected = b.blobs.reclaimableBytes(b.selectedManifests())
+	return nil
+}
+
+// selectedManifests returns the manifests selected for deletion.
+func (b *sizeBudget) selectedManifests() map[manifestRef]bool {
+	selected := make(map[manifestRef]bool)
+	for repoName, digests := range b.selected {
+		for digest := range digests {
+			selected[manifestRef{repoName: repoName, digest: digest}] = true
+		}
+	}
+	return selected
+}
+
+// candidates adds the blobs of the manifests of the repository to the blob index and returns the manifests that the
+// purge would delete from it.
+func (b *sizeBudget) candidates(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, tagFilter string, excludeFilter string, cutoff time.Time, opts purgeOptions) ([]sizeCandidate, error) {
+	manifests, err := listAllManifests(ctx, acrClient, repoName)
+	if err != nil || len(manifests) == 0 {
+		return nil, err
+	}
+	if err := b.blobs.addManifests(ctx, acrClient, opts.repoParallelism, repoName, manifests); err != nil {
+		return nil, err
+	}
+
+	// The manifests whose every tag would be deleted are found like in a dry run, from the number of deleted tags.
+	var deletedTagsCount map[string]int
+	if !opts.untaggedOnly {
+		deletedTagsCount, err = tagsToDeleteCount(ctx, acrClient, repoName, tagFilter, excludeFilter, cutoff, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	manifestsToDelete, err := repository.GetUntaggedManifests(ctx, opts.repoParallelism, acrClient, opts.writer(), repoName, false, deletedTagsCount, true, opts.includeLocked, &cutoff, nil, opts.limiter)
+	if err != nil {
+		return nil, err
+	}
+	if opts.keep > 0 {
+		remaining := keepMostRecent(repoName, manifestsToDelete, opts.keep, nil)
+		kept := set.New[string]()
+		for _, manifest := range manifestsToDelete[:len(manifestsToDelete)-len(remaining)] {
+			kept.Add(*manifest.Digest)
+		}
+		b.kept[repoName] = kept
+		manifestsToDelete = remaining
+	}
+
+	candidates := make([]sizeCandidate, 0, len(manifestsToDelete))
+	for _, manifest := range manifestsToDelete {
+		candidate := sizeCandidate{repoName: repoName, manifest: manifest}
+		if manifest.LastUpdateTime != nil {
+			// A last update time that cannot be read is the zero time, such manifests are selected first.
+			candidate.lastUpdateTime, _ = time.Parse(time.RFC3339Nano, *manifest.LastUpdateTime)
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+// tagsToDeleteCount returns the number of tags that the purge would delete per manifest digest.
+func tagsToDeleteCount(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, tagFilter string, excludeFilter string, cutoff time.Time, opts purgeOptions) (map[string]int, error) {
+	tagRegex, err := repository.BuildRegexFilter(tagFilter, opts.filterTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Regex %s with error: %w", tagFilter, err)
+	}
+	var excludeRegex *regexp2.Regexp
+	if excludeFilter != "" {
+		excludeRegex, err = repository.BuildRegexFilter(excludeFilter, opts.filterTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build exclude Regex %s with error: %w", excludeFilter, err)
+		}
+	}
+	var protectedTags set.Set[string]
+	if opts.semverKeep.Enabled() {
+		protectedTags, err = getSemverProtectedTags(ctx, acrClient, opts.writer(), repoName, tagRegex, opts.semverKeep)
+		if err != nil {
+			return nil, err
+		}
+	}
+	deletedTagsCount := make(map[string]int)
+	lastTag := ""
+	skippedTagsCount := 0
+	for {
+		tagsToDelete, newLastTag, newSkippedTagsCount, _, err := getTagsToDelete(ctx, acrClient, repoName, tagRegex, excludeRegex, protectedTags, cutoff, lastTag, skippedTagsCount, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tagsToDelete {
+			deletedTagsCount[*tag.Digest]++
+		}
+		if newLastTag == "" {
+			return deletedTagsCount, nil
+		}
+		lastTag, skippedTagsCount = newLastTag, newSkippedTagsCount
+	}
+}
+
+// selectOldest selects the candidates from the oldest until the bytes they free, returned by freed as every candidate
+// is selected, reach excess. It returns the number of the selected manifests and the bytes they free. Nothing is
+// selected when excess is not positive.
+func (b *sizeBudget) selectOldest(candidates []sizeCandidate, excess int64, freed func(manifestRef) int64) (int, int64) {
+	if excess <= 0 {
+		return 0, 0
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if !candidates[i].lastUpdateTime.Equal(candidates[j].lastUpdateTime) {
+			return candidates[i].lastUpdateTime.Before(candidates[j].lastUpdateTime)
+		}
+		if candidates[i].repoName != candidates[j].repoName {
+			return candidates[i].repoName < candidates[j].repoName
+		}
+		return *candidates[i].manifest.Digest < *candidates[j].manifest.Digest
+	})
+	var selectedSize int64
+	count := 0
+	for _, candidate := range candidates {
+		if selectedSize >= excess {
+			break
+		}
+		size := freed(manifestRef{repoName: candidate.repoName, digest: *candidate.manifest.Digest})
+		if b.selected[candidate.repoName] == nil {
+			b.selected[candidate.repoName] = make(map[string]int64)
+		}
+		b.selected[candidate.repoName][*candidate.manifest.Digest] = size
+		selectedSize += size
+		count++
+	}
+	return count, selectedSize
+}
+
+// printBudgetPlan writes the size of a repository, or of all the repositories, against the budget and what was
+// selected to fit in it. The subject ends with the verb, such as "Repository hello uses".
+func printBudgetPlan(out io.Writer, subject string, size int64, budget int64, selectedCount int, selectedSize int64) {
+	if size <= budget {
+		fmt.Fprintf(out, "%s %s, within the size budget of %s\n", subject, formatSize(size), formatSize(budget))
+		return
+	}
+	fmt.Fprintf(out, "%s %s, %s over the size budget of %s, %d manifests (%s) selected for deletion\n", subject, formatSize(size), formatSize(size-budget), formatSize(budget), selectedCount, formatSize(selectedSize))
+	if selectedSize < size-budget {
+		fmt.Fprintf(out, "Warning: only %s can be freed from the tags and manifests eligible for deletion, the size budget is not met\n", formatSize(selectedSize))
+	}
+}
+
+// filterTags returns the tags of the manifests selected for deletion, the other ones are recorded as kept.
+func (b *sizeBudget) filterTags(repoName string, tags []acr.TagAttributesBase, reporter *report.Reporter) []acr.TagAttributesBase {
+	if b == nil {
+		return tags
+	}
+	var selected []acr.TagAttributesBase
+	for _, tag := range tags {
+		if _, ok := b.selected[repoName][*tag.Digest]; ok {
+			selected = append(selected, tag)
+			continue
+		}
+		reporter.Record(report.TagRecord(repoName, tag, report.ActionKept, "within the size budget"))
+	}
+	return selected
+}
+
+// filterManifests returns the manifests selected for deletion, the other ones are recorded as kept.
+func (b *sizeBudget) filterManifests(repoName string, manifests []acr.ManifestAttributesBase, reporter *report.Reporter) []acr.ManifestAttributesBase {
+	if b == nil {
+		return manifests
+	}
+	var selected []acr.ManifestAttributesBase
+	for _, manifest := range manifests {
+		if _, ok := b.selected[repoName][*manifest.Digest]; ok {
+			selected = append(selected, manifest)
+			continue
+		}
+		if b.kept[repoName].Contains(*manifest.Digest) {
+			reporter.Record(report.ManifestRecord(repoName, manifest, report.ActionKept, "kept by keep").WithCode(report.ReasonKeep, ""))
+			continue
+		}
+		reporter.Record(report.ManifestRecord(repoName, manifest, report.ActionKept, "within the size budget").WithCode(report.ReasonWithinBudget, ""))
+	}
+	return selected
+}
+
+// measure lists the manifests of the repositories that had manifests selected for deletion once they are purged, the
+// bytes freed are the size of the blobs that were only referenced by the manifests deleted since they were planned.
+func (b *sizeBudget) measure(ctx context.Context, acrClient api.AcrCLIClientInterface) error {
+	if b == nil {
+		return nil
+	}
+	repoNames := make([]string, 0, len(b.selected))
+	for repoName := range b.selected {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	deleted := make(map[manifestRef]bool)
+	for _, repoName := range repoNames {
+		if acrClient.IsAbac() {
+			if err := acrClient.RefreshTokenForAbac(ctx, []string{repoName}); err != nil {
+				return fmt.Errorf("failed to refresh ABAC token for repository %s: %w", repoName, err)
+			}
+		}
+		manifests, err := listAllManifests(ctx, acrClient, repoName)
+		if err != nil {
+			return err
+		}
+		remaining := set.New[string]()
+		for _, manifest := range manifests {
+			remaining.Add(*manifest.Digest)
+		}
+		for digest := range b.selected[repoName] {
+			if !remaining.Contains(digest) {
+				deleted[manifestRef{repoName: repoName, digest: digest}] = true
+			}
+		}
+	}
+	_, b.freed = b.blobs.reclaimableBytes(deleted)
+	return nil
+}
+
+// Projected returns the size of the manifests selected for deletion.
+func (b *sizeBudget) Projected() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.projected
+}
+
+// Freed returns the bytes freed by the purge, once measured.
+func (b *sizeBudget) Freed() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.freed
+}
+
+// Print writes the projected and, unless in a dry run, the freed bytes. Nothing is written for a nil *sizeBudget.
+func (b *sizeBudget) Print(out io.Writer, dryRun bool) {
+	if b == nil {
+		return
+	}
+	fmt.Fprintf(out, "Projected storage to be freed: %s\n", formatSize(b.projected))
+	if !dryRun {
+		fmt.Fprintf(out, "Storage freed: %s\n", formatSize(b.freed))
+	}
+}
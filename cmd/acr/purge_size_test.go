@@ -0,0 +1,183 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	godigest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	for value, expected := range map[string]int64{
+		"1024":    1024,
+		"500B":    500,
+		"500MB":   500_000_000,
+		"1.5GiB":  1536 << 20,
+		"50 gib":  50 << 30,
+		"2TiB":    2 << 40,
+		"0.5 kib": 512,
+	} {
+		size, err := parseSize(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, size, value)
+	}
+	for _, value := range []string{"", "GiB", "1.5XB", "-1GB", "1..5GB"} {
+		_, err := parseSize(value)
+		assert.Error(t, err, value)
+	}
+
+	budget, err := parseSizeBudget("", "")
+	assert.NoError(t, err)
+	assert.Nil(t, budget)
+	_, err = parseSizeBudget("0", "")
+	assert.EqualError(t, err, `invalid size "0", the size budget must be greater than 0`)
+	budget, err = parseSizeBudget("", "1GB")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1_000_000_000), budget.targetRegistrySize)
+}
+
+func TestPurgeSizeBudgetEndToEnd(t *testing.T) {
+	now := time.Now()
+	credentials := []string{"--username", fakeregistry.Username, "--password", fakeregistry.Password}
+	// sizeOf returns the image size of the manifests of the repository by digest, and the size of the repository.
+	sizeOf := func(t *testing.T, registry *fakeregistry.Registry, repoName string) (map[string]int64, int64) {
+		acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+		require.NoError(t, err)
+		manifests, err := listAllManifests(testCtx, acrClient, repoName)
+		require.NoError(t, err)
+		sizes := make(map[string]int64)
+		var total int64
+		for _, manifest := range manifests {
+			sizes[*manifest.Digest] = *manifest.ImageSize
+			total += *manifest.ImageSize
+		}
+		return sizes, total
+	}
+
+	t.Run("MaxRepoSize", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		oldest := registry.PushImage("hello", "oldest")
+		older := registry.PushImage("hello", "older")
+		recent := registry.PushImage("hello", "recent")
+		tagged := registry.PushImage("hello", "tagged", "v1")
+		registry.SetLastUpdateTime("hello", oldest, now.Add(-72*time.Hour))
+		registry.SetLastUpdateTime("hello", older, now.Add(-48*time.Hour))
+		registry.SetLastUpdateTime("hello", tagged, now.Add(-96*time.Hour))
+		sizes, total := sizeOf(t, registry, "hello")
+
+		acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+		require.NoError(t, err)
+		budget := newSizeBudget(total-sizes[oldest], 0)
+		tagFilters := map[string]string{"hello": ""}
+		require.NoError(t, budget.plan(testCtx, acrClient, tagFilters, nil, purgeOptions{repoParallelism: defaultPoolSize, filterTimeout: 60, untaggedOnly: true}))
+		_, deleted, _, err := purge(testCtx, acrClient, tagFilters, nil, purgeOptions{loginURL: registry.LoginURL(), repoParallelism: defaultPoolSize, filterTimeout: 60, untaggedOnly: true, budget: budget})
+		require.NoError(t, err)
+		require.NoError(t, budget.measure(testCtx, acrClient))
+		assert.Equal(t, 1, deleted)
+		assert.ElementsMatch(t, []string{older, recent, tagged}, registry.Manifests("hello"))
+		assert.Equal(t, sizes[oldest], budget.Projected())
+		assert.Equal(t, sizes[oldest], budget.Freed())
+
+		// Within the budget nothing is deleted.
+		err = runCommand(registry, append([]string{"purge", "--untagged-only", "--max-repo-size", "1GiB"}, credentials...)...)
+		require.NoError(t, err)
+		assert.Len(t, registry.Manifests("hello"), 3)
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		oldest := registry.PushImage("hello", "oldest", "v1")
+		older := registry.PushImage("hello", "older", "v2")
+		newer := registry.PushImage("hello", "newer", "v3")
+		excluded := registry.PushImage("hello", "excluded", "stable")
+		for i, digest := range []string{excluded, oldest, older, newer} {
+			registry.SetLastUpdateTime("hello", digest, now.Add(time.Duration(i-10)*time.Hour))
+		}
+		sizes, total := sizeOf(t, registry, "hello")
+
+		// stable is excluded even though it is the oldest, v1 and then v2 are deleted to fit the budget.
+		maxRepoSize := total - sizes[oldest] - sizes[older]
+		err := runCommand(registry, append([]string{"purge", "--filter", "hello:.*", "--exclude", "hello:^stable$", "--untagged",
+			"--max-repo-size", strconv.FormatInt(maxRepoSize, 10)}, credentials...)...)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{newer, excluded}, registry.Manifests("hello"))
+		assert.ElementsMatch(t, []string{"v3", "stable"}, registry.Tags("hello"))
+	})
+
+	t.Run("TargetRegistrySize", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		first := registry.PushImage("first", "first")
+		second := registry.PushImage("second", "second")
+		registry.SetLastUpdateTime("first", first, now.Add(-24*time.Hour))
+		registry.SetLastUpdateTime("second", second, now.Add(-48*time.Hour))
+		_, firstTotal := sizeOf(t, registry, "first")
+		_, secondTotal := sizeOf(t, registry, "second")
+
+		err := runCommand(registry, append([]string{"purge", "--untagged-only", "--target-registry-size", strconv.FormatInt(firstTotal+secondTotal-1, 10), "--dry-run"}, credentials...)...)
+		require.NoError(t, err)
+		assert.Len(t, registry.Manifests("first"), 1)
+		assert.Len(t, registry.Manifests("second"), 1)
+
+		err = runCommand(registry, append([]string{"purge", "--untagged-only", "--target-registry-size", strconv.FormatInt(firstTotal+secondTotal-1, 10)}, credentials...)...)
+		require.NoError(t, err)
+		assert.Equal(t, []string{first}, registry.Manifests("first"))
+		assert.Empty(t, registry.Manifests("second"))
+	})
+
+	t.Run("SharedLayers", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		base := strings.Repeat("base", 100)
+		// pushImage pushes an image with the base layer and its own layer, and returns its digest and the bytes that
+		// deleting it frees, which leave out the shared base layer.
+		pushImage := func(seed string, tags ...string) (string, int64) {
+			config, layer := fmt.Sprintf(`{"seed":%q}`, seed), "layer of "+seed
+			image := v1.Manifest{MediaType: v1.MediaTypeImageManifest}
+			image.SchemaVersion = 2
+			image.Config = v1.Descriptor{MediaType: v1.MediaTypeImageConfig, Digest: godigest.Digest(registry.PushBlob("hello", []byte(config))), Size: int64(len(config))}
+			for _, content := range []string{base, layer} {
+				image.Layers = append(image.Layers, v1.Descriptor{MediaType: v1.MediaTypeImageLayerGzip, Digest: godigest.Digest(registry.PushBlob("hello", []byte(content))), Size: int64(len(content))})
+			}
+			content, err := json.Marshal(image)
+			require.NoError(t, err)
+			return registry.PushManifest("hello", v1.MediaTypeImageManifest, content, tags...), int64(len(content) + len(config) + len(layer))
+		}
+		oldest, oldestFreed := pushImage("oldest")
+		older, olderFreed := pushImage("older")
+		tagged, taggedFreed := pushImage("tagged", "v1")
+		registry.SetLastUpdateTime("hello", oldest, now.Add(-72*time.Hour))
+		registry.SetLastUpdateTime("hello", older, now.Add(-48*time.Hour))
+		total := oldestFreed + olderFreed + taggedFreed + int64(len(base))
+
+		// Deleting the oldest image does not free the base layer, the older one is deleted too to fit the budget.
+		acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+		require.NoError(t, err)
+		budget := newSizeBudget(total-oldestFreed-1, 0)
+		tagFilters := map[string]string{"hello": ""}
+		require.NoError(t, budget.plan(testCtx, acrClient, tagFilters, nil, purgeOptions{repoParallelism: defaultPoolSize, filterTimeout: 60, untaggedOnly: true}))
+		_, deleted, _, err := purge(testCtx, acrClient, tagFilters, nil, purgeOptions{loginURL: registry.LoginURL(), repoParallelism: defaultPoolSize, filterTimeout: 60, untaggedOnly: true, budget: budget})
+		require.NoError(t, err)
+		require.NoError(t, budget.measure(testCtx, acrClient))
+		assert.Equal(t, 2, deleted)
+		assert.Equal(t, []string{tagged}, registry.Manifests("hello"))
+		assert.Equal(t, oldestFreed+olderFreed, budget.Projected())
+		assert.Equal(t, oldestFreed+olderFreed, budget.Freed())
+	})
+
+	t.Run("RequiresUntagged", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		err := runCommand(registry, append([]string{"purge", "--filter", "hello:.*", "--max-repo-size", "1GB"}, credentials...)...)
+		assert.EqualError(t, err, "--max-repo-size and --target-registry-size require --untagged or --untagged-only")
+	})
+}
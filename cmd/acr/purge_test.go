@@ -3,16 +3,21 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/Azure/acr-cli/acr"
 	"github.com/Azure/acr-cli/cmd/mocks"
 	"github.com/Azure/acr-cli/cmd/repository"
+	"github.com/Azure/acr-cli/internal/report"
+	"github.com/Azure/acr-cli/internal/tag"
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -43,7 +48,7 @@ func TestPurgeTags(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(TagWithLocal, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1-c-local.test").Return(&deletedResponse, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, ".*-?local[.].+", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, ".*-?local[.].+", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -56,7 +61,7 @@ func TestPurgeTags(t *testing.T) {
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(FourTagsWithRepoFilterMatch, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1-c").Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1-b").Return(&deletedResponse, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "v1(?!-a)", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "v1(?!-a)", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		assert.Equal(2, deletedTags, "Number of deleted elements should be 2")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -68,7 +73,7 @@ func TestPurgeTags(t *testing.T) {
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(FourTagsWithRepoFilterMatch, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1-c").Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1-b").Return(&deletedResponse, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "v1-*[abc]+(?<!-[a])", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "v1-*[abc]+(?<!-[a])", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		assert.Equal(2, deletedTags, "Number of deleted elements should be 2")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -80,7 +85,7 @@ func TestPurgeTags(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(notFoundTagResponse, errors.New("testRepo not found")).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, mustParseDuration("1d"), "[\\s\\S]*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "[\\s\\S]*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: mustParseDuration("1d"), filterTimeout: 60})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -91,7 +96,7 @@ func TestPurgeTags(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(EmptyListTagsResult, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, mustParseDuration("1d"), "[\\s\\S]*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "[\\s\\S]*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: mustParseDuration("1d"), filterTimeout: 60})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -103,7 +108,7 @@ func TestPurgeTags(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResult, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, mustParseDuration("1d"), "[\\s\\S]*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "[\\s\\S]*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: mustParseDuration("1d"), filterTimeout: 60})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -115,7 +120,7 @@ func TestPurgeTags(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResult, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "^hello.*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "^hello.*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -125,7 +130,7 @@ func TestPurgeTags(t *testing.T) {
 	t.Run("InvalidRegexTest", func(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "[", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "[", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		assert.Equal(-1, deletedTags, "Number of deleted elements should be -1")
 		assert.NotEqual(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -136,7 +141,7 @@ func TestPurgeTags(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(nil, errors.New("unauthorized")).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, mustParseDuration("1d"), "[\\s\\S]*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "[\\s\\S]*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: mustParseDuration("1d"), filterTimeout: 60})
 		assert.Equal(-1, deletedTags, "Number of deleted elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -149,7 +154,7 @@ func TestPurgeTags(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResultWithNext, nil).Once()
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "latest").Return(nil, errors.New("unauthorized")).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, mustParseDuration("1d"), "[\\s\\S]*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "[\\s\\S]*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: mustParseDuration("1d"), filterTimeout: 60})
 		assert.Equal(-1, deletedTags, "Number of deleted elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -161,7 +166,7 @@ func TestPurgeTags(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(DeleteDisabledOneTagResult, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "^la.*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "^la.*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -171,7 +176,7 @@ func TestPurgeTags(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(WriteDisabledOneTagResult, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "^la.*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "^la.*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -182,7 +187,7 @@ func TestPurgeTags(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(InvalidDateOneTagResult, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "^la.*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "^la.*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		assert.Equal(-1, deletedTags, "Number of deleted elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -195,7 +200,7 @@ func TestPurgeTags(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResult, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "latest").Return(&deletedResponse, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "^la.*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "^la.*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -213,7 +218,7 @@ func TestPurgeTags(t *testing.T) {
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v2").Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v3").Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v4").Return(&deletedResponse, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "[\\s\\S]*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "[\\s\\S]*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		assert.Equal(5, deletedTags, "Number of deleted elements should be 5")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -225,7 +230,7 @@ func TestPurgeTags(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResult, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "latest").Return(&notFoundResponse, errors.New("not found")).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "^la.*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "^la.*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		// If it is not found it can be assumed deleted.
 		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
 		assert.Equal(nil, err, "Error should be nil")
@@ -238,7 +243,7 @@ func TestPurgeTags(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResult, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "latest").Return(nil, errors.New("error during delete")).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "^la.*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "^la.*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		assert.Equal(-1, deletedTags, "Number of deleted elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -251,7 +256,7 @@ func TestPurgeTags(t *testing.T) {
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v2").Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v3").Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v4").Return(&deletedResponse, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "[\\s\\S]*", 1, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "[\\s\\S]*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, keep: 1, filterTimeout: 60})
 		assert.Equal(3, deletedTags, "Number of deleted elements should be 3")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -263,7 +268,7 @@ func TestPurgeTags(t *testing.T) {
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(FourTagsWithRepoFilterMatch, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1-c").Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1-b").Return(&deletedResponse, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, "v1-.*", 1, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "v1-.*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, keep: 1, filterTimeout: 60})
 		assert.Equal(2, deletedTags, "Number of deleted elements should be 2")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -274,7 +279,7 @@ func TestPurgeTags(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(FourTagsWithRepoFilterMatch, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1-c").Return(&deletedResponse, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, mustParseDuration("30m"), "v1-.*", 1, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "v1-.*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: mustParseDuration("30m"), keep: 1, filterTimeout: 60})
 		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -289,7 +294,7 @@ func TestPurgeManifests(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(notFoundManifestResponse, errors.New("testRepo not found")).Once()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -300,7 +305,7 @@ func TestPurgeManifests(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(nil, errors.New("unauthorized")).Once()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(-1, deletedTags, "Number of deleted elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -313,7 +318,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:2830cc0fcddc1bc2bd4aeab0ed5ee7087dab29a49e65151c77553e46a7ed5283").Return(EmptyListManifestsResult, nil).Once()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -336,7 +341,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(manifestList, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest1).Return(EmptyListManifestsResult, nil).Once()
 
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, mustParseDuration("1h"), 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: mustParseDuration("1h")})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.NoError(err)
 		mockClient.AssertExpectations(t)
@@ -360,7 +365,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest2).Return(EmptyListManifestsResult, nil).Once()
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, digest2).Return(nil, nil).Once()
 
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, mustParseDuration("24h"), 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: mustParseDuration("24h")})
 		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
 		assert.NoError(err)
 		mockClient.AssertExpectations(t)
@@ -372,7 +377,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:2830cc0fcddc1bc2bd4aeab0ed5ee7087dab29a49e65151c77553e46a7ed5283").Return(nil, errors.New("error getting manifests")).Once()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(-1, deletedTags, "Number of deleted elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -387,7 +392,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient.On("GetManifest", mock.Anything, testRepo, "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(nil, errors.New("error getting manifest")).Once()
 		// Despite the failure, the GetAcrManifests method may be called again before the failure happens
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(nil, nil).Maybe()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(-1, deletedTags, "Number of deleted elements should be -1")
 		assert.NotEqual(nil, err, "Error not should be nil")
 		mockClient.AssertExpectations(t)
@@ -401,7 +406,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient.On("GetManifest", mock.Anything, testRepo, "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return([]byte("invalid manifest"), nil).Once()
 		// Despite the failure, the GetAcrManifests method may be called again before the failure happens
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(nil, nil).Maybe()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(-1, deletedTags, "Number of deleted elements should be -1")
 		assert.NotEqual(nil, err, "Error not should be nil")
 		mockClient.AssertExpectations(t)
@@ -418,7 +423,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(EmptyListManifestsResult, nil).Once()
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:63532043b5af6247377a472ad075a42bde35689918de1cf7f807714997e0e683").Return(nil, nil).Once()
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(nil, nil).Once()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(2, deletedTags, "Number of deleted elements should be 2")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -434,7 +439,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(EmptyListManifestsResult, nil).Once()
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:63532043b5af6247377a472ad075a42bde35689918de1cf7f807714997e0e683").Return(nil, nil).Once()
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(&notFoundResponse, errors.New("manifest not found")).Once()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(2, deletedTags, "Number of deleted elements should be 2")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -449,7 +454,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(EmptyListManifestsResult, nil).Once()
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:63532043b5af6247377a472ad075a42bde35689918de1cf7f807714997e0e683").Return(nil, errors.New("error deleting manifest")).Once()
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(nil, nil).Maybe()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(-1, deletedTags, "Number of deleted elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -465,7 +470,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(EmptyListManifestsResult, nil).Once()
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:63532043b5af6247377a472ad075a42bde35689918de1cf7f807714997e0e683").Return(nil, nil).Maybe()
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(nil, errors.New("error deleting manifest")).Once()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(-1, deletedTags, "Number of deleted elements should be -1")
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
@@ -482,7 +487,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(doubleManifestV2WithoutTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(EmptyListManifestsResult, nil).Once()
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(nil, nil).Once()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -500,7 +505,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:d88fb54ba4424dada7c928c6af332ed1c49065ad85eafefb6f26664695015119").Return(doubleOCIWithoutTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(EmptyListManifestsResult, nil).Once()
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:6305e31b9b0081d2532397a1e08823f843f329a7af2ac98cb1d7f0355a3e3696").Return(nil, nil).Once()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -513,7 +518,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(deleteDisabledOneManifestResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -526,7 +531,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(writeDisabledOneManifestResult, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -539,7 +544,7 @@ func TestPurgeManifests(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(singleManifestWithSubjectWithoutTagResult, nil).Once()
 		mockClient.On("GetManifest", mock.Anything, testRepo, "sha256:118811b833e6ca4f3c65559654ca6359410730e97c719f5090d0bfe4db0ab588").Return(manifestWithSubjectOCIArtificate, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "sha256:118811b833e6ca4f3c65559654ca6359410730e97c719f5090d0bfe4db0ab588").Return(EmptyListManifestsResult, nil).Once()
-		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, false)
+		deletedTags, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -558,7 +563,7 @@ func TestDryRun(t *testing.T) {
 		mockClient.On("IsTokenExpired").Return(false).Maybe()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(notFoundManifestResponse, errors.New("testRepo not found")).Once()
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(notFoundTagResponse, errors.New("testRepo not found")).Once()
-		deletedTags, deletedManifests, err := purge(testCtx, mockClient, testLoginURL, 60, -24*time.Hour, 0, 1, true, false, map[string]string{testRepo: "[\\s\\S]*"}, true, false, false)
+		deletedTags, deletedManifests, _, err := purge(testCtx, mockClient, map[string]string{testRepo: "[\\s\\S]*"}, nil, purgeOptions{loginURL: testLoginURL, repoParallelism: 60, agoDuration: -24 * time.Hour, filterTimeout: 1, untagged: true, dryRun: true})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(0, deletedManifests, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
@@ -1449,7 +1454,7 @@ func TestIncludeLockedFlag(t *testing.T) {
 			return attrs.DeleteEnabled != nil && *attrs.DeleteEnabled && attrs.WriteEnabled != nil && *attrs.WriteEnabled
 		})).Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, tagName).Return(&deletedResponse, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, ".*", 0, 60, false, true)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60, includeLocked: true})
 		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -1464,7 +1469,7 @@ func TestIncludeLockedFlag(t *testing.T) {
 			return attrs.DeleteEnabled != nil && *attrs.DeleteEnabled && attrs.WriteEnabled != nil && *attrs.WriteEnabled
 		})).Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, tagName).Return(&deletedResponse, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, ".*", 0, 60, false, true)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60, includeLocked: true})
 		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -1492,7 +1497,7 @@ func TestIncludeLockedFlag(t *testing.T) {
 			return attrs.DeleteEnabled != nil && *attrs.DeleteEnabled && attrs.WriteEnabled != nil && *attrs.WriteEnabled
 		})).Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, digest).Return(&deletedResponse, nil).Once()
-		deletedManifests, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, false, true)
+		deletedManifests, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, includeLocked: true})
 		assert.Equal(1, deletedManifests, "Number of deleted manifests should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -1503,7 +1508,7 @@ func TestIncludeLockedFlag(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(DeleteDisabledOneTagResult, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, ".*", 0, 60, false, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
 		assert.Equal(0, deletedTags, "Number of deleted elements should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -1517,11 +1522,84 @@ func TestIncludeLockedFlag(t *testing.T) {
 		mockClient.On("UpdateAcrTagAttributes", mock.Anything, testRepo, tagName, mock.Anything).Return(nil, errors.New("unlock failed")).Once()
 		// Even though unlock fails, we still attempt deletion
 		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, tagName).Return(&deletedResponse, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, ".*", 0, 60, false, true)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60, includeLocked: true})
 		assert.Equal(1, deletedTags, "Number of deleted elements should be 1 as deletion succeeded despite unlock failure")
 		assert.Nil(err, "Error should be nil as deletion succeeded")
 		mockClient.AssertExpectations(t)
 	})
+
+	// Test that the lock of a tag is restored when its deletion fails
+	t.Run("IncludeLockedRestoresLockWhenDeleteFails", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		failedResponse := autorest.Response{Response: &http.Response{StatusCode: http.StatusInternalServerError}}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(DeleteDisabledOneTagResult, nil).Once()
+		mockClient.On("UpdateAcrTagAttributes", mock.Anything, testRepo, tagName, mock.MatchedBy(func(attrs *acr.ChangeableAttributes) bool {
+			return *attrs.DeleteEnabled && *attrs.WriteEnabled
+		})).Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, tagName).Return(&failedResponse, errors.New("delete failed")).Once()
+		mockClient.On("UpdateAcrTagAttributes", mock.Anything, testRepo, tagName, mock.MatchedBy(func(attrs *acr.ChangeableAttributes) bool {
+			return !*attrs.DeleteEnabled && *attrs.WriteEnabled
+		})).Return(&deletedResponse, nil).Once()
+		_, _, _, err := purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60, includeLocked: true})
+		assert.EqualError(err, "delete failed")
+		mockClient.AssertExpectations(t)
+	})
+
+	// Test that the lock of a manifest is restored when its deletion is not allowed
+	t.Run("IncludeLockedRestoresLockWhenDeleteNotAllowed", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		notAllowedResponse := autorest.Response{Response: &http.Response{StatusCode: http.StatusMethodNotAllowed}}
+		deleteDisabledDanglingManifest := &acr.Manifests{
+			Registry:  &testLoginURL,
+			ImageName: &testRepo,
+			ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+				LastUpdateTime:       &lastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteDisabled, WriteEnabled: &writeEnabled},
+				Digest:               &digest,
+				MediaType:            &dockerV2MediaType,
+			}},
+		}
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(deleteDisabledDanglingManifest, nil).Once()
+		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("UpdateAcrManifestAttributes", mock.Anything, testRepo, digest, mock.MatchedBy(func(attrs *acr.ChangeableAttributes) bool {
+			return *attrs.DeleteEnabled
+		})).Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteManifest", mock.Anything, testRepo, digest).Return(&notAllowedResponse, errors.New("not allowed")).Once()
+		mockClient.On("UpdateAcrManifestAttributes", mock.Anything, testRepo, digest, mock.MatchedBy(func(attrs *acr.ChangeableAttributes) bool {
+			return !*attrs.DeleteEnabled
+		})).Return(&deletedResponse, nil).Once()
+		deletedManifests, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, includeLocked: true})
+		assert.Equal(0, deletedManifests)
+		assert.NoError(err)
+		mockClient.AssertExpectations(t)
+	})
+
+	// Test that a lock that cannot be restored is reported
+	t.Run("IncludeLockedRestoreFailureIsReported", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		notAllowedResponse := autorest.Response{Response: &http.Response{StatusCode: http.StatusMethodNotAllowed}}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(DeleteDisabledOneTagResult, nil).Once()
+		mockClient.On("UpdateAcrTagAttributes", mock.Anything, testRepo, tagName, mock.MatchedBy(func(attrs *acr.ChangeableAttributes) bool {
+			return *attrs.DeleteEnabled
+		})).Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, tagName).Return(&notAllowedResponse, errors.New("not allowed")).Once()
+		mockClient.On("UpdateAcrTagAttributes", mock.Anything, testRepo, tagName, mock.MatchedBy(func(attrs *acr.ChangeableAttributes) bool {
+			return !*attrs.DeleteEnabled
+		})).Return(nil, errors.New("restore failed")).Once()
+		reporter, err := report.NewReporter("", io.Discard)
+		assert.NoError(err)
+		var records []report.Record
+		reporter.Subscribe(func(record report.Record) { records = append(records, record) })
+		_, _, _, err = purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60, includeLocked: true, reporter: reporter})
+		assert.NoError(err)
+		assert.Equal(1, reporter.Count(report.ActionRestoreFailed))
+		assert.Equal(report.ActionRestoreFailed, records[len(records)-1].Action)
+		assert.Equal("restore failed", records[len(records)-1].Reason)
+		mockClient.AssertExpectations(t)
+	})
 }
 
 // TestDryRunWithIncludeLocked contains tests for dry-run behavior with include-locked flag
@@ -1532,7 +1610,7 @@ func TestDryRunWithIncludeLocked(t *testing.T) {
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(DeleteDisabledOneTagResult, nil).Once()
 		// No unlock or delete calls should be made in dry-run mode
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, ".*", 0, 60, true, true)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60, dryRun: true, includeLocked: true})
 		assert.Equal(1, deletedTags, "Number of tags to be deleted should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -1557,7 +1635,7 @@ func TestDryRunWithIncludeLocked(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", "").Return(deleteDisabledDanglingManifest, nil).Once()
 		mockClient.On("GetAcrManifests", mock.Anything, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
 		// No unlock or delete calls should be made in dry-run mode
-		deletedManifests, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, 0, nil, true, true)
+		deletedManifests, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, dryRun: true, includeLocked: true})
 		assert.Equal(1, deletedManifests, "Number of manifests to be deleted should be 1")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -1568,7 +1646,7 @@ func TestDryRunWithIncludeLocked(t *testing.T) {
 		assert := assert.New(t)
 		mockClient := &mocks.AcrCLIClientInterface{}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(DeleteDisabledOneTagResult, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, ".*", 0, 60, true, false)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60, dryRun: true})
 		assert.Equal(0, deletedTags, "Number of tags to be deleted should be 0")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
@@ -1603,9 +1681,306 @@ func TestDryRunWithIncludeLocked(t *testing.T) {
 			},
 		}
 		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(mixedTagsResult, nil).Once()
-		deletedTags, _, err := purgeTags(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, defaultAgoDuration, ".*", 0, 60, true, true)
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60, dryRun: true, includeLocked: true})
 		assert.Equal(2, deletedTags, "Number of tags to be deleted should be 2 with include-locked")
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
 	})
 }
+
+// TestPurgeTagsSemverKeep tests that the tags protected by the semantic version keep rule are not deleted.
+func TestPurgeTagsSemverKeep(t *testing.T) {
+	semverTag := func(name string) acr.TagAttributesBase {
+		tagName := name
+		return acr.TagAttributesBase{
+			Name:                 &tagName,
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled, WriteEnabled: &writeEnabled},
+			Digest:               &digest,
+		}
+	}
+	semverTagsResult := &acr.RepositoryTagsType{
+		Response: autorest.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+			},
+		},
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		TagsAttributes: &[]acr.TagAttributesBase{
+			semverTag("v1.1.1"),
+			semverTag("v1.1.0"),
+			semverTag("v1.0.1"),
+			semverTag("v1.0.0"),
+			semverTag("v1.1.2-rc.1"),
+			semverTag("dev"),
+		},
+	}
+
+	t.Run("ProtectLatestPatchOfLatestMinor", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		// The first call collects every tag to compute the protected versions, the second one selects the tags to delete.
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(semverTagsResult, nil).Twice()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1.1.0").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1.0.1").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1.0.0").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1.1.2-rc.1").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "dev").Return(&deletedResponse, nil).Once()
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, semverKeep: tag.SemverKeep{Minors: 1, Patches: 1}, filterTimeout: 60})
+		assert.Equal(5, deletedTags, "Number of deleted elements should be 5")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("ProtectedTagsDoNotCountTowardsKeep", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(semverTagsResult, nil).Twice()
+		// v1.1.1, v1.1.0, v1.0.1 and v1.0.0 are protected, the most recent of the remaining tags is kept.
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "dev").Return(&deletedResponse, nil).Once()
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, keep: 1, semverKeep: tag.SemverKeep{Minors: 2, Patches: 2}, filterTimeout: 60})
+		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("OnlyTagsMatchingTheFilterAreConsidered", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(semverTagsResult, nil).Twice()
+		// v1.1.1 does not match the filter, so v1.0.1 is the latest patch of the latest minor version and is protected.
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1.0.0").Return(&deletedResponse, nil).Once()
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, `^v1\.0\..*`, "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, semverKeep: tag.SemverKeep{Minors: 1, Patches: 1}, filterTimeout: 60})
+		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestPurgeTagsExclude checks that tags matching the exclude filter are kept and counted separately.
+func TestPurgeTagsExclude(t *testing.T) {
+	t.Run("ExcludedTagsAreKept", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v2").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v4").Return(&deletedResponse, nil).Once()
+		deletedTags, excludedTags, _, err := purgeTags(testCtx, mockClient, testRepo, "v.*", "^v1$|^v3$", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
+		assert.Equal(2, deletedTags, "Number of deleted elements should be 2")
+		assert.Equal(2, excludedTags, "Number of excluded elements should be 2")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("ExcludedTagsDoNotCountTowardsKeep", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(FourTagsResult, nil).Once()
+		// v1 is excluded, v2 is the most recent of the remaining tags and is kept.
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v3").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v4").Return(&deletedResponse, nil).Once()
+		deletedTags, excludedTags, _, err := purgeTags(testCtx, mockClient, testRepo, "v.*", "^v1$", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, keep: 1, filterTimeout: 60})
+		assert.Equal(2, deletedTags, "Number of deleted elements should be 2")
+		assert.Equal(1, excludedTags, "Number of excluded elements should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("TagsNotMatchingTheFilterAreNotCounted", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v2").Return(&deletedResponse, nil).Once()
+		deletedTags, excludedTags, _, err := purgeTags(testCtx, mockClient, testRepo, "^v2$", "^v1$", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
+		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
+		assert.Equal(0, excludedTags, "Tags that do not match the filter should not be reported as excluded")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("InvalidExcludeRegex", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "v.*", "[", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60})
+		assert.Equal(-1, deletedTags, "Number of deleted elements should be -1")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestPurgeTagsReport checks that every tag matching the filter is recorded in the report with the action taken.
+func TestPurgeTagsReport(t *testing.T) {
+	// reportRecords decodes the records of a json report.
+	reportRecords := func(t *testing.T, out *bytes.Buffer) []report.Record {
+		t.Helper()
+		var document struct {
+			Records []report.Record `json:"records"`
+		}
+		if err := json.Unmarshal(out.Bytes(), &document); err != nil {
+			t.Fatalf("Failed to decode report: %v", err)
+		}
+		return document.Records
+	}
+
+	t.Run("DeletedKeptAndExcluded", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		reporter, _ := report.NewReporter("json", out)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v3").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v4").Return(&notFoundResponse, errors.New("not found")).Once()
+		deletedTags, _, _, err := purgeTags(testCtx, mockClient, testRepo, "v.*", "^v1$", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, keep: 1, filterTimeout: 60, reporter: reporter})
+		assert.Equal(2, deletedTags, "Number of deleted elements should be 2")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Nil(reporter.Close(report.Summary{}))
+
+		actions := map[string]report.Action{}
+		for _, record := range reportRecords(t, out) {
+			assert.Equal(testRepo, record.Repository)
+			actions[record.Tag] = record.Action
+			if record.Tag == "v4" {
+				assert.Equal(http.StatusNotFound, record.HTTPStatus, "The HTTP status should be recorded")
+			}
+		}
+		assert.Equal(map[string]report.Action{
+			"v1": report.ActionKept,
+			"v2": report.ActionKept,
+			"v3": report.ActionDeleted,
+			"v4": report.ActionSkipped,
+		}, actions)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("LockedAndDryRun", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		reporter, _ := report.NewReporter("json", out)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(DeleteDisabledOneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResult, nil).Once()
+		_, _, _, err := purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60, reporter: reporter})
+		assert.Equal(nil, err, "Error should be nil")
+		_, _, _, err = purgeTags(testCtx, mockClient, testRepo, ".*", "", purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: defaultAgoDuration, filterTimeout: 60, dryRun: true, reporter: reporter})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Nil(reporter.Close(report.Summary{}))
+
+		records := reportRecords(t, out)
+		assert.Len(records, 2)
+		assert.Equal(report.ActionLocked, records[0].Action)
+		assert.Equal(report.ActionDeleted, records[1].Action)
+		assert.True(records[1].DryRun, "Dry run deletions should be flagged")
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestPurgeInterrupted checks that an interrupted purge completes the deletions in flight, skips the others and
+// reports what was purged.
+func TestPurgeInterrupted(t *testing.T) {
+	// The context is canceled by the first deletion, which still completes, the other tags are never deleted.
+	t.Run("InFlightDeletionsAreDrained", func(t *testing.T) {
+		assert := assert.New(t)
+		ctx, cancel := context.WithCancel(testCtx)
+		defer cancel()
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("IsAbac").Return(false)
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1").Run(func(args mock.Arguments) {
+			cancel()
+			assert.Nil(args.Get(0).(context.Context).Err(), "The deletion in flight should not be canceled")
+		}).Return(&deletedResponse, nil).Once()
+		deletedTags, deletedManifests, _, err := purge(ctx, mockClient, map[string]string{testRepo: "v.*", "other": "v.*"}, nil, purgeOptions{loginURL: testLoginURL, repoParallelism: 1, agoDuration: defaultAgoDuration, filterTimeout: 60, untagged: true})
+		assert.NotNil(err, "Error should not be nil")
+		assert.Contains(err.Error(), "purge interrupted while purging repository")
+		assert.Contains(err.Error(), "Completed repositories: none")
+		assert.Equal(1, deletedTags, "The tag deleted before the interruption should be counted")
+		assert.Equal(0, deletedManifests)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("TimedOut", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(testCtx, 0)
+		defer cancel()
+		<-ctx.Done()
+		err := formatInterruptedError(ctx, testRepo, []string{"done"}, []string{testRepo, "other"})
+		assert.Contains(t, err.Error(), "purge timed out while purging repository")
+		assert.Contains(t, err.Error(), "Completed repositories (1): done")
+		assert.Contains(t, err.Error(), "Remaining repositories not yet processed (1): other")
+	})
+}
+
+// TestResolveConcurrency checks that --concurrency accepts a number, which is clamped to the allowed range, or auto.
+func TestResolveConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	poolSize, limiter, err := resolveConcurrency("4")
+	assert.Nil(err, "Error should be nil")
+	assert.Equal(4, poolSize)
+	assert.Nil(limiter, "A fixed concurrency should not be adaptive")
+
+	poolSize, _, err = resolveConcurrency("0")
+	assert.Nil(err, "Error should be nil")
+	assert.Equal(defaultPoolSize, poolSize)
+
+	poolSize, _, err = resolveConcurrency("100")
+	assert.Nil(err, "Error should be nil")
+	assert.Equal(maxPoolSize, poolSize)
+
+	poolSize, limiter, err = resolveConcurrency(concurrencyAuto)
+	assert.Nil(err, "Error should be nil")
+	assert.Equal(maxPoolSize, poolSize)
+	assert.NotNil(limiter, "An auto concurrency should be adaptive")
+	current, _, _ := limiter.Limits()
+	assert.Equal(defaultPoolSize, current, "The adaptive concurrency should start at the default value")
+
+	_, _, err = resolveConcurrency("many")
+	assert.NotNil(err, "Error should not be nil")
+}
+
+// TestMessageWriter checks that the human readable messages only move to stderr when a report is written to stdout.
+func TestMessageWriter(t *testing.T) {
+	assert := assert.New(t)
+	reporter, err := report.NewReporter(string(report.FormatText), os.Stdout)
+	assert.Nil(err, "Error should be nil")
+	assert.Equal(os.Stdout, messageWriter(reporter))
+	reporter, err = report.NewReporter(string(report.FormatJSON), os.Stdout)
+	assert.Nil(err, "Error should be nil")
+	assert.Equal(os.Stderr, messageWriter(reporter))
+}
+
+// TestPurgeContinueOnError checks that with collected failures a failed deletion or repository does not stop the purge.
+func TestPurgeContinueOnError(t *testing.T) {
+	t.Run("FailuresAreCollected", func(t *testing.T) {
+		assert := assert.New(t)
+		failures := report.NewFailures()
+		failedResponse := autorest.Response{Response: &http.Response{StatusCode: http.StatusInternalServerError}}
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("IsAbac").Return(false)
+		mockClient.On("GetAcrTags", mock.Anything, "other", "timedesc", "").Return(nil, errors.New("failed to list tags")).Once()
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v1").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v2").Return(&failedResponse, errors.New("failed to delete tag")).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v3").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, testRepo, "v4").Return(&deletedResponse, nil).Once()
+		deletedTags, _, _, err := purge(testCtx, mockClient, map[string]string{testRepo: "v.*", "other": "v.*"}, nil, purgeOptions{loginURL: testLoginURL, repoParallelism: defaultPoolSize, agoDuration: defaultAgoDuration, filterTimeout: 60, failures: failures})
+		assert.Nil(err, "Error should be nil, the failures are collected")
+		assert.Equal(3, deletedTags, "Number of deleted tags should be 3")
+		assert.Equal(2, failures.Len(), "The failed tag and the failed repository should be collected")
+		assert.True(failures.Has(testRepo))
+		assert.True(failures.Has("other"))
+		assert.NotNil(failures.Err(), "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+
+	// Without collected failures the first failed repository stops the purge.
+	t.Run("StopAtFirstError", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("IsAbac").Return(false)
+		mockClient.On("GetAcrTags", mock.Anything, "another", "timedesc", "").Return(nil, errors.New("failed to list tags")).Once()
+		_, _, _, err := purge(testCtx, mockClient, map[string]string{"another": "v.*", testRepo: "v.*"}, nil, purgeOptions{loginURL: testLoginURL, repoParallelism: defaultPoolSize, agoDuration: defaultAgoDuration, filterTimeout: 60})
+		assert.NotNil(err, "Error should not be nil")
+		mockClient.AssertNotCalled(t, "GetAcrTags", mock.Anything, testRepo, "timedesc", "")
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -77,21 +77,12 @@ func TestPurgeUntaggedOnly(t *testing.T) {
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, manifestDigest).Return(localDeletedResponse, nil).Once()
 
 		// Call purge with untaggedOnly=true
-		deletedTagsCount, deletedManifestsCount, err := purge(
-			testCtx,
-			mockClient,
-			testLoginURL,
-			defaultPoolSize,
-			0, // ago is 0 for untagged-only (meaning all past manifests are eligible)
-			0, // keep is 0 for untagged-only
-			60,
-			true, // removeUntaggedManifests
-			true, // untaggedOnly
-			map[string]string{testRepo: ".*"},
-			false, // dryRun
-			false, // includeLocked
-			false, // verbose
-		)
+		deletedTagsCount, deletedManifestsCount, _, err := purge(testCtx, mockClient, map[string]string{testRepo: ".*"}, nil, purgeOptions{
+			loginURL:        testLoginURL,
+			repoParallelism: defaultPoolSize,
+			filterTimeout:   60,
+			untaggedOnly:    true,
+		})
 
 		assert.Equal(0, deletedTagsCount, "No tags should be deleted in untagged-only mode")
 		assert.Equal(1, deletedManifestsCount, "One untagged manifest should be deleted")
@@ -132,21 +123,12 @@ func TestPurgeUntaggedOnly(t *testing.T) {
 			tagFilters[repo] = ".*"
 		}
 
-		deletedTagsCount, deletedManifestsCount, err := purge(
-			testCtx,
-			mockClient,
-			testLoginURL,
-			defaultPoolSize,
-			0, // ago is 0 for untagged-only (meaning all past manifests are eligible)
-			0, // keep is 0 for untagged-only
-			60,
-			true, // removeUntaggedManifests
-			true, // untaggedOnly
-			tagFilters,
-			false, // dryRun
-			false, // includeLocked
-			false, // verbose
-		)
+		deletedTagsCount, deletedManifestsCount, _, err := purge(testCtx, mockClient, tagFilters, nil, purgeOptions{
+			loginURL:        testLoginURL,
+			repoParallelism: defaultPoolSize,
+			filterTimeout:   60,
+			untaggedOnly:    true,
+		})
 
 		assert.Equal(0, deletedTagsCount, "No tags should be deleted")
 		assert.Equal(0, deletedManifestsCount, "No manifests deleted when none are untagged")
@@ -204,21 +186,12 @@ func TestPurgeUntaggedOnly(t *testing.T) {
 		}
 		mockClient.On("DeleteManifest", mock.Anything, "specific-repo", manifestDigest).Return(localDeletedResponse, nil).Once()
 
-		deletedTagsCount, deletedManifestsCount, err := purge(
-			testCtx,
-			mockClient,
-			testLoginURL,
-			defaultPoolSize,
-			0, // ago is 0 for untagged-only (meaning all past manifests are eligible)
-			0, // keep is 0 for untagged-only
-			60,
-			true, // removeUntaggedManifests
-			true, // untaggedOnly
-			map[string]string{"specific-repo": ".*"},
-			false, // dryRun
-			false, // includeLocked
-			false, // verbose
-		)
+		deletedTagsCount, deletedManifestsCount, _, err := purge(testCtx, mockClient, map[string]string{"specific-repo": ".*"}, nil, purgeOptions{
+			loginURL:        testLoginURL,
+			repoParallelism: defaultPoolSize,
+			filterTimeout:   60,
+			untaggedOnly:    true,
+		})
 
 		assert.Equal(0, deletedTagsCount, "No tags should be deleted in untagged-only mode")
 		assert.Equal(1, deletedManifestsCount, "One untagged manifest should be deleted")
@@ -271,21 +244,13 @@ func TestPurgeUntaggedOnly(t *testing.T) {
 		// Note: GetManifest is not called for untagged manifests
 		// No DeleteManifest call expected in dry-run mode
 
-		deletedTagsCount, deletedManifestsCount, err := purge(
-			testCtx,
-			mockClient,
-			testLoginURL,
-			defaultPoolSize,
-			0, // ago is 0 for untagged-only (meaning all past manifests are eligible)
-			0, // keep is 0 for untagged-only
-			60,
-			true, // removeUntaggedManifests
-			true, // untaggedOnly
-			map[string]string{testRepo: ".*"},
-			true,  // dryRun
-			false, // includeLocked
-			false, // verbose
-		)
+		deletedTagsCount, deletedManifestsCount, _, err := purge(testCtx, mockClient, map[string]string{testRepo: ".*"}, nil, purgeOptions{
+			loginURL:        testLoginURL,
+			repoParallelism: defaultPoolSize,
+			filterTimeout:   60,
+			untaggedOnly:    true,
+			dryRun:          true,
+		})
 
 		assert.Equal(0, deletedTagsCount, "No tags should be deleted in dry-run")
 		assert.Equal(1, deletedManifestsCount, "Should report 1 manifest to be deleted in dry-run")
@@ -355,21 +320,12 @@ func TestPurgeUntaggedOnly(t *testing.T) {
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, unlockedDigest).Return(localDeletedResponse, nil).Once()
 		// No delete call for locked manifest
 
-		deletedTagsCount, deletedManifestsCount, err := purge(
-			testCtx,
-			mockClient,
-			testLoginURL,
-			defaultPoolSize,
-			0, // ago is 0 for untagged-only (meaning all past manifests are eligible)
-			0, // keep is 0 for untagged-only
-			60,
-			true, // removeUntaggedManifests
-			true, // untaggedOnly
-			map[string]string{testRepo: ".*"},
-			false, // dryRun
-			false, // includeLocked = false
-			false, // verbose
-		)
+		deletedTagsCount, deletedManifestsCount, _, err := purge(testCtx, mockClient, map[string]string{testRepo: ".*"}, nil, purgeOptions{
+			loginURL:        testLoginURL,
+			repoParallelism: defaultPoolSize,
+			filterTimeout:   60,
+			untaggedOnly:    true,
+		})
 
 		assert.Equal(0, deletedTagsCount, "No tags should be deleted")
 		assert.Equal(1, deletedManifestsCount, "Only unlocked manifest should be deleted")
@@ -436,21 +392,13 @@ func TestPurgeUntaggedOnly(t *testing.T) {
 		}
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, lockedDigest).Return(localDeletedResponse, nil).Once()
 
-		deletedTagsCount, deletedManifestsCount, err := purge(
-			testCtx,
-			mockClient,
-			testLoginURL,
-			defaultPoolSize,
-			0, // ago is 0 for untagged-only (meaning all past manifests are eligible)
-			0, // keep is 0 for untagged-only
-			60,
-			true, // removeUntaggedManifests
-			true, // untaggedOnly
-			map[string]string{testRepo: ".*"},
-			false, // dryRun
-			true,  // includeLocked = true
-			false, // verbose
-		)
+		deletedTagsCount, deletedManifestsCount, _, err := purge(testCtx, mockClient, map[string]string{testRepo: ".*"}, nil, purgeOptions{
+			loginURL:        testLoginURL,
+			repoParallelism: defaultPoolSize,
+			filterTimeout:   60,
+			untaggedOnly:    true,
+			includeLocked:   true,
+		})
 
 		assert.Equal(0, deletedTagsCount, "No tags should be deleted")
 		assert.Equal(1, deletedManifestsCount, "Locked manifest should be unlocked and deleted")
@@ -557,7 +505,7 @@ func TestPurgeDanglingManifestsWithAgoAndKeep(t *testing.T) {
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:old123").Return(nil, nil).Once()
 
 		// Call with 300 days ago (should only delete the old manifest from 2023)
-		deletedCount, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, mustParseDuration("300d"), 0, nil, false, false)
+		deletedCount, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: mustParseDuration("300d")})
 
 		assert.Nil(err, "Should not return error")
 		assert.Equal(1, deletedCount, "Should delete only the old manifest")
@@ -602,7 +550,7 @@ func TestPurgeDanglingManifestsWithAgoAndKeep(t *testing.T) {
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:medium").Return(nil, nil).Once()
 
 		// Call with keep=2 (should preserve the 2 most recent manifests)
-		deletedCount, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, 0, 2, nil, false, false)
+		deletedCount, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, keep: 2})
 
 		assert.Nil(err, "Should not return error")
 		assert.Equal(3, deletedCount, "Should delete 3 manifests, keeping 2 most recent")
@@ -647,7 +595,7 @@ func TestPurgeDanglingManifestsWithAgoAndKeep(t *testing.T) {
 		mockClient.On("DeleteManifest", mock.Anything, testRepo, "sha256:veryold2").Return(nil, nil).Once()
 
 		// Call with both age filter (300 days) and keep (keep 1 of the old ones)
-		deletedCount, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, mustParseDuration("300d"), 1, nil, false, false)
+		deletedCount, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: mustParseDuration("300d"), keep: 1})
 
 		assert.Nil(err, "Should not return error")
 		assert.Equal(2, deletedCount, "Should delete 2 old manifests, keeping 1 old + all recent ones")
@@ -684,7 +632,7 @@ func TestPurgeDanglingManifestsWithAgoAndKeep(t *testing.T) {
 		// No UpdateAcrManifestAttributes calls expected for dry run
 
 		// Call with dry run and age filter
-		deletedCount, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, mustParseDuration("300d"), 0, nil, true, false)
+		deletedCount, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, agoDuration: mustParseDuration("300d"), dryRun: true})
 
 		assert.Nil(err, "Should not return error")
 		assert.Equal(1, deletedCount, "Should report 1 manifest would be deleted")
@@ -724,7 +672,7 @@ func TestPurgeDanglingManifestsWithAgoAndKeep(t *testing.T) {
 		// No DeleteManifest calls expected - keep exceeds manifest count
 
 		// Call with keep=10 but only 3 manifests exist - should delete nothing
-		deletedCount, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, 0, 10, nil, false, false)
+		deletedCount, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, keep: 10})
 
 		assert.Nil(err, "Should not return error")
 		assert.Equal(0, deletedCount, "Should delete 0 manifests when keep exceeds manifest count")
@@ -764,7 +712,7 @@ func TestPurgeDanglingManifestsWithAgoAndKeep(t *testing.T) {
 		// No DeleteManifest calls expected - keep equals manifest count
 
 		// Call with keep=3 and exactly 3 manifests - should delete nothing
-		deletedCount, err := purgeDanglingManifests(testCtx, mockClient, defaultPoolSize, testLoginURL, testRepo, 0, 3, nil, false, false)
+		deletedCount, err := purgeDanglingManifests(testCtx, mockClient, testRepo, nil, purgeOptions{repoParallelism: defaultPoolSize, loginURL: testLoginURL, keep: 3})
 
 		assert.Nil(err, "Should not return error")
 		assert.Equal(0, deletedCount, "Should delete 0 manifests when keep equals manifest count")
@@ -813,21 +761,13 @@ func TestPurgeAbacVerboseMode(t *testing.T) {
 		os.Stdout = w
 
 		// Call purge with verbose=true and ABAC enabled
-		deletedTagsCount, deletedManifestsCount, purgeErr := purge(
-			testCtx,
-			mockClient,
-			testLoginURL,
-			defaultPoolSize,
-			0,    // ago
-			0,    // keep
-			60,   // filterTimeout
-			true, // removeUntaggedManifests
-			true, // untaggedOnly
-			tagFilters,
-			false, // dryRun
-			false, // includeLocked
-			true,  // verbose = true
-		)
+		deletedTagsCount, deletedManifestsCount, _, purgeErr := purge(testCtx, mockClient, tagFilters, nil, purgeOptions{
+			loginURL:        testLoginURL,
+			repoParallelism: defaultPoolSize,
+			filterTimeout:   60,
+			untaggedOnly:    true,
+			verbose:         true,
+		})
 
 		// Restore stdout and read captured output
 		err := w.Close()
@@ -889,21 +829,12 @@ func TestPurgeAbacVerboseMode(t *testing.T) {
 		os.Stdout = w
 
 		// Call purge with verbose=false and ABAC enabled
-		deletedTagsCount, deletedManifestsCount, purgeErr := purge(
-			testCtx,
-			mockClient,
-			testLoginURL,
-			defaultPoolSize,
-			0,    // ago
-			0,    // keep
-			60,   // filterTimeout
-			true, // removeUntaggedManifests
-			true, // untaggedOnly
-			tagFilters,
-			false, // dryRun
-			false, // includeLocked
-			false, // verbose = false
-		)
+		deletedTagsCount, deletedManifestsCount, _, purgeErr := purge(testCtx, mockClient, tagFilters, nil, purgeOptions{
+			loginURL:        testLoginURL,
+			repoParallelism: defaultPoolSize,
+			filterTimeout:   60,
+			untaggedOnly:    true,
+		})
 
 		// Restore stdout and read captured output
 		err := w.Close()
@@ -950,21 +881,13 @@ func TestPurgeAbacVerboseMode(t *testing.T) {
 		mockClient.On("GetAcrManifests", mock.Anything, "test-repo", "", "").Return(emptyManifestsResult, nil).Once()
 
 		// Call purge with verbose=true but non-ABAC registry
-		deletedTagsCount, deletedManifestsCount, err := purge(
-			testCtx,
-			mockClient,
-			testLoginURL,
-			defaultPoolSize,
-			0,    // ago
-			0,    // keep
-			60,   // filterTimeout
-			true, // removeUntaggedManifests
-			true, // untaggedOnly
-			map[string]string{"test-repo": ".*"},
-			false, // dryRun
-			false, // includeLocked
-			true,  // verbose = true
-		)
+		deletedTagsCount, deletedManifestsCount, _, err := purge(testCtx, mockClient, map[string]string{"test-repo": ".*"}, nil, purgeOptions{
+			loginURL:        testLoginURL,
+			repoParallelism: defaultPoolSize,
+			filterTimeout:   60,
+			untaggedOnly:    true,
+			verbose:         true,
+		})
 
 		assert.Equal(0, deletedTagsCount, "No tags should be deleted")
 		assert.Equal(0, deletedManifestsCount, "No manifests deleted")
@@ -0,0 +1,338 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/acr/acrapi"
+	"github.com/Azure/acr-cli/cmd/repository"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newRepositoryCmdLongMessage       = `acr repository: list, show, update and delete the repositories of a registry.`
+	newRepositoryListCmdLongMessage   = `acr repository list: outputs the repositories of the registry, optionally only the ones whose name matches a regular expression`
+	newRepositoryShowCmdLongMessage   = `acr repository show: outputs the manifest and tag counts, the created and last update times and the changeable attributes of a repository`
+	newRepositoryDeleteCmdLongMessage = `acr repository delete: delete a repository along with all of its manifests and tags, after a confirmation`
+	newRepositoryUpdateCmdLongMessage = `acr repository update: enable or disable the deletion, writes, listing and reads of a repository`
+)
+
+// Besides the registry name and authentication information the subcommands take the repository as an argument.
+type repositoryParameters struct {
+	*rootParameters
+	filter        string
+	filterTimeout int64
+	repoPageSize  int32
+	yes           bool
+	attributes    changeableAttributesFlags
+}
+
+// changeableAttributesFlags holds the values of the --delete-enabled, --write-enabled, --list-enabled and
+// --read-enabled flags, only the flags that were set are applied.
+type changeableAttributesFlags struct {
+	deleteEnabled bool
+	writeEnabled  bool
+	listEnabled   bool
+	readEnabled   bool
+}
+
+// The repository command can be used to list, show, update or delete repositories, that can be done with the
+// repository list, show, update and delete commands respectively.
+func newRepositoryCmd(rootParams *rootParameters) *cobra.Command {
+	repositoryParams := repositoryParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:   "repository",
+		Short: "Manage the repositories of a registry",
+		Long:  newRepositoryCmdLongMessage,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_ = cmd.Help()
+			return nil
+		},
+	}
+
+	cmd.AddCommand(
+		newRepositoryListCmd(&repositoryParams),
+		newRepositoryShowCmd(&repositoryParams),
+		newRepositoryDeleteCmd(&repositoryParams),
+		newRepositoryUpdateCmd(&repositoryParams),
+	)
+	return cmd
+}
+
+// newRepositoryListCmd creates the repository list command, the repositories are listed through the catalog so no
+// repository scoped token is needed on ABAC registries.
+func newRepositoryListCmd(repositoryParams *repositoryParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the repositories of a registry",
+		Long:  newRepositoryListCmdLongMessage,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			registryName, err := repositoryParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			ctx := cmd.Context()
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, repositoryParams.username, repositoryParams.password, repositoryParams.configs, repositoryParams.transport)
+			if err != nil {
+				return err
+			}
+			acrClient.SetRetryPolicy(repositoryParams.retryPolicy(false))
+			return listRepositories(ctx, acrClient.AutorestClient, os.Stdout, loginURL, repositoryParams.filter, repositoryParams.filterTimeout, repositoryParams.repoPageSize)
+		},
+	}
+	cmd.Flags().StringVar(&repositoryParams.filter, "filter", "", "Regular expression the repository names must match as a whole to be listed, every repository is listed by default")
+	cmd.Flags().Int64Var(&repositoryParams.filterTimeout, "filter-timeout-seconds", defaultRegexpMatchTimeoutSeconds, "This limits the evaluation of the regex filter, and will return a timeout error if this duration is exceeded during a single evaluation. If written incorrectly a regexp filter with backtracking can result in an infinite loop")
+	cmd.Flags().Int32Var(&repositoryParams.repoPageSize, "repository-page-size", defaultRepoPageSize, repoPageSizeDescription)
+	return cmd
+}
+
+// listRepositories prints the repositories of the registry whose name matches the filter, all of them when it is empty.
+func listRepositories(ctx context.Context, client acrapi.BaseClientAPI, out io.Writer, loginURL string, filter string, filterTimeout int64, repoPageSize int32) error {
+	repoNames, err := repository.GetAllRepositoryNames(ctx, client, repoPageSize)
+	if err != nil {
+		return errors.Wrap(err, "failed to list repositories")
+	}
+	if filter != "" {
+		repoNames, err = repository.GetMatchingRepos(repoNames, "^"+filter+"$", filterTimeout)
+		if err != nil {
+			return err
+		}
+	}
+	for _, repoName := range repoNames {
+		fmt.Fprintf(out, "%s/%s\n", loginURL, repoName)
+	}
+	return nil
+}
+
+// newRepositoryShowCmd creates the repository show command.
+func newRepositoryShowCmd(repositoryParams *repositoryParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show <repository>",
+		Short: "Show the attributes of a repository",
+		Long:  newRepositoryShowCmdLongMessage,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			acrClient, loginURL, err := repositoryParams.newClient(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return showRepository(cmd.Context(), acrClient, os.Stdout, loginURL, args[0])
+		},
+	}
+	return cmd
+}
+
+// showRepository prints the attributes of a repository.
+func showRepository(ctx context.Context, acrClient api.AcrCLIClientInterface, out io.Writer, loginURL string, repoName string) error {
+	attributes, err := acrClient.GetAcrRepositoryAttributes(ctx, repoName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the attributes of repository %s", repoName)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Repository:\t%s/%s\n", loginURL, repoName)
+	fmt.Fprintf(w, "Created:\t%s\n", stringValue(attributes.CreatedTime))
+	fmt.Fprintf(w, "Last updated:\t%s\n", stringValue(attributes.LastUpdateTime))
+	fmt.Fprintf(w, "Manifests:\t%d\n", int32Value(attributes.ManifestCount))
+	fmt.Fprintf(w, "Tags:\t%d\n", int32Value(attributes.TagCount))
+	if changeable := attributes.ChangeableAttributes; changeable != nil {
+		fmt.Fprintf(w, "Delete enabled:\t%t\n", boolValue(changeable.DeleteEnabled))
+		fmt.Fprintf(w, "Write enabled:\t%t\n", boolValue(changeable.WriteEnabled))
+		fmt.Fprintf(w, "List enabled:\t%t\n", boolValue(changeable.ListEnabled))
+		fmt.Fprintf(w, "Read enabled:\t%t\n", boolValue(changeable.ReadEnabled))
+	}
+	return w.Flush()
+}
+
+// newRepositoryDeleteCmd creates the repository delete command. The deletion is confirmed interactively unless --yes
+// is set.
+func newRepositoryDeleteCmd(repositoryParams *repositoryParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete <repository>",
+		Short: "Delete a repository",
+		Long:  newRepositoryDeleteCmdLongMessage,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			acrClient, loginURL, err := repositoryParams.newClient(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			var in io.Reader = os.Stdin
+			if repositoryParams.yes {
+				in = nil
+			}
+			return deleteRepository(cmd.Context(), acrClient, in, os.Stdout, loginURL, args[0])
+		},
+	}
+	cmd.Flags().BoolVarP(&repositoryParams.yes, "yes", "y", false, "Do not prompt for confirmation")
+	return cmd
+}
+
+// deleteRepository deletes a repository after the user confirmed it on in, the confirmation is skipped when in is nil.
+func deleteRepository(ctx context.Context, acrClient api.AcrCLIClientInterface, in io.Reader, out io.Writer, loginURL string, repoName string) error {
+	if in != nil {
+		// The counts are shown so that the user knows what is about to be deleted.
+		attributes, err := acrClient.GetAcrRepositoryAttributes(ctx, repoName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get the attributes of repository %s", repoName)
+		}
+		prompt := fmt.Sprintf("Are you sure you want to delete the repository %s/%s with %d manifests and %d tags? This cannot be undone. [y/N]: ",
+			loginURL, repoName, int32Value(attributes.ManifestCount), int32Value(attributes.TagCount))
+		confirmed, err := confirm(in, out, prompt)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			fmt.Fprintln(out, "The repository was not deleted")
+			return nil
+		}
+	}
+	deleted, err := acrClient.DeleteAcrRepository(ctx, repoName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete repository %s", repoName)
+	}
+	manifestsDeleted, tagsDeleted := 0, 0
+	if deleted.ManifestsDeleted != nil {
+		manifestsDeleted = len(*deleted.ManifestsDeleted)
+	}
+	if deleted.TagsDeleted != nil {
+		tagsDeleted = len(*deleted.TagsDeleted)
+	}
+	fmt.Fprintf(out, "Deleted %s/%s, %d manifests and %d tags\n", loginURL, repoName, manifestsDeleted, tagsDeleted)
+	return nil
+}
+
+// confirm writes the prompt to out and returns true when the answer read from in is yes.
+func confirm(in io.Reader, out io.Writer, prompt string) (bool, error) {
+	fmt.Fprint(out, prompt)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && answer != "") {
+		return false, errors.Wrap(err, "failed to read the confirmation, use --yes to skip it")
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// newRepositoryUpdateCmd creates the repository update command, only the attributes whose flag is set are changed.
+func newRepositoryUpdateCmd(repositoryParams *repositoryParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update <repository>",
+		Short: "Update the changeable attributes of a repository",
+		Long:  newRepositoryUpdateCmdLongMessage,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			value := repositoryParams.attributes.changed(cmd)
+			if value == nil {
+				return errors.New("at least one of --delete-enabled, --write-enabled, --list-enabled or --read-enabled is required")
+			}
+			acrClient, loginURL, err := repositoryParams.newClient(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return updateRepository(cmd.Context(), acrClient, os.Stdout, loginURL, args[0], value)
+		},
+	}
+	cmd.Flags().BoolVar(&repositoryParams.attributes.deleteEnabled, "delete-enabled", true, "Allow the repository to be deleted")
+	cmd.Flags().BoolVar(&repositoryParams.attributes.writeEnabled, "write-enabled", true, "Allow images to be pushed to the repository")
+	cmd.Flags().BoolVar(&repositoryParams.attributes.listEnabled, "list-enabled", true, "Show the repository in the catalog")
+	cmd.Flags().BoolVar(&repositoryParams.attributes.readEnabled, "read-enabled", true, "Allow images to be pulled from the repository")
+	return cmd
+}
+
+// updateRepository changes the attributes of a repository and prints them once updated.
+func updateRepository(ctx context.Context, acrClient api.AcrCLIClientInterface, out io.Writer, loginURL string, repoName string, value *acr.ChangeableAttributes) error {
+	if _, err := acrClient.UpdateAcrRepositoryAttributes(ctx, repoName, value); err != nil {
+		return errors.Wrapf(err, "failed to update the attributes of repository %s", repoName)
+	}
+	return showRepository(ctx, acrClient, out, loginURL, repoName)
+}
+
+// changed returns the attributes whose flag was set on the command line, nil when none was.
+func (f *changeableAttributesFlags) changed(cmd *cobra.Command) *acr.ChangeableAttributes {
+	var value acr.ChangeableAttributes
+	set := false
+	for name, field := range map[string]struct {
+		flag  *bool
+		value **bool
+	}{
+		"delete-enabled": {&f.deleteEnabled, &value.DeleteEnabled},
+		"write-enabled":  {&f.writeEnabled, &value.WriteEnabled},
+		"list-enabled":   {&f.listEnabled, &value.ListEnabled},
+		"read-enabled":   {&f.readEnabled, &value.ReadEnabled},
+	} {
+		if cmd.Flags().Changed(name) {
+			*field.value = field.flag
+			set = true
+		}
+	}
+	if !set {
+		return nil
+	}
+	return &value
+}
+
+// newClient returns a client for the registry, with a token scoped to the repository on ABAC registries.
+func (repositoryParams *repositoryParameters) newClient(ctx context.Context, repoName string) (*api.AcrCLIClient, string, error) {
+	registryName, err := repositoryParams.GetRegistryName()
+	if err != nil {
+		return nil, "", err
+	}
+	loginURL := api.LoginURL(registryName)
+	acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, repositoryParams.username, repositoryParams.password, repositoryParams.configs, repositoryParams.transport)
+	if err != nil {
+		return nil, "", err
+	}
+	acrClient.SetRetryPolicy(repositoryParams.retryPolicy(false))
+	// For ABAC registries, scope the token to the target repository.
+	if acrClient.IsAbac() {
+		if err := acrClient.RefreshTokenForAbac(ctx, []string{repoName}); err != nil {
+			return nil, "", err
+		}
+	}
+	return acrClient, loginURL, nil
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func int32Value(value *int32) int32 {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+func int64Value(value *int64) int64 {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+func boolValue(value *bool) bool {
+	return value != nil && *value
+}
+
+// enabledValue returns the value of a changeable attribute, an attribute that is not set is enabled.
+func enabledValue(value *bool) bool {
+	return value == nil || *value
+}
@@ -0,0 +1,165 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRepositoryCmd(t *testing.T) {
+	rootParams := &rootParameters{}
+	cmd := newRepositoryCmd(rootParams)
+	assert.NotNil(t, cmd)
+	assert.Equal(t, "repository", cmd.Use)
+	assert.Equal(t, newRepositoryCmdLongMessage, cmd.Long)
+	assert.Len(t, cmd.Commands(), 4)
+}
+
+func TestListRepositories(t *testing.T) {
+	t.Run("AllRepositories", func(t *testing.T) {
+		mockClient := &mocks.BaseClientAPI{}
+		mockClient.On("GetRepositories", mock.Anything, "", mock.Anything).Return(ManyRepositoriesResult, nil).Once()
+		mockClient.On("GetRepositories", mock.Anything, "foo/bar", mock.Anything).Return(NoRepositoriesResult, nil).Once()
+		var out bytes.Buffer
+		err := listRepositories(testCtx, mockClient, &out, testLoginURL, "", defaultRegexpMatchTimeoutSeconds, defaultRepoPageSize)
+		assert.NoError(t, err)
+		assert.Equal(t, "foo.azurecr.io/bar\nfoo.azurecr.io/foo\nfoo.azurecr.io/baz\nfoo.azurecr.io/foo/bar\n", out.String())
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("FilteredRepositories", func(t *testing.T) {
+		mockClient := &mocks.BaseClientAPI{}
+		mockClient.On("GetRepositories", mock.Anything, "", mock.Anything).Return(ManyRepositoriesResult, nil).Once()
+		mockClient.On("GetRepositories", mock.Anything, "foo/bar", mock.Anything).Return(NoRepositoriesResult, nil).Once()
+		var out bytes.Buffer
+		// The filter must match the whole name.
+		err := listRepositories(testCtx, mockClient, &out, testLoginURL, "foo", defaultRegexpMatchTimeoutSeconds, defaultRepoPageSize)
+		assert.NoError(t, err)
+		assert.Equal(t, "foo.azurecr.io/foo\n", out.String())
+	})
+
+	t.Run("InvalidFilter", func(t *testing.T) {
+		mockClient := &mocks.BaseClientAPI{}
+		mockClient.On("GetRepositories", mock.Anything, "", mock.Anything).Return(ManyRepositoriesResult, nil).Once()
+		mockClient.On("GetRepositories", mock.Anything, "foo/bar", mock.Anything).Return(NoRepositoriesResult, nil).Once()
+		err := listRepositories(testCtx, mockClient, &bytes.Buffer{}, testLoginURL, "[", defaultRegexpMatchTimeoutSeconds, defaultRepoPageSize)
+		assert.Error(t, err)
+	})
+}
+
+func TestShowRepository(t *testing.T) {
+	t.Run("Attributes", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositoryAttributes", mock.Anything, testRepo).Return(testRepositoryAttributes(), nil).Once()
+		var out bytes.Buffer
+		err := showRepository(testCtx, mockClient, &out, testLoginURL, testRepo)
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "Repository:      foo.azurecr.io/bar\n")
+		assert.Contains(t, out.String(), "Manifests:       3\n")
+		assert.Contains(t, out.String(), "Tags:            2\n")
+		assert.Contains(t, out.String(), "Delete enabled:  false\n")
+		assert.Contains(t, out.String(), "Read enabled:    true\n")
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositoryAttributes", mock.Anything, testRepo).Return(nil, errors.New("not found")).Once()
+		err := showRepository(testCtx, mockClient, &bytes.Buffer{}, testLoginURL, testRepo)
+		assert.EqualError(t, err, "failed to get the attributes of repository bar: not found")
+	})
+}
+
+func TestDeleteRepository(t *testing.T) {
+	deleted := &acr.DeletedRepository{ManifestsDeleted: &[]string{"sha256:1", "sha256:2", "sha256:3"}, TagsDeleted: &[]string{"a", "b"}}
+
+	t.Run("Confirmed", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositoryAttributes", mock.Anything, testRepo).Return(testRepositoryAttributes(), nil).Once()
+		mockClient.On("DeleteAcrRepository", mock.Anything, testRepo).Return(deleted, nil).Once()
+		var out bytes.Buffer
+		err := deleteRepository(testCtx, mockClient, strings.NewReader("y\n"), &out, testLoginURL, testRepo)
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "delete the repository foo.azurecr.io/bar with 3 manifests and 2 tags?")
+		assert.Contains(t, out.String(), "Deleted foo.azurecr.io/bar, 3 manifests and 2 tags\n")
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("NotConfirmed", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositoryAttributes", mock.Anything, testRepo).Return(testRepositoryAttributes(), nil).Once()
+		var out bytes.Buffer
+		err := deleteRepository(testCtx, mockClient, strings.NewReader("n\n"), &out, testLoginURL, testRepo)
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "The repository was not deleted")
+		mockClient.AssertNotCalled(t, "DeleteAcrRepository", mock.Anything, mock.Anything)
+	})
+
+	t.Run("NoInput", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositoryAttributes", mock.Anything, testRepo).Return(testRepositoryAttributes(), nil).Once()
+		err := deleteRepository(testCtx, mockClient, strings.NewReader(""), &bytes.Buffer{}, testLoginURL, testRepo)
+		assert.ErrorContains(t, err, "use --yes to skip it")
+		mockClient.AssertNotCalled(t, "DeleteAcrRepository", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Yes", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("DeleteAcrRepository", mock.Anything, testRepo).Return(deleted, nil).Once()
+		err := deleteRepository(testCtx, mockClient, nil, &bytes.Buffer{}, testLoginURL, testRepo)
+		assert.NoError(t, err)
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestRepositoryEndToEnd(t *testing.T) {
+	registry := fakeregistry.New(t)
+	registry.PushImage("hello", "a", "v1", "latest")
+	registry.PushImage("world", "a", "v1")
+	credentials := []string{"--username", fakeregistry.Username, "--password", fakeregistry.Password}
+
+	// Only the attributes whose flag is set are changed.
+	err := runCommand(registry, append([]string{"repository", "update", "hello", "--delete-enabled=false"}, credentials...)...)
+	require.NoError(t, err)
+	err = runCommand(registry, append([]string{"repository", "delete", "hello", "--yes"}, credentials...)...)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"hello", "world"}, registry.Repositories())
+
+	err = runCommand(registry, append([]string{"repository", "update", "hello", "--delete-enabled"}, credentials...)...)
+	require.NoError(t, err)
+	err = runCommand(registry, append([]string{"repository", "delete", "hello", "--yes"}, credentials...)...)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"world"}, registry.Repositories())
+
+	err = runCommand(registry, append([]string{"repository", "update", "world"}, credentials...)...)
+	assert.EqualError(t, err, "at least one of --delete-enabled, --write-enabled, --list-enabled or --read-enabled is required")
+}
+
+func testRepositoryAttributes() *acr.RepositoryAttributes {
+	manifestCount, tagCount := int32(3), int32(2)
+	deleteEnabled, enabled := false, true
+	createdTime, lastUpdateTime := "2024-01-01T00:00:00Z", "2024-02-01T00:00:00Z"
+	return &acr.RepositoryAttributes{
+		ImageName:      &testRepo,
+		CreatedTime:    &createdTime,
+		LastUpdateTime: &lastUpdateTime,
+		ManifestCount:  &manifestCount,
+		TagCount:       &tagCount,
+		ChangeableAttributes: &acr.ChangeableAttributes{
+			DeleteEnabled: &deleteEnabled,
+			WriteEnabled:  &enabled,
+			ListEnabled:   &enabled,
+			ReadEnabled:   &enabled,
+		},
+	}
+}
@@ -4,9 +4,13 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"net/http"
 	"os"
+	"time"
 
+	"github.com/Azure/acr-cli/internal/api"
 	"github.com/spf13/cobra"
 )
 
@@ -16,14 +20,21 @@ type rootParameters struct {
 	username     string
 	password     string
 	configs      []string
+	timeout      time.Duration
+	maxAttempts  int
+	// transport sends the requests to the registry, the default transport is used when it is nil.
+	transport http.RoundTripper
 }
 
-func newRootCmd(args []string) *cobra.Command {
+// newRootCmd defines the root command. The requests of the commands are sent through transport, or the default
+// transport when it is nil.
+func newRootCmd(args []string, transport http.RoundTripper) *cobra.Command {
 	// for _, arg := range args {
 	// 	fmt.Printf("arg = %s\n", arg)
 	// }
 
-	var rootParams rootParameters
+	rootParams := rootParameters{transport: transport}
+	cancelTimeout := context.CancelFunc(func() {})
 
 	cmd := &cobra.Command{
 		Use:   "acr",
@@ -32,6 +43,17 @@ func newRootCmd(args []string) *cobra.Command {
 
 To start working with the CLI, run acr --help`,
 		SilenceUsage: true,
+		// The timeout applies to the context of the command that is run, so it bounds every request it makes.
+		PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+			if rootParams.timeout > 0 {
+				var ctx context.Context
+				ctx, cancelTimeout = context.WithTimeout(cmd.Context(), rootParams.timeout)
+				cmd.SetContext(ctx)
+			}
+		},
+		PersistentPostRun: func(_ *cobra.Command, _ []string) {
+			cancelTimeout()
+		},
 	}
 
 	flags := cmd.PersistentFlags()
@@ -43,6 +65,11 @@ To start working with the CLI, run acr --help`,
 		newLogoutCmd(),
 		newTagCmd(&rootParams),
 		newManifestCmd(&rootParams),
+		newRepositoryCmd(&rootParams),
+		newUsageCmd(&rootParams),
+		newCopyCmd(&rootParams),
+		newExportCmd(&rootParams),
+		newImportCmd(&rootParams),
 	)
 	// If environment variable ACR_EXPERIMENTAL_CSSC is set to true, add the cssc command to the command list
 	if isExperimentalCssc, exists := os.LookupEnv("ACR_EXPERIMENTAL_CSSC"); exists && isExperimentalCssc == "true" {
@@ -55,6 +82,8 @@ To start working with the CLI, run acr --help`,
 	cmd.PersistentFlags().StringVarP(&rootParams.registryName, "registry", "r", "", "Registry name")
 	cmd.PersistentFlags().StringVarP(&rootParams.username, "username", "u", "", "Registry username")
 	cmd.PersistentFlags().StringVarP(&rootParams.password, "password", "p", "", "Registry password")
+	cmd.PersistentFlags().DurationVar(&rootParams.timeout, "timeout", 0, "Maximum duration of the command, for example 30m or 2h. When it is reached the requests in flight are completed and the command stops. No timeout by default")
+	cmd.PersistentFlags().IntVar(&rootParams.maxAttempts, "max-attempts", api.DefaultMaxAttempts, "Maximum number of attempts of a request to the registry. Requests that are throttled (HTTP 429), fail with a server error (HTTP 5xx) or whose connection is reset are retried with an exponential backoff, honouring the Retry-After header. Set to 1 to disable retries")
 	cmd.Flags().BoolP("help", "h", false, "Print usage")
 	cmd.Flags().StringArrayVarP(&rootParams.configs, "config", "c", nil, "Auth config paths")
 	// No parameter is marked as required because the registry could be inferred from a task context, same with username and password
@@ -75,3 +104,11 @@ func (rootParams *rootParameters) GetRegistryName() (string, error) {
 	return "", errors.New("unable to determine registry name, please use --registry flag")
 
 }
+
+// retryPolicy returns the retry policy of the requests to the registry, retries are printed when verbose is set.
+func (rootParams *rootParameters) retryPolicy(verbose bool) api.RetryPolicy {
+	policy := api.DefaultRetryPolicy()
+	policy.MaxAttempts = rootParams.maxAttempts
+	policy.Verbose = verbose
+	return policy
+}
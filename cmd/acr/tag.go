@@ -6,22 +6,37 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/repository"
 	"github.com/Azure/acr-cli/internal/api"
 	"github.com/Azure/acr-cli/internal/tag"
+	"github.com/Azure/acr-cli/internal/worker"
+	"github.com/dlclark/regexp2"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 const (
 	newTagCmdLongMessage       = `acr tag: list tags and untag them individually.`
-	newTagListCmdLongMessage   = `acr tag list: outputs all the tags that are inside a given repository`
+	newTagListCmdLongMessage   = `acr tag list: outputs the tags that are inside a given repository, with their digest, age and lock state in the table, json and csv formats`
 	newTagDeleteCmdLongMessage = `acr tag delete: delete a set of tags inside the specified repository`
+	newTagLockCmdLongMessage   = `acr tag lock: lock a set of tags, and the tags matching the filter, inside the specified repository. By default their deletion and overwrite are disabled`
+	newTagUnlockCmdLongMessage = `acr tag unlock: unlock a set of tags, and the tags matching the filter, inside the specified repository. By default their deletion and overwrite are enabled`
 )
 
 // Besides the registry name and authentication information only the repository is needed.
 type tagParameters struct {
 	*rootParameters
-	repoName string
+	repoName      string
+	filter        string
+	filterTimeout int64
+	orderBy       string
+	output        string
 }
 
 // The tag command can be used to either list tags or delete tags inside a repository.
@@ -44,6 +59,8 @@ func newTagCmd(rootParams *rootParameters) *cobra.Command {
 	cmd.AddCommand(
 		listTagCmd,
 		deleteTagCmd,
+		newTagLockCmd(&tagParams, true),
+		newTagLockCmd(&tagParams, false),
 	)
 	cmd.PersistentFlags().StringVar(&tagParams.repoName, "repository", "", "The repository name")
 	// Since the repository will be needed in either subcommand it is marked as a required flag
@@ -52,46 +69,186 @@ func newTagCmd(rootParams *rootParameters) *cobra.Command {
 	return cmd
 }
 
-// newTagListCmd creates tag list command, it does not need any aditional parameters.
+// newTagListCmd creates tag list command, the tags can be filtered, ordered and written in several formats.
 // The registry interaction is done through the listTags method
 func newTagListCmd(tagParams *tagParameters) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List tags from a repository",
 		Long:  newTagListCmdLongMessage,
-		RunE: func(_ *cobra.Command, _ []string) error {
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			orderBy, ok := tagListOrderBy[tagParams.orderBy]
+			if !ok {
+				return fmt.Errorf("invalid orderby value %q, allowed values are name, time_asc, time_desc", tagParams.orderBy)
+			}
+			if err := validateOutput(tagParams.output, outputText, outputTable, outputJSON, outputCSV); err != nil {
+				return err
+			}
+			filter, err := buildOptionalFilter(tagParams.filter, tagParams.filterTimeout)
+			if err != nil {
+				return err
+			}
 			registryName, err := tagParams.GetRegistryName()
 			if err != nil {
 				return err
 			}
 			loginURL := api.LoginURL(registryName)
-			ctx := context.Background()
+			ctx := cmd.Context()
 			// An acrClient is created to make the http requests to the registry.
-			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, tagParams.username, tagParams.password, tagParams.configs)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, tagParams.username, tagParams.password, tagParams.configs, tagParams.transport)
 			if err != nil {
 				return err
 			}
+			acrClient.SetRetryPolicy(tagParams.retryPolicy(false))
 			// For ABAC registries, scope the token to the target repository.
 			if acrClient.IsAbac() {
 				if err := acrClient.RefreshTokenForAbac(ctx, []string{tagParams.repoName}); err != nil {
 					return err
 				}
 			}
-			tagList, err := tag.ListTags(ctx, acrClient, tagParams.repoName)
+			tagList, err := listTags(ctx, acrClient, tagParams.repoName, orderBy, filter)
 			if err != nil {
 				return err
 			}
-			fmt.Printf("Listing tags for the %q repository:\n", tagParams.repoName)
-			for _, tag := range tagList {
-				fmt.Printf("%s/%s:%s\n", loginURL, tagParams.repoName, *tag.Name)
-			}
-
-			return nil
+			return printTags(os.Stdout, tagParams.output, loginURL, tagParams.repoName, tagList, time.Now().UTC())
 		},
 	}
+	cmd.Flags().StringVar(&tagParams.filter, "filter", "", "Regular expression the tag names must match to be listed, every tag is listed by default")
+	cmd.Flags().Int64Var(&tagParams.filterTimeout, "filter-timeout-seconds", defaultRegexpMatchTimeoutSeconds, "This limits the evaluation of the regex filter, and will return a timeout error if this duration is exceeded during a single evaluation. If written incorrectly a regexp filter with backtracking can result in an infinite loop")
+	cmd.Flags().StringVar(&tagParams.orderBy, "orderby", "name", "Order of the tags: name, time_asc or time_desc, by last update time. The tags are ordered by the registry")
+	cmd.Flags().StringVarP(&tagParams.output, "output", "o", outputText, "Output format: text, table, json or csv. The table, json and csv formats include the digest, the created and last update times, the age and the lock state of every tag")
 	return cmd
 }
 
+// tagListOrderBy maps the values of the --orderby flag to the orderby parameter of the registry, the registry orders
+// the tags by name when it is empty.
+var tagListOrderBy = map[string]string{
+	"name":      "",
+	"time_asc":  "timeasc",
+	"time_desc": "timedesc",
+}
+
+// listTags returns the tags of the repository in the order of the registry, only the ones matching the filter when it
+// is not nil. When the tags are ordered by time the pages are followed through the Link header, since the name of the
+// last tag of a page does not tell where the next one starts.
+func listTags(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, orderBy string, filter *regexp2.Regexp) ([]acr.TagAttributesBase, error) {
+	var tagList []acr.TagAttributesBase
+	if orderBy == "" {
+		var err error
+		if tagList, err = tag.ListTags(ctx, acrClient, repoName); err != nil {
+			return nil, err
+		}
+	} else {
+		lastTag := ""
+		for {
+			resultTags, err := acrClient.GetAcrTags(ctx, repoName, orderBy, lastTag)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to list tags")
+			}
+			if resultTags == nil || resultTags.TagsAttributes == nil {
+				break
+			}
+			tagList = append(tagList, *resultTags.TagsAttributes...)
+			if lastTag = repository.GetLastTagFromResponse(resultTags); lastTag == "" {
+				break
+			}
+		}
+	}
+	if filter == nil {
+		return tagList, nil
+	}
+	filtered := tagList[:0]
+	for _, t := range tagList {
+		matches, err := filter.MatchString(*t.Name)
+		if err != nil {
+			// The only error regexp2 can throw is a timeout error
+			return nil, err
+		}
+		if matches {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered, nil
+}
+
+// tagListItem is a tag as written by tag list with the json output.
+type tagListItem struct {
+	Name           string `json:"name"`
+	Digest         string `json:"digest"`
+	CreatedTime    string `json:"createdTime"`
+	LastUpdateTime string `json:"lastUpdateTime"`
+	Signed         bool   `json:"signed"`
+	DeleteEnabled  bool   `json:"deleteEnabled"`
+	WriteEnabled   bool   `json:"writeEnabled"`
+	ListEnabled    bool   `json:"listEnabled"`
+	ReadEnabled    bool   `json:"readEnabled"`
+}
+
+// printTags writes the tags to out in the output format. The age of the tags is relative to now.
+func printTags(out io.Writer, output string, loginURL string, repoName string, tagList []acr.TagAttributesBase, now time.Time) error {
+	if output == outputText {
+		fmt.Fprintf(out, "Listing tags for the %q repository:\n", repoName)
+		for _, t := range tagList {
+			fmt.Fprintf(out, "%s/%s:%s\n", loginURL, repoName, *t.Name)
+		}
+		return nil
+	}
+	items := make([]tagListItem, 0, len(tagList))
+	for _, t := range tagList {
+		item := tagListItem{
+			Name:           stringValue(t.Name),
+			Digest:         stringValue(t.Digest),
+			CreatedTime:    stringValue(t.CreatedTime),
+			LastUpdateTime: stringValue(t.LastUpdateTime),
+			Signed:         boolValue(t.Signed),
+		}
+		// Like isLocked, an operation is only disabled when the registry says so.
+		changeable := t.ChangeableAttributes
+		if changeable == nil {
+			changeable = &acr.ChangeableAttributes{}
+		}
+		item.DeleteEnabled = enabledValue(changeable.DeleteEnabled)
+		item.WriteEnabled = enabledValue(changeable.WriteEnabled)
+		item.ListEnabled = enabledValue(changeable.ListEnabled)
+		item.ReadEnabled = enabledValue(changeable.ReadEnabled)
+		items = append(items, item)
+	}
+	if output == outputJSON {
+		return writeJSON(out, items)
+	}
+	header := []string{"tag", "digest", "lastUpdateTime", "age", "locked"}
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, []string{item.Name, item.Digest, item.LastUpdateTime, formatAge(item.LastUpdateTime, now), item.lockState()})
+	}
+	if output == outputCSV {
+		return writeCSV(out, header, rows)
+	}
+	return writeTable(out, header, rows)
+}
+
+// lockState returns the operations that are disabled on the tag, like delete,write, or "-" when none is.
+func (item tagListItem) lockState() string {
+	var disabled []string
+	for _, attribute := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"delete", item.DeleteEnabled},
+		{"write", item.WriteEnabled},
+		{"list", item.ListEnabled},
+		{"read", item.ReadEnabled},
+	} {
+		if !attribute.enabled {
+			disabled = append(disabled, attribute.name)
+		}
+	}
+	if len(disabled) == 0 {
+		return "-"
+	}
+	return strings.Join(disabled, ",")
+}
+
 // newTagDeleteCmd defines the tag delete subcommand, it receives as an argument an array of tag digests.
 // The delete functionality of this command is implemented in the deleteTags function.
 func newTagDeleteCmd(tagParams *tagParameters) *cobra.Command {
@@ -99,17 +256,18 @@ func newTagDeleteCmd(tagParams *tagParameters) *cobra.Command {
 		Use:   "delete",
 		Short: "Delete tags from a repository",
 		Long:  newTagDeleteCmdLongMessage,
-		RunE: func(_ *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			registryName, err := tagParams.GetRegistryName()
 			if err != nil {
 				return err
 			}
 			loginURL := api.LoginURL(registryName)
-			ctx := context.Background()
-			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, tagParams.username, tagParams.password, tagParams.configs)
+			ctx := cmd.Context()
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, tagParams.username, tagParams.password, tagParams.configs, tagParams.transport)
 			if err != nil {
 				return err
 			}
+			acrClient.SetRetryPolicy(tagParams.retryPolicy(false))
 			// For ABAC registries, scope the token to the target repository.
 			if acrClient.IsAbac() {
 				if err := acrClient.RefreshTokenForAbac(ctx, []string{tagParams.repoName}); err != nil {
@@ -126,3 +284,65 @@ func newTagDeleteCmd(tagParams *tagParameters) *cobra.Command {
 
 	return cmd
 }
+
+// newTagLockCmd defines the tag lock subcommand, or the tag unlock subcommand when lock is false. It receives as an
+// argument an array of tag names, the tags matching --filter are updated too.
+func newTagLockCmd(tagParams *tagParameters, lock bool) *cobra.Command {
+	// The lock and unlock subcommands have different flag defaults, so they cannot share their parameters.
+	lockParams := lockParameters{}
+	use, short, long := "lock", "Lock tags inside a repository", newTagLockCmdLongMessage
+	if !lock {
+		use, short, long = "unlock", "Unlock tags inside a repository", newTagUnlockCmdLongMessage
+	}
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && tagParams.filter == "" {
+				return errors.New("at least one tag or --filter is required")
+			}
+			filter, err := buildOptionalFilter(tagParams.filter, tagParams.filterTimeout)
+			if err != nil {
+				return err
+			}
+			poolSize, limiter, err := resolveConcurrency(lockParams.concurrency)
+			if err != nil {
+				return err
+			}
+			registryName, err := tagParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			ctx := cmd.Context()
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, tagParams.username, tagParams.password, tagParams.configs, tagParams.transport)
+			if err != nil {
+				return err
+			}
+			acrClient.SetRetryPolicy(tagParams.retryPolicy(false))
+			// For ABAC registries, scope the token to the target repository.
+			if acrClient.IsAbac() {
+				if err := acrClient.RefreshTokenForAbac(ctx, []string{tagParams.repoName}); err != nil {
+					return err
+				}
+			}
+			tagNames, err := selectTags(ctx, acrClient, tagParams.repoName, args, filter)
+			if err != nil {
+				return err
+			}
+			locker := worker.NewLocker(poolSize, acrClient, loginURL, tagParams.repoName, lockParams.changeableAttributes(cmd), limiter)
+			updatedTagsCount, err := locker.LockTags(ctx, tagNames)
+			fmt.Printf("\nNumber of updated tags: %d\n", updatedTagsCount)
+			printEffectiveConcurrency(os.Stdout, limiter)
+			if err != nil {
+				return errors.Wrap(err, "failed to update tags")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&tagParams.filter, "filter", "", "Regular expression the names of the tags to update must match, in addition to the tags passed as arguments")
+	cmd.Flags().Int64Var(&tagParams.filterTimeout, "filter-timeout-seconds", defaultRegexpMatchTimeoutSeconds, "This limits the evaluation of the regex filter, and will return a timeout error if this duration is exceeded during a single evaluation. If written incorrectly a regexp filter with backtracking can result in an infinite loop")
+	lockParams.addFlags(cmd, lock)
+	return cmd
+}
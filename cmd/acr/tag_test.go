@@ -4,13 +4,22 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/Azure/acr-cli/acr"
 	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/cmd/repository"
+	"github.com/Azure/acr-cli/internal/api"
 	"github.com/Azure/acr-cli/internal/tag"
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewTagCmd(t *testing.T) {
@@ -147,3 +156,90 @@ func TestDeleteTagsAbac(t *testing.T) {
 		mockClient.AssertExpectations(t)
 	})
 }
+
+func TestListTagsOrderAndFilter(t *testing.T) {
+	t.Run("TimeOrderFollowsLinkHeader", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "").Return(OneTagResultWithNext, nil).Once()
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "timedesc", "latest").Return(OneTagResult, nil).Once()
+		tagList, err := listTags(testCtx, mockClient, testRepo, "timedesc", nil)
+		assert.NoError(t, err)
+		assert.Len(t, tagList, 2)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		filter, err := repository.BuildRegexFilter("^v[12]$", defaultRegexpMatchTimeoutSeconds)
+		assert.NoError(t, err)
+		tagList, err := listTags(testCtx, mockClient, testRepo, "", filter)
+		assert.NoError(t, err)
+		assert.Len(t, tagList, 2)
+		assert.Equal(t, "v1", *tagList[0].Name)
+		assert.Equal(t, "v2", *tagList[1].Name)
+	})
+}
+
+func TestPrintTags(t *testing.T) {
+	now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	name, digest, lastUpdateTime := "v1", "sha256:abc", "2024-03-01T10:00:00Z"
+	enabled, disabled := true, false
+	tagList := []acr.TagAttributesBase{{
+		Name:                 &name,
+		Digest:               &digest,
+		LastUpdateTime:       &lastUpdateTime,
+		ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &disabled, WriteEnabled: &disabled, ListEnabled: &enabled, ReadEnabled: &enabled},
+	}}
+
+	t.Run("Text", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, printTags(&out, outputText, testLoginURL, testRepo, tagList, now))
+		assert.Equal(t, "Listing tags for the \"bar\" repository:\nfoo.azurecr.io/bar:v1\n", out.String())
+	})
+
+	t.Run("Table", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, printTags(&out, outputTable, testLoginURL, testRepo, tagList, now))
+		assert.Equal(t, "TAG  DIGEST      LASTUPDATETIME        AGE  LOCKED\nv1   sha256:abc  2024-03-01T10:00:00Z  3d   delete,write\n", out.String())
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, printTags(&out, outputCSV, testLoginURL, testRepo, tagList, now))
+		assert.Equal(t, "tag,digest,lastUpdateTime,age,locked\nv1,sha256:abc,2024-03-01T10:00:00Z,3d,\"delete,write\"\n", out.String())
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, printTags(&out, outputJSON, testLoginURL, testRepo, tagList, now))
+		var items []tagListItem
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &items))
+		assert.Equal(t, []tagListItem{{Name: "v1", Digest: "sha256:abc", LastUpdateTime: "2024-03-01T10:00:00Z", ListEnabled: true, ReadEnabled: true}}, items)
+	})
+
+	t.Run("NoChangeableAttributes", func(t *testing.T) {
+		var out bytes.Buffer
+		unknown := []acr.TagAttributesBase{{Name: &name, Digest: &digest, LastUpdateTime: &lastUpdateTime}}
+		assert.NoError(t, printTags(&out, outputCSV, testLoginURL, testRepo, unknown, now))
+		assert.Equal(t, "tag,digest,lastUpdateTime,age,locked\nv1,sha256:abc,2024-03-01T10:00:00Z,3d,-\n", out.String())
+	})
+}
+
+func TestTagListEndToEnd(t *testing.T) {
+	registry := fakeregistry.New(t)
+	for i := 0; i < 150; i++ {
+		tagName := fmt.Sprintf("v%03d", i)
+		registry.PushImage("hello", tagName, tagName)
+		registry.SetLastUpdateTime("hello", tagName, time.Now().Add(time.Duration(-i)*time.Minute))
+	}
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+	require.NoError(t, err)
+
+	tagList, err := listTags(testCtx, acrClient, "hello", tagListOrderBy["time_asc"], nil)
+	require.NoError(t, err)
+	require.Len(t, tagList, 150)
+	assert.Equal(t, "v149", *tagList[0].Name)
+	assert.Equal(t, "v000", *tagList[149].Name)
+}
@@ -0,0 +1,304 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/repository"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newUsageCmdLongMessage = `acr usage: outputs the storage used by every repository of the registry, split between tagged and untagged manifests, the largest manifests and the storage that purging the untagged manifests would reclaim`
+	defaultUsageTop        = 10
+)
+
+// usageParameters defines the parameters of the usage command.
+type usageParameters struct {
+	*rootParameters
+	filter        string
+	filterTimeout int64
+	repoPageSize  int32
+	ago           string
+	top           int
+	dedup         bool
+	output        string
+}
+
+// repositoryUsage is the storage used by a repository. The sizes are the image sizes of the manifests, which count the
+// layers shared between images once per image. The unique sizes, only collected with --dedup, count every blob once.
+type repositoryUsage struct {
+	Name                   string `json:"name"`
+	Manifests              int    `json:"manifests"`
+	TotalBytes             int64  `json:"totalBytes"`
+	TaggedBytes            int64  `json:"taggedBytes"`
+	UntaggedBytes          int64  `json:"untaggedBytes"`
+	ReclaimableBytes       int64  `json:"reclaimableBytes"`
+	UniqueBytes            int64  `json:"uniqueBytes,omitempty"`
+	ReclaimableUniqueBytes int64  `json:"reclaimableUniqueBytes,omitempty"`
+}
+
+// manifestUsage is one of the largest manifests of the registry.
+type manifestUsage struct {
+	Repository     string   `json:"repository"`
+	Digest         string   `json:"digest"`
+	Tags           []string `json:"tags"`
+	Size           int64    `json:"size"`
+	LastUpdateTime string   `json:"lastUpdateTime"`
+}
+
+// registryUsage is the storage used by the repositories of a registry, as written by usage with the json output.
+type registryUsage struct {
+	Registry               string            `json:"registry"`
+	Ago                    string            `json:"ago,omitempty"`
+	Dedup                  bool              `json:"dedup,omitempty"`
+	TotalBytes             int64             `json:"totalBytes"`
+	TaggedBytes            int64             `json:"taggedBytes"`
+	UntaggedBytes          int64             `json:"untaggedBytes"`
+	ReclaimableBytes       int64             `json:"reclaimableBytes"`
+	UniqueBytes            int64             `json:"uniqueBytes,omitempty"`
+	ReclaimableUniqueBytes int64             `json:"reclaimableUniqueBytes,omitempty"`
+	Repositories           []repositoryUsage `json:"repositories"`
+	LargestManifests       []manifestUsage   `json:"largestManifests"`
+	ExclusiveLayers        []layerUsage      `json:"exclusiveLayers,omitempty"`
+}
+
+// newUsageCmd defines the usage command.
+func newUsageCmd(rootParams *rootParameters) *cobra.Command {
+	usageParams := usageParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Show the storage used by the repositories of a registry",
+		Long:  newUsageCmdLongMessage,
+		Example: `  - Show the storage used by every repository and the storage reclaimed by purging the untagged manifests older than 7 days
+	acr usage -r example --ago 7d
+
+  - Show the 20 largest manifests of the repositories under team/ as JSON
+	acr usage -r example --filter "team/.*" --top 20 --output json
+
+  - Show the storage used once the layers shared between images are counted once, and the largest layers only referenced by one image
+	acr usage -r example --ago 7d --dedup`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := validateOutput(usageParams.output, outputTable, outputJSON, outputCSV); err != nil {
+				return err
+			}
+			if usageParams.top < 0 {
+				return fmt.Errorf("invalid top value %d, it should be 0 or more", usageParams.top)
+			}
+			var agoDuration time.Duration
+			if usageParams.ago != "" {
+				var err error
+				if agoDuration, err = parseDuration(usageParams.ago); err != nil {
+					return err
+				}
+			}
+			registryName, err := usageParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			ctx := cmd.Context()
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, usageParams.username, usageParams.password, usageParams.configs, usageParams.transport)
+			if err != nil {
+				return err
+			}
+			acrClient.SetRetryPolicy(usageParams.retryPolicy(false))
+
+			repoNames, err := repository.GetAllRepositoryNames(ctx, acrClient.AutorestClient, usageParams.repoPageSize)
+			if err != nil {
+				return errors.Wrap(err, "failed to list repositories")
+			}
+			if usageParams.filter != "" {
+				repoNames, err = repository.GetMatchingRepos(repoNames, "^"+usageParams.filter+"$", usageParams.filterTimeout)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Only the report is written to stdout, the messages printed while the manifests are read go to stderr.
+			usage, err := collectUsage(ctx, acrClient, os.Stderr, loginURL, repoNames, time.Now().UTC().Add(agoDuration), usageParams.top, usageParams.dedup)
+			if err != nil {
+				return err
+			}
+			usage.Ago = usageParams.ago
+			return printUsage(os.Stdout, usageParams.output, usage)
+		},
+	}
+	cmd.Flags().StringVar(&usageParams.filter, "filter", "", "Regular expression the repository names must match as a whole, every repository is included by default")
+	cmd.Flags().Int64Var(&usageParams.filterTimeout, "filter-timeout-seconds", defaultRegexpMatchTimeoutSeconds, "This limits the evaluation of the regex filter, and will return a timeout error if this duration is exceeded during a single evaluation. If written incorrectly a regexp filter with backtracking can result in an infinite loop")
+	cmd.Flags().Int32Var(&usageParams.repoPageSize, "repository-page-size", defaultRepoPageSize, repoPageSizeDescription)
+	cmd.Flags().StringVar(&usageParams.ago, "ago", "", "The reclaimable storage is the size of the untagged manifests last updated before this duration that 'acr purge --untagged-only --ago' would delete, in the same format as the --ago flag of purge. Every untagged manifest that purge would delete is reclaimable by default")
+	cmd.Flags().IntVar(&usageParams.top, "top", defaultUsageTop, "Number of largest manifests of the registry to show")
+	cmd.Flags().BoolVar(&usageParams.dedup, "dedup", false, "Read every manifest to also show the storage used once the blobs shared between manifests are counted once, the storage really reclaimed by purging the untagged manifests and the largest layers referenced by a single manifest. The blobs shared with the repositories left out by --filter are not seen")
+	cmd.Flags().StringVarP(&usageParams.output, "output", "o", outputTable, "Output format: table, json or csv. The csv output only holds the repositories")
+	return cmd
+}
+
+// collectUsage returns the storage used by the repositories, from the largest, and the top largest manifests. The
+// reclaimable storage of a repository is the size of the untagged manifests last updated before cutoff that a purge
+// of the untagged manifests would delete. With dedup, the manifests are read to also count the storage of every blob
+// once and to find the top largest layers referenced by a single manifest. The messages printed while the manifests
+// are read are written to out.
+func collectUsage(ctx context.Context, acrClient api.AcrCLIClientInterface, out io.Writer, loginURL string, repoNames []string, cutoff time.Time, top int, dedup bool) (*registryUsage, error) {
+	usage := &registryUsage{Registry: loginURL, Dedup: dedup, Repositories: []repositoryUsage{}, LargestManifests: []manifestUsage{}}
+	var largest []manifestUsage
+	blobs := newBlobIndex()
+	reclaimableManifests := make(map[manifestRef]bool)
+	for _, repoName := range repoNames {
+		if acrClient.IsAbac() {
+			if err := acrClient.RefreshTokenForAbac(ctx, []string{repoName}); err != nil {
+				return nil, fmt.Errorf("failed to refresh ABAC token for repository %s: %w", repoName, err)
+			}
+		}
+		manifests, err := listAllManifests(ctx, acrClient, repoName)
+		if err != nil {
+			return nil, err
+		}
+		repoUsage := repositoryUsage{Name: repoName, Manifests: len(manifests)}
+		for _, manifest := range manifests {
+			size := int64Value(manifest.ImageSize)
+			repoUsage.TotalBytes += size
+			var tags []string
+			if manifest.Tags != nil && len(*manifest.Tags) > 0 {
+				tags = *manifest.Tags
+				repoUsage.TaggedBytes += size
+			} else {
+				repoUsage.UntaggedBytes += size
+			}
+			largest = append(largest, manifestUsage{
+				Repository:     repoName,
+				Digest:         stringValue(manifest.Digest),
+				Tags:           append([]string{}, tags...),
+				Size:           size,
+				LastUpdateTime: stringValue(manifest.LastUpdateTime),
+			})
+		}
+		if repoUsage.UntaggedBytes > 0 {
+			reclaimable, err := repository.GetUntaggedManifests(ctx, defaultPoolSize, acrClient, out, repoName, false, nil, false, false, &cutoff, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			for _, manifest := range reclaimable {
+				repoUsage.ReclaimableBytes += int64Value(manifest.ImageSize)
+				reclaimableManifests[manifestRef{repoName: repoName, digest: stringValue(manifest.Digest)}] = true
+			}
+		}
+		if dedup {
+			if err := blobs.addManifests(ctx, acrClient, defaultPoolSize, repoName, manifests); err != nil {
+				return nil, err
+			}
+		}
+		usage.TotalBytes += repoUsage.TotalBytes
+		usage.TaggedBytes += repoUsage.TaggedBytes
+		usage.UntaggedBytes += repoUsage.UntaggedBytes
+		usage.ReclaimableBytes += repoUsage.ReclaimableBytes
+		usage.Repositories = append(usage.Repositories, repoUsage)
+	}
+	if dedup {
+		uniqueBytes, totalUniqueBytes := blobs.uniqueBytes()
+		reclaimableBytes, totalReclaimableBytes := blobs.reclaimableBytes(reclaimableManifests)
+		for i := range usage.Repositories {
+			usage.Repositories[i].UniqueBytes = uniqueBytes[usage.Repositories[i].Name]
+			usage.Repositories[i].ReclaimableUniqueBytes = reclaimableBytes[usage.Repositories[i].Name]
+		}
+		usage.UniqueBytes = totalUniqueBytes
+		usage.ReclaimableUniqueBytes = totalReclaimableBytes
+		usage.ExclusiveLayers = blobs.exclusiveLayers(top)
+	}
+	sort.SliceStable(usage.Repositories, func(i, j int) bool {
+		return usage.Repositories[i].TotalBytes > usage.Repositories[j].TotalBytes
+	})
+	sort.SliceStable(largest, func(i, j int) bool {
+		return largest[i].Size > largest[j].Size
+	})
+	usage.LargestManifests = append(usage.LargestManifests, largest[:min(top, len(largest))]...)
+	return usage, nil
+}
+
+// printUsage writes the usage to out in the output format.
+func printUsage(out io.Writer, output string, usage *registryUsage) error {
+	if output == outputJSON {
+		return writeJSON(out, usage)
+	}
+	header := []string{"repository", "manifests", "total", "tagged", "untagged", "reclaimable"}
+	if usage.Dedup {
+		header = append(header, "unique", "reclaimableUnique")
+	}
+	if output == outputCSV {
+		header = []string{"repository", "manifests", "totalBytes", "taggedBytes", "untaggedBytes", "reclaimableBytes"}
+		if usage.Dedup {
+			header = append(header, "uniqueBytes", "reclaimableUniqueBytes")
+		}
+		rows := make([][]string, 0, len(usage.Repositories))
+		for _, repoUsage := range usage.Repositories {
+			row := []string{repoUsage.Name, strconv.Itoa(repoUsage.Manifests),
+				strconv.FormatInt(repoUsage.TotalBytes, 10), strconv.FormatInt(repoUsage.TaggedBytes, 10),
+				strconv.FormatInt(repoUsage.UntaggedBytes, 10), strconv.FormatInt(repoUsage.ReclaimableBytes, 10)}
+			if usage.Dedup {
+				row = append(row, strconv.FormatInt(repoUsage.UniqueBytes, 10), strconv.FormatInt(repoUsage.ReclaimableUniqueBytes, 10))
+			}
+			rows = append(rows, row)
+		}
+		return writeCSV(out, header, rows)
+	}
+
+	rows := make([][]string, 0, len(usage.Repositories)+1)
+	manifestCount := 0
+	for _, repoUsage := range usage.Repositories {
+		manifestCount += repoUsage.Manifests
+		row := []string{repoUsage.Name, strconv.Itoa(repoUsage.Manifests), formatSize(repoUsage.TotalBytes),
+			formatSize(repoUsage.TaggedBytes), formatSize(repoUsage.UntaggedBytes), formatSize(repoUsage.ReclaimableBytes)}
+		if usage.Dedup {
+			row = append(row, formatSize(repoUsage.UniqueBytes), formatSize(repoUsage.ReclaimableUniqueBytes))
+		}
+		rows = append(rows, row)
+	}
+	// The unique storage of the registry is less than the sum of the repositories when they share blobs.
+	row := []string{"(total)", strconv.Itoa(manifestCount), formatSize(usage.TotalBytes),
+		formatSize(usage.TaggedBytes), formatSize(usage.UntaggedBytes), formatSize(usage.ReclaimableBytes)}
+	if usage.Dedup {
+		row = append(row, formatSize(usage.UniqueBytes), formatSize(usage.ReclaimableUniqueBytes))
+	}
+	rows = append(rows, row)
+	fmt.Fprintf(out, "Storage used by %s:\n", usage.Registry)
+	if err := writeTable(out, header, rows); err != nil {
+		return err
+	}
+	if len(usage.LargestManifests) > 0 {
+		if err := printLargestManifests(out, usage.LargestManifests); err != nil {
+			return err
+		}
+	}
+	if len(usage.ExclusiveLayers) == 0 {
+		return nil
+	}
+	rows = make([][]string, 0, len(usage.ExclusiveLayers))
+	for _, layer := range usage.ExclusiveLayers {
+		rows = append(rows, []string{layer.Repository, layer.Manifest, layer.Digest, formatSize(layer.Size)})
+	}
+	fmt.Fprintf(out, "\nLargest layers referenced by a single manifest:\n")
+	return writeTable(out, []string{"repository", "manifest", "layer", "size"}, rows)
+}
+
+// printLargestManifests writes the table of the largest manifests to out.
+func printLargestManifests(out io.Writer, manifests []manifestUsage) error {
+	rows := make([][]string, 0, len(manifests))
+	for _, manifest := range manifests {
+		rows = append(rows, []string{manifest.Repository, manifest.Digest, valueOrDash(strings.Join(manifest.Tags, ",")),
+			formatSize(manifest.Size), manifest.LastUpdateTime})
+	}
+	fmt.Fprintf(out, "\nLargest manifests:\n")
+	return writeTable(out, []string{"repository", "digest", "tags", "size", "lastUpdateTime"}, rows)
+}
@@ -0,0 +1,231 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/alitto/pond/v2"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// manifestRef identifies a manifest of a repository.
+type manifestRef struct {
+	repoName string
+	digest   string
+}
+
+// blobUsage is a blob with the manifests referencing it. The manifests themselves are blobs referenced by their own
+// manifest.
+type blobUsage struct {
+	size       int64
+	isLayer    bool
+	references []manifestRef
+}
+
+// layerUsage is one of the largest layers referenced by a single manifest, as written by usage --dedup.
+type layerUsage struct {
+	Repository string `json:"repository"`
+	Manifest   string `json:"manifest"`
+	Digest     string `json:"digest"`
+	Size       int64  `json:"size"`
+}
+
+// blobIndex holds the blobs referenced by the manifests of the repositories, to count the storage of every blob
+// once. The blobs are the manifests, the configs and the layers of the image manifests and the blobs of the artifact
+// manifests. It is safe for concurrent use.
+type blobIndex struct {
+	mu    sync.Mutex
+	blobs map[string]*blobUsage
+}
+
+// newBlobIndex returns an empty blobIndex.
+func newBlobIndex() *blobIndex {
+	return &blobIndex{blobs: make(map[string]*blobUsage)}
+}
+
+// addManifests reads the manifests of the repository concurrently with poolSize workers and adds the blobs they
+// reference. The manifests deleted since they were listed are left out. Docker v2 schema 1 manifests do not hold the
+// size of their layers, so only the manifest itself is added for them.
+func (b *blobIndex) addManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, poolSize int, repoName string, manifests []acr.ManifestAttributesBase) error {
+	pool := pond.NewPool(poolSize, pond.WithContext(ctx), pond.WithQueueSize(poolSize*3), pond.WithNonBlocking(false))
+	group := pool.NewGroup()
+	for _, manifest := range manifests {
+		if manifest.Digest == nil {
+			continue
+		}
+		group.SubmitErr(func() error {
+			manifestBytes, err := acrClient.GetManifest(ctx, repoName, *manifest.Digest)
+			if err != nil {
+				errParsed := autorest.DetailedError{}
+				if errors.As(err, &errParsed) && errParsed.StatusCode == http.StatusNotFound {
+					// The manifest was deleted since it was listed.
+					return nil
+				}
+				return err
+			}
+			content, err := parseManifest(manifestBytes)
+			if err != nil {
+				return pkgerrors.Wrapf(err, "failed to read the manifest %s", *manifest.Digest)
+			}
+			ref := manifestRef{repoName: repoName, digest: *manifest.Digest}
+			b.add(ref, *manifest.Digest, int64(len(manifestBytes)), false)
+			if content.Config != nil {
+				b.add(ref, content.Config.Digest.String(), content.Config.Size, false)
+			}
+			for _, layers := range [][]v1.Descriptor{content.Layers, content.Blobs} {
+				for _, layer := range layers {
+					b.add(ref, layer.Digest.String(), layer.Size, true)
+				}
+			}
+			return nil
+		})
+	}
+	err := group.Wait()
+	pool.StopAndWait()
+	return err
+}
+
+// add records that the manifest references the blob.
+func (b *blobIndex) add(ref manifestRef, digest string, size int64, isLayer bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	blob, ok := b.blobs[digest]
+	if !ok {
+		blob = &blobUsage{size: size}
+		b.blobs[digest] = blob
+	}
+	blob.isLayer = blob.isLayer || isLayer
+	for _, existing := range blob.references {
+		if existing == ref {
+			return
+		}
+	}
+	blob.references = append(blob.references, ref)
+}
+
+// uniqueBytes returns the size of the distinct blobs referenced by the manifests of every repository, and of all of
+// them together.
+func (b *blobIndex) uniqueBytes() (map[string]int64, int64) {
+	perRepository := make(map[string]int64)
+	var total int64
+	for _, blob := range b.blobs {
+		total += blob.size
+		counted := make(map[string]bool)
+		for _, ref := range blob.references {
+			if !counted[ref.repoName] {
+				counted[ref.repoName] = true
+				perRepository[ref.repoName] += blob.size
+			}
+		}
+	}
+	return perRepository, total
+}
+
+// reclaimableBytes returns the size of the blobs that are only referenced by reclaimable manifests, the storage
+// deleting them frees. The blobs are counted in the repository of their manifests, and only in the total when the
+// manifests are in several repositories.
+func (b *blobIndex) reclaimableBytes(reclaimable map[manifestRef]bool) (map[string]int64, int64) {
+	perRepository := make(map[string]int64)
+	var total int64
+	for _, blob := range b.blobs {
+		freed := true
+		for _, ref := range blob.references {
+			freed = freed && reclaimable[ref]
+		}
+		if !freed || len(blob.references) == 0 {
+			continue
+		}
+		total += blob.size
+		repoName := blob.references[0].repoName
+		sameRepository := true
+		for _, ref := range blob.references {
+			sameRepository = sameRepository && ref.repoName == repoName
+		}
+		if sameRepository {
+			perRepository[repoName] += blob.size
+		}
+	}
+	return perRepository, total
+}
+
+// exclusiveLayers returns the top largest layers that are referenced by a single manifest, from the largest.
+func (b *blobIndex) exclusiveLayers(top int) []layerUsage {
+	layers := []layerUsage{}
+	for digest, blob := range b.blobs {
+		if blob.isLayer && len(blob.references) == 1 {
+			ref := blob.references[0]
+			layers = append(layers, layerUsage{Repository: ref.repoName, Manifest: ref.digest, Digest: digest, Size: blob.size})
+		}
+	}
+	sort.Slice(layers, func(i, j int) bool {
+		if layers[i].Size != layers[j].Size {
+			return layers[i].Size > layers[j].Size
+		}
+		return layers[i].Digest < layers[j].Digest
+	})
+	return layers[:min(top, len(layers))]
+}
+
+// repositoryBlob identifies a blob in a repository.
+type repositoryBlob struct {
+	repoName string
+	digest   string
+}
+
+// blobRelease counts the references left to the blobs of a blobIndex as its manifests are released one by one, to
+// find the storage that deleting them frees in their repository and in the registry.
+type blobRelease struct {
+	blobs                 map[string]*blobUsage
+	manifests             map[manifestRef][]string
+	remaining             map[string]int
+	remainingInRepository map[repositoryBlob]int
+}
+
+// newRelease returns a blobRelease of the blobs of the index where no manifest is released yet.
+func (b *blobIndex) newRelease() *blobRelease {
+	r := &blobRelease{
+		blobs:                 b.blobs,
+		manifests:             make(map[manifestRef][]string),
+		remaining:             make(map[string]int),
+		remainingInRepository: make(map[repositoryBlob]int),
+	}
+	for digest, blob := range b.blobs {
+		r.remaining[digest] = len(blob.references)
+		for _, ref := range blob.references {
+			r.manifests[ref] = append(r.manifests[ref], digest)
+			r.remainingInRepository[repositoryBlob{repoName: ref.repoName, digest: digest}]++
+		}
+	}
+	return r
+}
+
+// release releases the manifest and returns the size of the blobs that no manifest left references in its
+// repository, and in every repository. Releasing a manifest again, or a manifest that is not in the index, frees
+// nothing.
+func (r *blobRelease) release(ref manifestRef) (int64, int64) {
+	var repositoryFreed, registryFreed int64
+	for _, digest := range r.manifests[ref] {
+		size := r.blobs[digest].size
+		r.remaining[digest]--
+		if r.remaining[digest] == 0 {
+			registryFreed += size
+		}
+		key := repositoryBlob{repoName: ref.repoName, digest: digest}
+		r.remainingInRepository[key]--
+		if r.remainingInRepository[key] == 0 {
+			repositoryFreed += size
+		}
+	}
+	delete(r.manifests, ref)
+	return repositoryFreed, registryFreed
+}
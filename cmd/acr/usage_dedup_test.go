@@ -0,0 +1,92 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	godigest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageDedup(t *testing.T) {
+	now := time.Now()
+	registry := fakeregistry.New(t)
+	// pushImage pushes an image with the config and the layers, and returns its digest and the size of its manifest.
+	pushImage := func(repoName string, config string, layers []string, tags ...string) (string, int64) {
+		image := v1.Manifest{MediaType: v1.MediaTypeImageManifest}
+		image.SchemaVersion = 2
+		image.Config = v1.Descriptor{MediaType: v1.MediaTypeImageConfig, Digest: godigest.Digest(registry.PushBlob(repoName, []byte(config))), Size: int64(len(config))}
+		for _, layer := range layers {
+			image.Layers = append(image.Layers, v1.Descriptor{MediaType: v1.MediaTypeImageLayerGzip, Digest: godigest.Digest(registry.PushBlob(repoName, []byte(layer))), Size: int64(len(layer))})
+		}
+		content, err := json.Marshal(image)
+		require.NoError(t, err)
+		return registry.PushManifest(repoName, v1.MediaTypeImageManifest, content, tags...), int64(len(content))
+	}
+	size := func(values ...string) int64 {
+		var total int64
+		for _, value := range values {
+			total += int64(len(value))
+		}
+		return total
+	}
+	base := strings.Repeat("base", 100)
+	large := strings.Repeat("large", 50)
+	small := "small"
+	old, oldSize := pushImage("app", `{"seed":"old"}`, []string{base, large})
+	_, tagSize := pushImage("app", `{"seed":"tagged"}`, []string{base, small}, "v1")
+	_, copySize := pushImage("copy", `{"seed":"copy"}`, []string{base}, "latest")
+	registry.SetLastUpdateTime("app", old, now.Add(-48*time.Hour))
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+	require.NoError(t, err)
+
+	usage, err := collectUsage(testCtx, acrClient, io.Discard, registry.LoginURL(), []string{"app", "copy"}, now.Add(-24*time.Hour), 10, true)
+	require.NoError(t, err)
+	require.Len(t, usage.Repositories, 2)
+	// The base layer is counted once per repository and once for the registry, and it is not reclaimed by deleting the
+	// old image.
+	app, copied := usage.Repositories[0], usage.Repositories[1]
+	assert.Equal(t, "app", app.Name)
+	assert.Equal(t, oldSize+tagSize+size(`{"seed":"old"}`, `{"seed":"tagged"}`, base, large, small), app.UniqueBytes)
+	assert.Equal(t, oldSize+size(`{"seed":"old"}`, large), app.ReclaimableUniqueBytes)
+	assert.Greater(t, app.ReclaimableBytes, app.ReclaimableUniqueBytes)
+	assert.Equal(t, copySize+size(`{"seed":"copy"}`, base), copied.UniqueBytes)
+	assert.Zero(t, copied.ReclaimableUniqueBytes)
+	assert.Equal(t, app.UniqueBytes+copied.UniqueBytes-size(base), usage.UniqueBytes)
+	assert.Equal(t, app.ReclaimableUniqueBytes, usage.ReclaimableUniqueBytes)
+	// The base layer is shared, the other layers are only referenced by their image.
+	assert.Equal(t, []layerUsage{
+		{Repository: "app", Manifest: old, Digest: godigest.FromString(large).String(), Size: size(large)},
+		{Repository: "app", Manifest: usage.ExclusiveLayers[1].Manifest, Digest: godigest.FromString(small).String(), Size: size(small)},
+	}, usage.ExclusiveLayers)
+
+	t.Run("Table", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, printUsage(&out, outputTable, usage))
+		lines := strings.Split(out.String(), "\n")
+		assert.Regexp(t, `^REPOSITORY\s+MANIFESTS\s+TOTAL\s+TAGGED\s+UNTAGGED\s+RECLAIMABLE\s+UNIQUE\s+RECLAIMABLEUNIQUE$`, lines[1])
+		assert.Contains(t, out.String(), "\nLargest layers referenced by a single manifest:\nREPOSITORY")
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, printUsage(&out, outputCSV, usage))
+		assert.True(t, strings.HasPrefix(out.String(), "repository,manifests,totalBytes,taggedBytes,untaggedBytes,reclaimableBytes,uniqueBytes,reclaimableUniqueBytes\n"))
+	})
+
+	t.Run("Command", func(t *testing.T) {
+		err := runCommand(registry, "usage", "--username", fakeregistry.Username, "--password", fakeregistry.Password, "--dedup", "--output", "json")
+		assert.NoError(t, err)
+	})
+}
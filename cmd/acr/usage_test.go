@@ -0,0 +1,100 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUsageCmd(t *testing.T) {
+	cmd := newUsageCmd(&rootParameters{})
+	assert.Equal(t, "usage", cmd.Use)
+	assert.Equal(t, newUsageCmdLongMessage, cmd.Long)
+}
+
+func TestUsage(t *testing.T) {
+	now := time.Now()
+	registry := fakeregistry.New(t)
+	tagged := registry.PushImage("hello", "tagged", "v1")
+	old := registry.PushImage("hello", "old")
+	recent := registry.PushImage("hello", "recent")
+	signature := registry.PushReferrer("hello", tagged, "application/vnd.cncf.notary.signature", nil)
+	registry.PushImage("other", "other", "latest")
+	for _, digest := range []string{tagged, old, signature} {
+		registry.SetLastUpdateTime("hello", digest, now.Add(-48*time.Hour))
+	}
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+	require.NoError(t, err)
+	manifests, err := listAllManifests(testCtx, acrClient, "hello")
+	require.NoError(t, err)
+	sizes := make(map[string]int64)
+	for _, manifest := range manifests {
+		sizes[*manifest.Digest] = *manifest.ImageSize
+	}
+	otherManifests, err := listAllManifests(testCtx, acrClient, "other")
+	require.NoError(t, err)
+	otherSize := *otherManifests[0].ImageSize
+
+	usage, err := collectUsage(testCtx, acrClient, io.Discard, registry.LoginURL(), []string{"other", "hello"}, now.Add(-24*time.Hour), 2, false)
+	require.NoError(t, err)
+	require.Len(t, usage.Repositories, 2)
+	// The repositories are ordered from the largest, the signature is untagged but not reclaimable.
+	assert.Equal(t, repositoryUsage{
+		Name:             "hello",
+		Manifests:        4,
+		TotalBytes:       sizes[tagged] + sizes[old] + sizes[recent] + sizes[signature],
+		TaggedBytes:      sizes[tagged],
+		UntaggedBytes:    sizes[old] + sizes[recent] + sizes[signature],
+		ReclaimableBytes: sizes[old],
+	}, usage.Repositories[0])
+	assert.Equal(t, repositoryUsage{Name: "other", Manifests: 1, TotalBytes: otherSize, TaggedBytes: otherSize}, usage.Repositories[1])
+	assert.Equal(t, usage.Repositories[0].TotalBytes+otherSize, usage.TotalBytes)
+	assert.Equal(t, sizes[old], usage.ReclaimableBytes)
+	require.Len(t, usage.LargestManifests, 2)
+	assert.GreaterOrEqual(t, usage.LargestManifests[0].Size, usage.LargestManifests[1].Size)
+
+	t.Run("Table", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, printUsage(&out, outputTable, usage))
+		lines := strings.Split(out.String(), "\n")
+		assert.Equal(t, "Storage used by "+registry.LoginURL()+":", lines[0])
+		assert.Regexp(t, `^REPOSITORY\s+MANIFESTS\s+TOTAL\s+TAGGED\s+UNTAGGED\s+RECLAIMABLE$`, lines[1])
+		assert.Regexp(t, `^hello\s+4\s+`, lines[2])
+		assert.Regexp(t, `^\(total\)\s+5\s+`, lines[4])
+		assert.Contains(t, out.String(), "\nLargest manifests:\nREPOSITORY")
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, printUsage(&out, outputCSV, usage))
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Equal(t, "repository,manifests,totalBytes,taggedBytes,untaggedBytes,reclaimableBytes", lines[0])
+		assert.Len(t, lines, 3)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, printUsage(&out, outputJSON, usage))
+		var written registryUsage
+		require.NoError(t, json.Unmarshal(out.Bytes(), &written))
+		assert.Equal(t, *usage, written)
+	})
+
+	t.Run("Command", func(t *testing.T) {
+		err := runCommand(registry, "usage", "--username", fakeregistry.Username, "--password", fakeregistry.Password, "--filter", "hel.*", "--ago", "1d")
+		assert.NoError(t, err)
+		err = runCommand(registry, "usage", "--username", fakeregistry.Username, "--password", fakeregistry.Password, "--output", "text")
+		assert.EqualError(t, err, `invalid output format "text", allowed values are table, json, csv`)
+	})
+}
@@ -201,6 +201,75 @@ func (_m *AcrCLIClientInterface) UpdateAcrManifestAttributes(ctx context.Context
 	return r0, r1
 }
 
+// GetAcrRepositoryAttributes provides a mock function with given fields: ctx, repoName
+func (_m *AcrCLIClientInterface) GetAcrRepositoryAttributes(ctx context.Context, repoName string) (*acr.RepositoryAttributes, error) {
+	ret := _m.Called(ctx, repoName)
+
+	var r0 *acr.RepositoryAttributes
+	if rf, ok := ret.Get(0).(func(context.Context, string) *acr.RepositoryAttributes); ok {
+		r0 = rf(ctx, repoName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*acr.RepositoryAttributes)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, repoName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateAcrRepositoryAttributes provides a mock function with given fields: ctx, repoName, value
+func (_m *AcrCLIClientInterface) UpdateAcrRepositoryAttributes(ctx context.Context, repoName string, value *acr.ChangeableAttributes) (*autorest.Response, error) {
+	ret := _m.Called(ctx, repoName, value)
+
+	var r0 *autorest.Response
+	if rf, ok := ret.Get(0).(func(context.Context, string, *acr.ChangeableAttributes) *autorest.Response); ok {
+		r0 = rf(ctx, repoName, value)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*autorest.Response)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, *acr.ChangeableAttributes) error); ok {
+		r1 = rf(ctx, repoName, value)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteAcrRepository provides a mock function with given fields: ctx, repoName
+func (_m *AcrCLIClientInterface) DeleteAcrRepository(ctx context.Context, repoName string) (*acr.DeletedRepository, error) {
+	ret := _m.Called(ctx, repoName)
+
+	var r0 *acr.DeletedRepository
+	if rf, ok := ret.Get(0).(func(context.Context, string) *acr.DeletedRepository); ok {
+		r0 = rf(ctx, repoName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*acr.DeletedRepository)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, repoName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // IsAbac provides a mock function that returns whether the registry is ABAC-enabled
 func (_m *AcrCLIClientInterface) IsAbac() bool {
 	ret := _m.Called()
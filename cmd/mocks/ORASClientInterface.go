@@ -6,6 +6,8 @@ import (
 	context "context"
 
 	mock "github.com/stretchr/testify/mock"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // ORASClientInterface is an autogenerated mock type for the ORASClientInterface type
@@ -51,6 +53,32 @@ func (_m *ORASClientInterface) DiscoverLifecycleAnnotation(ctx context.Context,
 	return r0, r1
 }
 
+// Referrers provides a mock function with given fields: ctx, reference, artifactType
+func (_m *ORASClientInterface) Referrers(ctx context.Context, reference string, artifactType string) ([]v1.Descriptor, error) {
+	ret := _m.Called(ctx, reference, artifactType)
+
+	var r0 []v1.Descriptor
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) ([]v1.Descriptor, error)); ok {
+		return rf(ctx, reference, artifactType)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) []v1.Descriptor); ok {
+		r0 = rf(ctx, reference, artifactType)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]v1.Descriptor)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, reference, artifactType)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 type mockConstructorTestingTNewORASClientInterface interface {
 	mock.TestingT
 	Cleanup(func())
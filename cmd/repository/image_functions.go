@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -19,6 +20,8 @@ import (
 	"github.com/Azure/acr-cli/acr"
 	"github.com/Azure/acr-cli/acr/acrapi"
 	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/report"
+	"github.com/Azure/acr-cli/internal/worker"
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/alitto/pond/v2"
@@ -131,6 +134,35 @@ func CollectTagFilters(ctx context.Context, rawFilters []string, client acrapi.B
 	return tagFilters, nil
 }
 
+// CollectExcludeFilters matches the exclude filters, in the same <repository>:<regex filter> form as the tag filters, against
+// the provided repository names and collects the associated tag expressions. Unlike CollectTagFilters it does not list the
+// registry, exclusions only apply to repositories that were already selected.
+func CollectExcludeFilters(rawFilters []string, repoNames []string, regexMatchTimeout int64) (map[string]string, error) {
+	excludeFilters := map[string]string{}
+	for _, filter := range rawFilters {
+		repoRegex, tagRegex, err := GetRepositoryAndTagRegex(filter)
+		if err != nil {
+			return nil, err
+		}
+		// The tag expression is compiled up front so that an invalid exclusion fails before anything is deleted.
+		if _, err := BuildRegexFilter(tagRegex, regexMatchTimeout); err != nil {
+			return nil, fmt.Errorf("invalid exclude filter %s: %w", filter, err)
+		}
+		matchedRepos, err := GetMatchingRepos(repoNames, "^"+repoRegex+"$", regexMatchTimeout)
+		if err != nil {
+			return nil, err
+		}
+		for _, repoName := range matchedRepos {
+			if _, ok := excludeFilters[repoName]; ok {
+				excludeFilters[repoName] = excludeFilters[repoName] + "|" + tagRegex
+			} else {
+				excludeFilters[repoName] = tagRegex
+			}
+		}
+	}
+	return excludeFilters, nil
+}
+
 // GetLastTagFromResponse extracts the last tag from pagination headers in the response.
 func GetLastTagFromResponse(resultTags *acr.RepositoryTagsType) string {
 	// The lastTag is updated to keep the for loop going.
@@ -158,21 +190,25 @@ func GetLastTagFromResponse(resultTags *acr.RepositoryTagsType) string {
 // the manifest should also not have a tag and not have a subject manifest.
 // Param manifestToTagsCountMap is an optional map that can be used to pass the count of tags for each manifest that we know would be deleted if the command is exectued
 // under dryRun conditions. Its ignored if the dryRun flag is false.
-func GetUntaggedManifests(ctx context.Context, poolSize int, acrClient api.AcrCLIClientInterface, repoName string, preserveAllOCIManifests bool, manifestToDeletedTagsCountMap map[string]int, dryRun bool, includeLocked bool, deleteCutoff *time.Time) ([]acr.ManifestAttributesBase, error) {
+// Untagged manifests that are not returned because they are locked, too recent or still referenced are recorded in the reporter,
+// which can be nil, with the code of the reason. When the reporter explains, the tagged manifests are recorded too. When a limiter is specified it adapts the number of concurrent manifest reads, and poolSize is ignored.
+// The human readable messages, such as the manifests protected because their age is unknown, are written to out.
+func GetUntaggedManifests(ctx context.Context, poolSize int, acrClient api.AcrCLIClientInterface, out io.Writer, repoName string, preserveAllOCIManifests bool, manifestToDeletedTagsCountMap map[string]int, dryRun bool, includeLocked bool, deleteCutoff *time.Time, reporter *report.Reporter, limiter *worker.AdaptiveLimiter) ([]acr.ManifestAttributesBase, error) {
 	lastManifestDigest := ""
 	var manifestsToDelete []acr.ManifestAttributesBase
 	resultManifests, err := acrClient.GetAcrManifests(ctx, repoName, "", lastManifestDigest)
 	if err != nil {
 		if resultManifests != nil && resultManifests.Response.Response != nil && resultManifests.StatusCode == http.StatusNotFound {
-			fmt.Printf("%s repository not found\n", repoName)
+			fmt.Fprintf(out, "%s repository not found\n", repoName)
 			return manifestsToDelete, nil
 		}
 		return nil, err
 	}
 
 	// This will act as a set. If a key is present, then the command shouldn't be executed because it is referenced by a multiarch manifest
-	// or the manifest has subjects attached
+	// or the manifest has subjects attached. The values are the protection of the manifest.
 	ignoreList := sync.Map{}
+	explain := reporter.Explains()
 
 	// Represents the manifests that are candidates for deletion. This is a purely additive map, the ignoreList will be used to weed out
 	// candidates that are not deletable after all at the end.
@@ -181,6 +217,7 @@ func GetUntaggedManifests(ctx context.Context, poolSize int, acrClient api.AcrCL
 	// Read operations, specifically manifest gets are less throttled and so we can do more at once
 	// We will use a goroutine pool to limit the number of concurrent operations. We allow for a large queue size
 	// so that we save some time by not having to wait for the pool to be available before submitting a new task.
+	poolSize = limiter.PoolSize(poolSize)
 	pool := pond.NewPool(poolSize, pond.WithContext(ctx), pond.WithQueueSize(poolSize*3), pond.WithNonBlocking(false))
 	group := pool.NewGroup()
 
@@ -198,26 +235,30 @@ func GetUntaggedManifests(ctx context.Context, poolSize int, acrClient api.AcrCL
 			}
 
 			// Check if the manifest is already in the ignoreList and can be skipped
-			if _, ok := ignoreList.Load(*manifest.Digest); ok {
+			if value, ok := ignoreList.Load(*manifest.Digest); ok {
+				if explain {
+					reporter.Record(value.(protection).record(repoName, manifest))
+				}
 				continue
 			}
 
 			// _____MANIFEST HAS DELETION AS DISALLOWED BY ATTRIBUTES_____
 			// If the manifest cannot be deleted or written to we can skip them (ACR will not allow deletion of these manifests)
 			// Unless --include-locked flag is set, in which case we will unlock them first
+			// _____MANIFEST HAS TAGS_____
+			// Check tags first since it's cheaper and can short-circuit age criteria evaluation
+			manifestHasTags := manifest.Tags != nil && len(*manifest.Tags) > 0
+
 			if !includeLocked && manifest.ChangeableAttributes != nil {
-				if manifest.ChangeableAttributes.DeleteEnabled != nil && !(*manifest.ChangeableAttributes.DeleteEnabled) {
-					continue
-				}
-				if manifest.ChangeableAttributes.WriteEnabled != nil && !(*manifest.ChangeableAttributes.WriteEnabled) {
+				if (manifest.ChangeableAttributes.DeleteEnabled != nil && !(*manifest.ChangeableAttributes.DeleteEnabled)) ||
+					(manifest.ChangeableAttributes.WriteEnabled != nil && !(*manifest.ChangeableAttributes.WriteEnabled)) {
+					if !manifestHasTags || explain {
+						reporter.Record(report.ManifestRecord(repoName, manifest, report.ActionLocked, "manifest is locked").WithCode(report.ReasonLocked, ""))
+					}
 					continue
 				}
 			}
 
-			// _____MANIFEST HAS TAGS_____
-			// Check tags first since it's cheaper and can short-circuit age criteria evaluation
-			manifestHasTags := manifest.Tags != nil && len(*manifest.Tags) > 0
-
 			// _____MANIFEST IS PROTECTED BY TAGS______
 			isProtectedByTags := false
 			if manifestHasTags {
@@ -243,18 +284,25 @@ func GetUntaggedManifests(ctx context.Context, poolSize int, acrClient api.AcrCL
 				// Take the more conservative approach and protect manifests with no last update time
 				if manifest.LastUpdateTime == nil {
 					isProtectedByAge = true
-					fmt.Printf("Protecting manifest %s because the last update time is unavailable\n", *manifest.Digest)
+					fmt.Fprintf(out, "Protecting manifest %s because the last update time is unavailable\n", *manifest.Digest)
+					reporter.Record(report.ManifestRecord(repoName, manifest, report.ActionKept, "last update time is unavailable").WithCode(report.ReasonUnknownAge, ""))
 				} else {
 					lastUpdateTime, err := time.Parse(time.RFC3339Nano, *manifest.LastUpdateTime)
 					if err != nil {
 						isProtectedByAge = true
-						fmt.Printf("Protecting manifest %s because the last update time cannot be read\n", *manifest.Digest)
+						fmt.Fprintf(out, "Protecting manifest %s because the last update time cannot be read\n", *manifest.Digest)
+						reporter.Record(report.ManifestRecord(repoName, manifest, report.ActionKept, "last update time cannot be read").WithCode(report.ReasonUnknownAge, ""))
 					} else if lastUpdateTime.After(*deleteCutoff) {
 						isProtectedByAge = true
+						reporter.Record(report.ManifestRecord(repoName, manifest, report.ActionKept, "newer than the ago duration").WithCode(report.ReasonNewer, ""))
 					}
 				}
 			}
 
+			if isProtectedByTags && explain {
+				reporter.Record(report.ManifestRecord(repoName, manifest, report.ActionKept, "manifest is tagged").WithCode(report.ReasonTagged, ""))
+			}
+
 			if isProtectedByTags || isProtectedByAge {
 				// If the media type is not set, we will have to identify the manifest type from its fields, in this case the manifests field.
 				// This should not really happen for this API but we will handle it gracefully.
@@ -268,7 +316,7 @@ func GetUntaggedManifests(ctx context.Context, poolSize int, acrClient api.AcrCL
 				group.SubmitErr(func() error {
 					// For tagged indexes/lists, we need to get dependencies and add them to ignore list
 					// We don't need to check deletability attributes since it's not deletable, just get dependencies
-					manifestBytes, err := acrClient.GetManifest(ctx, repoName, *manifest.Digest)
+					manifestBytes, err := getManifest(ctx, acrClient, limiter, repoName, *manifest.Digest)
 					if err != nil {
 						errParsed := autorest.DetailedError{}
 						if errors.As(err, &errParsed) && errParsed.StatusCode == http.StatusNotFound {
@@ -284,7 +332,7 @@ func GetUntaggedManifests(ctx context.Context, poolSize int, acrClient api.AcrCL
 					}
 
 					if len(dependentManifests) > 0 {
-						return addDependentManifestsToIgnoreList(ctx, dependentManifests, acrClient, repoName, &ignoreList)
+						return addDependentManifestsToIgnoreList(ctx, *manifest.Digest, dependentManifests, acrClient, limiter, repoName, &ignoreList)
 					}
 					return nil
 				})
@@ -311,21 +359,21 @@ func GetUntaggedManifests(ctx context.Context, poolSize int, acrClient api.AcrCL
 
 			// We only need to do this check if we are looking at an oci index or oci manifest
 			group.SubmitErr(func() error {
-				canDelete, dependentManifests, err := checkManifestDeletabilityAndGetDependencies(ctx, manifest, acrClient, repoName)
+				protected, dependentManifests, err := checkManifestDeletabilityAndGetDependencies(ctx, manifest, acrClient, limiter, out, repoName)
 				if err != nil {
 					return err
 				}
-				if canDelete {
+				if protected.code == "" {
 					// Manifest is okay to delete
 					return nil
 				}
 
 				// If the manifest has dependencies (is an index), add them to the ignore list
 				if len(dependentManifests) > 0 {
-					return addDependentManifestsToIgnoreList(ctx, dependentManifests, acrClient, repoName, &ignoreList)
+					return addDependentManifestsToIgnoreList(ctx, *manifest.Digest, dependentManifests, acrClient, limiter, repoName, &ignoreList)
 				}
 
-				ignoreList.LoadOrStore(*manifest.Digest, struct{}{})
+				ignoreList.LoadOrStore(*manifest.Digest, protected)
 				return nil
 			})
 
@@ -358,15 +406,40 @@ func GetUntaggedManifests(ctx context.Context, poolSize int, acrClient api.AcrCL
 
 	for _, manifest := range candidates {
 		// If the manifest is not in the ignore list, it should be deleted
-		if _, shouldBeIgnored := ignoreList.Load(*manifest.Digest); !shouldBeIgnored {
+		if value, shouldBeIgnored := ignoreList.Load(*manifest.Digest); !shouldBeIgnored {
 			// Add the manifest to the list of manifests to delete
 			manifestsToDelete = append(manifestsToDelete, manifest)
+		} else {
+			reporter.Record(value.(protection).record(repoName, manifest))
 		}
 	}
 
 	return manifestsToDelete, nil
 }
 
+// protection is the reason a manifest is in the ignore list, with the digest of the index or the subject protecting it.
+// An empty code means the manifest is not protected.
+type protection struct {
+	code   report.ReasonCode
+	parent string
+}
+
+// record returns the record of the manifest kept because of the protection.
+func (p protection) record(repoName string, manifest acr.ManifestAttributesBase) report.Record {
+	reason := "referenced by another manifest or a preserved referrer"
+	switch p.code {
+	case report.ReasonInIndex:
+		reason = "referenced by the index " + p.parent
+	case report.ReasonReferrer:
+		reason = "referrer of " + p.parent
+	case report.ReasonNoMediaType:
+		reason = "manifest has no media type"
+	case report.ReasonNotFound:
+		reason = "manifest was not found"
+	}
+	return report.ManifestRecord(repoName, manifest, report.ActionKept, reason).WithCode(p.code, p.parent)
+}
+
 type dependentManifestResult struct {
 	Digest string `json:"digest"`
 	IsList bool   `json:"isList"`
@@ -374,9 +447,9 @@ type dependentManifestResult struct {
 
 // findDirectDependentManifests finds all the manifests that are directly dependent on the provided manifest digest. We expect the manifest to be a multiarch manifest or an index.
 // It returns a list of dependent manifests with their digests and whether they are lists or not.
-func findDirectDependentManifests(ctx context.Context, manifestDigest string, acrClient api.AcrCLIClientInterface, repoName string) ([]dependentManifestResult, error) {
+func findDirectDependentManifests(ctx context.Context, manifestDigest string, acrClient api.AcrCLIClientInterface, limiter *worker.AdaptiveLimiter, repoName string) ([]dependentManifestResult, error) {
 	var manifestBytes []byte
-	manifestBytes, err := acrClient.GetManifest(ctx, repoName, manifestDigest)
+	manifestBytes, err := getManifest(ctx, acrClient, limiter, repoName, manifestDigest)
 	if err != nil {
 		errParsed := azure.RequestError{}
 		if errors.As(err, &errParsed) && errParsed.StatusCode == http.StatusNotFound {
@@ -389,6 +462,18 @@ func findDirectDependentManifests(ctx context.Context, manifestDigest string, ac
 	return extractSubmanifestsFromBytes(manifestBytes)
 }
 
+// getManifest reads a manifest once the limiter allows it. Only the single request is measured by the limiter, the work
+// done with the manifest afterwards does not count towards its latency.
+func getManifest(ctx context.Context, acrClient api.AcrCLIClientInterface, limiter *worker.AdaptiveLimiter, repoName string, manifestDigest string) ([]byte, error) {
+	var manifestBytes []byte
+	err := limiter.Run(ctx, func() error {
+		var err error
+		manifestBytes, err = acrClient.GetManifest(ctx, repoName, manifestDigest)
+		return err
+	})
+	return manifestBytes, err
+}
+
 // BuildRegexFilter compiles a regex state machine from a regex expression
 func BuildRegexFilter(expression string, regexpMatchTimeoutSeconds int64) (*regexp2.Regexp, error) {
 	regexp, err := regexp2.Compile(expression, defaultRegexpOptions)
@@ -406,15 +491,16 @@ func BuildRegexFilter(expression string, regexpMatchTimeoutSeconds int64) (*rege
 }
 
 // checkManifestDeletabilityAndGetDependencies combines the functionality of isManifestOkayToDelete and findDirectDependentManifests
-// to avoid double-fetching the same manifest. It returns whether the manifest can be deleted and its dependencies if it's an index.
-func checkManifestDeletabilityAndGetDependencies(ctx context.Context, manifest acr.ManifestAttributesBase, acrClient api.AcrCLIClientInterface, repoName string) (bool, []dependentManifestResult, error) {
+// to avoid double-fetching the same manifest. It returns the protection of the manifest, whose code is empty when it can be
+// deleted, and its dependencies if it's an index. The manifests that are skipped are written to out.
+func checkManifestDeletabilityAndGetDependencies(ctx context.Context, manifest acr.ManifestAttributesBase, acrClient api.AcrCLIClientInterface, limiter *worker.AdaptiveLimiter, out io.Writer, repoName string) (protection, []dependentManifestResult, error) {
 	var dependentManifests []dependentManifestResult
 
 	// Check media type first to avoid unnecessary GetManifest calls
 	if manifest.MediaType == nil {
 		// No media type, do not delete this manifest to be on the safe side
-		fmt.Println("Manifest", *manifest.Digest, "has no media type, skipping deletion")
-		return false, dependentManifests, nil
+		fmt.Fprintln(out, "Manifest", *manifest.Digest, "has no media type, skipping deletion")
+		return protection{code: report.ReasonNoMediaType}, dependentManifests, nil
 	}
 
 	mediaType := *manifest.MediaType
@@ -422,43 +508,43 @@ func checkManifestDeletabilityAndGetDependencies(ctx context.Context, manifest a
 	switch mediaType {
 	case v1.MediaTypeImageManifest, v1.MediaTypeImageIndex, mediaTypeArtifactManifest:
 		// Fetch the manifest content only when needed
-		manifestBytes, err := acrClient.GetManifest(ctx, repoName, *manifest.Digest)
+		manifestBytes, err := getManifest(ctx, acrClient, limiter, repoName, *manifest.Digest)
 		if err != nil {
 			errParsed := autorest.DetailedError{}
 			if errors.As(err, &errParsed) && errParsed.StatusCode == http.StatusNotFound {
-				fmt.Println("Manifest", *manifest.Digest, "not found, skip it")
-				return false, dependentManifests, nil
+				fmt.Fprintln(out, "Manifest", *manifest.Digest, "not found, skip it")
+				return protection{code: report.ReasonNotFound}, dependentManifests, nil
 			}
-			return false, dependentManifests, err
+			return protection{}, dependentManifests, err
 		}
 
 		// Check if it's an OCI artifact type (referrer) - these are not deletable
-		canDelete, err := checkOCIArtifactDeletability(manifestBytes, mediaType)
+		subject, err := getSubjectDigest(manifestBytes, mediaType)
 		if err != nil {
-			return false, dependentManifests, err
+			return protection{}, dependentManifests, err
 		}
 		// Image can be deleted, it has no subject (referrer)
-		if canDelete {
-			return true, dependentManifests, nil
+		if subject == "" {
+			return protection{}, dependentManifests, nil
 		}
 
 		// If we reach here, the manifest is an OCI index with a subject
 		if mediaType == v1.MediaTypeImageIndex {
 			dependentManifests, err = extractSubmanifestsFromBytes(manifestBytes)
 			if err != nil {
-				return false, dependentManifests, err
+				return protection{}, dependentManifests, err
 			}
 		}
-		return false, dependentManifests, nil
+		return protection{code: report.ReasonReferrer, parent: subject}, dependentManifests, nil
 
 	default:
 		// Regular manifest types (like Docker v2) that don't need content inspection
-		return true, dependentManifests, nil
+		return protection{}, dependentManifests, nil
 	}
 }
 
-// checkOCIArtifactDeletability checks if an OCI artifact manifest can be deleted based on whether it has a subject (referrer)
-func checkOCIArtifactDeletability(manifestBytes []byte, mediaType string) (bool, error) {
+// getSubjectDigest returns the digest of the subject of referrers, or an empty string when the manifest has no subject.
+func getSubjectDigest(manifestBytes []byte, mediaType string) (string, error) {
 	// Only check for subject on artifact types that can be referrers
 	switch mediaType {
 	case mediaTypeArtifactManifest, v1.MediaTypeImageManifest, v1.MediaTypeImageIndex:
@@ -467,16 +553,16 @@ func checkOCIArtifactDeletability(manifestBytes []byte, mediaType string) (bool,
 		}{}
 
 		if err := json.Unmarshal(manifestBytes, &subjectOnlyStruct); err != nil {
-			return false, err
+			return "", err
 		}
 
 		// If it has a subject, it's a referrer and should not be deleted
 		if subjectOnlyStruct.Subject != nil && subjectOnlyStruct.Subject.Digest != "" {
-			return false, nil
+			return subjectOnlyStruct.Subject.Digest.String(), nil
 		}
 	}
 
-	return true, nil
+	return "", nil
 }
 
 // extractSubmanifestsFromBytes extracts submanifest dependencies from manifest bytes
@@ -504,32 +590,37 @@ func extractSubmanifestsFromBytes(manifestBytes []byte) ([]dependentManifestResu
 	return dependentManifests, nil
 }
 
-// addDependentManifestsToIgnoreList adds the provided dependent manifests to the ignore list, recursively handling nested indexes
-func addDependentManifestsToIgnoreList(ctx context.Context, dependentManifests []dependentManifestResult, acrClient api.AcrCLIClientInterface, repoName string, ignoreList *sync.Map) error {
-	queue := make([]string, 0, len(dependentManifests))
+// addDependentManifestsToIgnoreList adds the provided dependent manifests of the index parentDigest to the ignore list, recursively
+// handling nested indexes. Every manifest is protected by the index that directly references it.
+func addDependentManifestsToIgnoreList(ctx context.Context, parentDigest string, dependentManifests []dependentManifestResult, acrClient api.AcrCLIClientInterface, limiter *worker.AdaptiveLimiter, repoName string, ignoreList *sync.Map) error {
+	type queuedIndex struct {
+		digest string
+		parent string
+	}
+	queue := make([]queuedIndex, 0, len(dependentManifests))
 
 	// Add initial dependencies to queue
 	for _, manifest := range dependentManifests {
 		if manifest.IsList {
-			queue = append(queue, manifest.Digest)
+			queue = append(queue, queuedIndex{manifest.Digest, parentDigest})
 		} else {
-			ignoreList.LoadOrStore(manifest.Digest, struct{}{})
+			ignoreList.LoadOrStore(manifest.Digest, protection{code: report.ReasonInIndex, parent: parentDigest})
 		}
 	}
 
 	// Process nested indexes
 	for len(queue) > 0 {
 		// Dequeue the first digest
-		currentDigest := queue[0]
+		current := queue[0]
 		queue = queue[1:]
 
 		// Skip if already in ignore list
-		if _, loaded := ignoreList.LoadOrStore(currentDigest, struct{}{}); loaded {
+		if _, loaded := ignoreList.LoadOrStore(current.digest, protection{code: report.ReasonInIndex, parent: current.parent}); loaded {
 			continue
 		}
 
 		// Fetch direct dependencies
-		manifests, err := findDirectDependentManifests(ctx, currentDigest, acrClient, repoName)
+		manifests, err := findDirectDependentManifests(ctx, current.digest, acrClient, limiter, repoName)
 		if err != nil {
 			return err
 		}
@@ -537,9 +628,9 @@ func addDependentManifestsToIgnoreList(ctx context.Context, dependentManifests [
 		// Enqueue child manifests if they are lists
 		for _, manifest := range manifests {
 			if manifest.IsList {
-				queue = append(queue, manifest.Digest)
+				queue = append(queue, queuedIndex{manifest.Digest, current.digest})
 			} else {
-				ignoreList.LoadOrStore(manifest.Digest, struct{}{})
+				ignoreList.LoadOrStore(manifest.Digest, protection{code: report.ReasonInIndex, parent: current.digest})
 			}
 		}
 	}
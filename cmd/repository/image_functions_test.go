@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math/big"
 	"sync"
 	"testing"
@@ -71,7 +72,7 @@ func TestFindDirectDependentManifests(t *testing.T) {
 				mockClient.On("GetManifest", ctx, repoName, tc.manifestDigest).Return(bytes, nil)
 			}
 
-			results, err := findDirectDependentManifests(ctx, tc.manifestDigest, mockClient, repoName)
+			results, err := findDirectDependentManifests(ctx, tc.manifestDigest, mockClient, nil, repoName)
 
 			if tc.expectedError != nil {
 				assert.ErrorContains(t, err, tc.expectedError.Error())
@@ -100,7 +101,7 @@ func TestAddDependentManifestsToIgnoreList(t *testing.T) {
 			{Digest: "digest2", IsList: false},
 		}
 
-		err := addDependentManifestsToIgnoreList(ctx, dependentManifests, mockClient, repoName, ignoreList)
+		err := addDependentManifestsToIgnoreList(ctx, "index", dependentManifests, mockClient, nil, repoName, ignoreList)
 		assert.NoError(t, err)
 
 		// Check that both manifests are in ignore list
@@ -129,7 +130,7 @@ func TestAddDependentManifestsToIgnoreList(t *testing.T) {
 			]
 		}`), nil)
 
-		err := addDependentManifestsToIgnoreList(ctx, dependentManifests, mockClient, repoName, ignoreList)
+		err := addDependentManifestsToIgnoreList(ctx, "index", dependentManifests, mockClient, nil, repoName, ignoreList)
 		assert.NoError(t, err)
 
 		// Check that all manifests are in ignore list
@@ -179,7 +180,7 @@ func TestAddIndexDependenciesToIgnoreListComplex(t *testing.T) {
 				{Digest: rootDigest, IsList: true},
 			}
 
-			err := addDependentManifestsToIgnoreList(ctx, dependentManifests, mockClient, repoName, ignoreList)
+			err := addDependentManifestsToIgnoreList(ctx, "index", dependentManifests, mockClient, nil, repoName, ignoreList)
 			assert.NoError(t, err, "Expected no error while processing recursive manifests")
 
 			// Check that root digest is in ignore list
@@ -253,67 +254,67 @@ func generateRecursiveTestCase(depth, branching int) (string, map[string]string,
 	return root, mockResponses, expectedKeys
 }
 
-func TestCheckOCIArtifactDeletability(t *testing.T) {
+func TestGetSubjectDigest(t *testing.T) {
 	testCases := []struct {
 		name         string
 		manifestJSON string
 		mediaType    string
-		canDelete    bool
+		subject      string
 		expectError  bool
 	}{
 		{
 			name:         "OCI manifest without subject",
 			manifestJSON: `{"schemaVersion": 2}`,
 			mediaType:    v1.MediaTypeImageManifest,
-			canDelete:    true,
+			subject:      "",
 			expectError:  false,
 		},
 		{
 			name:         "OCI manifest with subject - referrer",
 			manifestJSON: `{"schemaVersion": 2, "subject": {"digest": "sha256:abc123", "mediaType": "application/vnd.oci.image.manifest.v1+json"}}`,
 			mediaType:    v1.MediaTypeImageManifest,
-			canDelete:    false,
+			subject:      "sha256:abc123",
 			expectError:  false,
 		},
 		{
 			name:         "OCI artifact manifest without subject",
 			manifestJSON: `{"schemaVersion": 2}`,
 			mediaType:    mediaTypeArtifactManifest,
-			canDelete:    true,
+			subject:      "",
 			expectError:  false,
 		},
 		{
 			name:         "OCI artifact manifest with subject - referrer",
 			manifestJSON: `{"schemaVersion": 2, "subject": {"digest": "sha256:def456", "mediaType": "application/vnd.oci.image.manifest.v1+json"}}`,
 			mediaType:    mediaTypeArtifactManifest,
-			canDelete:    false,
+			subject:      "sha256:def456",
 			expectError:  false,
 		},
 		{
 			name:         "Non-OCI media type",
 			manifestJSON: `{"schemaVersion": 2}`,
 			mediaType:    "application/vnd.docker.distribution.manifest.v2+json",
-			canDelete:    true,
+			subject:      "",
 			expectError:  false,
 		},
 		{
 			name:         "Invalid JSON",
 			manifestJSON: `{invalid json}`,
 			mediaType:    v1.MediaTypeImageManifest,
-			canDelete:    false,
+			subject:      "",
 			expectError:  true,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			canDelete, err := checkOCIArtifactDeletability([]byte(tc.manifestJSON), tc.mediaType)
+			subject, err := getSubjectDigest([]byte(tc.manifestJSON), tc.mediaType)
 
 			if tc.expectError {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tc.canDelete, canDelete)
+				assert.Equal(t, tc.subject, subject)
 			}
 		})
 	}
@@ -411,7 +412,7 @@ func TestGetUntaggedManifestsWithAgeCriteria(t *testing.T) {
 
 		cutoff := parseTime(t, "2024-11-01T12:00:00Z") // 30 days ago from "now"
 
-		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, repoName, false, nil, false, false, &cutoff)
+		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, io.Discard, repoName, false, nil, false, false, &cutoff, nil, nil)
 
 		assert.NoError(t, err)
 		assert.Equal(t, 1, len(result))
@@ -431,7 +432,7 @@ func TestGetUntaggedManifestsWithAgeCriteria(t *testing.T) {
 
 		cutoff := parseTime(t, "2024-11-01T12:00:00Z")
 
-		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, repoName, false, nil, false, false, &cutoff)
+		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, io.Discard, repoName, false, nil, false, false, &cutoff, nil, nil)
 
 		assert.NoError(t, err)
 		assert.Equal(t, 0, len(result), "Recent manifest should be protected")
@@ -450,7 +451,7 @@ func TestGetUntaggedManifestsWithAgeCriteria(t *testing.T) {
 
 		cutoff := parseTime(t, "2024-11-01T12:00:00Z")
 
-		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, repoName, false, nil, false, false, &cutoff)
+		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, io.Discard, repoName, false, nil, false, false, &cutoff, nil, nil)
 
 		assert.NoError(t, err)
 		assert.Equal(t, 0, len(result), "Manifest with nil timestamp should be protected")
@@ -469,7 +470,7 @@ func TestGetUntaggedManifestsWithAgeCriteria(t *testing.T) {
 
 		cutoff := parseTime(t, "2024-11-01T12:00:00Z")
 
-		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, repoName, false, nil, false, false, &cutoff)
+		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, io.Discard, repoName, false, nil, false, false, &cutoff, nil, nil)
 
 		assert.NoError(t, err)
 		assert.Equal(t, 0, len(result), "Tagged manifest should be protected regardless of age")
@@ -494,7 +495,7 @@ func TestGetUntaggedManifestsWithAgeCriteria(t *testing.T) {
 
 		cutoff := parseTime(t, "2024-11-01T12:00:00Z")
 
-		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, repoName, false, nil, false, false, &cutoff)
+		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, io.Discard, repoName, false, nil, false, false, &cutoff, nil, nil)
 
 		assert.NoError(t, err)
 		assert.Equal(t, 1, len(result))
@@ -513,7 +514,7 @@ func TestGetUntaggedManifestsWithAgeCriteria(t *testing.T) {
 		mockClient.On("GetAcrManifests", ctx, repoName, "", "").Return(manifests, nil).Once()
 		mockClient.On("GetAcrManifests", ctx, repoName, "", "sha256:recent1").Return(createEmptyManifestsResult(), nil).Once()
 
-		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, repoName, false, nil, false, false, nil)
+		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, io.Discard, repoName, false, nil, false, false, nil, nil, nil)
 
 		assert.NoError(t, err)
 		assert.Equal(t, 2, len(result), "All untagged manifests should be candidates when no cutoff is specified")
@@ -533,7 +534,7 @@ func TestGetUntaggedManifestsWithAgeCriteria(t *testing.T) {
 
 		cutoff := parseTime(t, "2024-11-01T12:00:00Z")
 
-		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, repoName, false, nil, true, false, &cutoff)
+		result, err := GetUntaggedManifests(ctx, poolSize, mockClient, io.Discard, repoName, false, nil, true, false, &cutoff, nil, nil)
 
 		assert.NoError(t, err)
 		assert.Equal(t, 1, len(result), "Dry run should still apply age criteria")
@@ -596,3 +597,33 @@ func parseTime(t *testing.T, timeStr string) time.Time {
 	}
 	return parsed
 }
+
+func TestCollectExcludeFilters(t *testing.T) {
+	repoNames := []string{"app", "app/cache", "tools"}
+
+	t.Run("CombinesFiltersPerRepository", func(t *testing.T) {
+		excludeFilters, err := CollectExcludeFilters([]string{".*:^latest$", "app.*:^stable$", "tools:^v1$"}, repoNames, 60)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"app":       "^latest$|^stable$",
+			"app/cache": "^latest$|^stable$",
+			"tools":     "^latest$|^v1$",
+		}, excludeFilters)
+	})
+
+	t.Run("NoFilters", func(t *testing.T) {
+		excludeFilters, err := CollectExcludeFilters(nil, repoNames, 60)
+		assert.NoError(t, err)
+		assert.Empty(t, excludeFilters)
+	})
+
+	t.Run("MissingTagExpression", func(t *testing.T) {
+		_, err := CollectExcludeFilters([]string{"app"}, repoNames, 60)
+		assert.Error(t, err)
+	})
+
+	t.Run("InvalidTagExpression", func(t *testing.T) {
+		_, err := CollectExcludeFilters([]string{"app:["}, repoNames, 60)
+		assert.Error(t, err)
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"strings"
 	"time"
 
@@ -60,6 +61,8 @@ type AcrCLIClient struct {
 	// currentRepositories holds the repository names for which the current ABAC token has permissions.
 	// This is used for dynamic token refresh when the token expires during operations.
 	currentRepositories []string
+	// transport sends the requests, the default sender of the autorest SDK is used when it is nil.
+	transport http.RoundTripper
 }
 
 // LoginURL returns the FQDN for a registry.
@@ -80,20 +83,25 @@ func LoginURLWithPrefix(loginURL string) string {
 	return urlWithPrefix
 }
 
-// newAcrCLIClient creates a client that does not have any authentication.
-func newAcrCLIClient(loginURL string) AcrCLIClient {
+// newAcrCLIClient creates a client that does not have any authentication. The requests are sent through transport, or
+// the default sender of the autorest SDK when it is nil.
+func newAcrCLIClient(loginURL string, transport http.RoundTripper) AcrCLIClient {
 	loginURLPrefix := LoginURLWithPrefix(loginURL)
-	return AcrCLIClient{
+	acrClient := AcrCLIClient{
 		AutorestClient: acrapi.NewWithoutDefaults(loginURLPrefix),
 		// The manifestTagFetchCount is set to the default which is 100
 		manifestTagFetchCount: manifestTagFetchCount,
 		loginURL:              loginURL,
+		transport:             transport,
 	}
+	// Requests are retried with the default policy until another one is set.
+	acrClient.SetRetryPolicy(DefaultRetryPolicy())
+	return acrClient
 }
 
 // newAcrCLIClientWithBasicAuth creates a client that uses basic authentication.
-func newAcrCLIClientWithBasicAuth(loginURL string, username string, password string) AcrCLIClient {
-	newAcrCLIClient := newAcrCLIClient(loginURL)
+func newAcrCLIClientWithBasicAuth(loginURL string, username string, password string, transport http.RoundTripper) AcrCLIClient {
+	newAcrCLIClient := newAcrCLIClient(loginURL, transport)
 	newAcrCLIClient.AutorestClient.Authorizer = autorest.NewBasicAuthorizer(username, password)
 	return newAcrCLIClient
 }
@@ -103,8 +111,8 @@ func newAcrCLIClientWithBasicAuth(loginURL string, username string, password str
 // It always requests both catalog and wildcard repository access; on ABAC registries the
 // wildcard is silently ignored by the server, so callers must use RefreshTokenForAbac to
 // request repository-specific scopes before accessing individual repositories.
-func newAcrCLIClientWithBearerAuth(loginURL string, refreshToken string) (AcrCLIClient, error) {
-	newAcrCLIClient := newAcrCLIClient(loginURL)
+func newAcrCLIClientWithBearerAuth(loginURL string, refreshToken string, transport http.RoundTripper) (AcrCLIClient, error) {
+	newAcrCLIClient := newAcrCLIClient(loginURL, transport)
 	newAcrCLIClient.isAbac = hasAadIdentityClaim(refreshToken)
 
 	ctx := context.Background()
@@ -129,8 +137,9 @@ func newAcrCLIClientWithBearerAuth(loginURL string, refreshToken string) (AcrCLI
 	return newAcrCLIClient, nil
 }
 
-// GetAcrCLIClientWithAuth obtains a client that has authentication for making ACR http requests
-func GetAcrCLIClientWithAuth(loginURL string, username string, password string, configs []string) (*AcrCLIClient, error) {
+// GetAcrCLIClientWithAuth obtains a client that has authentication for making ACR http requests. The requests are sent
+// through transport, or the default sender of the autorest SDK when it is nil.
+func GetAcrCLIClientWithAuth(loginURL string, username string, password string, configs []string, transport http.RoundTripper) (*AcrCLIClient, error) {
 	if username == "" && password == "" {
 		// If both username and password are empty then the docker config file will be used, it can be found in the default
 		// location or in a location specified by the configs string array
@@ -158,14 +167,14 @@ func GetAcrCLIClientWithAuth(loginURL string, username string, password string,
 	if username == "" || username == "00000000-0000-0000-0000-000000000000" {
 		// If the username is empty an ACR refresh token was used.
 		var err error
-		acrClient, err = newAcrCLIClientWithBearerAuth(loginURL, password)
+		acrClient, err = newAcrCLIClientWithBearerAuth(loginURL, password, transport)
 		if err != nil {
 			return nil, errors.Wrap(err, "error resolving authentication")
 		}
 		return &acrClient, nil
 	}
 	// if both the username and password were specified basic authentication can be assumed.
-	acrClient = newAcrCLIClientWithBasicAuth(loginURL, username, password)
+	acrClient = newAcrCLIClientWithBasicAuth(loginURL, username, password, transport)
 	return &acrClient, nil
 }
 
@@ -465,6 +474,48 @@ func (c *AcrCLIClient) UpdateAcrManifestAttributes(ctx context.Context, repoName
 	return &resp, nil
 }
 
+// GetAcrRepositoryAttributes gets the attributes of a repository, including its manifest and tag counts.
+func (c *AcrCLIClient) GetAcrRepositoryAttributes(ctx context.Context, repoName string) (*acrapi.RepositoryAttributes, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c, repoName); err != nil {
+			return nil, err
+		}
+	}
+	repoAttrs, err := c.AutorestClient.GetAcrRepositoryAttributes(ctx, repoName)
+	if err != nil {
+		return &repoAttrs, err
+	}
+	return &repoAttrs, nil
+}
+
+// UpdateAcrRepositoryAttributes updates repository attributes to enable/disable deletion, writing, listing and reading.
+func (c *AcrCLIClient) UpdateAcrRepositoryAttributes(ctx context.Context, repoName string, value *acrapi.ChangeableAttributes) (*autorest.Response, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c, repoName); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := c.AutorestClient.UpdateAcrRepositoryAttributes(ctx, repoName, value)
+	if err != nil {
+		return &resp, err
+	}
+	return &resp, nil
+}
+
+// DeleteAcrRepository deletes a repository along with all of its manifests and tags.
+func (c *AcrCLIClient) DeleteAcrRepository(ctx context.Context, repoName string) (*acrapi.DeletedRepository, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c, repoName); err != nil {
+			return nil, err
+		}
+	}
+	deleted, err := c.AutorestClient.DeleteAcrRepository(ctx, repoName)
+	if err != nil {
+		return &deleted, err
+	}
+	return &deleted, nil
+}
+
 // AcrCLIClientInterface defines the required methods that the acr-cli will need to use.
 type AcrCLIClientInterface interface {
 	GetAcrTags(ctx context.Context, repoName string, orderBy string, last string) (*acrapi.RepositoryTagsType, error)
@@ -475,6 +526,9 @@ type AcrCLIClientInterface interface {
 	GetAcrManifestAttributes(ctx context.Context, repoName string, reference string) (*acrapi.ManifestAttributes, error)
 	UpdateAcrTagAttributes(ctx context.Context, repoName string, reference string, value *acrapi.ChangeableAttributes) (*autorest.Response, error)
 	UpdateAcrManifestAttributes(ctx context.Context, repoName string, reference string, value *acrapi.ChangeableAttributes) (*autorest.Response, error)
+	GetAcrRepositoryAttributes(ctx context.Context, repoName string) (*acrapi.RepositoryAttributes, error)
+	UpdateAcrRepositoryAttributes(ctx context.Context, repoName string, value *acrapi.ChangeableAttributes) (*autorest.Response, error)
+	DeleteAcrRepository(ctx context.Context, repoName string) (*acrapi.DeletedRepository, error)
 
 	// IsAbac returns true if the registry uses Attribute-Based Access Control.
 	IsAbac() bool
@@ -212,7 +212,7 @@ func TestGetAcrCLIClientWithAuth(t *testing.T) {
 				t.Errorf("cannot create test config file: %v", err)
 				return
 			}
-			got, err := GetAcrCLIClientWithAuth(tt.loginURL, tt.username, tt.password, []string{configFilePath})
+			got, err := GetAcrCLIClientWithAuth(tt.loginURL, tt.username, tt.password, []string{configFilePath}, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetAcrCLIClientWithAuth() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -402,7 +402,7 @@ func TestRefreshAcrCLIClientTokenAbac(t *testing.T) {
 			defer as.Close()
 
 			// Create client with test configuration
-			client := newAcrCLIClient(as.URL)
+			client := newAcrCLIClient(as.URL, nil)
 			client.isAbac = tt.isAbac
 			client.currentRepositories = tt.currentRepositories
 			client.token = &adal.Token{
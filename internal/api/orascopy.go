@@ -0,0 +1,110 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+)
+
+// CopyStatus is what happened to a manifest or blob while it was copied.
+type CopyStatus string
+
+const (
+	// CopyStatusCopied is a manifest or blob read from the source and pushed to the destination.
+	CopyStatusCopied CopyStatus = "Copied"
+	// CopyStatusMounted is a blob mounted from the source repository, without being read.
+	CopyStatusMounted CopyStatus = "Mounted"
+	// CopyStatusExists is a manifest or blob, with everything it references, already in the destination.
+	CopyStatusExists CopyStatus = "Exists"
+)
+
+// CopyOptions are the options of a copy.
+type CopyOptions struct {
+	// Recursive also copies the referrers of the manifest, such as signatures and SBOMs, and their own referrers.
+	Recursive bool
+	// Concurrency is the number of manifests and blobs copied at once, the oras-go default when it is 0.
+	Concurrency int
+	// Progress, when set, is called once for every manifest and blob. It can be called concurrently.
+	Progress func(status CopyStatus, desc ocispec.Descriptor)
+}
+
+// Copy copies the manifest at srcReference, with the blobs and manifests it references, to dstReference. The manifest
+// is tagged with the tag of dstReference, or with the tag of srcReference when dstReference has neither a tag nor a
+// digest. Within a registry the blobs are mounted from the source repository instead of being read and pushed again.
+// It returns the descriptor of the copied manifest.
+func (o *ORASClient) Copy(ctx context.Context, srcReference string, dstReference string, opts CopyOptions) (ocispec.Descriptor, error) {
+	src, err := o.getTarget(srcReference)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	dst, err := o.getTarget(dstReference)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if src.Reference.Reference == "" {
+		return ocispec.Descriptor{}, fmt.Errorf("the source %s has neither a tag nor a digest", srcReference)
+	}
+	dstRef := dst.Reference.Reference
+	if dstRef == "" {
+		dstRef = src.Reference.Reference
+	}
+
+	var mountFrom func(context.Context, ocispec.Descriptor) ([]string, error)
+	if src.Reference.Registry == dst.Reference.Registry && src.Reference.Repository != dst.Reference.Repository {
+		sourceRepository := src.Reference.Repository
+		mountFrom = func(context.Context, ocispec.Descriptor) ([]string, error) {
+			return []string{sourceRepository}, nil
+		}
+	}
+	return copyGraph(ctx, src, src.Reference.Reference, dst, dstRef, opts, mountFrom)
+}
+
+// Export copies the manifest at reference, with the blobs and manifests it references, to dst such as an OCI image
+// layout, where it is tagged with dstRef. The referrers of the manifest are copied when opts.Recursive is set.
+func (o *ORASClient) Export(ctx context.Context, reference string, dst oras.Target, dstRef string, opts CopyOptions) (ocispec.Descriptor, error) {
+	src, err := o.getTarget(reference)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return copyGraph(ctx, src, src.Reference.Reference, dst, dstRef, opts, nil)
+}
+
+// Import copies the manifest tagged with srcRef in src, such as an OCI image layout, with the blobs and manifests it
+// references, to reference. The referrers of the manifest are copied when opts.Recursive is set.
+func (o *ORASClient) Import(ctx context.Context, src oras.ReadOnlyGraphTarget, srcRef string, reference string, opts CopyOptions) (ocispec.Descriptor, error) {
+	dst, err := o.getTarget(reference)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return copyGraph(ctx, src, srcRef, dst, dst.Reference.Reference, opts, nil)
+}
+
+// copyGraph copies the manifest tagged with srcRef in src, with its blobs, its manifests and its referrers when
+// opts.Recursive is set, to dst where it is tagged with dstRef. The blobs are mounted from the repositories returned by
+// mountFrom when it is not nil.
+func copyGraph(ctx context.Context, src oras.ReadOnlyGraphTarget, srcRef string, dst oras.Target, dstRef string, opts CopyOptions, mountFrom func(context.Context, ocispec.Descriptor) ([]string, error)) (ocispec.Descriptor, error) {
+	graphOpts := oras.CopyGraphOptions{Concurrency: opts.Concurrency, MountFrom: mountFrom}
+	if opts.Progress != nil {
+		report := func(status CopyStatus) func(context.Context, ocispec.Descriptor) error {
+			return func(_ context.Context, desc ocispec.Descriptor) error {
+				opts.Progress(status, desc)
+				return nil
+			}
+		}
+		graphOpts.PostCopy = report(CopyStatusCopied)
+		graphOpts.OnMounted = report(CopyStatusMounted)
+		graphOpts.OnCopySkipped = report(CopyStatusExists)
+	}
+
+	if opts.Recursive {
+		return oras.ExtendedCopy(ctx, src, srcRef, dst, dstRef, oras.ExtendedCopyOptions{
+			ExtendedCopyGraphOptions: oras.ExtendedCopyGraphOptions{CopyGraphOptions: graphOpts},
+		})
+	}
+	return oras.Copy(ctx, src, srcRef, dst, dstRef, oras.CopyOptions{CopyGraphOptions: graphOpts})
+}
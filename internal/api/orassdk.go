@@ -6,6 +6,7 @@ package api
 import (
 	"context"
 	"io"
+	"net/http"
 
 	orasauth "github.com/Azure/acr-cli/auth/oras"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
@@ -33,15 +34,7 @@ type GraphTarget interface {
 
 // DiscoverLifecycleAnnotation checks if the given reference has lifecycle annotation support.
 func (o *ORASClient) DiscoverLifecycleAnnotation(ctx context.Context, reference string, artifactType string) (bool, error) {
-	ref, err := o.getTarget(reference)
-	if err != nil {
-		return false, err
-	}
-	subject, err := ref.Resolve(ctx, reference)
-	if err != nil {
-		return false, err
-	}
-	descriptors, err := registry.Referrers(ctx, ref, subject, artifactType)
+	descriptors, err := o.Referrers(ctx, reference, artifactType)
 	if err != nil {
 		return false, err
 	}
@@ -55,6 +48,20 @@ func (o *ORASClient) DiscoverLifecycleAnnotation(ctx context.Context, reference
 	return false, nil
 }
 
+// Referrers lists the manifests whose subject is the given reference through the OCI referrers API, optionally only
+// the ones of an artifact type.
+func (o *ORASClient) Referrers(ctx context.Context, reference string, artifactType string) ([]ocispec.Descriptor, error) {
+	ref, err := o.getTarget(reference)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := ref.Resolve(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	return registry.Referrers(ctx, ref, subject, artifactType)
+}
+
 // type packFunc func() (ocispec.Descriptor, error)
 // type copyFunc func(desc ocispec.Descriptor) error
 
@@ -123,9 +130,10 @@ func (o *ORASClient) getTarget(reference string) (repo *remote.Repository, err e
 	return repo, nil
 }
 
-// GetORASClientWithAuth creates an ORAS client with authentication credentials.
-func GetORASClientWithAuth(username string, password string, configs []string) (*ORASClient, error) {
-	clientOpts := orasauth.ClientOptions{}
+// GetORASClientWithAuth creates an ORAS client with authentication credentials. The requests are sent through
+// transport, or the default transport when it is nil.
+func GetORASClientWithAuth(username string, password string, configs []string, transport http.RoundTripper) (*ORASClient, error) {
+	clientOpts := orasauth.ClientOptions{Transport: transport}
 	if username != "" && password != "" {
 		clientOpts.Credential = orasauth.Credential(username, password)
 	} else {
@@ -146,4 +154,5 @@ func GetORASClientWithAuth(username string, password string, configs []string) (
 type ORASClientInterface interface {
 	Annotate(ctx context.Context, reference string, artifactType string, annotations map[string]string) error
 	DiscoverLifecycleAnnotation(ctx context.Context, reference string, artifactType string) (bool, error)
+	Referrers(ctx context.Context, reference string, artifactType string) ([]ocispec.Descriptor, error)
 }
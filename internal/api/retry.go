@@ -0,0 +1,174 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// Default values of the RetryPolicy used by every AcrCLIClient.
+const (
+	DefaultMaxAttempts = 5
+	defaultBaseDelay   = time.Second
+	defaultMaxDelay    = 30 * time.Second
+)
+
+// RetryPolicy configures how the requests to the registry are retried when they are throttled (429), fail with a
+// server error (5xx) or when the connection is reset.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is sent, including the first attempt. A value of 1 or less
+	// disables retries.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry, it doubles with every retry up to MaxDelay. A random jitter of up
+	// to half the backoff is subtracted so that concurrent requests do not retry in lockstep.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Verbose prints every retry with the reason and the delay before it to Out, or to stderr when Out is nil.
+	Verbose bool
+	Out     io.Writer
+	// OnThrottled is called for every response throttled by the registry, including the ones that are retried. It can be
+	// nil.
+	OnThrottled func()
+}
+
+// DefaultRetryPolicy returns the retry policy used when none is set.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   defaultBaseDelay,
+		MaxDelay:    defaultMaxDelay,
+	}
+}
+
+// SetRetryPolicy replaces the retry policy of the client. The retries of the autorest SDK are disabled since the
+// policy replaces them.
+func (c *AcrCLIClient) SetRetryPolicy(policy RetryPolicy) {
+	var sender autorest.Sender = autorest.CreateSender()
+	if c.transport != nil {
+		sender = &http.Client{Transport: c.transport}
+	}
+	c.AutorestClient.Sender = newRetrySender(sender, policy)
+	c.AutorestClient.RetryAttempts = 0
+	c.AutorestClient.RetryDuration = 0
+}
+
+// newRetrySender returns a sender that sends requests through sender and retries them according to the policy.
+func newRetrySender(sender autorest.Sender, policy RetryPolicy) autorest.Sender {
+	return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		// The retriable request rewinds the body of the request before every attempt.
+		rr := autorest.NewRetriableRequest(r)
+		for attempt := 1; ; attempt++ {
+			if err := rr.Prepare(); err != nil {
+				return nil, err
+			}
+			resp, err := sender.Do(rr.Request())
+			if resp != nil && resp.StatusCode == http.StatusTooManyRequests && policy.OnThrottled != nil {
+				policy.OnThrottled()
+			}
+			reason, retriable := retryReason(resp, err)
+			if !retriable || attempt >= policy.MaxAttempts || r.Context().Err() != nil {
+				if retriable && resp != nil {
+					// The autorest SDK waits for the Retry-After header even when its own retries are disabled, there is
+					// nothing left to wait for once the policy gave up.
+					resp.Header.Del("Retry-After")
+				}
+				return resp, err
+			}
+			delay, ok := retryAfter(resp)
+			if !ok {
+				delay = policy.backoff(attempt)
+			}
+			if policy.Verbose {
+				fmt.Fprintf(policy.writer(), "Retrying %s %s in %v (attempt %d of %d): %s\n", r.Method, r.URL.Path, delay.Round(time.Millisecond), attempt+1, policy.MaxAttempts, reason)
+			}
+			autorest.DrainResponseBody(resp)
+			if err := sleep(r.Context(), delay); err != nil {
+				return resp, err
+			}
+		}
+	})
+}
+
+// writer returns the writer the retries are printed to.
+func (p RetryPolicy) writer() io.Writer {
+	if p.Out == nil {
+		return os.Stderr
+	}
+	return p.Out
+}
+
+// retryReason returns why the request should be retried, the second return value is false when it should not.
+func retryReason(resp *http.Response, err error) (string, bool) {
+	if err != nil {
+		if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return err.Error(), true
+		}
+		return "", false
+	}
+	if resp == nil {
+		return "", false
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return "throttled by the registry, HTTP status: 429", true
+	case resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusNotImplemented:
+		return fmt.Sprintf("HTTP status: %d", resp.StatusCode), true
+	}
+	return "", false
+}
+
+// retryAfter returns the delay requested by the Retry-After header of the response, which can be a number of seconds
+// or a date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// backoff returns the jittered exponential delay before the retry following the specified attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+	if delay <= 0 {
+		return 0
+	}
+	return delay - rand.N(delay/2+1) //#nosec G404 -- the jitter does not need a cryptographically secure source
+}
+
+// sleep waits for the delay or until the context is done.
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
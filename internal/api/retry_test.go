@@ -0,0 +1,176 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRetryTestClient returns a client for the test server that retries according to the policy.
+func newRetryTestClient(server *httptest.Server, policy RetryPolicy) AcrCLIClient {
+	client := newAcrCLIClient(server.URL, nil)
+	client.AutorestClient.Sender = newRetrySender(server.Client(), policy)
+	client.AutorestClient.RetryAttempts = 0
+	client.AutorestClient.RetryDuration = 0
+	return client
+}
+
+func TestRetrySender(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond}
+
+	tests := []struct {
+		name         string
+		statusCodes  []int
+		retryAfter   string
+		wantAttempts int32
+		wantStatus   int
+		wantErr      bool
+	}{
+		{
+			name:         "throttled request is retried with Retry-After",
+			statusCodes:  []int{http.StatusTooManyRequests, http.StatusAccepted},
+			retryAfter:   "0",
+			wantAttempts: 2,
+			wantStatus:   http.StatusAccepted,
+		},
+		{
+			name:         "server errors are retried up to the maximum number of attempts",
+			statusCodes:  []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusInternalServerError, http.StatusAccepted},
+			wantAttempts: 3,
+			wantStatus:   http.StatusInternalServerError,
+			wantErr:      true,
+		},
+		{
+			name:         "client errors are not retried",
+			statusCodes:  []int{http.StatusNotFound, http.StatusAccepted},
+			wantAttempts: 1,
+			wantStatus:   http.StatusNotFound,
+			wantErr:      true,
+		},
+		{
+			name:         "not implemented is not retried",
+			statusCodes:  []int{http.StatusNotImplemented, http.StatusAccepted},
+			wantAttempts: 1,
+			wantStatus:   http.StatusNotImplemented,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodDelete {
+					t.Errorf("unexpected request method, got %s, expect DELETE", r.Method)
+				}
+				attempt := attempts.Add(1)
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.statusCodes[attempt-1])
+			}))
+			defer server.Close()
+
+			client := newRetryTestClient(server, policy)
+			resp, err := client.DeleteAcrTag(context.Background(), "repo", "tag")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeleteAcrTag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("got %d attempts, expected %d", got, tt.wantAttempts)
+			}
+			if resp == nil || resp.Response == nil || resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected HTTP status %d, got %v", tt.wantStatus, resp)
+			}
+		})
+	}
+}
+
+func TestRetrySenderCanceled(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := newRetryTestClient(server, DefaultRetryPolicy())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.DeleteManifest(ctx, "repo", "sha256:abc"); err == nil {
+		t.Error("expected an error when the context is done while waiting to retry")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the retry should stop waiting when the context is done, waited %v", elapsed)
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("got %d attempts, expected 1", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "seconds", value: "7", want: 7 * time.Second, wantOk: true},
+		{name: "date in the past", value: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0, wantOk: true},
+		{name: "missing", value: "", wantOk: false},
+		{name: "invalid", value: "soon", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.value != "" {
+				resp.Header.Set("Retry-After", tt.value)
+			}
+			got, ok := retryAfter(resp)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("retryAfter() = %v, %v, expected %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 8 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 8 * time.Second, 9: 8 * time.Second} {
+		got := policy.backoff(attempt)
+		// The jitter subtracts at most half of the backoff.
+		if got > want || got < want/2 {
+			t.Errorf("backoff(%d) = %v, expected between %v and %v", attempt, got, want/2, want)
+		}
+	}
+}
+
+func TestRetrySenderVerbose(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	client := newRetryTestClient(server, RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Verbose: true, Out: &out})
+	if _, err := client.DeleteAcrTag(context.Background(), "repo", "tag"); err != nil {
+		t.Fatalf("DeleteAcrTag() error = %v", err)
+	}
+	if got := out.String(); !strings.HasPrefix(got, "Retrying DELETE /acr/v1/repo/_tags/tag in ") || !strings.HasSuffix(got, "(attempt 2 of 2): HTTP status: 503\n") {
+		t.Errorf("unexpected retry message %q", got)
+	}
+}
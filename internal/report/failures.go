@@ -0,0 +1,116 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Failure is an operation that failed on a repository, or on a single tag or manifest of it.
+type Failure struct {
+	Repository string
+	// Item is the tag or the digest of the manifest, it is empty when the operation failed for the whole repository.
+	Item      string
+	Operation string
+	Err       error
+}
+
+// Failures collects the failures of a command that continues after an error, see --continue-on-error. A nil *Failures
+// is valid and collects nothing, the callers stop at the first error then.
+type Failures struct {
+	mu       sync.Mutex
+	failures []Failure
+}
+
+// NewFailures returns an empty Failures.
+func NewFailures() *Failures {
+	return &Failures{}
+}
+
+// Collecting returns true when failures are collected and the caller should continue after an error.
+func (f *Failures) Collecting() bool {
+	return f != nil
+}
+
+// Collect adds a failure and returns true, or returns false without adding anything when failures are not collected
+// and the caller should stop at err. It is safe for concurrent use.
+func (f *Failures) Collect(repoName string, item string, operation string, err error) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, Failure{Repository: repoName, Item: item, Operation: operation, Err: err})
+	return true
+}
+
+// Has returns true when a failure was collected for the repository.
+func (f *Failures) Has(repoName string) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, failure := range f.failures {
+		if failure.Repository == repoName {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of failures collected.
+func (f *Failures) Len() int {
+	if f == nil {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.failures)
+}
+
+// Print writes a table of the failures to out, sorted by repository. Nothing is written when there are none.
+func (f *Failures) Print(out io.Writer) {
+	if f.Len() == 0 {
+		return
+	}
+	f.mu.Lock()
+	failures := append([]Failure{}, f.failures...)
+	f.mu.Unlock()
+	// The failures of concurrent workers are collected in any order, the repositories are sorted and their failures
+	// keep the order they occurred in.
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].Repository < failures[j].Repository
+	})
+	fmt.Fprintf(out, "\nFailures (%d):\n", len(failures))
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tITEM\tOPERATION\tERROR")
+	for _, failure := range failures {
+		item := failure.Item
+		if item == "" {
+			item = "-"
+		}
+		// Errors of the autorest SDK span several lines, the table keeps one line per failure.
+		errMsg := strings.Join(strings.Fields(failure.Err.Error()), " ")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", failure.Repository, item, failure.Operation, errMsg)
+	}
+	_ = w.Flush()
+}
+
+// Err returns an error summarizing the failures, nil when there are none.
+func (f *Failures) Err() error {
+	count := f.Len()
+	if count == 0 {
+		return nil
+	}
+	if count == 1 {
+		return fmt.Errorf("1 operation failed")
+	}
+	return fmt.Errorf("%d operations failed", count)
+}
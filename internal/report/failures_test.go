@@ -0,0 +1,57 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package report
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailures(t *testing.T) {
+	t.Run("Table", func(t *testing.T) {
+		assert := assert.New(t)
+		failures := NewFailures()
+		assert.True(failures.Collect("repo2", "v1", "delete tag", errors.New("failed\n  to delete")))
+		assert.True(failures.Collect("repo1", "", "purge tags", errors.New("not allowed")))
+		assert.True(failures.Has("repo1"))
+		assert.False(failures.Has("repo3"))
+		assert.Equal("2 operations failed", failures.Err().Error())
+
+		var out bytes.Buffer
+		failures.Print(&out)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Equal([]string{
+			"Failures (2):",
+			"REPOSITORY  ITEM  OPERATION   ERROR",
+			"repo1       -     purge tags  not allowed",
+			"repo2       v1    delete tag  failed to delete",
+		}, lines)
+	})
+
+	t.Run("NoFailures", func(t *testing.T) {
+		assert := assert.New(t)
+		failures := NewFailures()
+		var out bytes.Buffer
+		failures.Print(&out)
+		assert.Empty(out.String())
+		assert.Nil(failures.Err())
+	})
+
+	t.Run("NilFailures", func(t *testing.T) {
+		assert := assert.New(t)
+		var failures *Failures
+		assert.False(failures.Collecting())
+		assert.False(failures.Collect("repo", "v1", "delete tag", errors.New("failed")))
+		assert.False(failures.Has("repo"))
+		assert.Equal(0, failures.Len())
+		assert.Nil(failures.Err())
+		var out bytes.Buffer
+		failures.Print(&out)
+		assert.Empty(out.String())
+	})
+}
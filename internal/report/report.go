@@ -0,0 +1,293 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package report provides machine-readable reports of the tags and manifests considered by a command.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Azure/acr-cli/acr"
+)
+
+// Format is the format in which a report is written.
+type Format string
+
+const (
+	// FormatText is the default human readable output, no report is written but subscribers still receive the records.
+	FormatText Format = "text"
+	// FormatJSON writes a single JSON document holding every record and the summary once the command is done.
+	FormatJSON Format = "json"
+	// FormatNDJSON writes one JSON object per line as soon as a record is available, followed by the summary.
+	FormatNDJSON Format = "ndjson"
+)
+
+// Action is what happened to a tag or manifest.
+type Action string
+
+const (
+	// ActionDeleted means the item was deleted, or would be deleted in a dry run.
+	ActionDeleted Action = "deleted"
+	// ActionSkipped means the deletion was attempted but the registry did not delete the item.
+	ActionSkipped Action = "skipped"
+	// ActionKept means the item matched the selection but is protected from deletion.
+	ActionKept Action = "kept"
+	// ActionLocked means the item matched the selection but is locked and --include-locked was not set.
+	ActionLocked Action = "locked"
+	// ActionFailed means the deletion of the item failed.
+	ActionFailed Action = "failed"
+	// ActionRestoreFailed means the item was unlocked to be deleted with --include-locked, it was not deleted and its
+	// original lock could not be restored. The item is left unlocked.
+	ActionRestoreFailed Action = "restore-failed"
+)
+
+// ReasonCode is a stable identifier of the reason a manifest was kept or deleted, see Record.Code.
+type ReasonCode string
+
+const (
+	// ReasonUntagged means the manifest has no tag and nothing protects it, so it is deleted.
+	ReasonUntagged ReasonCode = "untagged"
+	// ReasonTagged means the manifest still has tags.
+	ReasonTagged ReasonCode = "tagged"
+	// ReasonLocked means the deletion or the update of the manifest is disabled.
+	ReasonLocked ReasonCode = "locked"
+	// ReasonNewer means the manifest was updated after the ago duration.
+	ReasonNewer ReasonCode = "newer-than-ago"
+	// ReasonUnknownAge means the last update time of the manifest is unavailable or cannot be read.
+	ReasonUnknownAge ReasonCode = "unknown-update-time"
+	// ReasonKeep means the manifest is one of the most recent ones kept by --keep.
+	ReasonKeep ReasonCode = "keep"
+	// ReasonInIndex means the manifest is referenced by a protected index, which is the parent of the record.
+	ReasonInIndex ReasonCode = "in-protected-index"
+	// ReasonReferrer means the manifest has a subject, which is the parent of the record. Referrers are deleted by
+	// the registry together with their subject.
+	ReasonReferrer ReasonCode = "referrer"
+	// ReasonSubjectDeleted means the manifest is a referrer whose subject, which is the parent of the record, is
+	// deleted or no longer exists, see purge --referrers.
+	ReasonSubjectDeleted ReasonCode = "subject-deleted"
+	// ReasonReferrerFailed means a referrer of the manifest, which is the parent of the record, could not be deleted,
+	// so the manifest is kept to not leave the referrer without its subject, see purge --referrers.
+	ReasonReferrerFailed ReasonCode = "referrer-failed"
+	// ReasonWithinBudget means the manifest could be deleted but is not needed to bring the repository or the registry
+	// under the size budget, see purge --max-repo-size and --target-registry-size.
+	ReasonWithinBudget ReasonCode = "within-size-budget"
+	// ReasonNoMediaType means the manifest has no media type so it cannot be checked for a subject.
+	ReasonNoMediaType ReasonCode = "no-media-type"
+	// ReasonNotFound means the manifest was deleted while it was being checked.
+	ReasonNotFound ReasonCode = "not-found"
+)
+
+// Record describes a single tag or manifest that was considered. Tag is empty for manifests, Tag and Digest are both
+// empty for repositories.
+type Record struct {
+	Repository     string `json:"repository"`
+	Tag            string `json:"tag,omitempty"`
+	Digest         string `json:"digest,omitempty"`
+	LastUpdateTime string `json:"lastUpdateTime,omitempty"`
+	Action         Action `json:"action"`
+	Reason         string `json:"reason,omitempty"`
+	HTTPStatus     int    `json:"httpStatus,omitempty"`
+	DryRun         bool   `json:"dryRun,omitempty"`
+	// Code and Parent explain why a manifest was kept or deleted, Parent is the digest of the protecting index or
+	// subject.
+	Code   ReasonCode `json:"code,omitempty"`
+	Parent string     `json:"parent,omitempty"`
+}
+
+// Summary is written once at the end of the report. Actions is filled in by the Reporter with the number of records
+// written per action.
+type Summary struct {
+	DryRun           bool           `json:"dryRun"`
+	DeletedTags      int            `json:"deletedTags"`
+	DeletedManifests int            `json:"deletedManifests"`
+	ExcludedTags     int            `json:"excludedTags"`
+	Actions          map[Action]int `json:"actions"`
+	Error            string         `json:"error,omitempty"`
+	// EffectiveConcurrency is the concurrency the command ended with when it was adapted, see --concurrency auto.
+	EffectiveConcurrency int `json:"effectiveConcurrency,omitempty"`
+	// Failures is the number of failures collected with --continue-on-error.
+	Failures int `json:"failures,omitempty"`
+	// DeletedRepositories is the number of empty repositories deleted with --delete-empty-repositories.
+	DeletedRepositories int `json:"deletedRepositories,omitempty"`
+	// FailedRestores is the number of items left unlocked, see ActionRestoreFailed.
+	FailedRestores int `json:"failedRestores,omitempty"`
+	// ProjectedBytes and FreedBytes are the size of the manifests selected to fit a size budget and the bytes freed
+	// once they were deleted, see purge --max-repo-size and --target-registry-size.
+	ProjectedBytes int64 `json:"projectedBytes,omitempty"`
+	FreedBytes     int64 `json:"freedBytes,omitempty"`
+}
+
+// Reporter collects records from concurrent workers and writes them in the requested format. A nil *Reporter is valid
+// and discards everything, so callers do not need to check whether a report was requested.
+type Reporter struct {
+	mu          sync.Mutex
+	format      Format
+	encoder     *json.Encoder
+	records     []Record
+	actions     map[Action]int
+	subscribers []func(Record)
+	explain     bool
+	err         error
+}
+
+// NewReporter returns a Reporter writing to out in the given format. Nothing is written for FormatText.
+func NewReporter(format string, out io.Writer) (*Reporter, error) {
+	switch Format(format) {
+	case "":
+		format = string(FormatText)
+	case FormatText, FormatJSON, FormatNDJSON:
+	default:
+		return nil, fmt.Errorf("invalid output format %q, supported formats are %s, %s and %s", format, FormatText, FormatJSON, FormatNDJSON)
+	}
+	return &Reporter{
+		format:  Format(format),
+		encoder: json.NewEncoder(out),
+		records: []Record{},
+		actions: make(map[Action]int),
+	}, nil
+}
+
+// Writes returns true when the Reporter writes a machine-readable report.
+func (r *Reporter) Writes() bool {
+	return r != nil && r.format != FormatText
+}
+
+// Explain makes the commands record every manifest they evaluate, including the tagged ones that are not candidates
+// for deletion, with the code of the reason it was kept or deleted.
+func (r *Reporter) Explain() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.explain = true
+}
+
+// Explains returns true when every evaluated manifest is recorded, see Explain.
+func (r *Reporter) Explains() bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.explain
+}
+
+// Subscribe registers fn to be called with every record added to the Reporter, in the order they are added. Calls
+// are serialized so fn does not need to be safe for concurrent use.
+func (r *Reporter) Subscribe(fn func(Record)) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Record adds a record to the report. It is safe for concurrent use.
+func (r *Reporter) Record(record Record) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.actions[record.Action]++
+	for _, fn := range r.subscribers {
+		fn(record)
+	}
+	switch r.format {
+	case FormatText:
+		return
+	case FormatNDJSON:
+		r.write(struct {
+			Type string `json:"type"`
+			Record
+		}{Type: "record", Record: record})
+		return
+	}
+	r.records = append(r.records, record)
+}
+
+// Count returns the number of records added with the action.
+func (r *Reporter) Count(action Action) int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.actions[action]
+}
+
+// Close writes the summary, and for FormatJSON the whole document, and returns the first error that occurred while
+// writing the report.
+func (r *Reporter) Close(summary Summary) error {
+	if !r.Writes() {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	summary.Actions = r.actions
+	if r.format == FormatNDJSON {
+		r.write(struct {
+			Type string `json:"type"`
+			Summary
+		}{Type: "summary", Summary: summary})
+	} else {
+		r.write(struct {
+			Records []Record `json:"records"`
+			Summary Summary  `json:"summary"`
+		}{Records: r.records, Summary: summary})
+	}
+	return r.err
+}
+
+// write encodes v, only the first error is kept. The caller must hold the lock.
+func (r *Reporter) write(v any) {
+	if r.err != nil {
+		return
+	}
+	if err := r.encoder.Encode(v); err != nil {
+		r.err = fmt.Errorf("failed to write report: %w", err)
+	}
+}
+
+// TagRecord returns a record for the tag of the repository with the given action and reason.
+func TagRecord(repoName string, tag acr.TagAttributesBase, action Action, reason string) Record {
+	return Record{
+		Repository:     repoName,
+		Tag:            stringValue(tag.Name),
+		Digest:         stringValue(tag.Digest),
+		LastUpdateTime: stringValue(tag.LastUpdateTime),
+		Action:         action,
+		Reason:         reason,
+	}
+}
+
+// ManifestRecord returns a record for the manifest of the repository with the given action and reason.
+func ManifestRecord(repoName string, manifest acr.ManifestAttributesBase, action Action, reason string) Record {
+	return Record{
+		Repository:     repoName,
+		Digest:         stringValue(manifest.Digest),
+		LastUpdateTime: stringValue(manifest.LastUpdateTime),
+		Action:         action,
+		Reason:         reason,
+	}
+}
+
+// WithCode returns a copy of the record with the code of its reason and the digest of the protecting parent, which can
+// be empty.
+func (r Record) WithCode(code ReasonCode, parent string) Record {
+	r.Code = code
+	r.Parent = parent
+	return r
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,124 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReporter(t *testing.T) {
+	for _, format := range []string{"", "text"} {
+		out := &bytes.Buffer{}
+		reporter, err := NewReporter(format, out)
+		assert.NoError(t, err)
+		assert.False(t, reporter.Writes(), "No report should be written for the %q format", format)
+		reporter.Record(Record{Repository: "repo", Action: ActionDeleted})
+		assert.NoError(t, reporter.Close(Summary{}))
+		assert.Empty(t, out.String())
+	}
+	_, err := NewReporter("yaml", &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestReporterSubscribe(t *testing.T) {
+	reporter, err := NewReporter("text", &bytes.Buffer{})
+	assert.NoError(t, err)
+	var received []Record
+	reporter.Subscribe(func(record Record) {
+		received = append(received, record)
+	})
+	reporter.Record(Record{Repository: "repo", Tag: "v1", Action: ActionDeleted})
+	reporter.Record(Record{Repository: "repo", Tag: "v2", Action: ActionKept})
+	assert.Equal(t, []string{"v1", "v2"}, []string{received[0].Tag, received[1].Tag})
+}
+
+func TestReporterCount(t *testing.T) {
+	reporter, err := NewReporter("text", &bytes.Buffer{})
+	assert.NoError(t, err)
+	reporter.Record(Record{Repository: "repo", Tag: "v1", Action: ActionRestoreFailed})
+	reporter.Record(Record{Repository: "repo", Tag: "v2", Action: ActionFailed})
+	reporter.Record(Record{Repository: "repo", Tag: "v3", Action: ActionRestoreFailed})
+	assert.Equal(t, 2, reporter.Count(ActionRestoreFailed))
+	assert.Equal(t, 0, reporter.Count(ActionDeleted))
+	assert.Equal(t, 0, (*Reporter)(nil).Count(ActionRestoreFailed))
+}
+
+func TestReporterExplain(t *testing.T) {
+	reporter, err := NewReporter("text", &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.False(t, reporter.Explains())
+	reporter.Explain()
+	assert.True(t, reporter.Explains())
+	assert.False(t, (*Reporter)(nil).Explains())
+
+	record := Record{Repository: "repo", Digest: "sha256:child", Action: ActionKept}.WithCode(ReasonInIndex, "sha256:index")
+	assert.Equal(t, ReasonInIndex, record.Code)
+	assert.Equal(t, "sha256:index", record.Parent)
+}
+
+func TestNilReporter(t *testing.T) {
+	var reporter *Reporter
+	reporter.Explain()
+	reporter.Subscribe(func(Record) {})
+	reporter.Record(Record{Repository: "repo", Action: ActionDeleted})
+	assert.NoError(t, reporter.Close(Summary{}))
+}
+
+func TestReporterJSON(t *testing.T) {
+	assert := assert.New(t)
+	out := &bytes.Buffer{}
+	reporter, err := NewReporter("json", out)
+	assert.NoError(err)
+	reporter.Record(Record{Repository: "repo", Tag: "v1", Digest: "sha256:abc", Action: ActionDeleted, HTTPStatus: 202})
+	reporter.Record(Record{Repository: "repo", Tag: "v2", Action: ActionKept, Reason: "kept by keep"})
+	assert.NoError(reporter.Close(Summary{DeletedTags: 1}))
+
+	var document struct {
+		Records []Record `json:"records"`
+		Summary Summary  `json:"summary"`
+	}
+	assert.NoError(json.Unmarshal(out.Bytes(), &document))
+	assert.Len(document.Records, 2)
+	assert.Equal("v1", document.Records[0].Tag)
+	assert.Equal(202, document.Records[0].HTTPStatus)
+	assert.Equal(1, document.Summary.DeletedTags)
+	assert.Equal(map[Action]int{ActionDeleted: 1, ActionKept: 1}, document.Summary.Actions)
+}
+
+func TestReporterNDJSON(t *testing.T) {
+	assert := assert.New(t)
+	out := &bytes.Buffer{}
+	reporter, err := NewReporter("ndjson", out)
+	assert.NoError(err)
+	reporter.Record(Record{Repository: "repo", Digest: "sha256:abc", Action: ActionFailed, Reason: "boom"})
+	// Records are written as soon as they are added.
+	assert.Equal(1, strings.Count(out.String(), "\n"))
+	assert.NoError(reporter.Close(Summary{Error: "boom"}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(lines, 2)
+	var record map[string]any
+	assert.NoError(json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal("record", record["type"])
+	assert.Equal("failed", record["action"])
+	assert.NotContains(record, "tag", "Empty fields should be omitted")
+	var summary map[string]any
+	assert.NoError(json.Unmarshal([]byte(lines[1]), &summary))
+	assert.Equal("summary", summary["type"])
+	assert.Equal("boom", summary["error"])
+}
+
+func TestRecordHelpers(t *testing.T) {
+	name, digest, lastUpdateTime := "v1", "sha256:abc", "2024-01-01T00:00:00Z"
+	tagRecord := TagRecord("repo", acr.TagAttributesBase{Name: &name, Digest: &digest, LastUpdateTime: &lastUpdateTime}, ActionLocked, "tag is locked")
+	assert.Equal(t, Record{Repository: "repo", Tag: name, Digest: digest, LastUpdateTime: lastUpdateTime, Action: ActionLocked, Reason: "tag is locked"}, tagRecord)
+	manifestRecord := ManifestRecord("repo", acr.ManifestAttributesBase{Digest: &digest}, ActionKept, "")
+	assert.Equal(t, Record{Repository: "repo", Digest: digest, Action: ActionKept}, manifestRecord)
+}
@@ -0,0 +1,176 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package tag
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/acr-cli/internal/container/set"
+)
+
+// semverRegex matches semantic version tags with an optional "v" prefix, e.g. 1.2.3, v1.2.3-rc.1 or 1.2.3+build.5.
+var semverRegex = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?$`)
+
+// Semver is a parsed semantic version. Build metadata is dropped since it does not take part in ordering.
+type Semver struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	PreRelease string
+}
+
+// ParseSemver parses a tag name as a semantic version, a leading "v" is allowed. The second return value is false
+// when the tag is not a valid semantic version.
+func ParseSemver(tagName string) (Semver, bool) {
+	matches := semverRegex.FindStringSubmatch(tagName)
+	if matches == nil {
+		return Semver{}, false
+	}
+	major, err := strconv.ParseUint(matches[1], 10, 64)
+	if err != nil {
+		return Semver{}, false
+	}
+	minor, err := strconv.ParseUint(matches[2], 10, 64)
+	if err != nil {
+		return Semver{}, false
+	}
+	patch, err := strconv.ParseUint(matches[3], 10, 64)
+	if err != nil {
+		return Semver{}, false
+	}
+	return Semver{Major: major, Minor: minor, Patch: patch, PreRelease: matches[4]}, true
+}
+
+// Compare returns -1, 0 or 1 when v has a lower, equal or higher precedence than other, following the semver
+// specification: a pre-release version has a lower precedence than the associated release version.
+func (v Semver) Compare(other Semver) int {
+	if c := compareUint(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+	switch {
+	case v.PreRelease == other.PreRelease:
+		return 0
+	case v.PreRelease == "":
+		return 1
+	case other.PreRelease == "":
+		return -1
+	}
+	return comparePreRelease(v.PreRelease, other.PreRelease)
+}
+
+// comparePreRelease compares dot separated pre-release identifiers, numeric identifiers are compared numerically and
+// have a lower precedence than alphanumeric ones.
+func comparePreRelease(a string, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNum, aErr := strconv.ParseUint(aParts[i], 10, 64)
+		bNum, bErr := strconv.ParseUint(bParts[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareUint(aNum, bNum); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(aParts[i], bParts[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareUint(uint64(len(aParts)), uint64(len(bParts)))
+}
+
+func compareUint(a uint64, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// SemverKeep describes which semantic version tags are protected from deletion: the latest Patches release versions
+// of each of the latest Minors major.minor groups. The zero value protects nothing.
+type SemverKeep struct {
+	Minors  int
+	Patches int
+}
+
+// Enabled returns true when the SemverKeep protects at least one version.
+func (k SemverKeep) Enabled() bool {
+	return k.Minors > 0 && k.Patches > 0
+}
+
+// ProtectedTags returns the tag names that are protected by the SemverKeep. Tags that are not valid semantic versions
+// and pre-release versions are never protected, they are left to the regular purge criteria. Tags that only differ
+// in their "v" prefix or build metadata refer to the same version and are protected together.
+func (k SemverKeep) ProtectedTags(tagNames []string) set.Set[string] {
+	protected := set.New[string]()
+	if !k.Enabled() {
+		return protected
+	}
+
+	type minorGroup struct {
+		major, minor uint64
+	}
+	// Every release version is grouped by major.minor, and each version remembers the tags that point to it.
+	versionTags := make(map[Semver][]string)
+	groups := make(map[minorGroup][]Semver)
+	for _, tagName := range tagNames {
+		version, ok := ParseSemver(tagName)
+		if !ok || version.PreRelease != "" {
+			continue
+		}
+		if _, seen := versionTags[version]; !seen {
+			group := minorGroup{major: version.Major, minor: version.Minor}
+			groups[group] = append(groups[group], version)
+		}
+		versionTags[version] = append(versionTags[version], tagName)
+	}
+
+	sortedGroups := make([]minorGroup, 0, len(groups))
+	for group := range groups {
+		sortedGroups = append(sortedGroups, group)
+	}
+	// Newest major.minor first.
+	sort.Slice(sortedGroups, func(i, j int) bool {
+		if sortedGroups[i].major != sortedGroups[j].major {
+			return sortedGroups[i].major > sortedGroups[j].major
+		}
+		return sortedGroups[i].minor > sortedGroups[j].minor
+	})
+	if len(sortedGroups) > k.Minors {
+		sortedGroups = sortedGroups[:k.Minors]
+	}
+
+	for _, group := range sortedGroups {
+		versions := groups[group]
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i].Compare(versions[j]) > 0
+		})
+		if len(versions) > k.Patches {
+			versions = versions[:k.Patches]
+		}
+		for _, version := range versions {
+			for _, tagName := range versionTags[version] {
+				protected.Add(tagName)
+			}
+		}
+	}
+	return protected
+}
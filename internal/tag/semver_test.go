@@ -0,0 +1,80 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package tag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		tagName  string
+		expected Semver
+		ok       bool
+	}{
+		{"1.2.3", Semver{Major: 1, Minor: 2, Patch: 3}, true},
+		{"v1.2.3", Semver{Major: 1, Minor: 2, Patch: 3}, true},
+		{"1.2.3-rc.1", Semver{Major: 1, Minor: 2, Patch: 3, PreRelease: "rc.1"}, true},
+		{"1.2.3+build.7", Semver{Major: 1, Minor: 2, Patch: 3}, true},
+		{"v0.10.0-alpha+001", Semver{Major: 0, Minor: 10, Patch: 0, PreRelease: "alpha"}, true},
+		{"1.2", Semver{}, false},
+		{"latest", Semver{}, false},
+		{"01.2.3", Semver{}, false},
+		{"V1.2.3", Semver{}, false},
+		{"1.2.3-", Semver{}, false},
+	}
+	for _, test := range tests {
+		version, ok := ParseSemver(test.tagName)
+		assert.Equal(t, test.ok, ok, "Unexpected parse result for %s", test.tagName)
+		assert.Equal(t, test.expected, version, "Unexpected version for %s", test.tagName)
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	// Ordered from lowest to highest precedence as in the semver specification.
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.1.0", "2.0.0"}
+	for i := 0; i < len(ordered)-1; i++ {
+		lower, _ := ParseSemver(ordered[i])
+		higher, _ := ParseSemver(ordered[i+1])
+		assert.Equal(t, -1, lower.Compare(higher), "%s should be lower than %s", ordered[i], ordered[i+1])
+		assert.Equal(t, 1, higher.Compare(lower), "%s should be higher than %s", ordered[i+1], ordered[i])
+		assert.Equal(t, 0, lower.Compare(lower), "%s should be equal to itself", ordered[i])
+	}
+}
+
+func TestSemverKeepProtectedTags(t *testing.T) {
+	tagNames := []string{
+		"2.1.0", "2.1.1", "v2.1.2", "2.1.2+build.1", "2.1.3-rc.1",
+		"2.0.0", "2.0.1", "2.0.2", "2.0.3",
+		"1.9.9",
+		"2.2.0-beta.1",
+		"latest", "stable",
+	}
+
+	t.Run("LatestPatchesOfLatestMinors", func(t *testing.T) {
+		assert := assert.New(t)
+		protected := SemverKeep{Minors: 2, Patches: 2}.ProtectedTags(tagNames)
+		expected := []string{"v2.1.2", "2.1.2+build.1", "2.1.1", "2.0.3", "2.0.2"}
+		assert.Len(protected, len(expected))
+		for _, tagName := range expected {
+			assert.True(protected.Contains(tagName), "%s should be protected", tagName)
+		}
+		// Pre-releases and non semantic version tags are left to the regular purge criteria.
+		assert.False(protected.Contains("2.1.3-rc.1"))
+		assert.False(protected.Contains("2.2.0-beta.1"))
+		assert.False(protected.Contains("latest"))
+	})
+
+	t.Run("MoreThanAvailable", func(t *testing.T) {
+		protected := SemverKeep{Minors: 10, Patches: 10}.ProtectedTags(tagNames)
+		assert.Len(t, protected, 9, "Every release version tag should be protected")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		assert.Empty(t, SemverKeep{}.ProtectedTags(tagNames))
+		assert.Empty(t, SemverKeep{Minors: 2}.ProtectedTags(tagNames))
+	})
+}
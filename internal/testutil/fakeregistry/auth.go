@@ -0,0 +1,184 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package fakeregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// accessTokenLifetime is how long the access tokens issued by the registry are valid.
+const accessTokenLifetime = time.Hour
+
+// grant holds what an access token gives access to.
+type grant struct {
+	catalog bool
+	// allRepositories is set by a wildcard repository scope, which ABAC registries ignore.
+	allRepositories bool
+	repositories    map[string]bool
+}
+
+// allows returns true when the grant gives access to the repository.
+func (g *grant) allows(repoName string) bool {
+	return g.allRepositories || g.repositories[repoName]
+}
+
+// RefreshToken returns a refresh token accepted by the token exchange of the registry. On ABAC registries it carries
+// the aad_identity claim the clients use to detect them.
+func (r *Registry) RefreshToken() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	claims := jwt.MapClaims{
+		"jti":        uuid.New().String(),
+		"exp":        r.now().Add(24 * time.Hour).Unix(),
+		"grant_type": "refresh_token",
+	}
+	if r.abac {
+		claims["aad_identity"] = `{"oid":"00000000-0000-0000-0000-000000000000"}`
+	}
+	return r.sign(claims)
+}
+
+// serveToken issues access tokens. A POST exchanges a refresh token as the ACR SDK does, a GET authenticated with the
+// basic credentials follows the distribution token flow used by ORAS.
+func (r *Registry) serveToken(w http.ResponseWriter, req *http.Request) {
+	var scope string
+	switch req.Method {
+	case http.MethodPost:
+		if err := req.ParseForm(); err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+			return
+		}
+		if req.PostForm.Get("grant_type") != "refresh_token" || !r.validRefreshToken(req.PostForm.Get("refresh_token")) {
+			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid refresh token")
+			return
+		}
+		scope = req.PostForm.Get("scope")
+	case http.MethodGet:
+		if username, password, ok := req.BasicAuth(); !ok || username != Username || password != Password {
+			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+			return
+		}
+		scope = strings.Join(req.URL.Query()["scope"], " ")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+		return
+	}
+	accessToken := r.issueAccessToken(scope)
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": accessToken, "token": accessToken})
+}
+
+// serveExchange exchanges an AAD access token for a refresh token, any access token is accepted.
+func (r *Registry) serveExchange(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil || req.PostForm.Get("access_token") == "" {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "access_token is required")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"refresh_token": r.RefreshToken()})
+}
+
+// issueAccessToken returns an access token for the scopes. Like ACR, an ABAC registry ignores the wildcard repository
+// scope and only grants the repositories requested by name.
+func (r *Registry) issueAccessToken(scope string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	g := &grant{repositories: make(map[string]bool)}
+	var access []map[string]any
+	for _, s := range strings.Fields(scope) {
+		resourceType, rest, ok := strings.Cut(s, ":")
+		if !ok {
+			continue
+		}
+		i := strings.LastIndex(rest, ":")
+		if i < 0 {
+			continue
+		}
+		name, actions := rest[:i], rest[i+1:]
+		switch {
+		case resourceType == "registry" && name == "catalog":
+			g.catalog = true
+		case resourceType == "repository" && name == "*":
+			if r.abac {
+				continue
+			}
+			g.allRepositories = true
+		case resourceType == "repository":
+			g.repositories[name] = true
+		default:
+			continue
+		}
+		access = append(access, map[string]any{"type": resourceType, "name": name, "actions": strings.Split(actions, ",")})
+	}
+	token := r.sign(jwt.MapClaims{
+		"jti":    uuid.New().String(),
+		"exp":    r.now().Add(accessTokenLifetime).Unix(),
+		"access": access,
+	})
+	r.tokens[token] = g
+	return token
+}
+
+// validRefreshToken returns true when the token was issued by RefreshToken.
+func (r *Registry) validRefreshToken(token string) bool {
+	claims := jwt.MapClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) { return r.signingKey, nil })
+	return err == nil && parsed.Valid && claims["grant_type"] == "refresh_token"
+}
+
+// authorize returns the grant of the credentials of the request, nil when the request is not authenticated. Basic
+// credentials grant everything.
+func (r *Registry) authorize(req *http.Request) *grant {
+	if username, password, ok := req.BasicAuth(); ok {
+		if username == Username && password == Password {
+			return &grant{catalog: true, allRepositories: true}
+		}
+		return nil
+	}
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tokens[token]
+}
+
+// challenge answers with 401 and the bearer challenge clients follow to get a token for the scope.
+func (r *Registry) challenge(w http.ResponseWriter, scope string) {
+	challenge := fmt.Sprintf(`Bearer realm="https://%s/oauth2/token",service="%s"`, r.LoginURL(), r.LoginURL())
+	if scope != "" {
+		challenge += fmt.Sprintf(`,scope="%s"`, scope)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+}
+
+// sign returns the signed token for the claims.
+func (r *Registry) sign(claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(r.signingKey)
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+// writeJSON writes v as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the format of the registry.
+func writeError(w http.ResponseWriter, statusCode int, code string, message string) {
+	writeJSON(w, statusCode, map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package fakeregistry
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fault is injected into the requests it matches instead of letting the registry handle them.
+type Fault struct {
+	// Method is the HTTP method of the requests to match, any method matches when it is empty.
+	Method string
+	// Path is a substring of the unescaped path of the requests to match, any path matches when it is empty.
+	Path string
+	// Match further restricts the requests to match when it is not nil.
+	Match func(req *http.Request) bool
+	// Times is the number of requests the fault is injected into, every matching request when it is 0.
+	Times int
+	// Delay is waited for before the request is answered, or handled by the registry when StatusCode is 0.
+	Delay time.Duration
+	// StatusCode is the status of the response, the registry handles the request after the delay when it is 0.
+	StatusCode int
+	// RetryAfter is the value of the Retry-After header of the response, no header is set when it is empty.
+	RetryAfter string
+
+	injected int
+}
+
+// InjectFault adds a fault, the faults are matched in the order they were added and the first one that matches a
+// request is injected.
+func (r *Registry) InjectFault(fault Fault) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.faults = append(r.faults, &fault)
+}
+
+// ClearFaults removes every fault.
+func (r *Registry) ClearFaults() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.faults = nil
+}
+
+// matchFault returns the fault to inject into the request, nil when there is none. The caller must hold the lock.
+func (r *Registry) matchFault(req *http.Request) *Fault {
+	for _, fault := range r.faults {
+		if fault.Times > 0 && fault.injected >= fault.Times {
+			continue
+		}
+		if fault.Method != "" && fault.Method != req.Method {
+			continue
+		}
+		if fault.Path != "" && !strings.Contains(req.URL.Path, fault.Path) {
+			continue
+		}
+		if fault.Match != nil && !fault.Match(req) {
+			continue
+		}
+		fault.injected++
+		return fault
+	}
+	return nil
+}
+
+// inject writes the response of the fault, it returns false when the registry should still handle the request.
+func (fault *Fault) inject(w http.ResponseWriter, req *http.Request) bool {
+	if fault.Delay > 0 {
+		select {
+		case <-time.After(fault.Delay):
+		case <-req.Context().Done():
+		}
+	}
+	if fault.StatusCode == 0 {
+		return false
+	}
+	if fault.RetryAfter != "" {
+		w.Header().Set("Retry-After", fault.RetryAfter)
+	}
+	writeError(w, fault.StatusCode, "INJECTED", "fault injected by the fake registry")
+	return true
+}
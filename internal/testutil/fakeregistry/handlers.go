@@ -0,0 +1,658 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package fakeregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/google/uuid"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// defaultPageSize is the number of items returned by the list endpoints when the request does not specify it.
+const defaultPageSize = 100
+
+// serveHTTP routes the requests to the ACR, distribution and token endpoints, after the faults are injected.
+func (r *Registry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+	fault := r.matchFault(req)
+	r.mu.Unlock()
+	if fault != nil && fault.inject(w, req) {
+		return
+	}
+
+	path := req.URL.Path
+	switch {
+	case path == "/oauth2/token":
+		r.serveToken(w, req)
+	case path == "/oauth2/exchange":
+		r.serveExchange(w, req)
+	case path == "/v2/" || path == "/v2":
+		if r.authorize(req) == nil {
+			r.challenge(w, "")
+			return
+		}
+		writeJSON(w, http.StatusOK, struct{}{})
+	case path == "/v2/_catalog" || path == "/acr/v1/_catalog":
+		r.serveCatalog(w, req)
+	case strings.HasPrefix(path, "/acr/v1/"):
+		r.serveACR(w, req, strings.TrimPrefix(path, "/acr/v1/"))
+	case strings.HasPrefix(path, "/v2/"):
+		r.serveDistribution(w, req, strings.TrimPrefix(path, "/v2/"))
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+	}
+}
+
+// serveCatalog lists the repositories in lexical order.
+func (r *Registry) serveCatalog(w http.ResponseWriter, req *http.Request) {
+	if g := r.authorize(req); g == nil || !g.catalog {
+		r.challenge(w, "registry:catalog:*")
+		return
+	}
+	names := r.Repositories()
+	page, next := paginate(names, req.URL.Query(), func(name string) string { return name })
+	if next != "" {
+		setNextLink(w, req, next)
+	}
+	result := acr.Repositories{}
+	if len(page) > 0 {
+		result.Names = &page
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// serveACR serves the /acr/v1/{name}[/_tags|/_manifests[/{reference}]] endpoints.
+func (r *Registry) serveACR(w http.ResponseWriter, req *http.Request, rest string) {
+	repoName, resource, reference := rest, "", ""
+	for _, marker := range []string{"/_tags", "/_manifests"} {
+		if i := strings.Index(rest, marker); i >= 0 {
+			repoName, resource, reference = rest[:i], marker[2:], strings.TrimPrefix(rest[i+len(marker):], "/")
+			break
+		}
+	}
+	if !r.authorizeRepository(w, req, repoName) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repository(repoName, false)
+	if repo == nil {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", fmt.Sprintf("repository %s is not found", repoName))
+		return
+	}
+	switch {
+	case resource == "":
+		r.serveRepository(w, req, repo)
+	case resource == "tags" && reference == "":
+		r.serveTagList(w, req, repo)
+	case resource == "tags":
+		r.serveTag(w, req, repo, reference)
+	case resource == "manifests" && reference == "":
+		r.serveManifestList(w, req, repo)
+	case resource == "manifests":
+		r.serveManifestAttributes(w, req, repo, reference)
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+	}
+}
+
+// serveRepository gets, updates or deletes a repository. The caller must hold the lock.
+func (r *Registry) serveRepository(w http.ResponseWriter, req *http.Request, repo *repository) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, r.repositoryAttributes(repo))
+	case http.MethodPatch:
+		if !updateAttributes(w, req, &repo.changeableAttributes) {
+			return
+		}
+		writeJSON(w, http.StatusOK, r.repositoryAttributes(repo))
+	case http.MethodDelete:
+		if !repo.changeableAttributes.deletable() {
+			writeError(w, http.StatusMethodNotAllowed, "OPERATION_NOT_ALLOWED", "the repository is locked")
+			return
+		}
+		manifestsDeleted := []string{}
+		for digest := range repo.manifests {
+			manifestsDeleted = append(manifestsDeleted, digest)
+		}
+		tagsDeleted := []string{}
+		for name := range repo.tags {
+			tagsDeleted = append(tagsDeleted, name)
+		}
+		sort.Strings(manifestsDeleted)
+		sort.Strings(tagsDeleted)
+		delete(r.repositories, repo.name)
+		writeJSON(w, http.StatusAccepted, acr.DeletedRepository{ManifestsDeleted: &manifestsDeleted, TagsDeleted: &tagsDeleted})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+	}
+}
+
+// serveTagList lists the tags of a repository, by name or by last update time with orderby timedesc or timeasc,
+// optionally only the ones of a digest. The caller must hold the lock.
+func (r *Registry) serveTagList(w http.ResponseWriter, req *http.Request, repo *repository) {
+	query := req.URL.Query()
+	var tags []*tag
+	for _, t := range repo.tags {
+		if d := query.Get("digest"); d == "" || d == t.digest {
+			tags = append(tags, t)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return orderBy(query.Get("orderby"), tags[i].lastUpdateTime, tags[j].lastUpdateTime, tags[i].name, tags[j].name)
+	})
+	page, next := paginate(tags, query, func(t *tag) string { return t.name })
+	if next != "" {
+		setNextLink(w, req, next)
+	}
+	attributes := make([]acr.TagAttributesBase, 0, len(page))
+	for _, t := range page {
+		attributes = append(attributes, tagAttributes(t))
+	}
+	registry := r.LoginURL()
+	result := acr.RepositoryTagsType{Registry: &registry, ImageName: &repo.name}
+	// Like ACR, the list is omitted from the last page when it is empty, the clients page until it is.
+	if len(attributes) > 0 {
+		result.TagsAttributes = &attributes
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// serveTag gets, updates or deletes a tag. The caller must hold the lock.
+func (r *Registry) serveTag(w http.ResponseWriter, req *http.Request, repo *repository, tagName string) {
+	t, ok := repo.tags[tagName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "TAG_UNKNOWN", fmt.Sprintf("tag %s is not found", tagName))
+		return
+	}
+	registry := r.LoginURL()
+	switch req.Method {
+	case http.MethodGet:
+		attributes := tagAttributes(t)
+		writeJSON(w, http.StatusOK, acr.TagAttributesType{Registry: &registry, ImageName: &repo.name, TagAttributes: &attributes})
+	case http.MethodPatch:
+		if !updateAttributes(w, req, &t.changeableAttributes) {
+			return
+		}
+		attributes := tagAttributes(t)
+		writeJSON(w, http.StatusOK, acr.TagAttributesType{Registry: &registry, ImageName: &repo.name, TagAttributes: &attributes})
+	case http.MethodDelete:
+		if !t.changeableAttributes.deletable() {
+			writeError(w, http.StatusMethodNotAllowed, "OPERATION_NOT_ALLOWED", "the tag is locked")
+			return
+		}
+		delete(repo.tags, tagName)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+	}
+}
+
+// serveManifestList lists the manifests of a repository, by digest or by last update time with orderby timedesc or
+// timeasc. The caller must hold the lock.
+func (r *Registry) serveManifestList(w http.ResponseWriter, req *http.Request, repo *repository) {
+	query := req.URL.Query()
+	manifests := make([]*manifest, 0, len(repo.manifests))
+	for _, m := range repo.manifests {
+		manifests = append(manifests, m)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return orderBy(query.Get("orderby"), manifests[i].lastUpdateTime, manifests[j].lastUpdateTime, manifests[i].digest, manifests[j].digest)
+	})
+	page, next := paginate(manifests, query, func(m *manifest) string { return m.digest })
+	if next != "" {
+		setNextLink(w, req, next)
+	}
+	attributes := make([]acr.ManifestAttributesBase, 0, len(page))
+	for _, m := range page {
+		attributes = append(attributes, manifestAttributes(repo, m))
+	}
+	registry := r.LoginURL()
+	result := acr.Manifests{Registry: &registry, ImageName: &repo.name}
+	if len(attributes) > 0 {
+		result.ManifestsAttributes = &attributes
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// serveManifestAttributes gets or updates the attributes of a manifest. The caller must hold the lock.
+func (r *Registry) serveManifestAttributes(w http.ResponseWriter, req *http.Request, repo *repository, reference string) {
+	m := repo.resolve(reference)
+	if m == nil {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest %s is not found", reference))
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		if !updateAttributes(w, req, &m.changeableAttributes) {
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+		return
+	}
+	registry := r.LoginURL()
+	attributes := manifestAttributes(repo, m)
+	writeJSON(w, http.StatusOK, acr.ManifestAttributes{Registry: &registry, ImageName: &repo.name, ManifestAttributes: &attributes})
+}
+
+// serveDistribution serves the /v2/{name}/manifests, blobs, tags and referrers endpoints of the distribution spec.
+func (r *Registry) serveDistribution(w http.ResponseWriter, req *http.Request, rest string) {
+	var repoName, resource, reference string
+	for _, marker := range []string{"/manifests/", "/blobs/uploads", "/blobs/", "/referrers/", "/tags/list"} {
+		if i := strings.Index(rest, marker); i >= 0 {
+			repoName, resource, reference = rest[:i], strings.Trim(marker, "/"), strings.TrimPrefix(rest[i+len(marker):], "/")
+			break
+		}
+	}
+	if repoName == "" {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		return
+	}
+	if !r.authorizeRepository(w, req, repoName) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Pushes create the repository, every other request needs it to exist.
+	repo := r.repository(repoName, req.Method == http.MethodPut || req.Method == http.MethodPost || req.Method == http.MethodPatch)
+	if repo == nil {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", fmt.Sprintf("repository %s is not found", repoName))
+		return
+	}
+	switch resource {
+	case "manifests":
+		r.serveManifest(w, req, repo, reference)
+	case "blobs/uploads":
+		r.serveUpload(w, req, repo, reference)
+	case "blobs":
+		r.serveBlob(w, req, repo, reference)
+	case "referrers":
+		r.serveReferrers(w, req, repo, reference)
+	case "tags/list":
+		r.serveDistributionTags(w, req, repo)
+	}
+}
+
+// serveManifest gets, pushes or deletes a manifest. The caller must hold the lock.
+func (r *Registry) serveManifest(w http.ResponseWriter, req *http.Request, repo *repository, reference string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		m := repo.resolve(reference)
+		if m == nil {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest %s is not found", reference))
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", m.digest)
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.content)))
+		w.WriteHeader(http.StatusOK)
+		if req.Method == http.MethodGet {
+			_, _ = w.Write(m.content)
+		}
+	case http.MethodPut:
+		content, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		isDigest := strings.Contains(reference, ":")
+		if isDigest && reference != digestOf(content) {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "the digest does not match the content")
+			return
+		}
+		if t, ok := repo.tags[reference]; ok && !t.changeableAttributes.writeEnabled {
+			writeError(w, http.StatusMethodNotAllowed, "OPERATION_NOT_ALLOWED", "the tag is locked")
+			return
+		}
+		m := r.putManifest(repo, req.Header.Get("Content-Type"), content)
+		if !isDigest {
+			r.putTag(repo, reference, m.digest)
+		}
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/manifests/%s", repo.name, m.digest))
+		w.Header().Set("Docker-Content-Digest", m.digest)
+		if m.subject != "" {
+			w.Header().Set("OCI-Subject", m.subject)
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		m, ok := repo.manifests[reference]
+		if !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest %s is not found", reference))
+			return
+		}
+		if !m.changeableAttributes.deletable() {
+			writeError(w, http.StatusMethodNotAllowed, "OPERATION_NOT_ALLOWED", "the manifest is locked")
+			return
+		}
+		repo.deleteManifest(reference)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+	}
+}
+
+// serveBlob gets a blob. The caller must hold the lock.
+func (r *Registry) serveBlob(w http.ResponseWriter, req *http.Request, repo *repository, digest string) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+		return
+	}
+	content, ok := repo.blobs[digest]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", fmt.Sprintf("blob %s is not found", digest))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodGet {
+		_, _ = w.Write(content)
+	}
+}
+
+// serveUpload serves the blob uploads, monolithic or chunked, and the blob mounts across repositories. The caller
+// must hold the lock.
+func (r *Registry) serveUpload(w http.ResponseWriter, req *http.Request, repo *repository, id string) {
+	query := req.URL.Query()
+	content, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+		return
+	}
+	switch {
+	case req.Method == http.MethodPost && query.Get("mount") != "":
+		if from := r.repository(query.Get("from"), false); from != nil {
+			if blob, ok := from.blobs[query.Get("mount")]; ok {
+				r.completeUpload(w, repo, query.Get("mount"), blob)
+				return
+			}
+		}
+		// The blob cannot be mounted, an upload is started instead.
+		r.startUpload(w, repo)
+	case req.Method == http.MethodPost && query.Get("digest") != "":
+		r.completeUpload(w, repo, query.Get("digest"), content)
+	case req.Method == http.MethodPost:
+		r.startUpload(w, repo)
+	case req.Method == http.MethodPatch || req.Method == http.MethodPut:
+		u, ok := r.uploads[id]
+		if !ok || u.repoName != repo.name {
+			writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "the upload is not found")
+			return
+		}
+		u.content = append(u.content, content...)
+		if req.Method == http.MethodPatch {
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo.name, id))
+			w.Header().Set("Range", fmt.Sprintf("0-%d", max(len(u.content)-1, 0)))
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		delete(r.uploads, id)
+		r.completeUpload(w, repo, query.Get("digest"), u.content)
+	case req.Method == http.MethodDelete:
+		delete(r.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+	}
+}
+
+// startUpload starts an upload session. The caller must hold the lock.
+func (r *Registry) startUpload(w http.ResponseWriter, repo *repository) {
+	id := uuid.New().String()
+	r.uploads[id] = &upload{repoName: repo.name}
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo.name, id))
+	w.Header().Set("Docker-Upload-UUID", id)
+	w.Header().Set("Range", "0-0")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// completeUpload stores the blob once its digest is verified. The caller must hold the lock.
+func (r *Registry) completeUpload(w http.ResponseWriter, repo *repository, expectedDigest string, content []byte) {
+	if expectedDigest != digestOf(content) {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "the digest does not match the content")
+		return
+	}
+	repo.blobs[expectedDigest] = content
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repo.name, expectedDigest))
+	w.Header().Set("Docker-Content-Digest", expectedDigest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// serveReferrers lists the manifests whose subject is the digest, optionally only the ones of an artifact type. The
+// caller must hold the lock.
+func (r *Registry) serveReferrers(w http.ResponseWriter, req *http.Request, repo *repository, subject string) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+		return
+	}
+	artifactType := req.URL.Query().Get("artifactType")
+	index := ocispec.Index{MediaType: ocispec.MediaTypeImageIndex, Manifests: []ocispec.Descriptor{}}
+	index.SchemaVersion = 2
+	for _, m := range sortedManifests(repo) {
+		if m.subject != subject || (artifactType != "" && m.artifactType != artifactType) {
+			continue
+		}
+		var parsed struct {
+			Annotations map[string]string `json:"annotations"`
+		}
+		_ = json.Unmarshal(m.content, &parsed)
+		index.Manifests = append(index.Manifests, ocispec.Descriptor{
+			MediaType:    m.mediaType,
+			Digest:       toDigest(m.digest),
+			Size:         int64(len(m.content)),
+			ArtifactType: m.artifactType,
+			Annotations:  parsed.Annotations,
+		})
+	}
+	if artifactType != "" {
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+	w.Header().Set("Content-Type", ocispec.MediaTypeImageIndex)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(index)
+}
+
+// serveDistributionTags lists the tag names of a repository in lexical order. The caller must hold the lock.
+func (r *Registry) serveDistributionTags(w http.ResponseWriter, req *http.Request, repo *repository) {
+	names := make([]string, 0, len(repo.tags))
+	for name := range repo.tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	page, next := paginate(names, req.URL.Query(), func(name string) string { return name })
+	if next != "" {
+		setNextLink(w, req, next)
+	}
+	writeJSON(w, http.StatusOK, acr.RepositoryTags{Name: &repo.name, Tags: &page})
+}
+
+// authorizeRepository checks that the request has access to the repository, and answers with a challenge otherwise.
+func (r *Registry) authorizeRepository(w http.ResponseWriter, req *http.Request, repoName string) bool {
+	if g := r.authorize(req); g != nil && g.allows(repoName) {
+		return true
+	}
+	actions := "pull"
+	switch req.Method {
+	case http.MethodPut, http.MethodPost, http.MethodPatch:
+		actions = "pull,push"
+	case http.MethodDelete:
+		actions = "delete"
+	}
+	r.challenge(w, fmt.Sprintf("repository:%s:%s", repoName, actions))
+	return false
+}
+
+// repositoryAttributes returns the ACR attributes of a repository. The caller must hold the lock.
+func (r *Registry) repositoryAttributes(repo *repository) acr.RepositoryAttributes {
+	registry := r.LoginURL()
+	manifestCount, tagCount := int32(len(repo.manifests)), int32(len(repo.tags))
+	return acr.RepositoryAttributes{
+		Registry:             &registry,
+		ImageName:            &repo.name,
+		CreatedTime:          formatTime(repo.createdTime),
+		LastUpdateTime:       formatTime(repo.lastUpdateTime),
+		ManifestCount:        &manifestCount,
+		TagCount:             &tagCount,
+		ChangeableAttributes: repo.changeableAttributes.acr(),
+	}
+}
+
+// tagAttributes returns the ACR attributes of a tag.
+func tagAttributes(t *tag) acr.TagAttributesBase {
+	name, digest, signed := t.name, t.digest, false
+	return acr.TagAttributesBase{
+		Name:                 &name,
+		Digest:               &digest,
+		CreatedTime:          formatTime(t.createdTime),
+		LastUpdateTime:       formatTime(t.lastUpdateTime),
+		Signed:               &signed,
+		ChangeableAttributes: t.changeableAttributes.acr(),
+	}
+}
+
+// manifestAttributes returns the ACR attributes of a manifest, its image size is the size of the manifest and of the
+// blobs it references.
+func manifestAttributes(repo *repository, m *manifest) acr.ManifestAttributesBase {
+	digest, mediaType := m.digest, m.mediaType
+	imageSize := int64(len(m.content))
+	var parsed struct {
+		Config *ocispec.Descriptor  `json:"config"`
+		Layers []ocispec.Descriptor `json:"layers"`
+	}
+	if err := json.Unmarshal(m.content, &parsed); err == nil {
+		if parsed.Config != nil {
+			imageSize += parsed.Config.Size
+		}
+		for _, layer := range parsed.Layers {
+			imageSize += layer.Size
+		}
+	}
+	attributes := acr.ManifestAttributesBase{
+		Digest:               &digest,
+		ImageSize:            &imageSize,
+		CreatedTime:          formatTime(m.createdTime),
+		LastUpdateTime:       formatTime(m.lastUpdateTime),
+		MediaType:            &mediaType,
+		ChangeableAttributes: m.changeableAttributes.acr(),
+	}
+	if m.configMediaType != "" {
+		configMediaType := m.configMediaType
+		attributes.ConfigMediaType = &configMediaType
+	}
+	if tags := repo.tagsOf(m.digest); len(tags) > 0 {
+		attributes.Tags = &tags
+	}
+	return attributes
+}
+
+// updateAttributes applies the changeable attributes of the request body, it answers with an error and returns false
+// when the body is invalid.
+func updateAttributes(w http.ResponseWriter, req *http.Request, a *attributes) bool {
+	var value acr.ChangeableAttributes
+	if err := json.NewDecoder(req.Body).Decode(&value); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return false
+	}
+	if value.DeleteEnabled != nil {
+		a.deleteEnabled = *value.DeleteEnabled
+	}
+	if value.WriteEnabled != nil {
+		a.writeEnabled = *value.WriteEnabled
+	}
+	if value.ListEnabled != nil {
+		a.listEnabled = *value.ListEnabled
+	}
+	if value.ReadEnabled != nil {
+		a.readEnabled = *value.ReadEnabled
+	}
+	return true
+}
+
+// acr returns the attributes in the format of the ACR API.
+func (a attributes) acr() *acr.ChangeableAttributes {
+	deleteEnabled, writeEnabled, listEnabled, readEnabled := a.deleteEnabled, a.writeEnabled, a.listEnabled, a.readEnabled
+	return &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled, WriteEnabled: &writeEnabled, ListEnabled: &listEnabled, ReadEnabled: &readEnabled}
+}
+
+// sortedManifests returns the manifests of the repository sorted by digest.
+func sortedManifests(repo *repository) []*manifest {
+	manifests := make([]*manifest, 0, len(repo.manifests))
+	for _, m := range repo.manifests {
+		manifests = append(manifests, m)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].digest < manifests[j].digest })
+	return manifests
+}
+
+// orderBy compares two items by last update time for the timedesc and timeasc orders, by key otherwise.
+func orderBy(order string, timeI, timeJ time.Time, keyI, keyJ string) bool {
+	switch {
+	case order == "timedesc" && !timeI.Equal(timeJ):
+		return timeI.After(timeJ)
+	case order == "timeasc" && !timeI.Equal(timeJ):
+		return timeI.Before(timeJ)
+	}
+	return keyI < keyJ
+}
+
+// paginate returns the page of the sorted items following the one whose key is the last query parameter, with at
+// most n items, and the key of the last item of the page when more items follow.
+func paginate[T any](items []T, query url.Values, key func(T) string) ([]T, string) {
+	start := 0
+	if last := query.Get("last"); last != "" {
+		start = -1
+		for i, item := range items {
+			if key(item) == last {
+				start = i + 1
+				break
+			}
+		}
+		// An unknown last item is compared lexically, like the catalog does.
+		if start < 0 {
+			start = len(items)
+			for i, item := range items {
+				if key(item) > last {
+					start = i
+					break
+				}
+			}
+		}
+	}
+	n := defaultPageSize
+	if value, err := strconv.Atoi(query.Get("n")); err == nil && value > 0 {
+		n = value
+	}
+	end := min(start+n, len(items))
+	page := append([]T{}, items[start:end]...)
+	if end < len(items) && end > start {
+		return page, key(items[end-1])
+	}
+	return page, ""
+}
+
+// setNextLink sets the Link header pointing at the next page, with the query of the request and the new last item.
+func setNextLink(w http.ResponseWriter, req *http.Request, last string) {
+	query := req.URL.Query()
+	query.Set("last", last)
+	w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, req.URL.Path, query.Encode()))
+}
+
+func formatTime(t time.Time) *string {
+	value := t.UTC().Format(time.RFC3339Nano)
+	return &value
+}
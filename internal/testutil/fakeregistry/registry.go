@@ -0,0 +1,484 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package fakeregistry provides an in-process fake of the Azure Container Registry data plane for end to end tests.
+// It serves the ACR endpoints used by the acr.BaseClient (tags, manifests, repositories and their attributes), the
+// OCI distribution endpoints used by ORAS (manifests, blobs, tags and referrers) and the oauth2 token exchange,
+// including the repository scoped tokens of ABAC registries. The state is held in memory and can be seeded and
+// inspected by the tests, and faults can be injected into any request.
+package fakeregistry
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Default credentials accepted by the registry with basic authentication.
+const (
+	Username = "fake-user"
+	Password = "fake-password"
+)
+
+// Registry is a fake Azure Container Registry served over TLS by an httptest.Server.
+type Registry struct {
+	server *httptest.Server
+
+	mu           sync.Mutex
+	abac         bool
+	repositories map[string]*repository
+	tokens       map[string]*grant
+	uploads      map[string]*upload
+	faults       []*Fault
+	requests     []string
+	signingKey   []byte
+	now          func() time.Time
+}
+
+// repository is the in-memory state of a repository. Blobs are stored per repository, like manifests.
+type repository struct {
+	name                 string
+	createdTime          time.Time
+	lastUpdateTime       time.Time
+	changeableAttributes attributes
+	manifests            map[string]*manifest
+	tags                 map[string]*tag
+	blobs                map[string][]byte
+}
+
+// manifest is a manifest of a repository along with its ACR attributes.
+type manifest struct {
+	digest               string
+	mediaType            string
+	artifactType         string
+	configMediaType      string
+	subject              string
+	content              []byte
+	createdTime          time.Time
+	lastUpdateTime       time.Time
+	changeableAttributes attributes
+}
+
+// tag is a tag of a repository along with its ACR attributes.
+type tag struct {
+	name                 string
+	digest               string
+	createdTime          time.Time
+	lastUpdateTime       time.Time
+	changeableAttributes attributes
+}
+
+// attributes are the changeable attributes of a repository, manifest or tag.
+type attributes struct {
+	deleteEnabled bool
+	writeEnabled  bool
+	listEnabled   bool
+	readEnabled   bool
+}
+
+// upload is a blob upload session.
+type upload struct {
+	repoName string
+	content  []byte
+}
+
+// New starts a fake registry that is closed when the test ends. The clients reach it through the transport returned by
+// Transport, which trusts its certificate.
+func New(t testing.TB) *Registry {
+	t.Helper()
+	r := &Registry{
+		repositories: make(map[string]*repository),
+		tokens:       make(map[string]*grant),
+		uploads:      make(map[string]*upload),
+		signingKey:   []byte(fmt.Sprintf("fake-registry-%d", time.Now().UnixNano())),
+		now:          func() time.Time { return time.Now().UTC() },
+	}
+	r.server = httptest.NewTLSServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+// LoginURL returns the host and port of the registry, to be used where the login server of a registry is expected.
+func (r *Registry) LoginURL() string {
+	u, _ := url.Parse(r.server.URL)
+	return u.Host
+}
+
+// Client returns an HTTP client that trusts the certificate of the registry.
+func (r *Registry) Client() *http.Client {
+	return r.server.Client()
+}
+
+// Transport returns the transport of the clients of the registry, it trusts the certificate of the registry.
+func (r *Registry) Transport() http.RoundTripper {
+	return r.server.Client().Transport
+}
+
+// SetABAC makes the registry an ABAC registry. The refresh tokens it issues then carry the aad_identity claim, and
+// the access tokens only grant the repositories that were requested by name, wildcard repository scopes are ignored.
+func (r *Registry) SetABAC(abac bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.abac = abac
+}
+
+// SetClock replaces the clock used for the created and last update times of new items.
+func (r *Registry) SetClock(now func() time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.now = now
+}
+
+// PushManifest adds a manifest to the repository, creating the repository when needed, and points the tags at it.
+// The artifact type, config media type and subject are read from the content. It returns the digest of the manifest.
+func (r *Registry) PushManifest(repoName string, mediaType string, content []byte, tags ...string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repository(repoName, true)
+	m := r.putManifest(repo, mediaType, content)
+	for _, tagName := range tags {
+		r.putTag(repo, tagName, m.digest)
+	}
+	return m.digest
+}
+
+// PushBlob adds a blob to the repository, creating the repository when needed, and returns its digest.
+func (r *Registry) PushBlob(repoName string, content []byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repository(repoName, true)
+	digest := digestOf(content)
+	repo.blobs[digest] = content
+	return digest
+}
+
+// PushImage adds an OCI image manifest with a config and a layer unique to the repository and the seed, and
+// returns its digest.
+func (r *Registry) PushImage(repoName string, seed string, tags ...string) string {
+	config := []byte(fmt.Sprintf(`{"architecture":"amd64","os":"linux","seed":%q}`, seed))
+	layer := []byte("layer of " + repoName + " " + seed)
+	image := ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    r.blobDescriptor(repoName, ocispec.MediaTypeImageConfig, config),
+		Layers:    []ocispec.Descriptor{r.blobDescriptor(repoName, ocispec.MediaTypeImageLayerGzip, layer)},
+	}
+	image.SchemaVersion = 2
+	return r.PushManifest(repoName, ocispec.MediaTypeImageManifest, mustMarshal(image), tags...)
+}
+
+// PushIndex adds an OCI image index referencing the manifests of the repository with the given digests, and returns
+// its digest.
+func (r *Registry) PushIndex(repoName string, digests []string, tags ...string) string {
+	index := ocispec.Index{MediaType: ocispec.MediaTypeImageIndex}
+	index.SchemaVersion = 2
+	r.mu.Lock()
+	repo := r.repository(repoName, true)
+	for _, digest := range digests {
+		descriptor := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: toDigest(digest)}
+		if m, ok := repo.manifests[digest]; ok {
+			descriptor.MediaType = m.mediaType
+			descriptor.Size = int64(len(m.content))
+		}
+		index.Manifests = append(index.Manifests, descriptor)
+	}
+	r.mu.Unlock()
+	return r.PushManifest(repoName, ocispec.MediaTypeImageIndex, mustMarshal(index), tags...)
+}
+
+// PushReferrer adds an OCI image manifest of the artifact type with the manifest of the subject digest as subject,
+// and returns its digest.
+func (r *Registry) PushReferrer(repoName string, subject string, artifactType string, annotations map[string]string) string {
+	r.mu.Lock()
+	repo := r.repository(repoName, true)
+	subjectDescriptor := &ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: toDigest(subject)}
+	if m, ok := repo.manifests[subject]; ok {
+		subjectDescriptor.MediaType = m.mediaType
+		subjectDescriptor.Size = int64(len(m.content))
+	}
+	r.mu.Unlock()
+	referrer := ocispec.Manifest{
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: artifactType,
+		Config:       r.blobDescriptor(repoName, ocispec.MediaTypeEmptyJSON, ocispec.DescriptorEmptyJSON.Data),
+		Layers:       []ocispec.Descriptor{},
+		Subject:      subjectDescriptor,
+		Annotations:  annotations,
+	}
+	referrer.SchemaVersion = 2
+	return r.PushManifest(repoName, ocispec.MediaTypeImageManifest, mustMarshal(referrer))
+}
+
+// SetLastUpdateTime changes the last update time of a tag, or of a manifest when reference is a digest.
+func (r *Registry) SetLastUpdateTime(repoName string, reference string, lastUpdateTime time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repository(repoName, false)
+	if repo == nil {
+		return
+	}
+	if t, ok := repo.tags[reference]; ok {
+		t.lastUpdateTime = lastUpdateTime.UTC()
+	}
+	if m, ok := repo.manifests[reference]; ok {
+		m.lastUpdateTime = lastUpdateTime.UTC()
+	}
+}
+
+// Lock disables the deletion and the writes of a tag, or of a manifest when reference is a digest.
+func (r *Registry) Lock(repoName string, reference string) {
+	r.setWritable(repoName, reference, false)
+}
+
+// Unlock enables the deletion and the writes of a tag, or of a manifest when reference is a digest.
+func (r *Registry) Unlock(repoName string, reference string) {
+	r.setWritable(repoName, reference, true)
+}
+
+func (r *Registry) setWritable(repoName string, reference string, enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repository(repoName, false)
+	if repo == nil {
+		return
+	}
+	if t, ok := repo.tags[reference]; ok {
+		t.changeableAttributes.deleteEnabled, t.changeableAttributes.writeEnabled = enabled, enabled
+	}
+	if m, ok := repo.manifests[reference]; ok {
+		m.changeableAttributes.deleteEnabled, m.changeableAttributes.writeEnabled = enabled, enabled
+	}
+}
+
+// Locked returns true when the deletion of the tag, or of the manifest when reference is a digest, is disabled.
+func (r *Registry) Locked(repoName string, reference string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repository(repoName, false)
+	if repo == nil {
+		return false
+	}
+	if t, ok := repo.tags[reference]; ok {
+		return !t.changeableAttributes.deletable()
+	}
+	if m, ok := repo.manifests[reference]; ok {
+		return !m.changeableAttributes.deletable()
+	}
+	return false
+}
+
+// Repositories returns the names of the repositories, sorted.
+func (r *Registry) Repositories() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.repositories))
+	for name := range r.repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Tags returns the tags of the repository, sorted.
+func (r *Registry) Tags(repoName string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repository(repoName, false)
+	if repo == nil {
+		return nil
+	}
+	names := make([]string, 0, len(repo.tags))
+	for name := range repo.tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Manifests returns the digests of the manifests of the repository, sorted.
+func (r *Registry) Manifests(repoName string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repository(repoName, false)
+	if repo == nil {
+		return nil
+	}
+	digests := make([]string, 0, len(repo.manifests))
+	for digest := range repo.manifests {
+		digests = append(digests, digest)
+	}
+	sort.Strings(digests)
+	return digests
+}
+
+// Manifest returns the content of a manifest by tag or digest, the second return value is false when it does not exist.
+func (r *Registry) Manifest(repoName string, reference string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repository(repoName, false)
+	if repo == nil {
+		return nil, false
+	}
+	m := repo.resolve(reference)
+	if m == nil {
+		return nil, false
+	}
+	return m.content, true
+}
+
+// Requests returns every request served so far as "METHOD path", in the order they were received.
+func (r *Registry) Requests() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.requests...)
+}
+
+// repository returns the repository with the name, it is created when create is set. The caller must hold the lock.
+func (r *Registry) repository(repoName string, create bool) *repository {
+	repo, ok := r.repositories[repoName]
+	if !ok && create {
+		now := r.now()
+		repo = &repository{
+			name:                 repoName,
+			createdTime:          now,
+			lastUpdateTime:       now,
+			changeableAttributes: defaultAttributes(),
+			manifests:            make(map[string]*manifest),
+			tags:                 make(map[string]*tag),
+			blobs:                make(map[string][]byte),
+		}
+		r.repositories[repoName] = repo
+	}
+	return repo
+}
+
+// putManifest adds or replaces a manifest. The caller must hold the lock.
+func (r *Registry) putManifest(repo *repository, mediaType string, content []byte) *manifest {
+	digest := digestOf(content)
+	now := r.now()
+	if m, ok := repo.manifests[digest]; ok {
+		m.lastUpdateTime = now
+		return m
+	}
+	var parsed struct {
+		ArtifactType string              `json:"artifactType"`
+		Config       *ocispec.Descriptor `json:"config"`
+		Subject      *ocispec.Descriptor `json:"subject"`
+	}
+	_ = json.Unmarshal(content, &parsed)
+	m := &manifest{
+		digest:               digest,
+		mediaType:            mediaType,
+		artifactType:         parsed.ArtifactType,
+		content:              content,
+		createdTime:          now,
+		lastUpdateTime:       now,
+		changeableAttributes: defaultAttributes(),
+	}
+	if parsed.Config != nil {
+		m.configMediaType = parsed.Config.MediaType
+		if m.artifactType == "" && parsed.Config.MediaType != ocispec.MediaTypeEmptyJSON {
+			m.artifactType = parsed.Config.MediaType
+		}
+	}
+	if parsed.Subject != nil {
+		m.subject = parsed.Subject.Digest.String()
+	}
+	repo.manifests[digest] = m
+	repo.lastUpdateTime = now
+	return m
+}
+
+// putTag points a tag at a manifest. The caller must hold the lock.
+func (r *Registry) putTag(repo *repository, tagName string, digest string) {
+	now := r.now()
+	if t, ok := repo.tags[tagName]; ok {
+		t.digest = digest
+		t.lastUpdateTime = now
+		return
+	}
+	repo.tags[tagName] = &tag{
+		name:                 tagName,
+		digest:               digest,
+		createdTime:          now,
+		lastUpdateTime:       now,
+		changeableAttributes: defaultAttributes(),
+	}
+	repo.lastUpdateTime = now
+}
+
+// blobDescriptor stores the blob in the repository and returns its descriptor.
+func (r *Registry) blobDescriptor(repoName string, mediaType string, content []byte) ocispec.Descriptor {
+	digest := r.PushBlob(repoName, content)
+	return ocispec.Descriptor{MediaType: mediaType, Digest: toDigest(digest), Size: int64(len(content))}
+}
+
+// resolve returns the manifest a tag or digest refers to, nil when there is none.
+func (repo *repository) resolve(reference string) *manifest {
+	if strings.Contains(reference, ":") {
+		return repo.manifests[reference]
+	}
+	if t, ok := repo.tags[reference]; ok {
+		return repo.manifests[t.digest]
+	}
+	return nil
+}
+
+// tagsOf returns the sorted tags pointing at the digest.
+func (repo *repository) tagsOf(digest string) []string {
+	var names []string
+	for name, t := range repo.tags {
+		if t.digest == digest {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// deleteManifest removes the manifest and the tags pointing at it.
+func (repo *repository) deleteManifest(digest string) {
+	delete(repo.manifests, digest)
+	for name, t := range repo.tags {
+		if t.digest == digest {
+			delete(repo.tags, name)
+		}
+	}
+}
+
+func defaultAttributes() attributes {
+	return attributes{deleteEnabled: true, writeEnabled: true, listEnabled: true, readEnabled: true}
+}
+
+// deletable returns true when the attributes allow the deletion, like ACR both deletes and writes must be enabled.
+func (a attributes) deletable() bool {
+	return a.deleteEnabled && a.writeEnabled
+}
+
+func digestOf(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+// toDigest converts a digest string to the type of the OCI descriptors, where the local variables named digest would
+// shadow the package.
+func toDigest(value string) digest.Digest {
+	return digest.Digest(value)
+}
+
+func mustMarshal(v any) []byte {
+	content, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return content
+}
@@ -0,0 +1,148 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package fakeregistry_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/repository"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/tag"
+	"github.com/Azure/acr-cli/internal/testutil/fakeregistry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("TagPagination", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		for i := 0; i < 250; i++ {
+			registry.PushImage("repo", fmt.Sprint(i), fmt.Sprintf("tag%03d", i))
+		}
+		client, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+		require.NoError(t, err)
+
+		// The Link header is followed page by page.
+		result, err := client.GetAcrTags(ctx, "repo", "", "")
+		require.NoError(t, err)
+		assert.Len(t, *result.TagsAttributes, 100)
+		assert.Equal(t, "tag099", repository.GetLastTagFromResponse(result))
+
+		// Paging by the last tag name returns every tag once.
+		tags, err := tag.ListTags(ctx, client, "repo")
+		require.NoError(t, err)
+		assert.Len(t, tags, 250)
+		assert.Equal(t, "tag249", *tags[249].Name)
+	})
+
+	t.Run("TimeOrder", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		registry.PushImage("repo", "a", "old")
+		registry.PushImage("repo", "b", "new")
+		registry.SetLastUpdateTime("repo", "old", time.Now().Add(-time.Hour))
+		client, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+		require.NoError(t, err)
+
+		result, err := client.GetAcrTags(ctx, "repo", "timeasc", "")
+		require.NoError(t, err)
+		require.Len(t, *result.TagsAttributes, 2)
+		assert.Equal(t, "old", *(*result.TagsAttributes)[0].Name)
+		assert.Equal(t, "new", *(*result.TagsAttributes)[1].Name)
+	})
+
+	t.Run("Catalog", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		for _, repoName := range []string{"c", "a/b", "b"} {
+			registry.PushImage(repoName, "seed")
+		}
+		client, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+		require.NoError(t, err)
+
+		names, err := repository.GetAllRepositoryNames(ctx, client.AutorestClient, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a/b", "b", "c"}, names)
+	})
+
+	t.Run("DeleteManifestAndLocks", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		digest := registry.PushImage("repo", "a", "latest")
+		locked := registry.PushImage("repo", "b", "locked")
+		registry.Lock("repo", locked)
+		client, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+		require.NoError(t, err)
+
+		_, err = client.DeleteManifest(ctx, "repo", locked)
+		assert.Error(t, err)
+		assert.Contains(t, registry.Manifests("repo"), locked)
+
+		_, err = client.DeleteManifest(ctx, "repo", digest)
+		require.NoError(t, err)
+		assert.NotContains(t, registry.Manifests("repo"), digest)
+		assert.Equal(t, []string{"locked"}, registry.Tags("repo"))
+
+		// The attributes are updated through the API.
+		deleteEnabled, writeEnabled := true, true
+		_, err = client.UpdateAcrManifestAttributes(ctx, "repo", locked, &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled, WriteEnabled: &writeEnabled})
+		require.NoError(t, err)
+		assert.False(t, registry.Locked("repo", locked))
+	})
+
+	t.Run("ABAC", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		registry.SetABAC(true)
+		registry.PushImage("repo", "a", "latest")
+		client, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), "", registry.RefreshToken(), nil, registry.Transport())
+		require.NoError(t, err)
+		assert.True(t, client.IsAbac())
+
+		// The wildcard repository scope is ignored, the repository must be requested by name.
+		_, err = client.GetAcrTags(ctx, "repo", "", "")
+		assert.Error(t, err)
+		require.NoError(t, client.RefreshTokenForAbac(ctx, []string{"repo"}))
+		result, err := client.GetAcrTags(ctx, "repo", "", "")
+		require.NoError(t, err)
+		assert.Len(t, *result.TagsAttributes, 1)
+	})
+
+	t.Run("FaultsAreRetried", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		registry.PushImage("repo", "a", "latest")
+		registry.InjectFault(fakeregistry.Fault{Path: "/_tags", StatusCode: http.StatusTooManyRequests, RetryAfter: "0", Times: 2})
+		client, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+		require.NoError(t, err)
+
+		_, err = client.GetAcrTags(ctx, "repo", "", "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"GET /acr/v1/repo/_tags",
+			"GET /acr/v1/repo/_tags",
+			"GET /acr/v1/repo/_tags",
+		}, registry.Requests())
+	})
+
+	t.Run("AnnotateAndReferrers", func(t *testing.T) {
+		registry := fakeregistry.New(t)
+		registry.PushImage("repo", "a", "latest")
+		orasClient, err := api.GetORASClientWithAuth(fakeregistry.Username, fakeregistry.Password, nil, registry.Transport())
+		require.NoError(t, err)
+		reference := registry.LoginURL() + "/repo:latest"
+		artifactType := "application/vnd.microsoft.artifact.lifecycle"
+
+		found, err := orasClient.DiscoverLifecycleAnnotation(ctx, reference, artifactType)
+		require.NoError(t, err)
+		assert.False(t, found)
+		require.NoError(t, orasClient.Annotate(ctx, reference, artifactType, map[string]string{"vnd.microsoft.artifact.lifecycle.end-of-life.date": "2024-01-01"}))
+		found, err = orasClient.DiscoverLifecycleAnnotation(ctx, reference, artifactType)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Len(t, registry.Manifests("repo"), 2)
+	})
+}
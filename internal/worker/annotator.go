@@ -28,14 +28,17 @@ type Annotator struct {
 	orasClient   api.ORASClientInterface
 	artifactType string
 	annotations  map[string]string
+	limiter      *AdaptiveLimiter
 }
 
-// NewAnnotator creates a new Annotator.
-func NewAnnotator(poolSize int, orasClient api.ORASClientInterface, loginURL string, repoName string, artifactType string, annotations []string) (*Annotator, error) {
+// NewAnnotator creates a new Annotator. When a limiter is specified it adapts the number of concurrent annotations, and
+// poolSize is ignored.
+func NewAnnotator(poolSize int, orasClient api.ORASClientInterface, loginURL string, repoName string, artifactType string, annotations []string, limiter *AdaptiveLimiter) (*Annotator, error) {
 	annotationsMap, err := convertListToMap(annotations)
 	if err != nil {
 		return nil, err
 	}
+	poolSize = limiter.PoolSize(poolSize)
 	executeBase := Executer{
 		// Use a queue size 3x the pool size to buffer enough tasks and keep workers busy and avoiding
 		// slowdown due to task scheduling blocking.
@@ -48,18 +51,26 @@ func NewAnnotator(poolSize int, orasClient api.ORASClientInterface, loginURL str
 		orasClient:   orasClient,
 		artifactType: artifactType,
 		annotations:  annotationsMap,
+		limiter:      limiter,
 	}, nil
 }
 
 // Annotate annotates a list of manifests concurrently and returns a count of annotated images and the first error occurred.
+// Once ctx is done the manifests that were not started yet are dropped, the annotations in flight are completed.
 func (a *Annotator) Annotate(ctx context.Context, manifests []string) (int, error) {
 	var annotatedImages atomic.Int64
-	group := a.pool.NewGroup()
+	// The group stops running new tasks once ctx is done, the tasks already running use a context that is never
+	// canceled so that their requests are drained instead of being cut off halfway.
+	group := a.pool.NewGroupContext(ctx)
+	ctx = context.WithoutCancel(ctx)
 
 	for _, digest := range manifests {
 		group.SubmitErr(func() error {
 			ref := fmt.Sprintf("%s/%s@%s", a.loginURL, a.repoName, digest)
-			if err := a.orasClient.Annotate(ctx, ref, a.artifactType, a.annotations); err != nil {
+			err := a.limiter.Run(group.Context(), func() error {
+				return a.orasClient.Annotate(ctx, ref, a.artifactType, a.annotations)
+			})
+			if err != nil {
 				fmt.Printf("Failed to annotate %s/%s@%s, error: %v\n", a.loginURL, a.repoName, digest, err)
 				return err // TODO: #469 Do we want to fail the whole job if one fails? This is the current behaviour.
 			}
@@ -0,0 +1,187 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"oras.land/oras-go/v2/registry/remote/errcode"
+)
+
+const (
+	// latencySpikeFactor is how many times slower than the average a request has to be to count as a latency spike.
+	latencySpikeFactor = 3
+	// minLatencySamples is the number of healthy requests needed before latency spikes are detected.
+	minLatencySamples = 10
+)
+
+// AdaptiveLimiter adapts the number of concurrent requests to the registry with an additive increase, multiplicative
+// decrease (AIMD) controller. The limit grows by one after every window of healthy responses, a window being as many
+// responses as the current limit, and is halved when the registry throttles a request (HTTP 429) or when a request is
+// much slower than the average. A single limiter is shared by every pool of a command so that the limit applies to the
+// whole command. A nil *AdaptiveLimiter is valid and does not limit anything, the pool size alone applies then.
+type AdaptiveLimiter struct {
+	mu       sync.Mutex
+	changed  chan struct{}
+	limit    int
+	maxLimit int
+	inFlight int
+	// healthy is the number of healthy responses since the limit was last changed.
+	healthy int
+	// decreased is true when the last change of the limit was a decrease, further decreases are ignored until a window
+	// of responses completed so that the requests that were in flight during a decrease do not decrease it again.
+	decreased    bool
+	completed    int
+	avgLatency   time.Duration
+	samples      int
+	lowestLimit  int
+	highestLimit int
+}
+
+// NewAdaptiveLimiter returns a limiter that starts at the initial limit and never goes above maxLimit or below 1.
+func NewAdaptiveLimiter(initial int, maxLimit int) *AdaptiveLimiter {
+	initial = min(max(initial, 1), maxLimit)
+	return &AdaptiveLimiter{
+		changed:      make(chan struct{}),
+		limit:        initial,
+		maxLimit:     maxLimit,
+		lowestLimit:  initial,
+		highestLimit: initial,
+	}
+}
+
+// PoolSize returns the size a pool needs so that it never limits the requests more than the limiter does.
+func (l *AdaptiveLimiter) PoolSize(poolSize int) int {
+	if l == nil {
+		return poolSize
+	}
+	return l.maxLimit
+}
+
+// Acquire waits until a request can be sent, it returns an error when ctx is done first. Every successful Acquire must
+// be followed by a Release.
+func (l *AdaptiveLimiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Release records the outcome of a request sent after Acquire. The limit is halved when the request was throttled or
+// took latencySpikeFactor times longer than the average, and grows after a window of healthy requests otherwise.
+func (l *AdaptiveLimiter) Release(latency time.Duration, throttled bool) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.completed++
+	spike := l.samples >= minLatencySamples && latency > latencySpikeFactor*l.avgLatency
+	if throttled || spike {
+		l.decrease()
+	} else {
+		// The average is an exponentially weighted moving average of the healthy requests only, so that it keeps
+		// describing a registry that is not overloaded.
+		l.samples++
+		if l.samples == 1 {
+			l.avgLatency = latency
+		} else {
+			l.avgLatency += (latency - l.avgLatency) / 8
+		}
+		l.healthy++
+		if l.healthy >= l.limit && l.limit < l.maxLimit {
+			l.setLimit(l.limit + 1)
+			l.decreased = false
+		}
+	}
+	l.notify()
+}
+
+// Run runs the request fn once the limiter allows it and records its outcome, the request counts as throttled when it
+// fails with an HTTP 429 error.
+func (l *AdaptiveLimiter) Run(ctx context.Context, fn func() error) error {
+	if err := l.Acquire(ctx); err != nil {
+		return err
+	}
+	start := time.Now()
+	err := fn()
+	l.Release(time.Since(start), isThrottledError(err))
+	return err
+}
+
+// Throttled halves the limit, it is called for every throttled response, including the ones that are retried.
+func (l *AdaptiveLimiter) Throttled() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.decrease()
+}
+
+// Limits returns the current limit, and the lowest and highest limits that were reached.
+func (l *AdaptiveLimiter) Limits() (current int, lowest int, highest int) {
+	if l == nil {
+		return 0, 0, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit, l.lowestLimit, l.highestLimit
+}
+
+// decrease halves the limit unless it was already decreased during the current window. The caller must hold the lock.
+func (l *AdaptiveLimiter) decrease() {
+	if l.decreased && l.completed < l.limit {
+		return
+	}
+	l.setLimit(max(l.limit/2, 1))
+	l.decreased = true
+}
+
+// setLimit changes the limit and starts a new window. The caller must hold the lock.
+func (l *AdaptiveLimiter) setLimit(limit int) {
+	l.limit = limit
+	l.healthy = 0
+	l.completed = 0
+	l.lowestLimit = min(l.lowestLimit, limit)
+	l.highestLimit = max(l.highestLimit, limit)
+}
+
+// notify wakes up the requests waiting in Acquire. The caller must hold the lock.
+func (l *AdaptiveLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// isThrottledError returns true when err is an HTTP 429 error of the registry, from either the ACR or the ORAS client.
+func isThrottledError(err error) bool {
+	var detailedErr autorest.DetailedError
+	if errors.As(err, &detailedErr) {
+		if statusCode, ok := detailedErr.StatusCode.(int); ok {
+			return statusCode == http.StatusTooManyRequests
+		}
+	}
+	var errResp *errcode.ErrorResponse
+	return errors.As(err, &errResp) && errResp.StatusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,126 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+	"oras.land/oras-go/v2/registry/remote/errcode"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	// The limit grows by one after every window of healthy responses, a window being as many responses as the limit.
+	t.Run("AdditiveIncrease", func(t *testing.T) {
+		assert := assert.New(t)
+		limiter := NewAdaptiveLimiter(2, 4)
+		for i := 0; i < 2; i++ {
+			assert.Nil(limiter.Acquire(context.Background()))
+			limiter.Release(time.Millisecond, false)
+		}
+		current, _, _ := limiter.Limits()
+		assert.Equal(3, current)
+		for i := 0; i < 3; i++ {
+			assert.Nil(limiter.Acquire(context.Background()))
+			limiter.Release(time.Millisecond, false)
+		}
+		for i := 0; i < 10; i++ {
+			assert.Nil(limiter.Acquire(context.Background()))
+			limiter.Release(time.Millisecond, false)
+		}
+		current, lowest, highest := limiter.Limits()
+		assert.Equal(4, current, "The limit should not go above the maximum")
+		assert.Equal(2, lowest)
+		assert.Equal(4, highest)
+	})
+
+	// Only the first throttled response of a window halves the limit, the limit never goes below 1.
+	t.Run("MultiplicativeDecrease", func(t *testing.T) {
+		assert := assert.New(t)
+		limiter := NewAdaptiveLimiter(8, 8)
+		limiter.Throttled()
+		limiter.Throttled()
+		current, _, _ := limiter.Limits()
+		assert.Equal(4, current)
+		for i := 0; i < 4; i++ {
+			assert.Nil(limiter.Acquire(context.Background()))
+			limiter.Release(time.Millisecond, true)
+		}
+		current, _, _ = limiter.Limits()
+		assert.Equal(2, current)
+		for i := 0; i < 10; i++ {
+			assert.Nil(limiter.Acquire(context.Background()))
+			limiter.Release(time.Millisecond, true)
+		}
+		current, lowest, highest := limiter.Limits()
+		assert.Equal(1, current)
+		assert.Equal(1, lowest)
+		assert.Equal(8, highest)
+	})
+
+	// A request much slower than the average counts as a latency spike.
+	t.Run("LatencySpike", func(t *testing.T) {
+		assert := assert.New(t)
+		limiter := NewAdaptiveLimiter(32, 32)
+		for i := 0; i < minLatencySamples; i++ {
+			assert.Nil(limiter.Acquire(context.Background()))
+			limiter.Release(10*time.Millisecond, false)
+		}
+		assert.Nil(limiter.Acquire(context.Background()))
+		limiter.Release(time.Second, false)
+		current, _, _ := limiter.Limits()
+		assert.Equal(16, current)
+	})
+
+	// Acquire blocks while the limit is reached and returns once a request is released or the context is done.
+	t.Run("Acquire", func(t *testing.T) {
+		assert := assert.New(t)
+		limiter := NewAdaptiveLimiter(1, 1)
+		assert.Nil(limiter.Acquire(context.Background()))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(limiter.Acquire(ctx), context.DeadlineExceeded)
+		acquired := make(chan error)
+		go func() {
+			acquired <- limiter.Acquire(context.Background())
+		}()
+		limiter.Release(time.Millisecond, false)
+		assert.Nil(<-acquired)
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		assert := assert.New(t)
+		limiter := NewAdaptiveLimiter(4, 4)
+		throttledErr := autorest.DetailedError{StatusCode: http.StatusTooManyRequests}
+		assert.Equal(throttledErr, limiter.Run(context.Background(), func() error { return throttledErr }))
+		current, _, _ := limiter.Limits()
+		assert.Equal(2, current)
+	})
+
+	t.Run("NilLimiter", func(t *testing.T) {
+		assert := assert.New(t)
+		var limiter *AdaptiveLimiter
+		assert.Equal(5, limiter.PoolSize(5))
+		assert.Nil(limiter.Acquire(context.Background()))
+		limiter.Release(time.Millisecond, true)
+		limiter.Throttled()
+		assert.Nil(limiter.Run(context.Background(), func() error { return nil }))
+		current, _, _ := limiter.Limits()
+		assert.Equal(0, current)
+	})
+}
+
+func TestIsThrottledError(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(isThrottledError(autorest.DetailedError{StatusCode: http.StatusTooManyRequests}))
+	assert.True(isThrottledError(&errcode.ErrorResponse{StatusCode: http.StatusTooManyRequests}))
+	assert.False(isThrottledError(autorest.DetailedError{StatusCode: http.StatusNotFound}))
+	assert.False(isThrottledError(errors.New("error")))
+	assert.False(isThrottledError(nil))
+}
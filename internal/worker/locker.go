@@ -0,0 +1,91 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/alitto/pond/v2"
+)
+
+// Locker updates the changeable attributes of tags or manifests concurrently, to lock or unlock them.
+type Locker struct {
+	Executer
+	acrClient  api.AcrCLIClientInterface
+	attributes *acr.ChangeableAttributes
+	verb       string
+	limiter    *AdaptiveLimiter
+}
+
+// NewLocker creates a new Locker that sets the attributes, only the ones that are not nil are changed. Lockers are
+// repository specific. When a limiter is specified it adapts the number of concurrent updates, and poolSize is ignored.
+func NewLocker(poolSize int, acrClient api.AcrCLIClientInterface, loginURL string, repoName string, attributes *acr.ChangeableAttributes, limiter *AdaptiveLimiter) *Locker {
+	poolSize = limiter.PoolSize(poolSize)
+	executeBase := Executer{
+		// Use a queue size 3x the pool size to buffer enough tasks and keep workers busy and avoiding
+		// slowdown due to task scheduling blocking.
+		pool:     pond.NewPool(poolSize, pond.WithQueueSize(poolSize*3), pond.WithNonBlocking(false)),
+		loginURL: loginURL,
+		repoName: repoName,
+	}
+	verb := "Unlocked"
+	for _, enabled := range []*bool{attributes.DeleteEnabled, attributes.WriteEnabled, attributes.ListEnabled, attributes.ReadEnabled} {
+		if enabled != nil && !*enabled {
+			verb = "Locked"
+		}
+	}
+	return &Locker{
+		Executer:   executeBase,
+		acrClient:  acrClient,
+		attributes: attributes,
+		verb:       verb,
+		limiter:    limiter,
+	}
+}
+
+// LockTags updates the attributes of a list of tags concurrently, and returns a count of updated tags and the first
+// error occurred. Once ctx is done the tags that were not started yet are dropped, the updates in flight are completed.
+func (l *Locker) LockTags(ctx context.Context, tags []string) (int, error) {
+	return l.lock(ctx, tags, ":", l.acrClient.UpdateAcrTagAttributes)
+}
+
+// LockManifests updates the attributes of a list of manifests concurrently, and returns a count of updated manifests
+// and the first error occurred. Once ctx is done the manifests that were not started yet are dropped, the updates in
+// flight are completed.
+func (l *Locker) LockManifests(ctx context.Context, digests []string) (int, error) {
+	return l.lock(ctx, digests, "@", l.acrClient.UpdateAcrManifestAttributes)
+}
+
+// lock updates the attributes of every reference with update, separator joins the repository and the reference in the
+// messages.
+func (l *Locker) lock(ctx context.Context, references []string, separator string, update func(context.Context, string, string, *acr.ChangeableAttributes) (*autorest.Response, error)) (int, error) {
+	var updated atomic.Int64
+	group := l.pool.NewGroupContext(ctx)
+	ctx = context.WithoutCancel(ctx)
+	for _, reference := range references {
+		group.SubmitErr(func() error {
+			if err := l.limiter.Acquire(group.Context()); err != nil {
+				return err
+			}
+			start := time.Now()
+			resp, err := update(ctx, l.repoName, reference, l.attributes)
+			l.limiter.Release(time.Since(start), isThrottled(resp))
+			if err != nil {
+				fmt.Printf("Failed to update %s/%s%s%s, error: %v\n", l.loginURL, l.repoName, separator, reference, err)
+				return err
+			}
+			updated.Add(1)
+			fmt.Printf("%s %s/%s%s%s\n", l.verb, l.loginURL, l.repoName, separator, reference)
+			return nil
+		})
+	}
+	err := group.Wait()
+	return int(updated.Load()), err
+}
@@ -6,11 +6,16 @@ package worker
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/Azure/acr-cli/acr"
 	"github.com/Azure/acr-cli/internal/api"
+	"github.com/Azure/acr-cli/internal/report"
+	"github.com/Azure/go-autorest/autorest"
 	"github.com/alitto/pond/v2"
 )
 
@@ -18,11 +23,23 @@ import (
 type Purger struct {
 	Executer
 	acrClient     api.AcrCLIClientInterface
+	out           io.Writer
 	includeLocked bool
+	reporter      *report.Reporter
+	limiter       *AdaptiveLimiter
+	failures      *report.Failures
+	reasonCode    report.ReasonCode
+	parents       map[string]string
+	// notDeleted holds the digests of the manifests whose deletion failed or was not allowed.
+	notDeleted sync.Map
 }
 
-// NewPurger creates a new Purger. Purgers are currently repository specific
-func NewPurger(repoParallelism int, acrClient api.AcrCLIClientInterface, loginURL string, repoName string, includeLocked bool) *Purger {
+// NewPurger creates a new Purger. Purgers are currently repository specific. The outcome of every deletion is written
+// to out and recorded in the reporter, which can be nil. When a limiter is specified it adapts the number of concurrent deletions, and
+// repoParallelism is ignored. When failures are collected a failed deletion is added to them and the other deletions
+// continue, otherwise the first failed deletion stops the purge.
+func NewPurger(repoParallelism int, acrClient api.AcrCLIClientInterface, out io.Writer, loginURL string, repoName string, includeLocked bool, reporter *report.Reporter, limiter *AdaptiveLimiter, failures *report.Failures) *Purger {
+	repoParallelism = limiter.PoolSize(repoParallelism)
 	executeBase := Executer{
 		// Use a queue size 3x the pool size to buffer enough tasks and keep workers busy and avoiding
 		// slowdown due to task scheduling blocking.
@@ -33,40 +50,64 @@ func NewPurger(repoParallelism int, acrClient api.AcrCLIClientInterface, loginUR
 	return &Purger{
 		Executer:      executeBase,
 		acrClient:     acrClient,
+		out:           out,
 		includeLocked: includeLocked,
+		reporter:      reporter,
+		limiter:       limiter,
+		failures:      failures,
+		reasonCode:    report.ReasonUntagged,
 	}
 }
 
-// PurgeTags purges a list of tags concurrently, and returns a count of deleted tags and the first error occurred.
+// SetReason sets the code of the reason recorded for the deleted manifests, which is report.ReasonUntagged by
+// default, and the digests of their parents by manifest digest. The parents can be nil.
+func (p *Purger) SetReason(code report.ReasonCode, parents map[string]string) {
+	p.reasonCode = code
+	p.parents = parents
+}
+
+// NotDeleted returns true when the deletion of the manifest with the digest failed or was not allowed, including the
+// failures that were collected, so that the manifest still exists.
+func (p *Purger) NotDeleted(digest string) bool {
+	_, ok := p.notDeleted.Load(digest)
+	return ok
+}
+
+// PurgeTags purges a list of tags concurrently, and returns a count of deleted tags and the first error occurred. When
+// failures are collected the failed deletions are not returned as errors. With include-locked the locked tags are
+// unlocked to be deleted, and locked again when they are not deleted after all.
+// Once ctx is done the tags that were not started yet are dropped, the deletions in flight are completed.
 func (p *Purger) PurgeTags(ctx context.Context, tags []acr.TagAttributesBase) (int, error) {
 	var deletedTags atomic.Int64 // Count of successfully deleted tags
-	group := p.pool.NewGroup()
+	group := p.pool.NewGroupContext(ctx)
+	ctx = context.WithoutCancel(ctx)
 	for _, tag := range tags {
 		group.SubmitErr(func() error {
-			// If include-locked is enabled and tag is locked, unlock it first
-			if p.includeLocked && tag.ChangeableAttributes != nil {
-				if (tag.ChangeableAttributes.DeleteEnabled != nil && !*tag.ChangeableAttributes.DeleteEnabled) ||
-					(tag.ChangeableAttributes.WriteEnabled != nil && !*tag.ChangeableAttributes.WriteEnabled) {
-
-					enabledTrue := true
-					unlockAttrs := &acr.ChangeableAttributes{
-						DeleteEnabled: &enabledTrue,
-						WriteEnabled:  &enabledTrue,
-					}
-
-					_, unlockErr := p.acrClient.UpdateAcrTagAttributes(ctx, p.repoName, *tag.Name, unlockAttrs)
-					if unlockErr != nil {
-						fmt.Printf("Warning: Failed to unlock %s/%s:%s, error: %v. Will attempt deletion anyway.\n", p.loginURL, p.repoName, *tag.Name, unlockErr)
-						// Continue to attempt deletion even if unlock fails
-					} else {
-						fmt.Printf("Unlocked %s/%s:%s\n", p.loginURL, p.repoName, *tag.Name)
-					}
-				}
+			if err := p.limiter.Acquire(group.Context()); err != nil {
+				return err
+			}
+			start := time.Now()
+			tagRef := fmt.Sprintf("%s/%s:%s", p.loginURL, p.repoName, *tag.Name)
+			restore := p.unlock(tag.ChangeableAttributes, tagRef, report.TagRecord(p.repoName, tag, report.ActionRestoreFailed, ""),
+				func(attributes *acr.ChangeableAttributes) (*autorest.Response, error) {
+					return p.acrClient.UpdateAcrTagAttributes(ctx, p.repoName, *tag.Name, attributes)
+				})
+			if err := group.Context().Err(); err != nil {
+				// The purge was cancelled while the tag was being unlocked, it is not deleted.
+				p.limiter.Release(time.Since(start), false)
+				restore()
+				return err
 			}
 
 			resp, err := p.acrClient.DeleteAcrTag(ctx, p.repoName, *tag.Name)
+			p.limiter.Release(time.Since(start), isThrottled(resp))
+			record := report.TagRecord(p.repoName, tag, report.ActionDeleted, "")
+			if resp != nil && resp.Response != nil {
+				record.HTTPStatus = resp.StatusCode
+			}
 			if err == nil {
-				fmt.Printf("Deleted %s/%s:%s\n", p.loginURL, p.repoName, *tag.Name)
+				fmt.Fprintf(p.out, "Deleted %s/%s:%s\n", p.loginURL, p.repoName, *tag.Name)
+				p.reporter.Record(record)
 				// Increment the count of successfully deleted tags atomically
 				deletedTags.Add(1)
 				return nil
@@ -77,16 +118,27 @@ func (p *Purger) PurgeTags(ctx context.Context, tags []acr.TagAttributesBase) (i
 				case http.StatusNotFound:
 					// If the tag is not found it can be assumed to have been deleted.
 					deletedTags.Add(1)
-					fmt.Printf("Skipped %s/%s:%s, HTTP status: %d\n", p.loginURL, p.repoName, *tag.Name, resp.StatusCode)
+					fmt.Fprintf(p.out, "Skipped %s/%s:%s, HTTP status: %d\n", p.loginURL, p.repoName, *tag.Name, resp.StatusCode)
+					record.Action, record.Reason = report.ActionSkipped, "not found"
+					p.reporter.Record(record)
 					return nil
 				case http.StatusMethodNotAllowed:
 					// Method not allowed - tag may be locked or operation not permitted
-					fmt.Printf("Skipped %s/%s:%s, operation not allowed, HTTP status: %d\n", p.loginURL, p.repoName, *tag.Name, resp.StatusCode)
+					fmt.Fprintf(p.out, "Skipped %s/%s:%s, operation not allowed, HTTP status: %d\n", p.loginURL, p.repoName, *tag.Name, resp.StatusCode)
+					record.Action, record.Reason = report.ActionSkipped, "operation not allowed"
+					p.reporter.Record(record)
+					restore()
 					return nil
 				}
 			}
 
-			fmt.Printf("Failed to delete %s/%s:%s, error: %v\n", p.loginURL, p.repoName, *tag.Name, err)
+			fmt.Fprintf(p.out, "Failed to delete %s/%s:%s, error: %v\n", p.loginURL, p.repoName, *tag.Name, err)
+			record.Action, record.Reason = report.ActionFailed, err.Error()
+			p.reporter.Record(record)
+			restore()
+			if p.failures.Collect(p.repoName, *tag.Name, "delete tag", err) {
+				return nil
+			}
 			return err
 		})
 	}
@@ -95,35 +147,40 @@ func (p *Purger) PurgeTags(ctx context.Context, tags []acr.TagAttributesBase) (i
 }
 
 // PurgeManifests purges a list of manifests concurrently, and returns a count of deleted manifests and the first error occurred.
+// When failures are collected the failed deletions are not returned as errors. With include-locked the locked manifests
+// are unlocked to be deleted, and locked again when they are not deleted after all.
+// Once ctx is done the manifests that were not started yet are dropped, the deletions in flight are completed.
 func (p *Purger) PurgeManifests(ctx context.Context, manifests []acr.ManifestAttributesBase) (int, error) {
 	var deletedManifests atomic.Int64 // Count of successfully deleted tags
-	group := p.pool.NewGroup()
+	group := p.pool.NewGroupContext(ctx)
+	ctx = context.WithoutCancel(ctx)
 	for _, manifest := range manifests {
 		group.SubmitErr(func() error {
-			// If include-locked is enabled and manifest is locked, unlock it first
-			if p.includeLocked && manifest.ChangeableAttributes != nil {
-				if (manifest.ChangeableAttributes.DeleteEnabled != nil && !*manifest.ChangeableAttributes.DeleteEnabled) ||
-					(manifest.ChangeableAttributes.WriteEnabled != nil && !*manifest.ChangeableAttributes.WriteEnabled) {
-
-					enabledTrue := true
-					unlockAttrs := &acr.ChangeableAttributes{
-						DeleteEnabled: &enabledTrue,
-						WriteEnabled:  &enabledTrue,
-					}
-
-					_, unlockErr := p.acrClient.UpdateAcrManifestAttributes(ctx, p.repoName, *manifest.Digest, unlockAttrs)
-					if unlockErr != nil {
-						fmt.Printf("Warning: Failed to unlock %s/%s@%s, error: %v. Will attempt deletion anyway.\n", p.loginURL, p.repoName, *manifest.Digest, unlockErr)
-						// Continue to attempt deletion even if unlock fails
-					} else {
-						fmt.Printf("Unlocked %s/%s@%s\n", p.loginURL, p.repoName, *manifest.Digest)
-					}
-				}
+			if err := p.limiter.Acquire(group.Context()); err != nil {
+				return err
+			}
+			start := time.Now()
+			manifestRef := fmt.Sprintf("%s/%s@%s", p.loginURL, p.repoName, *manifest.Digest)
+			restore := p.unlock(manifest.ChangeableAttributes, manifestRef, report.ManifestRecord(p.repoName, manifest, report.ActionRestoreFailed, ""),
+				func(attributes *acr.ChangeableAttributes) (*autorest.Response, error) {
+					return p.acrClient.UpdateAcrManifestAttributes(ctx, p.repoName, *manifest.Digest, attributes)
+				})
+			if err := group.Context().Err(); err != nil {
+				// The purge was cancelled while the manifest was being unlocked, it is not deleted.
+				p.limiter.Release(time.Since(start), false)
+				restore()
+				return err
 			}
 
 			resp, err := p.acrClient.DeleteManifest(ctx, p.repoName, *manifest.Digest)
+			p.limiter.Release(time.Since(start), isThrottled(resp))
+			record := report.ManifestRecord(p.repoName, manifest, report.ActionDeleted, "").WithCode(p.reasonCode, p.parents[*manifest.Digest])
+			if resp != nil && resp.Response != nil {
+				record.HTTPStatus = resp.StatusCode
+			}
 			if err == nil {
-				fmt.Printf("Deleted %s/%s@%s\n", p.loginURL, p.repoName, *manifest.Digest)
+				fmt.Fprintf(p.out, "Deleted %s/%s@%s\n", p.loginURL, p.repoName, *manifest.Digest)
+				p.reporter.Record(record)
 				// Increment the count of successfully deleted tags atomically
 				deletedManifests.Add(1)
 				return nil
@@ -134,16 +191,29 @@ func (p *Purger) PurgeManifests(ctx context.Context, manifests []acr.ManifestAtt
 				case http.StatusNotFound:
 					// If the manifest is not found it can be assumed to have been deleted.
 					deletedManifests.Add(1)
-					fmt.Printf("Skipped %s/%s@%s, HTTP status: %d\n", p.loginURL, p.repoName, *manifest.Digest, resp.StatusCode)
+					fmt.Fprintf(p.out, "Skipped %s/%s@%s, HTTP status: %d\n", p.loginURL, p.repoName, *manifest.Digest, resp.StatusCode)
+					record.Action, record.Reason = report.ActionSkipped, "not found"
+					p.reporter.Record(record)
 					return nil
 				case http.StatusMethodNotAllowed:
 					// Method not allowed - manifest may be locked or operation not permitted
-					fmt.Printf("Skipped %s/%s@%s, operation not allowed, HTTP status: %d\n", p.loginURL, p.repoName, *manifest.Digest, resp.StatusCode)
+					fmt.Fprintf(p.out, "Skipped %s/%s@%s, operation not allowed, HTTP status: %d\n", p.loginURL, p.repoName, *manifest.Digest, resp.StatusCode)
+					record.Action, record.Reason = report.ActionSkipped, "operation not allowed"
+					p.reporter.Record(record)
+					p.notDeleted.Store(*manifest.Digest, true)
+					restore()
 					return nil
 				}
 			}
 
-			fmt.Printf("Failed to delete %s/%s@%s, error: %v\n", p.loginURL, p.repoName, *manifest.Digest, err)
+			fmt.Fprintf(p.out, "Failed to delete %s/%s@%s, error: %v\n", p.loginURL, p.repoName, *manifest.Digest, err)
+			record.Action, record.Reason = report.ActionFailed, err.Error()
+			p.reporter.Record(record)
+			p.notDeleted.Store(*manifest.Digest, true)
+			restore()
+			if p.failures.Collect(p.repoName, *manifest.Digest, "delete manifest", err) {
+				return nil
+			}
 			return err
 
 		})
@@ -151,3 +221,41 @@ func (p *Purger) PurgeManifests(ctx context.Context, manifests []acr.ManifestAtt
 	err := group.Wait()
 	return int(deletedManifests.Load()), err
 }
+
+// unlock enables the deletion and the writes of a locked tag or manifest, described by ref, through update when
+// include-locked is set. It returns a function re-applying the original attributes, to be called when the item is
+// not deleted after all so that its lock is not lost. The function does nothing when the item was not unlocked. A
+// restore that fails is recorded with record.
+func (p *Purger) unlock(attributes *acr.ChangeableAttributes, ref string, record report.Record, update func(*acr.ChangeableAttributes) (*autorest.Response, error)) func() {
+	noop := func() {}
+	if !p.includeLocked || attributes == nil ||
+		((attributes.DeleteEnabled == nil || *attributes.DeleteEnabled) && (attributes.WriteEnabled == nil || *attributes.WriteEnabled)) {
+		return noop
+	}
+	enabledTrue := true
+	unlockAttrs := &acr.ChangeableAttributes{
+		DeleteEnabled: &enabledTrue,
+		WriteEnabled:  &enabledTrue,
+	}
+	if _, err := update(unlockAttrs); err != nil {
+		// Continue to attempt deletion even if unlock fails
+		fmt.Fprintf(p.out, "Warning: Failed to unlock %s, error: %v. Will attempt deletion anyway.\n", ref, err)
+		return noop
+	}
+	fmt.Fprintf(p.out, "Unlocked %s\n", ref)
+	original := *attributes
+	return func() {
+		if _, err := update(&original); err != nil {
+			fmt.Fprintf(p.out, "Failed to restore the lock of %s, error: %v\n", ref, err)
+			record.Reason = err.Error()
+			p.reporter.Record(record)
+			return
+		}
+		fmt.Fprintf(p.out, "Restored the lock of %s\n", ref)
+	}
+}
+
+// isThrottled returns true when the registry throttled the request.
+func isThrottled(resp *autorest.Response) bool {
+	return resp != nil && resp.Response != nil && resp.StatusCode == http.StatusTooManyRequests
+}